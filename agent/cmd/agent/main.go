@@ -3,51 +3,158 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/tom-draper/nginx-analytics/agent/internal/audit"
 	"github.com/tom-draper/nginx-analytics/agent/internal/auth"
 	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/internal/guard"
+	"github.com/tom-draper/nginx-analytics/agent/internal/metrics"
+	"github.com/tom-draper/nginx-analytics/agent/internal/otlp"
+	"github.com/tom-draper/nginx-analytics/agent/internal/rollup"
 	"github.com/tom-draper/nginx-analytics/agent/internal/routes"
-	"github.com/tom-draper/nginx-analytics/agent/internal/utils"
+	"github.com/tom-draper/nginx-analytics/agent/internal/store"
+	"github.com/tom-draper/nginx-analytics/agent/internal/syslog"
+	"github.com/tom-draper/nginx-analytics/agent/internal/tail"
 	"github.com/tom-draper/nginx-analytics/agent/pkg/location"
 	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
 	"github.com/tom-draper/nginx-analytics/agent/pkg/logs"
 	"github.com/tom-draper/nginx-analytics/agent/pkg/system"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/tlsconfig"
 )
 
 var startTime = time.Now()
 
 func main() {
-	cfg := config.LoadConfig()
+	loader := config.NewLoader()
+	cfg, err := loader.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	logFile, err := logger.Setup(cfg.Logging)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	defer logFile.Close()
+	if path := loader.Path(); path != "" {
+		logger.Infof("Using config file %s", path)
+	}
 	logConfig(cfg)
 
-	if cfg.SystemMonitoring {
+	// System monitoring needs a restart to change, as the sampler only starts
+	// here, so the routes keep the startup setting across reloads
+	systemMonitoring := cfg.SystemMonitoring
+	if systemMonitoring {
 		system.StartSampler(2 * time.Second)
 	}
 
-	// Define HTTP routes
-	setupRoute := func(path string, method string, logMessage string, handler func(http.ResponseWriter, *http.Request)) {
+	location.SetDatabasePath(cfg.LocationDB)
+	location.SetASNDatabasePath(cfg.ASNDB)
+	applyLogSettings(cfg)
+
+	tokens, err := auth.NewStore(cfg.TokensFile, cfg.AuthToken)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Holds the current configuration, replaced when it is reloaded
+	var current atomic.Pointer[config.Config]
+	current.Store(&cfg)
+
+	// Rejects clients by address, rate and failed auth attempts
+	clientGuard := guard.New(cfg.Guard)
+
+	var auditLog *audit.Log
+	if cfg.AuditLog.Path != "" {
+		auditLog, err = audit.Open(cfg.AuditLog)
+		if err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		defer auditLog.Close()
+	}
+
+	// Counts requests and errors as they are written to each source's logs
+	collector := metrics.New()
+
+	// Keeps the history of each source's logs beyond log rotation
+	var logStore *store.Store
+	if cfg.Store.Dir != "" {
+		logStore, err = store.Open(cfg.Store)
+		if err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		defer logStore.Close()
+	}
+
+	// Summarizes each source's access logs over long ranges
+	rollups := rollup.New()
+
+	// Define HTTP routes. Requests must present a token with the route's
+	// scope, or any valid token for routes without one.
+	setupRoute := func(path string, method string, logMessage string, scope auth.Scope, handler func(http.ResponseWriter, *http.Request)) {
 		http.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
 			if logMessage != "" {
-				logger.Log.Println(logMessage)
+				logger.Debug(logMessage)
 			}
 
+			// Record every request, including rejected ones, once responded to
+			start := time.Now()
+			rec := audit.NewRecorder(w)
+			w = rec
+			defer func() {
+				collector.ObserveAPI(path, r.Method, rec.Status(), time.Since(start))
+				if auditLog == nil {
+					return
+				}
+				var name string
+				if token := auth.FromContext(r.Context()); token != nil {
+					name = token.Name
+				}
+				if err := auditLog.Record(r, rec, name, start); err != nil {
+					logger.Errorf("Failed to write audit log: %v", err)
+				}
+			}()
+
 			// Check HTTP method
 			if r.Method != method {
 				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 				return
 			}
 
+			// Check the client is allowed to make the request
+			if err := clientGuard.Check(r); err != nil {
+				rejectClient(w, r, clientGuard, err)
+				return
+			}
+
 			// Check authentication
-			if !auth.IsAuthenticated(r, cfg.AuthToken) {
-				logger.Log.Println("Forbidden: Invalid auth token")
-				http.Error(w, "Forbidden: Invalid auth token", http.StatusForbidden)
+			token, err := tokens.Authenticate(r)
+			if err != nil {
+				clientGuard.AuthFailed(r)
+				message := "Forbidden: Invalid auth token"
+				if errors.Is(err, auth.ErrTokenExpired) {
+					message = "Forbidden: Auth token expired"
+				}
+				logger.Warn(message)
+				http.Error(w, message, http.StatusForbidden)
+				return
+			}
+			clientGuard.AuthSucceeded(r)
+			r = r.WithContext(auth.WithToken(r.Context(), token))
+			if scope != "" && !authorize(w, r, scope) {
 				return
 			}
 
@@ -55,61 +162,183 @@ func main() {
 		})
 	}
 
-	setupRoute("/api/logs/access", http.MethodGet, "", func(w http.ResponseWriter, r *http.Request) {
-		logger.Log.Println("Polling access logs")
+	setupRoute("/api/logs/access", http.MethodGet, "", auth.ScopeAccessLogs, func(w http.ResponseWriter, r *http.Request) {
+		cfg := *current.Load()
+		logger.Debug("Polling access logs")
 
 		includeCompressed := r.URL.Query().Get("includeCompressed") == "true"
 
-		positionsStr := r.URL.Query().Get("positions")
-		var positions []logs.Position
-		if positionsStr != "" {
-			if err := json.Unmarshal([]byte(positionsStr), &positions); err != nil {
-				http.Error(w, fmt.Sprintf("Failed to parse positions: %v", err), http.StatusBadRequest)
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "raw" && format != "parsed" {
+			http.Error(w, fmt.Sprintf("Unsupported format: %s", format), http.StatusBadRequest)
+			return
+		}
+
+		source, ok := requestSource(w, r, cfg)
+		if !ok {
+			return
+		}
+
+		if timeRangeRequested(r) {
+			if logStore == nil {
+				http.Error(w, "Time range requires the log store to be enabled", http.StatusBadRequest)
 				return
 			}
+			routes.ServeStoredLogs(w, r, logStore, source, false, format == "parsed")
+			return
 		}
 
-		logPath := cfg.AccessPath
-		if logPath == "" && utils.IsDir(cfg.ErrorPath) {
-			logPath = cfg.ErrorPath
-		} else if logPath == "" {
-			logPath = config.DefaultConfig.AccessPath
+		positions, err := parsePositions(r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to parse positions: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		logPath := source.AccessLogPath()
+		if format == "parsed" {
+			routes.ServeParsedLogs(w, r, logPath, positions, includeCompressed, source.LogFormat)
+			return
 		}
 		routes.ServeLogs(w, r, logPath, positions, false, includeCompressed)
 	})
 
-	setupRoute("/api/logs/error", http.MethodGet, "", func(w http.ResponseWriter, r *http.Request) {
+	setupRoute("/api/logs/error", http.MethodGet, "", auth.ScopeErrorLogs, func(w http.ResponseWriter, r *http.Request) {
+		cfg := *current.Load()
 		includeCompressed := r.URL.Query().Get("includeCompressed") == "true"
 
-		positionsStr := r.URL.Query().Get("positions")
-		var positions []logs.Position
-		if positionsStr != "" {
-			if err := json.Unmarshal([]byte(positionsStr), &positions); err != nil {
-				http.Error(w, fmt.Sprintf("Failed to parse positions: %v", err), http.StatusBadRequest)
+		source, ok := requestSource(w, r, cfg)
+		if !ok {
+			return
+		}
+
+		if timeRangeRequested(r) {
+			if logStore == nil {
+				http.Error(w, "Time range requires the log store to be enabled", http.StatusBadRequest)
 				return
 			}
+			routes.ServeStoredLogs(w, r, logStore, source, true, false)
+			return
 		}
 
-		logger.Log.Println("Polling error logs")
-		logPath := cfg.ErrorPath
-		if logPath == "" && utils.IsDir(cfg.AccessPath) {
-			logPath = cfg.AccessPath
-		} else if logPath == "" {
-			logPath = config.DefaultConfig.AccessPath
+		positions, err := parsePositions(r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to parse positions: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		logger.Debug("Polling error logs")
+		routes.ServeLogs(w, r, source.ErrorLogPath(), positions, true, includeCompressed)
+	})
+
+	setupRoute("/api/logs/stream", http.MethodGet, "", "", func(w http.ResponseWriter, r *http.Request) {
+		cfg := *current.Load()
+		isErrorLog := false
+		switch logType := r.URL.Query().Get("type"); logType {
+		case "", "access":
+		case "error":
+			isErrorLog = true
+		default:
+			http.Error(w, fmt.Sprintf("Unsupported log type: %s", logType), http.StatusBadRequest)
+			return
+		}
+
+		scope := auth.ScopeAccessLogs
+		if isErrorLog {
+			scope = auth.ScopeErrorLogs
+		}
+		if !authorize(w, r, scope) {
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "raw" && format != "parsed" {
+			http.Error(w, fmt.Sprintf("Unsupported format: %s", format), http.StatusBadRequest)
+			return
+		}
+		if format == "parsed" && isErrorLog {
+			http.Error(w, "Parsed format is only supported for access logs", http.StatusBadRequest)
+			return
+		}
+
+		source, ok := requestSource(w, r, cfg)
+		if !ok {
+			return
+		}
+
+		positions, err := parsePositions(r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to parse positions: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		logPath := source.AccessLogPath()
+		if isErrorLog {
+			logPath = source.ErrorLogPath()
+		}
+
+		logger.Debug("Streaming logs")
+		routes.ServeLogStream(w, r, logPath, positions, isErrorLog, format == "parsed", source.LogFormat)
+		logger.Debug("Log stream closed")
+	})
+
+	setupRoute("/api/stats", http.MethodGet, "Computing stats", auth.ScopeAccessLogs, func(w http.ResponseWriter, r *http.Request) {
+		cfg := *current.Load()
+		// Statistics can be merged across every source the token may read
+		if r.URL.Query().Get("source") == allSources {
+			sources := permittedSources(r, cfg)
+			if len(sources) == 0 {
+				http.Error(w, "Forbidden: Auth token may not read any source", http.StatusForbidden)
+				return
+			}
+			routes.ServeStats(w, r, sources, logStore, rollups)
+			return
+		}
+
+		source, ok := requestSource(w, r, cfg)
+		if !ok {
+			return
+		}
+		routes.ServeStats(w, r, []config.Source{source}, logStore, rollups)
+	})
+
+	setupRoute("/api/errors", http.MethodGet, "Summarizing error logs", auth.ScopeErrorLogs, func(w http.ResponseWriter, r *http.Request) {
+		cfg := *current.Load()
+		source, ok := requestSource(w, r, cfg)
+		if !ok {
+			return
+		}
+		routes.ServeErrors(w, r, source, logStore)
+	})
+
+	setupRoute("/api/query", http.MethodGet, "Querying logs", auth.ScopeAccessLogs, func(w http.ResponseWriter, r *http.Request) {
+		cfg := *current.Load()
+		source, ok := requestSource(w, r, cfg)
+		if !ok {
+			return
 		}
-		routes.ServeLogs(w, r, logPath, positions, true, includeCompressed)
+		routes.ServeQuery(w, r, source, logStore)
 	})
 
-	setupRoute("/api/system/logs", http.MethodGet, "Checking log size", func(w http.ResponseWriter, r *http.Request) {
-		if !cfg.SystemMonitoring {
-			logger.Log.Println("Forbidden: System monitoring disabled")
+	setupRoute("/api/sources", http.MethodGet, "Listing sources", "", func(w http.ResponseWriter, r *http.Request) {
+		cfg := *current.Load()
+		routes.ServeSources(w, permittedSources(r, cfg))
+	})
+
+	setupRoute("/api/system/logs", http.MethodGet, "Checking log size", auth.ScopeSystem, func(w http.ResponseWriter, r *http.Request) {
+		if !systemMonitoring {
+			logger.Warn("Forbidden: System monitoring disabled")
 			http.Error(w, "Forbidden: System monitoring disabled", http.StatusForbidden)
 			return
 		}
 
-		logPath := cfg.AccessPath
+		source, ok := requestSource(w, r, *current.Load())
+		if !ok {
+			return
+		}
+
+		logPath := source.AccessPath
 		if logPath == "" {
-			logPath = cfg.ErrorPath
+			logPath = source.ErrorPath
 		}
 		if logPath == "" {
 			logPath = config.DefaultConfig.AccessPath
@@ -117,9 +346,9 @@ func main() {
 		routes.ServeLogSizes(w, r, logPath)
 	})
 
-	setupRoute("/api/location", http.MethodPost, "", func(w http.ResponseWriter, r *http.Request) {
+	setupRoute("/api/location", http.MethodPost, "", auth.ScopeLocation, func(w http.ResponseWriter, r *http.Request) {
 		if !routes.LocationsEnabled() {
-			logger.Log.Println("Forbidden: Location lookup not configured")
+			logger.Warn("Forbidden: Location lookup not configured")
 			http.Error(w, "Forbidden: Location lookup not configured", http.StatusForbidden)
 			return
 		}
@@ -127,13 +356,18 @@ func main() {
 		routes.ServeLocations(w, r)
 	})
 
-	setupRoute("/api/status", http.MethodGet, "Checking status", func(w http.ResponseWriter, r *http.Request) {
-		routes.ServeServerStatus(w, cfg.AccessPath, cfg.ErrorPath, startTime, cfg.LogFormat)
+	setupRoute("/api/status", http.MethodGet, "Checking status", "", func(w http.ResponseWriter, r *http.Request) {
+		cfg := *current.Load()
+		source, ok := requestSource(w, r, cfg)
+		if !ok {
+			return
+		}
+		routes.ServeServerStatus(w, source.AccessPath, source.ErrorPath, startTime, source.LogFormat, clientGuard.Stats(), location.Databases())
 	})
 
-	setupRoute("/api/system", http.MethodGet, "Checking system resources", func(w http.ResponseWriter, r *http.Request) {
-		if !cfg.SystemMonitoring {
-			logger.Log.Println("Forbidden: System monitoring disabled")
+	setupRoute("/api/system", http.MethodGet, "Checking system resources", auth.ScopeSystem, func(w http.ResponseWriter, r *http.Request) {
+		if !systemMonitoring {
+			logger.Warn("Forbidden: System monitoring disabled")
 			http.Error(w, "Forbidden: System monitoring disabled", http.StatusForbidden)
 			return
 		}
@@ -141,21 +375,143 @@ func main() {
 		routes.ServeSystemResources(w, r)
 	})
 
+	setupRoute("/metrics", http.MethodGet, "", auth.ScopeMetrics, func(w http.ResponseWriter, r *http.Request) {
+		cfg := *current.Load()
+		routes.ServeMetrics(w, collector, permittedSources(r, cfg), systemMonitoring)
+	})
+
+	// Cancelled on shutdown so that open log streams end promptly
+	baseCtx, cancelBaseCtx := context.WithCancel(context.Background())
+	defer cancelBaseCtx()
+	// Syslog messages are stored in log files before the sources are tailed,
+	// so that the files exist to be followed
+	var receiver *syslog.Receiver
+	if cfg.Syslog.Address != "" {
+		receiver = syslog.New(cfg.Syslog)
+		if err := receiver.Route(cfg.Sources); err != nil {
+			log.Fatalf("Invalid syslog configuration: %v", err)
+		}
+		defer receiver.Close()
+		if err := receiver.Listen(baseCtx); err != nil {
+			log.Fatalf("Failed to start syslog receiver: %v", err)
+		}
+	}
+	handlers := []tail.Handler{collector}
+	if cfg.OTLP.Endpoint != "" {
+		exporter, err := otlp.New(cfg.OTLP)
+		if err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		defer exporter.Close()
+		go exporter.Run(baseCtx)
+		handlers = append(handlers, exporter)
+	}
+	if logStore != nil {
+		// Existing logs are backfilled up to the point the tailer takes over
+		logStore.Backfill(baseCtx, cfg.Sources)
+		go logStore.Run(baseCtx)
+		handlers = append(handlers, logStore)
+	}
+	// Existing logs are rolled up to the point the tailer takes over
+	rollups.Build(baseCtx, cfg.Sources, logStore)
+	go rollups.Run(baseCtx)
+	handlers = append(handlers, rollups)
+	tailer := tail.New(handlers...)
+	tailer.Follow(baseCtx, cfg.Sources)
+	// Location databases are loaded again when they're updated or first
+	// appear, so that weekly updates apply without a restart
+	databaseWatcher := &locationWatcher{ctx: baseCtx}
+	databaseWatcher.Restart()
+	if cfg.Push.Address != "" {
+		pusher := metrics.NewPusher(cfg.Push, collector)
+		go pusher.Run(baseCtx, func() []config.Source { return current.Load().Sources })
+	}
+
 	server := &http.Server{
 		Addr:         ":" + cfg.Port,
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 60 * time.Second,
 		IdleTimeout:  120 * time.Second,
+		BaseContext:  func(net.Listener) context.Context { return baseCtx },
+	}
+	server.RegisterOnShutdown(cancelBaseCtx)
+
+	if cfg.TLSCert != "" {
+		server.TLSConfig, err = tlsconfig.Server(cfg.TLSCert, cfg.TLSKey, cfg.TLSClientCA)
+		if err != nil {
+			log.Fatalf("Invalid TLS configuration: %v", err)
+		}
 	}
 
 	serverErr := make(chan error, 1)
 	go func() {
-		logger.Log.Printf("Agent running on port %s...\n", cfg.Port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if server.TLSConfig != nil {
+			logger.Infof("Agent running on port %s with TLS...", cfg.Port)
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			logger.Infof("Agent running on port %s...", cfg.Port)
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			serverErr <- err
 		}
 	}()
 
+	// Reload the configuration and tokens file on SIGHUP, or when the config
+	// file changes. Open connections are kept, and pick up the new
+	// configuration with their next request. Reloads run one at a time, so
+	// that a signal arriving while the file changes can't interleave them.
+	var reloadMu sync.Mutex
+	reloadConfig := func() {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+		next, err := loader.Load()
+		if err != nil {
+			logger.Errorf("Failed to reload configuration, keeping current configuration: %v", err)
+			return
+		}
+		if err := tokens.Configure(next.TokensFile, next.AuthToken); err != nil {
+			logger.Errorf("Failed to reload tokens, keeping current configuration: %v", err)
+			return
+		}
+		if changed := config.RestartRequired(*current.Load(), next); len(changed) > 0 {
+			logger.Warnf("Restart the agent to apply changes to: %s", strings.Join(changed, ", "))
+		}
+		applyLogSettings(next)
+		if next.LocationDB != current.Load().LocationDB || next.ASNDB != current.Load().ASNDB {
+			location.SetDatabasePath(next.LocationDB)
+			location.SetASNDatabasePath(next.ASNDB)
+			databaseWatcher.Restart()
+		}
+		if receiver != nil {
+			if err := receiver.Route(next.Sources); err != nil {
+				logger.Errorf("Failed to route syslog messages: %v", err)
+			}
+		}
+		if logStore != nil {
+			logStore.Backfill(baseCtx, next.Sources)
+		}
+		rollups.Build(baseCtx, next.Sources, logStore)
+		tailer.Follow(baseCtx, next.Sources)
+		current.Store(&next)
+		logger.Infof("Reloaded configuration with %d sources and %d tokens", len(next.Sources), tokens.Len())
+	}
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			reloadConfig()
+		}
+	}()
+
+	if path := loader.Path(); path != "" {
+		if err := config.WatchFile(baseCtx, path, reloadConfig); err != nil {
+			logger.Warnf("Failed to watch config file, reload with SIGHUP instead: %v", err)
+		}
+	}
+
 	sigchan := make(chan os.Signal, 1)
 	signal.Notify(sigchan, syscall.SIGINT, syscall.SIGTERM)
 
@@ -165,25 +521,202 @@ func main() {
 	case <-sigchan:
 	}
 
-	logger.Log.Println("Shutting down...")
+	logger.Info("Shutting down...")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	if err := server.Shutdown(ctx); err != nil {
-		logger.Log.Printf("Server shutdown error: %v", err)
+		logger.Errorf("Server shutdown error: %v", err)
 	}
 	location.Close()
 }
 
+// allSources is the source parameter that merges statistics across every
+// configured source.
+const allSources = "*"
+
+// requestSource returns the source named by the request's source parameter,
+// or the first configured source if none is named. Unknown sources are
+// rejected with a 404.
+func requestSource(w http.ResponseWriter, r *http.Request, cfg config.Config) (config.Source, bool) {
+	name := r.URL.Query().Get("source")
+	source, ok := cfg.Source(name)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown source: %s", name), http.StatusNotFound)
+		return config.Source{}, false
+	}
+	if !auth.FromContext(r.Context()).AllowsSource(source.Name) {
+		logger.Warnf("Forbidden: Auth token may not read source %s", source.Name)
+		http.Error(w, fmt.Sprintf("Forbidden: Auth token may not read source %s", source.Name), http.StatusForbidden)
+		return config.Source{}, false
+	}
+	return source, true
+}
+
+// permittedSources returns the configured sources that the request's token
+// may read.
+func permittedSources(r *http.Request, cfg config.Config) []config.Source {
+	token := auth.FromContext(r.Context())
+	var sources []config.Source
+	for _, source := range cfg.Sources {
+		if token.AllowsSource(source.Name) {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// authorize rejects requests whose token doesn't grant scope.
+func authorize(w http.ResponseWriter, r *http.Request, scope auth.Scope) bool {
+	if auth.FromContext(r.Context()).Allows(scope) {
+		return true
+	}
+	logger.Warnf("Forbidden: Auth token lacks %s scope", scope)
+	http.Error(w, fmt.Sprintf("Forbidden: Auth token lacks %s scope", scope), http.StatusForbidden)
+	return false
+}
+
+// timeRangeRequested reports whether a log request asks for the lines logged
+// within a time range, which are read from the log store.
+func timeRangeRequested(r *http.Request) bool {
+	query := r.URL.Query()
+	return query.Has("start") || query.Has("end")
+}
+
+func parsePositions(r *http.Request) ([]logs.Position, error) {
+	positionsStr := r.URL.Query().Get("positions")
+	if positionsStr == "" {
+		return nil, nil
+	}
+	var positions []logs.Position
+	if err := json.Unmarshal([]byte(positionsStr), &positions); err != nil {
+		return nil, err
+	}
+	return positions, nil
+}
+
+// applyLogSettings applies the options that control how log files are read.
+func applyLogSettings(cfg config.Config) {
+	if size, err := strconv.ParseInt(cfg.ArchiveCacheSize, 10, 64); err != nil || size < 0 {
+		logger.Warnf("Invalid archive cache size %q, using default", cfg.ArchiveCacheSize)
+	} else {
+		logs.SetArchiveCacheSize(size * 1024 * 1024)
+	}
+	logs.SetDiscovery(cfg.Discovery)
+}
+
+// rejectClient responds to a request rejected by the guard.
+func rejectClient(w http.ResponseWriter, r *http.Request, clientGuard *guard.Guard, err error) {
+	switch {
+	case errors.Is(err, guard.ErrRateLimited), errors.Is(err, guard.ErrLockedOut):
+		if retryAfter := clientGuard.RetryAfter(r); retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		}
+		logger.Warnf("Too many requests from %s: %v", r.RemoteAddr, err)
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+	default:
+		logger.Warnf("Forbidden: Request from %s not allowed", r.RemoteAddr)
+		http.Error(w, "Forbidden: Client address not allowed", http.StatusForbidden)
+	}
+}
+
+// locationWatcher watches the location databases for updates, and can be
+// restarted to watch them at new paths.
+type locationWatcher struct {
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Restart stops watching the previous database paths and watches the
+// current ones.
+func (w *locationWatcher) Restart() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancel != nil {
+		w.cancel()
+	}
+	var ctx context.Context
+	ctx, w.cancel = context.WithCancel(w.ctx)
+	watchLocationDatabases(ctx)
+}
+
+// watchLocationDatabases reloads the location databases whenever one of
+// their files is written or replaced, until ctx is done.
+func watchLocationDatabases(ctx context.Context) {
+	for _, path := range location.DatabasePaths() {
+		err := config.WatchFile(ctx, path, func() {
+			if err := location.Reload(); err != nil {
+				logger.Errorf("Failed to reload location database, keeping current database: %v", err)
+			}
+		})
+		if err != nil {
+			logger.Warnf("Failed to watch location database %s, restart to apply updates: %v", path, err)
+		}
+	}
+}
+
 func logConfig(cfg config.Config) {
-	if cfg.AuthToken == "" {
-		logger.Log.Println("Auth token not set in environment or command line argument. Access may be insecure.")
+	if cfg.AuthToken == "" && cfg.TokensFile == "" {
+		logger.Warn("Auth token not set in environment or command line argument. Access may be insecure.")
+	}
+	if cfg.TokensFile != "" {
+		logger.Infof("Using auth tokens from %s", cfg.TokensFile)
+	}
+	if cfg.LocationDB != "" {
+		logger.Infof("Using location database %s", cfg.LocationDB)
+	}
+	if cfg.ASNDB != "" {
+		logger.Infof("Using ASN database %s", cfg.ASNDB)
+	}
+	if cfg.TLSCert != "" {
+		logger.Infof("Serving HTTPS with certificate %s", cfg.TLSCert)
+	}
+	if cfg.TLSClientCA != "" {
+		logger.Infof("Requiring client certificates signed by %s", cfg.TLSClientCA)
+	}
+	if len(cfg.Guard.Allow) > 0 {
+		logger.Infof("Allowing requests from %v", cfg.Guard.Allow)
+	}
+	if len(cfg.Guard.Deny) > 0 {
+		logger.Infof("Denying requests from %v", cfg.Guard.Deny)
+	}
+	if cfg.AuditLog.Path != "" {
+		logger.Infof("Writing audit log to %s", cfg.AuditLog.Path)
+	}
+	if cfg.Push.Address != "" {
+		logger.Infof("Pushing %s metrics to %s every %s", cfg.Push.Protocol, cfg.Push.Address, cfg.Push.Interval)
+	}
+	if cfg.OTLP.Endpoint != "" {
+		logger.Infof("Exporting logs to %s, buffered in %s", cfg.OTLP.Endpoint, cfg.OTLP.BufferDir)
+	}
+	if cfg.Syslog.Address != "" {
+		logger.Infof("Receiving syslog messages on %s, stored in %s", cfg.Syslog.Address, cfg.Syslog.Dir)
+	}
+	if cfg.Store.Dir != "" && cfg.Store.Retention > 0 {
+		logger.Infof("Storing log history in %s for %d days", cfg.Store.Dir, int(cfg.Store.Retention.Hours()/24))
+	} else if cfg.Store.Dir != "" {
+		logger.Infof("Storing log history in %s indefinitely", cfg.Store.Dir)
+	}
+	if cfg.Guard.RateLimit > 0 {
+		logger.Infof("Limiting each client to %d requests per minute", cfg.Guard.RateLimit)
+	}
+	if cfg.Guard.MaxAuthFailures > 0 {
+		logger.Infof("Locking clients out for %s after %d failed auth attempts", cfg.Guard.LockoutDuration, cfg.Guard.MaxAuthFailures)
+	}
+	for _, source := range cfg.Sources {
+		logger.Infof("Using source %s with access log path %s and error log path %s", source.Name, source.AccessPath, source.ErrorPath)
+	}
+
+	logger.Infof("Using archive cache size: %s MiB", cfg.ArchiveCacheSize)
+	logger.Infof("Reading access logs matching %v excluding %v", cfg.Discovery.Access.Include, cfg.Discovery.Access.Exclude)
+	logger.Infof("Reading error logs matching %v excluding %v", cfg.Discovery.Error.Include, cfg.Discovery.Error.Exclude)
+	if cfg.Discovery.Recursive {
+		logger.Info("Reading log files in subdirectories")
 	}
-	logger.Log.Println("Using NGINX access log path:", cfg.AccessPath)
-	logger.Log.Println("Using NGINX error log path:", cfg.ErrorPath)
 
 	if cfg.SystemMonitoring {
-		logger.Log.Println("System monitoring enabled")
+		logger.Info("System monitoring enabled")
 	} else {
-		logger.Log.Println("System monitoring disabled")
+		logger.Info("System monitoring disabled")
 	}
 }
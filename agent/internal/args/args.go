@@ -13,21 +13,116 @@ type Arguments struct {
 	SystemMonitoringSet bool
 	AuthToken           string
 	LogFormat           string
+	ArchiveCacheSize    string
+	Sources             string
+	AccessInclude       string
+	AccessExclude       string
+	ErrorInclude        string
+	ErrorExclude        string
+	Recursive           bool
+	RecursiveSet        bool
+	TokensFile          string
+	TLSCert             string
+	TLSKey              string
+	TLSClientCA         string
+	AllowCIDRs          string
+	DenyCIDRs           string
+	RateLimit           string
+	LockoutAttempts     string
+	LockoutDuration     string
+	AuditLog            string
+	AuditLogMaxSize     string
+	AuditLogMaxBackups  string
+	LogLevel            string
+	LogOutput           string
+	LogJSON             bool
+	LogJSONSet          bool
+	LogMaxSize          string
+	LogMaxBackups       string
+	ConfigFile          string
+	LocationDB          string
+	ASNDB               string
+	PushAddress         string
+	PushProtocol        string
+	PushInterval        string
+	PushPrefix          string
+	OTLPEndpoint        string
+	OTLPHeaders         string
+	OTLPBatchSize       string
+	OTLPFlushInterval   string
+	OTLPBufferDir       string
+	OTLPBufferMaxSize   string
+	SyslogAddress       string
+	SyslogDir           string
+	SyslogMaxSize       string
+	SyslogMaxBackups    string
+	StoreDir            string
+	StoreRetention      string
 }
 
 func Parse(defaults Arguments) Arguments {
 	// Define command-line flags
 	cmdAuthToken := flag.String("auth-token", "", "Authentication token (recommended)")
-	cmdPort := flag.String("port", defaults.Port, fmt.Sprintf("Port to run the server on (default %s)", defaults.Port))
+	cmdPort := flag.String("port", "", fmt.Sprintf("Port to run the server on (default %s)", defaults.Port))
 	cmdAccessPath := flag.String("access-path", "", "Path to the NGINX access log file or parent directory")
 	cmdErrorPath := flag.String("error-path", "", "Path to the NGINX error log file or parent directory")
 	cmdSystemMonitoring := flag.Bool("system-monitoring", defaults.SystemMonitoring, fmt.Sprintf("System resource monitoring toggle (default %t)", defaults.SystemMonitoring))
 	cmdLogFormat := flag.String("log-format", "", fmt.Sprintf("Log format used by NGINX (default %s)", defaults.LogFormat))
+	cmdArchiveCacheSize := flag.String("archive-cache-size", "", fmt.Sprintf("Memory for caching decompressed log archives in MiB, 0 to disable (default %s)", defaults.ArchiveCacheSize))
+	cmdSources := flag.String("sources", "", "JSON list of named log sources, each with a name, accessPath, errorPath and logFormat")
+	cmdAccessInclude := flag.String("access-include", "", "Comma-separated glob patterns of access log files to read from a directory")
+	cmdAccessExclude := flag.String("access-exclude", "", "Comma-separated glob patterns of access log files to skip")
+	cmdErrorInclude := flag.String("error-include", "", "Comma-separated glob patterns of error log files to read from a directory")
+	cmdErrorExclude := flag.String("error-exclude", "", "Comma-separated glob patterns of error log files to skip")
+	cmdRecursive := flag.Bool("recursive", defaults.Recursive, fmt.Sprintf("Read log files in subdirectories (default %t)", defaults.Recursive))
+	cmdTokensFile := flag.String("tokens-file", "", "Path to a JSON file of named, scoped auth tokens, reloaded on SIGHUP")
+	cmdTLSCert := flag.String("tls-cert", "", "Path to a TLS certificate to serve HTTPS with")
+	cmdTLSKey := flag.String("tls-key", "", "Path to the private key of the TLS certificate")
+	cmdTLSClientCA := flag.String("tls-client-ca", "", "Path to a CA bundle that client certificates must be signed by")
+	cmdAllowCIDRs := flag.String("allow-cidrs", "", "Comma-separated networks allowed to use the API, in CIDR notation (default all)")
+	cmdDenyCIDRs := flag.String("deny-cidrs", "", "Comma-separated networks refused access to the API, in CIDR notation")
+	cmdRateLimit := flag.String("rate-limit", "", fmt.Sprintf("Requests per minute allowed from each client, 0 for no limit (default %s)", defaults.RateLimit))
+	cmdLockoutAttempts := flag.String("lockout-attempts", "", fmt.Sprintf("Failed auth attempts before a client is locked out, 0 to disable (default %s)", defaults.LockoutAttempts))
+	cmdLockoutDuration := flag.String("lockout-duration", "", fmt.Sprintf("How long a client is locked out after failed auth attempts (default %s)", defaults.LockoutDuration))
+	cmdAuditLog := flag.String("audit-log", "", "Path to write a JSON lines audit log of API requests to")
+	cmdAuditLogMaxSize := flag.String("audit-log-max-size", "", fmt.Sprintf("Size in MiB at which the audit log is rotated, 0 to never rotate (default %s)", defaults.AuditLogMaxSize))
+	cmdAuditLogMaxBackups := flag.String("audit-log-max-backups", "", fmt.Sprintf("Number of rotated audit logs to keep (default %s)", defaults.AuditLogMaxBackups))
+	cmdLogLevel := flag.String("log-level", "", fmt.Sprintf("Minimum level of messages logged: debug, info, warn or error (default %s)", defaults.LogLevel))
+	cmdLogOutput := flag.String("log-output", "", fmt.Sprintf("Where to write log messages: stderr or a file path (default %s)", defaults.LogOutput))
+	cmdLogJSON := flag.Bool("log-json", defaults.LogJSON, fmt.Sprintf("Write log messages as JSON lines (default %t)", defaults.LogJSON))
+	cmdLogMaxSize := flag.String("log-max-size", "", fmt.Sprintf("Size in MiB at which the log file is rotated, 0 to never rotate (default %s)", defaults.LogMaxSize))
+	cmdLogMaxBackups := flag.String("log-max-backups", "", fmt.Sprintf("Number of rotated log files to keep (default %s)", defaults.LogMaxBackups))
+	cmdConfigFile := flag.String("config", "", "Path to a YAML config file, reloaded on SIGHUP or when it changes")
+	cmdLocationDB := flag.String("location-db", "", "Path to a GeoLite2 City or Country database (default GeoLite2-City.mmdb or GeoLite2-Country.mmdb in the working directory)")
+	cmdASNDB := flag.String("asn-db", "", "Path to a GeoLite2 ASN database (default GeoLite2-ASN.mmdb in the working directory, if present)")
+	cmdPushAddress := flag.String("push-address", "", "Address of a StatsD or Graphite server to push traffic metrics to")
+	cmdPushProtocol := flag.String("push-protocol", "", fmt.Sprintf("Protocol to push metrics with: statsd (UDP) or graphite (plaintext over TCP) (default %s)", defaults.PushProtocol))
+	cmdPushInterval := flag.String("push-interval", "", fmt.Sprintf("How often metrics are pushed (default %s)", defaults.PushInterval))
+	cmdPushPrefix := flag.String("push-prefix", "", fmt.Sprintf("Prefix of pushed metric names (default %s)", defaults.PushPrefix))
+	cmdOTLPEndpoint := flag.String("otlp-endpoint", "", "URL of an OTLP/HTTP logs endpoint to export log lines to, such as http://localhost:4318/v1/logs")
+	cmdOTLPHeaders := flag.String("otlp-headers", "", "Comma-separated key=value headers sent with each OTLP export")
+	cmdOTLPBatchSize := flag.String("otlp-batch-size", "", fmt.Sprintf("Maximum log records per OTLP export (default %s)", defaults.OTLPBatchSize))
+	cmdOTLPFlushInterval := flag.String("otlp-flush-interval", "", fmt.Sprintf("Longest time log records wait to be batched before export (default %s)", defaults.OTLPFlushInterval))
+	cmdOTLPBufferDir := flag.String("otlp-buffer-dir", "", fmt.Sprintf("Directory holding OTLP batches until they are exported (default %s)", defaults.OTLPBufferDir))
+	cmdOTLPBufferMaxSize := flag.String("otlp-buffer-max-size", "", fmt.Sprintf("Size in MiB the OTLP buffer may reach before the oldest batches are dropped (default %s)", defaults.OTLPBufferMaxSize))
+	cmdSyslogAddress := flag.String("syslog-address", "", "Address to receive syslog messages on over UDP and TCP, such as :514")
+	cmdSyslogDir := flag.String("syslog-dir", "", fmt.Sprintf("Directory that received syslog messages are stored in (default %s)", defaults.SyslogDir))
+	cmdSyslogMaxSize := flag.String("syslog-max-size", "", fmt.Sprintf("Size in MiB at which each stored syslog file is rotated (default %s)", defaults.SyslogMaxSize))
+	cmdSyslogMaxBackups := flag.String("syslog-max-backups", "", fmt.Sprintf("Number of rotated syslog files to keep for each log (default %s)", defaults.SyslogMaxBackups))
+	cmdStoreDir := flag.String("store-dir", "", "Directory to keep the history of each source's logs in, beyond log rotation")
+	cmdStoreRetention := flag.String("store-retention-days", "", fmt.Sprintf("Days of log history kept in the store, or 0 to keep it forever (default %s)", defaults.StoreRetention))
 	flag.Parse()
 	systemMonitoringSet := false
+	recursiveSet := false
+	logJSONSet := false
 	flag.Visit(func(f *flag.Flag) {
-		if f.Name == "system-monitoring" {
+		switch f.Name {
+		case "system-monitoring":
 			systemMonitoringSet = true
+		case "recursive":
+			recursiveSet = true
+		case "log-json":
+			logJSONSet = true
 		}
 	})
 
@@ -39,5 +134,50 @@ func Parse(defaults Arguments) Arguments {
 		SystemMonitoring:    *cmdSystemMonitoring,
 		SystemMonitoringSet: systemMonitoringSet,
 		LogFormat:           *cmdLogFormat,
+		ArchiveCacheSize:    *cmdArchiveCacheSize,
+		Sources:             *cmdSources,
+		AccessInclude:       *cmdAccessInclude,
+		AccessExclude:       *cmdAccessExclude,
+		ErrorInclude:        *cmdErrorInclude,
+		ErrorExclude:        *cmdErrorExclude,
+		Recursive:           *cmdRecursive,
+		RecursiveSet:        recursiveSet,
+		TokensFile:          *cmdTokensFile,
+		TLSCert:             *cmdTLSCert,
+		TLSKey:              *cmdTLSKey,
+		TLSClientCA:         *cmdTLSClientCA,
+		AllowCIDRs:          *cmdAllowCIDRs,
+		DenyCIDRs:           *cmdDenyCIDRs,
+		RateLimit:           *cmdRateLimit,
+		LockoutAttempts:     *cmdLockoutAttempts,
+		LockoutDuration:     *cmdLockoutDuration,
+		AuditLog:            *cmdAuditLog,
+		AuditLogMaxSize:     *cmdAuditLogMaxSize,
+		AuditLogMaxBackups:  *cmdAuditLogMaxBackups,
+		LogLevel:            *cmdLogLevel,
+		LogOutput:           *cmdLogOutput,
+		LogJSON:             *cmdLogJSON,
+		LogJSONSet:          logJSONSet,
+		LogMaxSize:          *cmdLogMaxSize,
+		LogMaxBackups:       *cmdLogMaxBackups,
+		ConfigFile:          *cmdConfigFile,
+		LocationDB:          *cmdLocationDB,
+		ASNDB:               *cmdASNDB,
+		PushAddress:         *cmdPushAddress,
+		PushProtocol:        *cmdPushProtocol,
+		PushInterval:        *cmdPushInterval,
+		PushPrefix:          *cmdPushPrefix,
+		OTLPEndpoint:        *cmdOTLPEndpoint,
+		OTLPHeaders:         *cmdOTLPHeaders,
+		OTLPBatchSize:       *cmdOTLPBatchSize,
+		OTLPFlushInterval:   *cmdOTLPFlushInterval,
+		OTLPBufferDir:       *cmdOTLPBufferDir,
+		OTLPBufferMaxSize:   *cmdOTLPBufferMaxSize,
+		SyslogAddress:       *cmdSyslogAddress,
+		SyslogDir:           *cmdSyslogDir,
+		SyslogMaxSize:       *cmdSyslogMaxSize,
+		SyslogMaxBackups:    *cmdSyslogMaxBackups,
+		StoreDir:            *cmdStoreDir,
+		StoreRetention:      *cmdStoreRetention,
 	}
 }
@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
+)
+
+// Config controls where the audit log is written and when it is rotated.
+type Config struct {
+	// Path is the file the audit log is written to. Auditing is disabled if
+	// empty.
+	Path string
+	// MaxSize is the size in bytes a log reaches before it is rotated, or 0
+	// to never rotate.
+	MaxSize int64
+	// MaxBackups is the number of rotated logs kept, named Path.1 (newest)
+	// to Path.MaxBackups (oldest).
+	MaxBackups int
+}
+
+// Entry records a single request made to the API.
+type Entry struct {
+	Time              time.Time       `json:"time"`
+	ClientAddr        string          `json:"clientAddr"`
+	Token             string          `json:"token,omitempty"`
+	Method            string          `json:"method"`
+	Route             string          `json:"route"`
+	Source            string          `json:"source,omitempty"`
+	Positions         json.RawMessage `json:"positions,omitempty"`
+	IncludeCompressed bool            `json:"includeCompressed,omitempty"`
+	Status            int             `json:"status"`
+	Bytes             int64           `json:"bytes"`
+	DurationMs        float64         `json:"durationMs"`
+}
+
+// Log writes audit entries as JSON lines.
+type Log struct {
+	file *logger.RotatingFile
+}
+
+// Open opens the audit log for appending, creating it if needed.
+func Open(cfg Config) (*Log, error) {
+	file, err := logger.OpenRotatingFile(cfg.Path, cfg.MaxSize, cfg.MaxBackups)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Log{file: file}, nil
+}
+
+// Record writes an entry for a request that has been responded to.
+func (l *Log) Record(r *http.Request, rec *Recorder, token string, start time.Time) error {
+	query := r.URL.Query()
+	entry := Entry{
+		Time:              start.UTC(),
+		ClientAddr:        r.RemoteAddr,
+		Token:             token,
+		Method:            r.Method,
+		Route:             r.URL.Path,
+		Source:            query.Get("source"),
+		Positions:         positions(r),
+		IncludeCompressed: query.Get("includeCompressed") == "true",
+		Status:            rec.Status(),
+		Bytes:             rec.Bytes(),
+		DurationMs:        float64(time.Since(start).Microseconds()) / 1000,
+	}
+	return l.Write(entry)
+}
+
+// Write appends an entry to the log.
+func (l *Log) Write(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = l.file.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	return l.file.Close()
+}
+
+// positions returns the log positions the request resumed from, sent either
+// as a query parameter or, for streams, as the Last-Event-ID header.
+func positions(r *http.Request) json.RawMessage {
+	value := r.URL.Query().Get("positions")
+	if value == "" {
+		value = r.Header.Get("Last-Event-ID")
+	}
+	if value == "" || !json.Valid([]byte(value)) {
+		return nil
+	}
+	return json.RawMessage(value)
+}
+
+// Recorder wraps a ResponseWriter to capture the status and number of bytes
+// written.
+type Recorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func NewRecorder(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w}
+}
+
+func (rec *Recorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *Recorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController flush and set deadlines on the
+// underlying ResponseWriter.
+func (rec *Recorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Status returns the response status, which is 200 if nothing was written.
+func (rec *Recorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+// Bytes returns the number of bytes of the response body written.
+func (rec *Recorder) Bytes() int64 {
+	return rec.bytes
+}
@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readEntries(t *testing.T, path string) []Entry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid audit line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(Config{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	r := httptest.NewRequest("GET", `/api/logs/access?source=api&includeCompressed=true&positions=[{"position":10}]`, nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	w := httptest.NewRecorder()
+	rec := NewRecorder(w)
+	rec.Write([]byte("hello"))
+	if err := l.Record(r, rec, "dashboard", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	stream := httptest.NewRequest("GET", "/api/logs/stream", nil)
+	stream.Header.Set("Last-Event-ID", `[{"position":20}]`)
+	rec = NewRecorder(httptest.NewRecorder())
+	http.Error(rec, "Forbidden", http.StatusForbidden)
+	if err := l.Record(stream, rec, "", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := readEntries(t, path)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	got := entries[0]
+	if got.ClientAddr != "192.0.2.1:1234" || got.Token != "dashboard" || got.Route != "/api/logs/access" ||
+		got.Source != "api" || !got.IncludeCompressed || string(got.Positions) != `[{"position":10}]` ||
+		got.Status != http.StatusOK || got.Bytes != 5 {
+		t.Errorf("unexpected entry: %+v", got)
+	}
+	if got := entries[1]; got.Status != http.StatusForbidden || got.Token != "" || string(got.Positions) != `[{"position":20}]` {
+		t.Errorf("unexpected entry: %+v", got)
+	}
+}
+
+func TestRecorderFlush(t *testing.T) {
+	w := httptest.NewRecorder()
+	rec := NewRecorder(w)
+	rc := http.NewResponseController(rec)
+	rec.Write([]byte(strings.Repeat("a", 3)))
+	if err := rc.Flush(); err != nil {
+		t.Fatalf("expected the recorder to support flushing: %v", err)
+	}
+	if !w.Flushed {
+		t.Error("expected the underlying writer to be flushed")
+	}
+}
@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope is a capability that a token grants.
+type Scope string
+
+const (
+	ScopeAccessLogs Scope = "logs:access"
+	ScopeErrorLogs  Scope = "logs:error"
+	ScopeSystem     Scope = "system"
+	ScopeLocation   Scope = "location"
+	ScopeMetrics    Scope = "metrics"
+	// ScopeAll grants every capability.
+	ScopeAll Scope = "*"
+)
+
+var knownScopes = []Scope{ScopeAccessLogs, ScopeErrorLogs, ScopeSystem, ScopeLocation, ScopeMetrics, ScopeAll}
+
+const hashPrefix = "sha256:"
+
+var (
+	ErrInvalidToken = errors.New("invalid auth token")
+	ErrTokenExpired = errors.New("auth token expired")
+)
+
+// Token is a named bearer token. Only a hash of the token is stored. A token
+// without sources may read every source, and a token without an expiry date
+// never expires.
+type Token struct {
+	Name    string     `json:"name"`
+	Hash    string     `json:"hash"`
+	Scopes  []Scope    `json:"scopes"`
+	Sources []string   `json:"sources,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// unrestricted is granted to every request when no tokens are configured.
+var unrestricted = &Token{Name: "anonymous", Scopes: []Scope{ScopeAll}}
+
+// Allows reports whether the token grants scope. A nil token grants nothing.
+func (t *Token) Allows(scope Scope) bool {
+	if t == nil {
+		return false
+	}
+	return slices.Contains(t.Scopes, ScopeAll) || slices.Contains(t.Scopes, scope)
+}
+
+// AllowsSource reports whether the token may read the named source.
+func (t *Token) AllowsSource(name string) bool {
+	if t == nil {
+		return false
+	}
+	return len(t.Sources) == 0 || slices.Contains(t.Sources, name)
+}
+
+func (t *Token) expired(now time.Time) bool {
+	return t.Expires != nil && !now.Before(*t.Expires)
+}
+
+// HashToken returns the hash to store in a tokens file for a token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hashPrefix + hex.EncodeToString(sum[:])
+}
+
+type tokensFile struct {
+	Tokens []Token `json:"tokens"`
+}
+
+// Store holds the tokens accepted by the agent: the tokens listed in a tokens
+// file, and a single shared token with every scope.
+type Store struct {
+	mu          sync.RWMutex
+	path        string
+	sharedToken string
+	tokens      []Token
+}
+
+// NewStore loads the tokens file at path, if set, alongside the shared token.
+func NewStore(path string, sharedToken string) (*Store, error) {
+	s := &Store{}
+	if err := s.Configure(path, sharedToken); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reads the tokens file again. The current tokens are kept if the file
+// is invalid.
+func (s *Store) Reload() error {
+	s.mu.RLock()
+	path, sharedToken := s.path, s.sharedToken
+	s.mu.RUnlock()
+	return s.Configure(path, sharedToken)
+}
+
+// Configure replaces the tokens file and shared token, loading the tokens
+// file. The current tokens are kept if the file is invalid.
+func (s *Store) Configure(path string, sharedToken string) error {
+	var tokens []Token
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read tokens file: %w", err)
+		}
+		tokens, err = parseTokens(data)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.path = path
+	s.sharedToken = sharedToken
+	s.tokens = tokens
+	s.mu.Unlock()
+	return nil
+}
+
+// Len returns the number of tokens loaded from the tokens file.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.tokens)
+}
+
+// Authenticate returns the token presented as a bearer token by the request.
+// Every request is allowed when no tokens are configured.
+func (s *Store) Authenticate(r *http.Request) (*Token, error) {
+	s.mu.RLock()
+	path, sharedToken, tokens := s.path, s.sharedToken, s.tokens
+	s.mu.RUnlock()
+
+	if sharedToken == "" && path == "" {
+		return unrestricted, nil
+	}
+
+	provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || provided == "" {
+		return nil, ErrInvalidToken
+	}
+
+	if sharedToken != "" && IsAuthenticated(r, sharedToken) {
+		return &Token{Name: "shared", Scopes: []Scope{ScopeAll}}, nil
+	}
+
+	hash := HashToken(provided)
+	var match *Token
+	for i := range tokens {
+		// Compare against every token to avoid leaking which one matched
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(tokens[i].Hash)) == 1 {
+			match = &tokens[i]
+		}
+	}
+	if match == nil {
+		return nil, ErrInvalidToken
+	}
+	if match.expired(time.Now()) {
+		return nil, ErrTokenExpired
+	}
+	return match, nil
+}
+
+func parseTokens(data []byte) ([]Token, error) {
+	var file tokensFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid tokens file: %w", err)
+	}
+
+	names := make(map[string]bool)
+	for i, token := range file.Tokens {
+		if token.Name == "" {
+			return nil, fmt.Errorf("invalid tokens file: token %d has no name", i+1)
+		}
+		if names[token.Name] {
+			return nil, fmt.Errorf("invalid tokens file: duplicate token name %q", token.Name)
+		}
+		names[token.Name] = true
+
+		digest, ok := strings.CutPrefix(token.Hash, hashPrefix)
+		if decoded, err := hex.DecodeString(digest); !ok || err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("invalid tokens file: token %q must have a %s<hex> hash", token.Name, hashPrefix)
+		}
+		file.Tokens[i].Hash = strings.ToLower(token.Hash)
+
+		if len(token.Scopes) == 0 {
+			return nil, fmt.Errorf("invalid tokens file: token %q has no scopes", token.Name)
+		}
+		for _, scope := range token.Scopes {
+			if !slices.Contains(knownScopes, scope) {
+				return nil, fmt.Errorf("invalid tokens file: token %q has unknown scope %q", token.Name, scope)
+			}
+		}
+	}
+	return file.Tokens, nil
+}
+
+type contextKey struct{}
+
+// WithToken returns a copy of ctx carrying the request's token.
+func WithToken(ctx context.Context, token *Token) context.Context {
+	return context.WithValue(ctx, contextKey{}, token)
+}
+
+// FromContext returns the token of an authenticated request, or nil if the
+// request wasn't authenticated.
+func FromContext(ctx context.Context) *Token {
+	token, _ := ctx.Value(contextKey{}).(*Token)
+	return token
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTokensFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreAuthenticate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	writeTokensFile(t, path, fmt.Sprintf(`{"tokens": [
+		{"name": "dashboard", "hash": %q, "scopes": ["logs:access", "system"], "sources": ["api"]},
+		{"name": "old", "hash": %q, "scopes": ["*"], "expires": "2020-01-01T00:00:00Z"}
+	]}`, HashToken("dashboard-secret"), HashToken("old-secret")))
+
+	store, err := NewStore(path, "shared-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		header  string
+		want    string
+		wantErr error
+	}{
+		{"named token", "Bearer dashboard-secret", "dashboard", nil},
+		{"shared token", "Bearer shared-secret", "shared", nil},
+		{"expired token", "Bearer old-secret", "", ErrTokenExpired},
+		{"unknown token", "Bearer wrong", "", ErrInvalidToken},
+		{"missing token", "", "", ErrInvalidToken},
+		{"not a bearer token", "Basic dashboard-secret", "", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/logs/access", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			token, err := store.Authenticate(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && token.Name != tt.want {
+				t.Errorf("got token %q, want %q", token.Name, tt.want)
+			}
+		})
+	}
+
+	r := httptest.NewRequest("GET", "/api/logs/access", nil)
+	r.Header.Set("Authorization", "Bearer dashboard-secret")
+	token, _ := store.Authenticate(r)
+	if !token.Allows(ScopeAccessLogs) || !token.Allows(ScopeSystem) || token.Allows(ScopeErrorLogs) || token.Allows(ScopeLocation) {
+		t.Errorf("unexpected scopes: %v", token.Scopes)
+	}
+	if !token.AllowsSource("api") || token.AllowsSource("shop") {
+		t.Errorf("unexpected sources: %v", token.Sources)
+	}
+}
+
+func TestStoreWithoutTokens(t *testing.T) {
+	store, err := NewStore("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := store.Authenticate(httptest.NewRequest("GET", "/api/system", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !token.Allows(ScopeSystem) || !token.AllowsSource("any") {
+		t.Error("expected every request to be allowed without tokens")
+	}
+
+	var missing *Token
+	if missing.Allows(ScopeSystem) || missing.AllowsSource("any") {
+		t.Error("expected a missing token to be denied")
+	}
+}
+
+func TestStoreReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	writeTokensFile(t, path, fmt.Sprintf(`{"tokens": [{"name": "a", "hash": %q, "scopes": ["*"]}]}`, HashToken("first")))
+
+	store, err := NewStore(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticates := func(secret string) bool {
+		r := httptest.NewRequest("GET", "/api/status", nil)
+		r.Header.Set("Authorization", "Bearer "+secret)
+		_, err := store.Authenticate(r)
+		return err == nil
+	}
+
+	writeTokensFile(t, path, fmt.Sprintf(`{"tokens": [{"name": "b", "hash": %q, "scopes": ["*"]}]}`, HashToken("second")))
+	if err := store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if authenticates("first") || !authenticates("second") {
+		t.Error("expected reload to replace the tokens")
+	}
+
+	// An invalid file keeps the current tokens
+	writeTokensFile(t, path, `{"tokens": [{"name": "c", "hash": "plaintext", "scopes": ["*"]}]}`)
+	if err := store.Reload(); err == nil {
+		t.Error("expected an invalid file to fail to reload")
+	}
+	if !authenticates("second") {
+		t.Error("expected the current tokens to be kept")
+	}
+}
+
+func TestParseTokens(t *testing.T) {
+	hash := HashToken("secret")
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"missing name", fmt.Sprintf(`{"tokens": [{"hash": %q, "scopes": ["*"]}]}`, hash)},
+		{"duplicate name", fmt.Sprintf(`{"tokens": [{"name": "a", "hash": %q, "scopes": ["*"]}, {"name": "a", "hash": %q, "scopes": ["*"]}]}`, hash, hash)},
+		{"plaintext token", `{"tokens": [{"name": "a", "hash": "secret", "scopes": ["*"]}]}`},
+		{"short hash", `{"tokens": [{"name": "a", "hash": "sha256:abcd", "scopes": ["*"]}]}`},
+		{"no scopes", fmt.Sprintf(`{"tokens": [{"name": "a", "hash": %q}]}`, hash)},
+		{"unknown scope", fmt.Sprintf(`{"tokens": [{"name": "a", "hash": %q, "scopes": ["admin"]}]}`, hash)},
+		{"invalid JSON", `{"tokens": [`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseTokens([]byte(tt.content)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
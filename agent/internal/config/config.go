@@ -1,8 +1,25 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/tom-draper/nginx-analytics/agent/internal/args"
+	"github.com/tom-draper/nginx-analytics/agent/internal/audit"
 	"github.com/tom-draper/nginx-analytics/agent/internal/env"
+	"github.com/tom-draper/nginx-analytics/agent/internal/guard"
+	"github.com/tom-draper/nginx-analytics/agent/internal/utils"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logs"
 )
 
 type Config struct {
@@ -11,9 +28,137 @@ type Config struct {
 	ErrorPath        string
 	SystemMonitoring bool
 	AuthToken        string
-	LogFormat        string
+	// TokensFile is a JSON file of named auth tokens with their own scopes
+	TokensFile string
+	LogFormat  string
+	// ArchiveCacheSize is the memory budget for decompressed archives in MiB
+	ArchiveCacheSize string
+	// Sources are the named log sources served, such as one per virtual
+	// host. The first source is used when a request doesn't name one.
+	Sources []Source
+	// Discovery selects the access and error log files read from log
+	// directories.
+	Discovery logs.Discovery
+	// LocationDB is a GeoLite2 City or Country database used to locate
+	// clients, instead of looking in the working directory
+	LocationDB string
+	// ASNDB is a GeoLite2 ASN database used to find the networks of
+	// clients, instead of looking in the working directory
+	ASNDB string
+	// TLSCert and TLSKey serve the agent over HTTPS when set
+	TLSCert string
+	TLSKey  string
+	// TLSClientCA requires clients to present a certificate signed by one of
+	// the CAs in this bundle
+	TLSClientCA string
+	// Guard restricts which clients may use the API and how often
+	Guard guard.Config
+	// AuditLog records each API request as a line of JSON
+	AuditLog audit.Config
+	// Logging controls the level, format and destination of the agent's own
+	// log messages
+	Logging logger.Config
+	// Push sends traffic metrics to a StatsD or Graphite server
+	Push Push
+	// OTLP exports log lines to an OpenTelemetry collector
+	OTLP OTLP
+	// Syslog receives log messages sent over syslog instead of reading files
+	Syslog Syslog
+	// Store keeps the history of each source's logs beyond log rotation
+	Store Store
+}
+
+// Push controls where and how often traffic metrics are pushed.
+type Push struct {
+	// Address is the host:port of the server. Pushing is disabled if empty.
+	Address string
+	// Protocol is PushStatsD or PushGraphite
+	Protocol string
+	Interval time.Duration
+	// Prefix starts the name of every metric pushed
+	Prefix string
+}
+
+// OTLP controls where log lines are exported and how they are batched and
+// buffered.
+type OTLP struct {
+	// Endpoint is the URL of a collector's OTLP/HTTP logs endpoint. Exporting
+	// is disabled if empty.
+	Endpoint string
+	// Headers are sent with every export, such as for authentication
+	Headers map[string]string
+	// BatchSize is the most log records sent in one export
+	BatchSize int
+	// FlushInterval is the longest records wait to fill a batch
+	FlushInterval time.Duration
+	// BufferDir holds batches until they are exported, so that they survive
+	// collector outages and restarts
+	BufferDir string
+	// MaxBufferSize is the size in bytes the buffer may reach before the
+	// oldest batches are dropped
+	MaxBufferSize int64
+}
+
+// Syslog controls where syslog messages are received and how they are
+// stored.
+type Syslog struct {
+	// Address is the address to listen on over UDP and TCP. The receiver is
+	// disabled if empty.
+	Address string
+	// Dir holds a subdirectory of received logs for each source
+	Dir string
+	// MaxSize is the size in bytes each log file reaches before it is
+	// rotated, keeping MaxBackups rotated files.
+	MaxSize    int64
+	MaxBackups int
+}
+
+// SourceDir returns the directory that syslog messages for a source are
+// stored in, as access.log and error.log.
+func (s Syslog) SourceDir(name string) string {
+	return filepath.Join(s.Dir, url.PathEscape(name))
+}
+
+// Store controls where log history is kept and for how long.
+type Store struct {
+	// Dir holds a subdirectory of daily log segments for each source. The
+	// store is disabled if empty.
+	Dir string
+	// Retention is how long segments are kept, or forever if zero
+	Retention time.Duration
+}
+
+// SourceDir returns the directory that a source's log history is stored in.
+func (s Store) SourceDir(name string) string {
+	return filepath.Join(s.Dir, url.PathEscape(name))
+}
+
+const (
+	// PushStatsD sends StatsD metrics with DogStatsD tags over UDP
+	PushStatsD = "statsd"
+	// PushGraphite sends tagged metrics in the Graphite plaintext protocol
+	// over TCP
+	PushGraphite = "graphite"
+)
+
+// Source is a named set of logs with their own paths and log format. Tags
+// are attached to the metrics pushed for the source. A source with an access
+// or error tag receives its logs over syslog, from messages with those tags,
+// rather than reading them from its own paths.
+type Source struct {
+	Name       string            `json:"name" yaml:"name"`
+	AccessPath string            `json:"accessPath" yaml:"accessPath"`
+	ErrorPath  string            `json:"errorPath,omitempty" yaml:"errorPath"`
+	LogFormat  string            `json:"logFormat,omitempty" yaml:"logFormat"`
+	Tags       map[string]string `json:"tags,omitempty" yaml:"tags"`
+	AccessTag  string            `json:"accessTag,omitempty" yaml:"accessTag"`
+	ErrorTag   string            `json:"errorTag,omitempty" yaml:"errorTag"`
 }
 
+// DefaultSourceName names the source built from the access and error paths
+// when no sources are configured.
+const DefaultSourceName = "default"
+
 var DefaultConfig = Config{
 	Port:             "5000",
 	AccessPath:       "/var/log/nginx",
@@ -21,52 +166,567 @@ var DefaultConfig = Config{
 	SystemMonitoring: false,
 	AuthToken:        "",
 	LogFormat:        "$remote_addr - $remote_user [$time_local] \"$request\" $status $body_bytes_sent \"$http_referer\" \"$http_user_agent\"",
+	ArchiveCacheSize: "256",
+	Discovery:        logs.DefaultDiscovery,
+	Guard: guard.Config{
+		RateLimit:       0,
+		MaxAuthFailures: 10,
+		LockoutDuration: 15 * time.Minute,
+	},
+	AuditLog: audit.Config{
+		MaxSize:    100 * 1024 * 1024,
+		MaxBackups: 5,
+	},
+	Logging: logger.Config{
+		Level:      slog.LevelInfo,
+		Output:     logger.Stderr,
+		MaxSize:    100 * 1024 * 1024,
+		MaxBackups: 5,
+	},
+	Push: Push{
+		Protocol: PushStatsD,
+		Interval: 10 * time.Second,
+		Prefix:   "nginx",
+	},
+	OTLP: OTLP{
+		BatchSize:     512,
+		FlushInterval: 5 * time.Second,
+		BufferDir:     "otlp-buffer",
+		MaxBufferSize: 100 * 1024 * 1024,
+	},
+	Syslog: Syslog{
+		Dir:        "syslog",
+		MaxSize:    100 * 1024 * 1024,
+		MaxBackups: 5,
+	},
+	Store: Store{
+		Retention: 365 * 24 * time.Hour,
+	},
+}
+
+// Loader resolves the configuration from flags, env vars and a config file,
+// in that order of precedence, falling back to the defaults. Flags and env vars
+// are read once, while the config file is read on every Load so that the
+// configuration can be reloaded.
+type Loader struct {
+	args args.Arguments
+	env  env.Env
 }
 
-func LoadConfig() Config {
-	env := env.LoadEnv()
-	args := args.Parse(args.Arguments{
-		Port:             DefaultConfig.Port,
-		AccessPath:       DefaultConfig.AccessPath,
-		ErrorPath:        DefaultConfig.ErrorPath,
-		SystemMonitoring: DefaultConfig.SystemMonitoring,
-		AuthToken:        DefaultConfig.AuthToken,
-		LogFormat:        DefaultConfig.LogFormat,
-	})
+// NewLoader parses the command line flags and reads the env vars.
+func NewLoader() Loader {
+	return Loader{
+		env: env.LoadEnv(),
+		args: args.Parse(args.Arguments{
+			Port:               DefaultConfig.Port,
+			AccessPath:         DefaultConfig.AccessPath,
+			ErrorPath:          DefaultConfig.ErrorPath,
+			SystemMonitoring:   DefaultConfig.SystemMonitoring,
+			AuthToken:          DefaultConfig.AuthToken,
+			LogFormat:          DefaultConfig.LogFormat,
+			ArchiveCacheSize:   DefaultConfig.ArchiveCacheSize,
+			Recursive:          DefaultConfig.Discovery.Recursive,
+			RateLimit:          strconv.Itoa(DefaultConfig.Guard.RateLimit),
+			LockoutAttempts:    strconv.Itoa(DefaultConfig.Guard.MaxAuthFailures),
+			LockoutDuration:    DefaultConfig.Guard.LockoutDuration.String(),
+			AuditLogMaxSize:    strconv.FormatInt(DefaultConfig.AuditLog.MaxSize/(1024*1024), 10),
+			AuditLogMaxBackups: strconv.Itoa(DefaultConfig.AuditLog.MaxBackups),
+			LogLevel:           DefaultConfig.Logging.Level.String(),
+			LogOutput:          DefaultConfig.Logging.Output,
+			LogJSON:            DefaultConfig.Logging.JSON,
+			LogMaxSize:         strconv.FormatInt(DefaultConfig.Logging.MaxSize/(1024*1024), 10),
+			LogMaxBackups:      strconv.Itoa(DefaultConfig.Logging.MaxBackups),
+			PushProtocol:       DefaultConfig.Push.Protocol,
+			PushInterval:       DefaultConfig.Push.Interval.String(),
+			PushPrefix:         DefaultConfig.Push.Prefix,
+			OTLPBatchSize:      strconv.Itoa(DefaultConfig.OTLP.BatchSize),
+			OTLPFlushInterval:  DefaultConfig.OTLP.FlushInterval.String(),
+			OTLPBufferDir:      DefaultConfig.OTLP.BufferDir,
+			OTLPBufferMaxSize:  strconv.FormatInt(DefaultConfig.OTLP.MaxBufferSize/(1024*1024), 10),
+			SyslogDir:          DefaultConfig.Syslog.Dir,
+			SyslogMaxSize:      strconv.FormatInt(DefaultConfig.Syslog.MaxSize/(1024*1024), 10),
+			SyslogMaxBackups:   strconv.Itoa(DefaultConfig.Syslog.MaxBackups),
+			StoreRetention:     strconv.Itoa(retentionDays(DefaultConfig.Store.Retention)),
+		}),
+	}
+}
 
-	accessPath := resolveValue(args.AccessPath, env.AccessPath, DefaultConfig.AccessPath)
+// Path returns the path of the config file, or an empty string if none is
+// used.
+func (l Loader) Path() string {
+	return resolveValue(l.args.ConfigFile, l.env.ConfigFile, "", "")
+}
+
+// Load reads the config file and resolves the configuration.
+func (l Loader) Load() (Config, error) {
+	file, err := readFile(l.Path())
+	if err != nil {
+		return Config{}, err
+	}
+	return resolve(l.args, l.env, file)
+}
+
+func resolve(args args.Arguments, env env.Env, file File) (Config, error) {
+	accessPath := resolveValue(args.AccessPath, env.AccessPath, file.AccessPath, DefaultConfig.AccessPath)
 	// If an access path provided, use as default error path
 	defaultErrorPath := DefaultConfig.ErrorPath
 	if accessPath != DefaultConfig.AccessPath {
 		defaultErrorPath = accessPath
 	}
 
-	return Config{
-		Port:             resolveValue(args.Port, env.Port, DefaultConfig.Port),
+	cfg := Config{
+		Port:             resolveValue(args.Port, env.Port, file.Port, DefaultConfig.Port),
 		AccessPath:       accessPath,
-		ErrorPath:        resolveValue(args.ErrorPath, env.ErrorPath, defaultErrorPath),
-		SystemMonitoring: resolveBool(args.SystemMonitoring, args.SystemMonitoringSet, env.SystemMonitoring, DefaultConfig.SystemMonitoring),
-		AuthToken:        resolveValue(args.AuthToken, env.AuthToken, ""),
-		LogFormat:        resolveValue(args.LogFormat, env.LogFormat, DefaultConfig.LogFormat),
+		ErrorPath:        resolveValue(args.ErrorPath, env.ErrorPath, file.ErrorPath, defaultErrorPath),
+		SystemMonitoring: resolveBool(args.SystemMonitoring, args.SystemMonitoringSet, env.SystemMonitoring, file.SystemMonitoring, DefaultConfig.SystemMonitoring),
+		AuthToken:        resolveValue(args.AuthToken, env.AuthToken, file.AuthToken, ""),
+		TokensFile:       resolveValue(args.TokensFile, env.TokensFile, file.TokensFile, ""),
+		LogFormat:        resolveValue(args.LogFormat, env.LogFormat, file.LogFormat, DefaultConfig.LogFormat),
+		ArchiveCacheSize: resolveValue(args.ArchiveCacheSize, env.ArchiveCacheSize, file.ArchiveCacheSize, DefaultConfig.ArchiveCacheSize),
+		LocationDB:       resolveValue(args.LocationDB, env.LocationDB, file.LocationDB, ""),
+		ASNDB:            resolveValue(args.ASNDB, env.ASNDB, file.ASNDB, ""),
+		TLSCert:          resolveValue(args.TLSCert, env.TLSCert, file.TLSCert, ""),
+		TLSKey:           resolveValue(args.TLSKey, env.TLSKey, file.TLSKey, ""),
+		TLSClientCA:      resolveValue(args.TLSClientCA, env.TLSClientCA, file.TLSClientCA, ""),
+	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return cfg, fmt.Errorf("TLS certificate and key must be set together")
+	}
+	if cfg.TLSClientCA != "" && cfg.TLSCert == "" {
+		return cfg, fmt.Errorf("a TLS client CA requires a TLS certificate and key")
+	}
+
+	cfg.Discovery = logs.Discovery{
+		Access: DefaultConfig.Discovery.Access.WithOverrides(
+			splitPatterns(resolveValue(args.AccessInclude, env.AccessInclude, strings.Join(file.AccessInclude, ","), "")),
+			splitPatterns(resolveValue(args.AccessExclude, env.AccessExclude, strings.Join(file.AccessExclude, ","), "")),
+		),
+		Error: DefaultConfig.Discovery.Error.WithOverrides(
+			splitPatterns(resolveValue(args.ErrorInclude, env.ErrorInclude, strings.Join(file.ErrorInclude, ","), "")),
+			splitPatterns(resolveValue(args.ErrorExclude, env.ErrorExclude, strings.Join(file.ErrorExclude, ","), "")),
+		),
+		Recursive: resolveBool(args.Recursive, args.RecursiveSet, env.Recursive, file.Recursive, DefaultConfig.Discovery.Recursive),
+	}
+	if err := cfg.Discovery.Validate(); err != nil {
+		return cfg, err
+	}
+
+	guardConfig, err := parseGuard(
+		resolveValue(args.AllowCIDRs, env.AllowCIDRs, strings.Join(file.AllowCIDRs, ","), ""),
+		resolveValue(args.DenyCIDRs, env.DenyCIDRs, strings.Join(file.DenyCIDRs, ","), ""),
+		resolveValue(args.RateLimit, env.RateLimit, file.RateLimit, strconv.Itoa(DefaultConfig.Guard.RateLimit)),
+		resolveValue(args.LockoutAttempts, env.LockoutAttempts, file.LockoutAttempts, strconv.Itoa(DefaultConfig.Guard.MaxAuthFailures)),
+		resolveValue(args.LockoutDuration, env.LockoutDuration, file.LockoutDuration, DefaultConfig.Guard.LockoutDuration.String()),
+	)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Guard = guardConfig
+
+	auditConfig, err := parseAuditLog(
+		resolveValue(args.AuditLog, env.AuditLog, file.AuditLog, ""),
+		resolveValue(args.AuditLogMaxSize, env.AuditLogMaxSize, file.AuditLogMaxSize, strconv.FormatInt(DefaultConfig.AuditLog.MaxSize/(1024*1024), 10)),
+		resolveValue(args.AuditLogMaxBackups, env.AuditLogMaxBackups, file.AuditLogMaxBackups, strconv.Itoa(DefaultConfig.AuditLog.MaxBackups)),
+	)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.AuditLog = auditConfig
+
+	loggingConfig, err := parseLogging(
+		resolveValue(args.LogLevel, env.LogLevel, file.LogLevel, DefaultConfig.Logging.Level.String()),
+		resolveValue(args.LogOutput, env.LogOutput, file.LogOutput, DefaultConfig.Logging.Output),
+		resolveBool(args.LogJSON, args.LogJSONSet, env.LogJSON, file.LogJSON, DefaultConfig.Logging.JSON),
+		resolveValue(args.LogMaxSize, env.LogMaxSize, file.LogMaxSize, strconv.FormatInt(DefaultConfig.Logging.MaxSize/(1024*1024), 10)),
+		resolveValue(args.LogMaxBackups, env.LogMaxBackups, file.LogMaxBackups, strconv.Itoa(DefaultConfig.Logging.MaxBackups)),
+	)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Logging = loggingConfig
+
+	pushConfig, err := parsePush(
+		resolveValue(args.PushAddress, env.PushAddress, file.PushAddress, ""),
+		resolveValue(args.PushProtocol, env.PushProtocol, file.PushProtocol, DefaultConfig.Push.Protocol),
+		resolveValue(args.PushInterval, env.PushInterval, file.PushInterval, DefaultConfig.Push.Interval.String()),
+		resolveValue(args.PushPrefix, env.PushPrefix, file.PushPrefix, DefaultConfig.Push.Prefix),
+	)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Push = pushConfig
+
+	// Headers given by a flag or env var replace those in the file
+	headers := file.OTLPHeaders
+	if value := resolveValue(args.OTLPHeaders, env.OTLPHeaders, "", ""); value != "" {
+		if headers, err = parseHeaders(value); err != nil {
+			return cfg, err
+		}
+	}
+	otlpConfig, err := parseOTLP(
+		resolveValue(args.OTLPEndpoint, env.OTLPEndpoint, file.OTLPEndpoint, ""),
+		headers,
+		resolveValue(args.OTLPBatchSize, env.OTLPBatchSize, file.OTLPBatchSize, strconv.Itoa(DefaultConfig.OTLP.BatchSize)),
+		resolveValue(args.OTLPFlushInterval, env.OTLPFlushInterval, file.OTLPFlushInterval, DefaultConfig.OTLP.FlushInterval.String()),
+		resolveValue(args.OTLPBufferDir, env.OTLPBufferDir, file.OTLPBufferDir, DefaultConfig.OTLP.BufferDir),
+		resolveValue(args.OTLPBufferMaxSize, env.OTLPBufferMaxSize, file.OTLPBufferMaxSize, strconv.FormatInt(DefaultConfig.OTLP.MaxBufferSize/(1024*1024), 10)),
+	)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.OTLP = otlpConfig
+
+	syslogConfig, err := parseSyslog(
+		resolveValue(args.SyslogAddress, env.SyslogAddress, file.SyslogAddress, ""),
+		resolveValue(args.SyslogDir, env.SyslogDir, file.SyslogDir, DefaultConfig.Syslog.Dir),
+		resolveValue(args.SyslogMaxSize, env.SyslogMaxSize, file.SyslogMaxSize, strconv.FormatInt(DefaultConfig.Syslog.MaxSize/(1024*1024), 10)),
+		resolveValue(args.SyslogMaxBackups, env.SyslogMaxBackups, file.SyslogMaxBackups, strconv.Itoa(DefaultConfig.Syslog.MaxBackups)),
+	)
+	if err != nil {
+		return cfg, err
 	}
+	cfg.Syslog = syslogConfig
+
+	storeConfig, err := parseStore(
+		resolveValue(args.StoreDir, env.StoreDir, file.StoreDir, ""),
+		resolveValue(args.StoreRetention, env.StoreRetention, file.StoreRetention, strconv.Itoa(retentionDays(DefaultConfig.Store.Retention))),
+	)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Store = storeConfig
+
+	// Sources given as JSON by a flag or env var replace those in the file
+	var sources []Source
+	if value := resolveValue(args.Sources, env.Sources, "", ""); value != "" || len(file.Sources) == 0 {
+		sources, err = parseSources(value, cfg)
+	} else {
+		sources, err = resolveSources(file.Sources, cfg)
+	}
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Sources = sources
+	return cfg, nil
 }
 
-func resolveValue(argVal, envVal, defaultVal string) string {
-	if argVal != "" && argVal != defaultVal {
-		return argVal
+// RestartRequired returns the options that differ between two configurations
+// but can only take effect when the agent restarts.
+func RestartRequired(current Config, next Config) []string {
+	var changed []string
+	check := func(name string, a, b any) {
+		if !reflect.DeepEqual(a, b) {
+			changed = append(changed, name)
+		}
+	}
+	check("port", current.Port, next.Port)
+	check("TLS", [3]string{current.TLSCert, current.TLSKey, current.TLSClientCA}, [3]string{next.TLSCert, next.TLSKey, next.TLSClientCA})
+	check("system monitoring", current.SystemMonitoring, next.SystemMonitoring)
+	check("access control", current.Guard, next.Guard)
+	check("audit log", current.AuditLog, next.AuditLog)
+	check("logging", current.Logging, next.Logging)
+	check("metrics push", current.Push, next.Push)
+	check("OTLP export", current.OTLP, next.OTLP)
+	check("syslog receiver", current.Syslog, next.Syslog)
+	check("log store", current.Store, next.Store)
+	return changed
+}
+
+// Source returns the source with the given name, or the first source if name
+// is empty.
+func (c Config) Source(name string) (Source, bool) {
+	if name == "" && len(c.Sources) > 0 {
+		return c.Sources[0], true
+	}
+	for _, source := range c.Sources {
+		if source.Name == name {
+			return source, true
+		}
+	}
+	return Source{}, false
+}
+
+// AccessLogPath returns the path to serve the source's access logs from,
+// falling back to the error log directory when no access path is set.
+func (s Source) AccessLogPath() string {
+	if s.AccessPath == "" && utils.IsDir(s.ErrorPath) {
+		return s.ErrorPath
+	} else if s.AccessPath == "" {
+		return DefaultConfig.AccessPath
+	}
+	return s.AccessPath
+}
+
+// ErrorLogPath returns the path to serve the source's error logs from,
+// falling back to the access log directory when no error path is set.
+func (s Source) ErrorLogPath() string {
+	if s.ErrorPath == "" && utils.IsDir(s.AccessPath) {
+		return s.AccessPath
+	} else if s.ErrorPath == "" {
+		return DefaultConfig.AccessPath
+	}
+	return s.ErrorPath
+}
+
+// parseSources parses a JSON list of sources. Without any, a single default
+// source is built from the configured paths and log format.
+func parseSources(value string, cfg Config) ([]Source, error) {
+	if value == "" {
+		return resolveSources(nil, cfg)
+	}
+
+	var sources []Source
+	if err := json.Unmarshal([]byte(value), &sources); err != nil {
+		return nil, fmt.Errorf("invalid sources: %w", err)
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("invalid sources: no sources listed")
+	}
+	return resolveSources(sources, cfg)
+}
+
+// resolveSources validates a list of sources. Without any, a single default
+// source is built from the configured paths and log format. Sources without
+// their own log format use the configured one, and sources without an error
+// path look for error logs alongside their access logs. Sources with syslog
+// tags read from the directory their messages are stored in.
+func resolveSources(sources []Source, cfg Config) ([]Source, error) {
+	if len(sources) == 0 {
+		return []Source{{
+			Name:       DefaultSourceName,
+			AccessPath: cfg.AccessPath,
+			ErrorPath:  cfg.ErrorPath,
+			LogFormat:  cfg.LogFormat,
+		}}, nil
+	}
+
+	sources = slices.Clone(sources)
+	names := make(map[string]bool)
+	tags := make(map[string]bool)
+	for i := range sources {
+		source := &sources[i]
+		if source.Name == "" || source.Name == "*" {
+			return nil, fmt.Errorf("invalid sources: source %d has an invalid name %q", i+1, source.Name)
+		}
+		if names[source.Name] {
+			return nil, fmt.Errorf("invalid sources: duplicate source name %q", source.Name)
+		}
+		names[source.Name] = true
+
+		if source.AccessTag != "" || source.ErrorTag != "" {
+			if cfg.Syslog.Address == "" {
+				return nil, fmt.Errorf("invalid sources: source %q has syslog tags but the syslog receiver is disabled", source.Name)
+			}
+			if source.AccessPath != "" || source.ErrorPath != "" {
+				return nil, fmt.Errorf("invalid sources: source %q has both syslog tags and log paths", source.Name)
+			}
+			for _, tag := range []string{source.AccessTag, source.ErrorTag} {
+				if tag == "" {
+					continue
+				}
+				if tags[tag] {
+					return nil, fmt.Errorf("invalid sources: syslog tag %q is used more than once", tag)
+				}
+				tags[tag] = true
+			}
+			source.AccessPath = cfg.Syslog.SourceDir(source.Name)
+		}
+
+		if source.AccessPath == "" && source.ErrorPath == "" {
+			return nil, fmt.Errorf("invalid sources: source %q has no log paths", source.Name)
+		}
+		if source.ErrorPath == "" {
+			source.ErrorPath = source.AccessPath
+		}
+		if source.LogFormat == "" {
+			source.LogFormat = cfg.LogFormat
+		}
+	}
+	return sources, nil
+}
+
+// parseGuard parses the client restrictions applied to API requests.
+func parseGuard(allow, deny, rateLimit, lockoutAttempts, lockoutDuration string) (guard.Config, error) {
+	var cfg guard.Config
+	var err error
+	if cfg.Allow, err = guard.ParsePrefixes(splitPatterns(allow)); err != nil {
+		return cfg, fmt.Errorf("invalid allowed networks: %w", err)
+	}
+	if cfg.Deny, err = guard.ParsePrefixes(splitPatterns(deny)); err != nil {
+		return cfg, fmt.Errorf("invalid denied networks: %w", err)
+	}
+	if cfg.RateLimit, err = strconv.Atoi(rateLimit); err != nil || cfg.RateLimit < 0 {
+		return cfg, fmt.Errorf("invalid rate limit %q", rateLimit)
+	}
+	if cfg.MaxAuthFailures, err = strconv.Atoi(lockoutAttempts); err != nil || cfg.MaxAuthFailures < 0 {
+		return cfg, fmt.Errorf("invalid lockout attempts %q", lockoutAttempts)
+	}
+	if cfg.LockoutDuration, err = time.ParseDuration(lockoutDuration); err != nil || cfg.LockoutDuration <= 0 {
+		return cfg, fmt.Errorf("invalid lockout duration %q", lockoutDuration)
+	}
+	return cfg, nil
+}
+
+// parseAuditLog parses the audit log path and rotation settings. The maximum
+// size is given in MiB.
+func parseAuditLog(path, maxSize, maxBackups string) (audit.Config, error) {
+	cfg := audit.Config{Path: path}
+	size, err := strconv.ParseInt(maxSize, 10, 64)
+	if err != nil || size < 0 {
+		return cfg, fmt.Errorf("invalid audit log max size %q", maxSize)
+	}
+	cfg.MaxSize = size * 1024 * 1024
+	if cfg.MaxBackups, err = strconv.Atoi(maxBackups); err != nil || cfg.MaxBackups < 0 {
+		return cfg, fmt.Errorf("invalid audit log max backups %q", maxBackups)
+	}
+	return cfg, nil
+}
+
+// parseLogging parses the agent's logging settings. The maximum size is given
+// in MiB.
+func parseLogging(level, output string, json bool, maxSize, maxBackups string) (logger.Config, error) {
+	cfg := logger.Config{Output: output, JSON: json}
+	var err error
+	if cfg.Level, err = logger.ParseLevel(level); err != nil {
+		return cfg, err
+	}
+	size, err := strconv.ParseInt(maxSize, 10, 64)
+	if err != nil || size < 0 {
+		return cfg, fmt.Errorf("invalid log max size %q", maxSize)
+	}
+	cfg.MaxSize = size * 1024 * 1024
+	if cfg.MaxBackups, err = strconv.Atoi(maxBackups); err != nil || cfg.MaxBackups < 0 {
+		return cfg, fmt.Errorf("invalid log max backups %q", maxBackups)
 	}
-	if envVal != "" && envVal != defaultVal {
-		return envVal
+	return cfg, nil
+}
+
+// parsePush parses the settings for pushing metrics to a StatsD or Graphite
+// server.
+func parsePush(address, protocol, interval, prefix string) (Push, error) {
+	cfg := Push{Address: address, Protocol: protocol, Prefix: prefix}
+	if address != "" {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return cfg, fmt.Errorf("invalid push address %q: %w", address, err)
+		}
+	}
+	if protocol != PushStatsD && protocol != PushGraphite {
+		return cfg, fmt.Errorf("invalid push protocol %q, expected %s or %s", protocol, PushStatsD, PushGraphite)
+	}
+	var err error
+	if cfg.Interval, err = time.ParseDuration(interval); err != nil || cfg.Interval <= 0 {
+		return cfg, fmt.Errorf("invalid push interval %q", interval)
+	}
+	return cfg, nil
+}
+
+// parseOTLP parses the settings for exporting log lines over OTLP/HTTP. The
+// maximum buffer size is given in MiB.
+func parseOTLP(endpoint string, headers map[string]string, batchSize, flushInterval, bufferDir, maxBufferSize string) (OTLP, error) {
+	cfg := OTLP{Endpoint: endpoint, Headers: headers, BufferDir: bufferDir}
+	if endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return cfg, fmt.Errorf("invalid OTLP endpoint %q, expected an http or https URL", endpoint)
+		}
+	}
+	var err error
+	if cfg.BatchSize, err = strconv.Atoi(batchSize); err != nil || cfg.BatchSize <= 0 {
+		return cfg, fmt.Errorf("invalid OTLP batch size %q", batchSize)
+	}
+	if cfg.FlushInterval, err = time.ParseDuration(flushInterval); err != nil || cfg.FlushInterval <= 0 {
+		return cfg, fmt.Errorf("invalid OTLP flush interval %q", flushInterval)
+	}
+	size, err := strconv.ParseInt(maxBufferSize, 10, 64)
+	if err != nil || size <= 0 {
+		return cfg, fmt.Errorf("invalid OTLP buffer max size %q", maxBufferSize)
+	}
+	cfg.MaxBufferSize = size * 1024 * 1024
+	return cfg, nil
+}
+
+// parseSyslog parses the syslog receiver's address and storage settings. The
+// maximum size is given in MiB.
+func parseSyslog(address, dir, maxSize, maxBackups string) (Syslog, error) {
+	cfg := Syslog{Address: address, Dir: dir}
+	if address != "" {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return cfg, fmt.Errorf("invalid syslog address %q: %w", address, err)
+		}
+	}
+	size, err := strconv.ParseInt(maxSize, 10, 64)
+	if err != nil || size <= 0 {
+		return cfg, fmt.Errorf("invalid syslog max size %q", maxSize)
+	}
+	cfg.MaxSize = size * 1024 * 1024
+	if cfg.MaxBackups, err = strconv.Atoi(maxBackups); err != nil || cfg.MaxBackups < 0 {
+		return cfg, fmt.Errorf("invalid syslog max backups %q", maxBackups)
+	}
+	return cfg, nil
+}
+
+// parseStore parses the log store's directory and its retention in days.
+func parseStore(dir, retention string) (Store, error) {
+	cfg := Store{Dir: dir}
+	days, err := strconv.Atoi(retention)
+	if err != nil || days < 0 {
+		return cfg, fmt.Errorf("invalid store retention %q", retention)
+	}
+	cfg.Retention = time.Duration(days) * 24 * time.Hour
+	return cfg, nil
+}
+
+func retentionDays(retention time.Duration) int {
+	return int(retention / (24 * time.Hour))
+}
+
+// parseHeaders parses a comma-separated list of key=value headers.
+func parseHeaders(value string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(pair, "=")
+		if key = strings.TrimSpace(key); !ok || key == "" {
+			return nil, fmt.Errorf("invalid header %q, expected key=value", pair)
+		}
+		headers[key] = strings.TrimSpace(val)
+	}
+	return headers, nil
+}
+
+// splitPatterns splits a comma-separated list of glob patterns.
+func splitPatterns(value string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// resolveValue returns the first value that is set, from the flag, env var
+// and config file in turn, or the default if none are.
+func resolveValue(argVal, envVal, fileVal, defaultVal string) string {
+	for _, value := range []string{argVal, envVal, fileVal} {
+		if value != "" {
+			return value
+		}
 	}
 	return defaultVal
 }
 
-func resolveBool(argVal, argSet, envVal, defaultVal bool) bool {
+func resolveBool(argVal, argSet bool, envVal, fileVal *bool, defaultVal bool) bool {
 	if argSet {
 		return argVal
 	}
-	if envVal {
-		return true
+	if envVal != nil {
+		return *envVal
+	}
+	if fileVal != nil {
+		return *fileVal
 	}
 	return defaultVal
 }
@@ -1,24 +1,379 @@
 package config
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/args"
+	"github.com/tom-draper/nginx-analytics/agent/internal/env"
+)
 
 func TestResolveBool(t *testing.T) {
+	yes, no := true, false
 	tests := []struct {
-		name                     string
-		argValue, argSet, envVal bool
-		defaultVal, want         bool
+		name             string
+		argValue, argSet bool
+		envVal, fileVal  *bool
+		defaultVal, want bool
 	}{
-		{"explicit false overrides environment", false, true, true, false, false},
-		{"explicit true overrides environment", true, true, false, false, true},
-		{"environment is used when flag is absent", false, false, true, false, true},
-		{"default is used when unset", false, false, false, true, true},
+		{"explicit false overrides environment", false, true, &yes, nil, false, false},
+		{"explicit true overrides environment", true, true, &no, nil, false, true},
+		{"environment is used when flag is absent", false, false, &yes, &no, false, true},
+		{"explicit false in environment overrides config file", false, false, &no, &yes, true, false},
+		{"config file is used when flag and environment are absent", false, false, nil, &yes, false, true},
+		{"default is used when unset", false, false, nil, nil, true, true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := resolveBool(tt.argValue, tt.argSet, tt.envVal, tt.defaultVal); got != tt.want {
+			if got := resolveBool(tt.argValue, tt.argSet, tt.envVal, tt.fileVal, tt.defaultVal); got != tt.want {
 				t.Fatalf("resolveBool() = %t, want %t", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestResolveValue(t *testing.T) {
+	tests := []struct {
+		name                     string
+		arg, env, file, fallback string
+		want                     string
+	}{
+		{"flag set to the default overrides environment", "5000", "8080", "9000", "5000", "5000"},
+		{"environment overrides config file", "", "8080", "9000", "5000", "8080"},
+		{"config file overrides default", "", "", "9000", "5000", "9000"},
+		{"default is used when unset", "", "", "", "5000", "5000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveValue(tt.arg, tt.env, tt.file, tt.fallback); got != tt.want {
+				t.Errorf("resolveValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSources(t *testing.T) {
+	cfg := Config{AccessPath: "/var/log/nginx", ErrorPath: "/var/log/nginx", LogFormat: "$remote_addr"}
+
+	tests := []struct {
+		name    string
+		value   string
+		want    []Source
+		wantErr bool
+	}{
+		{
+			name:  "default source",
+			value: "",
+			want:  []Source{{Name: DefaultSourceName, AccessPath: "/var/log/nginx", ErrorPath: "/var/log/nginx", LogFormat: "$remote_addr"}},
+		},
+		{
+			name:  "named sources",
+			value: `[{"name":"api","accessPath":"/logs/api"},{"name":"www","accessPath":"/logs/www.log","errorPath":"/logs/www.error.log","logFormat":"$status"}]`,
+			want: []Source{
+				{Name: "api", AccessPath: "/logs/api", ErrorPath: "/logs/api", LogFormat: "$remote_addr"},
+				{Name: "www", AccessPath: "/logs/www.log", ErrorPath: "/logs/www.error.log", LogFormat: "$status"},
+			},
+		},
+		{
+			name:  "tags",
+			value: `[{"name":"api","accessPath":"/logs/api","tags":{"team":"payments"}}]`,
+			want:  []Source{{Name: "api", AccessPath: "/logs/api", ErrorPath: "/logs/api", LogFormat: "$remote_addr", Tags: map[string]string{"team": "payments"}}},
+		},
+		{name: "invalid json", value: `{"name":"api"}`, wantErr: true},
+		{name: "empty list", value: `[]`, wantErr: true},
+		{name: "missing name", value: `[{"accessPath":"/logs/api"}]`, wantErr: true},
+		{name: "reserved name", value: `[{"name":"*","accessPath":"/logs/api"}]`, wantErr: true},
+		{name: "duplicate name", value: `[{"name":"api","accessPath":"/a"},{"name":"api","accessPath":"/b"}]`, wantErr: true},
+		{name: "missing paths", value: `[{"name":"api"}]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSources(tt.value, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSources() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSources() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigSource(t *testing.T) {
+	cfg := Config{Sources: []Source{{Name: "api"}, {Name: "www"}}}
+
+	if source, ok := cfg.Source(""); !ok || source.Name != "api" {
+		t.Errorf("expected the first source by default, got %+v", source)
+	}
+	if source, ok := cfg.Source("www"); !ok || source.Name != "www" {
+		t.Errorf("expected source www, got %+v", source)
+	}
+	if _, ok := cfg.Source("missing"); ok {
+		t.Error("expected unknown source to be missing")
+	}
+}
+
+func TestSplitPatterns(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{"*.access", []string{"*.access"}},
+		{" *.access , *.access.log,, ", []string{"*.access", "*.access.log"}},
+	}
+
+	for _, tt := range tests {
+		if got := splitPatterns(tt.value); !slices.Equal(got, tt.want) {
+			t.Errorf("splitPatterns(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseGuard(t *testing.T) {
+	cfg, err := parseGuard("10.0.0.0/8, 192.168.1.1", "10.0.0.5", "120", "5", "10m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Allow) != 2 || len(cfg.Deny) != 1 || cfg.RateLimit != 120 || cfg.MaxAuthFailures != 5 || cfg.LockoutDuration != 10*time.Minute {
+		t.Errorf("unexpected guard config: %+v", cfg)
+	}
+
+	tests := []struct {
+		name                                                 string
+		allow, deny, rateLimit, lockoutAttempts, lockoutTime string
+	}{
+		{"invalid allowed network", "10.0.0.0/40", "", "0", "10", "15m"},
+		{"invalid denied network", "", "localhost", "0", "10", "15m"},
+		{"negative rate limit", "", "", "-1", "10", "15m"},
+		{"invalid lockout attempts", "", "", "0", "many", "15m"},
+		{"invalid lockout duration", "", "", "0", "10", "15"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseGuard(tt.allow, tt.deny, tt.rateLimit, tt.lockoutAttempts, tt.lockoutTime); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestParsePush(t *testing.T) {
+	cfg, err := parsePush("localhost:8125", PushGraphite, "30s", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Address != "localhost:8125" || cfg.Protocol != PushGraphite || cfg.Interval != 30*time.Second || cfg.Prefix != "web" {
+		t.Errorf("unexpected push config: %+v", cfg)
+	}
+
+	tests := []struct {
+		name                        string
+		address, protocol, interval string
+	}{
+		{"missing port", "localhost", PushStatsD, "10s"},
+		{"unknown protocol", "localhost:8125", "influx", "10s"},
+		{"invalid interval", "localhost:8125", PushStatsD, "10"},
+		{"zero interval", "localhost:8125", PushStatsD, "0s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parsePush(tt.address, tt.protocol, tt.interval, "nginx"); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseOTLP(t *testing.T) {
+	headers, err := parseHeaders("Authorization=Bearer abc, X-Scope-OrgID = tenant=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"Authorization": "Bearer abc", "X-Scope-OrgID": "tenant=1"}; !reflect.DeepEqual(headers, want) {
+		t.Errorf("parseHeaders() = %v, want %v", headers, want)
+	}
+	if _, err := parseHeaders("Authorization"); err == nil {
+		t.Error("expected an error for a header without a value")
+	}
+
+	cfg, err := parseOTLP("https://collector:4318/v1/logs", headers, "100", "2s", "/var/lib/otlp", "10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BatchSize != 100 || cfg.FlushInterval != 2*time.Second || cfg.MaxBufferSize != 10*1024*1024 {
+		t.Errorf("unexpected OTLP config: %+v", cfg)
+	}
+
+	tests := []struct {
+		name                                              string
+		endpoint, batchSize, flushInterval, maxBufferSize string
+	}{
+		{"endpoint without scheme", "collector:4318", "512", "5s", "100"},
+		{"zero batch size", "", "0", "5s", "100"},
+		{"invalid flush interval", "", "512", "soon", "100"},
+		{"zero buffer size", "", "512", "5s", "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseOTLP(tt.endpoint, nil, tt.batchSize, tt.flushInterval, "otlp-buffer", tt.maxBufferSize); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseSyslog(t *testing.T) {
+	cfg, err := parseSyslog(":514", "/var/lib/syslog", "10", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxSize != 10*1024*1024 || cfg.MaxBackups != 2 {
+		t.Errorf("unexpected syslog config: %+v", cfg)
+	}
+	if got, want := cfg.SourceDir("api/v1"), filepath.Join("/var/lib/syslog", "api%2Fv1"); got != want {
+		t.Errorf("SourceDir() = %s, want %s", got, want)
+	}
+
+	for _, args := range [][4]string{{"514", "syslog", "100", "5"}, {"", "syslog", "0", "5"}, {"", "syslog", "100", "-1"}} {
+		if _, err := parseSyslog(args[0], args[1], args[2], args[3]); err == nil {
+			t.Errorf("expected an error for %v", args)
+		}
+	}
+}
+
+func TestParseStore(t *testing.T) {
+	cfg, err := parseStore("/var/lib/nginx-analytics", "180")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Retention != 180*24*time.Hour {
+		t.Errorf("retention = %s, want 180 days", cfg.Retention)
+	}
+	if cfg, err := parseStore("", "0"); err != nil || cfg.Retention != 0 {
+		t.Errorf("expected a retention of 0 to keep logs forever, got %s, %v", cfg.Retention, err)
+	}
+	for _, retention := range []string{"-1", "6 months", ""} {
+		if _, err := parseStore("store", retention); err == nil {
+			t.Errorf("expected an error for retention %q", retention)
+		}
+	}
+}
+
+func TestResolveSyslogSources(t *testing.T) {
+	cfg := Config{LogFormat: DefaultConfig.LogFormat, Syslog: Syslog{Address: ":514", Dir: "/var/lib/syslog"}}
+	sources, err := resolveSources([]Source{{Name: "api", AccessTag: "api", ErrorTag: "api_error"}}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir := filepath.Join("/var/lib/syslog", "api"); sources[0].AccessPath != dir || sources[0].ErrorPath != dir {
+		t.Errorf("expected the source to read from its syslog directory, got %+v", sources[0])
+	}
+
+	tests := []struct {
+		name    string
+		sources []Source
+		syslog  Syslog
+	}{
+		{"receiver disabled", []Source{{Name: "api", AccessTag: "api"}}, Syslog{}},
+		{"tags and paths", []Source{{Name: "api", AccessTag: "api", AccessPath: "/logs"}}, cfg.Syslog},
+		{"duplicate tag", []Source{{Name: "api", AccessTag: "nginx"}, {Name: "www", ErrorTag: "nginx"}}, cfg.Syslog},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := resolveSources(tt.sources, Config{Syslog: tt.syslog}); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestResolveFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	content := `
+port: "9000"
+logFormat: $remote_addr
+systemMonitoring: true
+rateLimit: 600
+accessInclude: ["*.access"]
+sources:
+  - name: api
+    accessPath: /logs/api
+  - name: www
+    accessPath: /logs/www
+    logFormat: $status
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := readFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := resolve(args.Arguments{}, env.Env{Port: "8080"}, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != "8080" {
+		t.Errorf("expected the env var to override the config file, got port %s", cfg.Port)
+	}
+	if !cfg.SystemMonitoring || cfg.Guard.RateLimit != 600 || !slices.Equal(cfg.Discovery.Access.Include, []string{"*.access"}) {
+		t.Errorf("config file options not applied: %+v", cfg)
+	}
+	want := []Source{
+		{Name: "api", AccessPath: "/logs/api", ErrorPath: "/logs/api", LogFormat: "$remote_addr"},
+		{Name: "www", AccessPath: "/logs/www", ErrorPath: "/logs/www", LogFormat: "$status"},
+	}
+	if !reflect.DeepEqual(cfg.Sources, want) {
+		t.Errorf("got sources %+v, want %+v", cfg.Sources, want)
+	}
+
+	// Sources given as JSON replace those in the file
+	cfg, err = resolve(args.Arguments{Sources: `[{"name":"shop","accessPath":"/logs/shop"}]`}, env.Env{}, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Sources) != 1 || cfg.Sources[0].Name != "shop" {
+		t.Errorf("expected the flag's sources, got %+v", cfg.Sources)
+	}
+}
+
+func TestReadFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent.yaml")
+	if err := os.WriteFile(path, []byte("prot: 9000\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readFile(path); err == nil {
+		t.Error("expected an error for an unknown option")
+	}
+	if _, err := readFile(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+	if file, err := readFile(""); err != nil || file.Port != "" {
+		t.Errorf("expected an empty file without a path, got %+v, %v", file, err)
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	current := Config{Port: "5000", AccessPath: "/logs/a", LogFormat: "$status"}
+	next := current
+	next.AccessPath = "/logs/b"
+	next.LogFormat = "$remote_addr"
+	if changed := RestartRequired(current, next); len(changed) != 0 {
+		t.Errorf("expected paths and format to be reloadable, got %v", changed)
+	}
+
+	next.Port = "8080"
+	next.Guard.RateLimit = 60
+	if changed := RestartRequired(current, next); !slices.Equal(changed, []string{"port", "access control"}) {
+		t.Errorf("got %v, want port and access control", changed)
+	}
+}
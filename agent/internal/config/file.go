@@ -0,0 +1,93 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is the layout of the YAML config file. Options left out are taken from
+// flags, env vars or the defaults.
+type File struct {
+	Port             string   `yaml:"port"`
+	AccessPath       string   `yaml:"accessPath"`
+	ErrorPath        string   `yaml:"errorPath"`
+	LogFormat        string   `yaml:"logFormat"`
+	Sources          []Source `yaml:"sources"`
+	SystemMonitoring *bool    `yaml:"systemMonitoring"`
+	AuthToken        string   `yaml:"authToken"`
+	TokensFile       string   `yaml:"tokensFile"`
+	LocationDB       string   `yaml:"locationDB"`
+	ASNDB            string   `yaml:"asnDB"`
+	ArchiveCacheSize string   `yaml:"archiveCacheSize"`
+
+	AccessInclude []string `yaml:"accessInclude"`
+	AccessExclude []string `yaml:"accessExclude"`
+	ErrorInclude  []string `yaml:"errorInclude"`
+	ErrorExclude  []string `yaml:"errorExclude"`
+	Recursive     *bool    `yaml:"recursive"`
+
+	TLSCert     string `yaml:"tlsCert"`
+	TLSKey      string `yaml:"tlsKey"`
+	TLSClientCA string `yaml:"tlsClientCA"`
+
+	AllowCIDRs      []string `yaml:"allowCIDRs"`
+	DenyCIDRs       []string `yaml:"denyCIDRs"`
+	RateLimit       string   `yaml:"rateLimit"`
+	LockoutAttempts string   `yaml:"lockoutAttempts"`
+	LockoutDuration string   `yaml:"lockoutDuration"`
+
+	AuditLog           string `yaml:"auditLog"`
+	AuditLogMaxSize    string `yaml:"auditLogMaxSize"`
+	AuditLogMaxBackups string `yaml:"auditLogMaxBackups"`
+
+	LogLevel      string `yaml:"logLevel"`
+	LogOutput     string `yaml:"logOutput"`
+	LogJSON       *bool  `yaml:"logJSON"`
+	LogMaxSize    string `yaml:"logMaxSize"`
+	LogMaxBackups string `yaml:"logMaxBackups"`
+
+	PushAddress  string `yaml:"pushAddress"`
+	PushProtocol string `yaml:"pushProtocol"`
+	PushInterval string `yaml:"pushInterval"`
+	PushPrefix   string `yaml:"pushPrefix"`
+
+	OTLPEndpoint      string            `yaml:"otlpEndpoint"`
+	OTLPHeaders       map[string]string `yaml:"otlpHeaders"`
+	OTLPBatchSize     string            `yaml:"otlpBatchSize"`
+	OTLPFlushInterval string            `yaml:"otlpFlushInterval"`
+	OTLPBufferDir     string            `yaml:"otlpBufferDir"`
+	OTLPBufferMaxSize string            `yaml:"otlpBufferMaxSize"`
+
+	SyslogAddress    string `yaml:"syslogAddress"`
+	SyslogDir        string `yaml:"syslogDir"`
+	SyslogMaxSize    string `yaml:"syslogMaxSize"`
+	SyslogMaxBackups string `yaml:"syslogMaxBackups"`
+
+	StoreDir       string `yaml:"storeDir"`
+	StoreRetention string `yaml:"storeRetentionDays"`
+}
+
+// readFile reads the config file at path. An empty path gives an empty file.
+// Unknown options are rejected so that typos aren't silently ignored.
+func readFile(path string) (File, error) {
+	var file File
+	if path == "" {
+		return file, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return file, fmt.Errorf("failed to read config file: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return file, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return file, nil
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDelay groups the several events an editor makes when saving a file
+// into a single reload.
+const reloadDelay = 250 * time.Millisecond
+
+// WatchFile calls changed whenever the file at path is written, created or
+// replaced, until ctx is done. The file's directory is watched so that files
+// replaced by renaming a new file over them are still followed.
+func WatchFile(ctx context.Context, path string, changed func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+		name := filepath.Clean(path)
+		var timer <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == name && event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename) {
+					timer = time.After(reloadDelay)
+				}
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			case <-timer:
+				timer = nil
+				changed()
+			}
+		}
+	}()
+	return nil
+}
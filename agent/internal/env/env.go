@@ -2,32 +2,129 @@ package env
 
 import (
 	"os"
+	"strconv"
 
 	"github.com/joho/godotenv"
 	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
 )
 
 type Env struct {
-	Port             string
-	AccessPath       string
-	ErrorPath        string
-	SystemMonitoring bool
-	AuthToken        string
-	LogFormat        string
+	Port               string
+	AccessPath         string
+	ErrorPath          string
+	SystemMonitoring   *bool
+	AuthToken          string
+	LogFormat          string
+	ArchiveCacheSize   string
+	Sources            string
+	AccessInclude      string
+	AccessExclude      string
+	ErrorInclude       string
+	ErrorExclude       string
+	Recursive          *bool
+	TokensFile         string
+	TLSCert            string
+	TLSKey             string
+	TLSClientCA        string
+	AllowCIDRs         string
+	DenyCIDRs          string
+	RateLimit          string
+	LockoutAttempts    string
+	LockoutDuration    string
+	AuditLog           string
+	AuditLogMaxSize    string
+	AuditLogMaxBackups string
+	LogLevel           string
+	LogOutput          string
+	LogJSON            *bool
+	LogMaxSize         string
+	LogMaxBackups      string
+	ConfigFile         string
+	LocationDB         string
+	ASNDB              string
+	PushAddress        string
+	PushProtocol       string
+	PushInterval       string
+	PushPrefix         string
+	OTLPEndpoint       string
+	OTLPHeaders        string
+	OTLPBatchSize      string
+	OTLPFlushInterval  string
+	OTLPBufferDir      string
+	OTLPBufferMaxSize  string
+	SyslogAddress      string
+	SyslogDir          string
+	SyslogMaxSize      string
+	SyslogMaxBackups   string
+	StoreDir           string
+	StoreRetention     string
 }
 
 func LoadEnv() Env {
 	// Load .env file if present
 	if err := godotenv.Load(); err != nil {
-		logger.Log.Println("No .env file found, using system environment variables")
+		logger.Debug("No .env file found, using system environment variables")
 	}
 
 	return Env{
-		Port:             os.Getenv("PORT"),
-		AccessPath:       os.Getenv("NGINX_ANALYTICS_ACCESS_PATH"),
-		ErrorPath:        os.Getenv("NGINX_ANALYTICS_ERROR_PATH"),
-		SystemMonitoring: os.Getenv("NGINX_ANALYTICS_SYSTEM_MONITORING") == "true",
-		AuthToken:        os.Getenv("NGINX_ANALYTICS_AUTH_TOKEN"),
-		LogFormat:        os.Getenv("NGINX_ANALYTICS_LOG_FORMAT"),
+		Port:               os.Getenv("PORT"),
+		AccessPath:         os.Getenv("NGINX_ANALYTICS_ACCESS_PATH"),
+		ErrorPath:          os.Getenv("NGINX_ANALYTICS_ERROR_PATH"),
+		SystemMonitoring:   lookupBool("NGINX_ANALYTICS_SYSTEM_MONITORING"),
+		AuthToken:          os.Getenv("NGINX_ANALYTICS_AUTH_TOKEN"),
+		LogFormat:          os.Getenv("NGINX_ANALYTICS_LOG_FORMAT"),
+		ArchiveCacheSize:   os.Getenv("NGINX_ANALYTICS_ARCHIVE_CACHE_SIZE"),
+		Sources:            os.Getenv("NGINX_ANALYTICS_SOURCES"),
+		AccessInclude:      os.Getenv("NGINX_ANALYTICS_ACCESS_INCLUDE"),
+		AccessExclude:      os.Getenv("NGINX_ANALYTICS_ACCESS_EXCLUDE"),
+		ErrorInclude:       os.Getenv("NGINX_ANALYTICS_ERROR_INCLUDE"),
+		ErrorExclude:       os.Getenv("NGINX_ANALYTICS_ERROR_EXCLUDE"),
+		Recursive:          lookupBool("NGINX_ANALYTICS_RECURSIVE"),
+		TokensFile:         os.Getenv("NGINX_ANALYTICS_TOKENS_FILE"),
+		TLSCert:            os.Getenv("NGINX_ANALYTICS_TLS_CERT"),
+		TLSKey:             os.Getenv("NGINX_ANALYTICS_TLS_KEY"),
+		TLSClientCA:        os.Getenv("NGINX_ANALYTICS_TLS_CLIENT_CA"),
+		AllowCIDRs:         os.Getenv("NGINX_ANALYTICS_ALLOW_CIDRS"),
+		DenyCIDRs:          os.Getenv("NGINX_ANALYTICS_DENY_CIDRS"),
+		RateLimit:          os.Getenv("NGINX_ANALYTICS_RATE_LIMIT"),
+		LockoutAttempts:    os.Getenv("NGINX_ANALYTICS_LOCKOUT_ATTEMPTS"),
+		LockoutDuration:    os.Getenv("NGINX_ANALYTICS_LOCKOUT_DURATION"),
+		AuditLog:           os.Getenv("NGINX_ANALYTICS_AUDIT_LOG"),
+		AuditLogMaxSize:    os.Getenv("NGINX_ANALYTICS_AUDIT_LOG_MAX_SIZE"),
+		AuditLogMaxBackups: os.Getenv("NGINX_ANALYTICS_AUDIT_LOG_MAX_BACKUPS"),
+		LogLevel:           os.Getenv("NGINX_ANALYTICS_LOG_LEVEL"),
+		LogOutput:          os.Getenv("NGINX_ANALYTICS_LOG_OUTPUT"),
+		LogJSON:            lookupBool("NGINX_ANALYTICS_LOG_JSON"),
+		LogMaxSize:         os.Getenv("NGINX_ANALYTICS_LOG_MAX_SIZE"),
+		LogMaxBackups:      os.Getenv("NGINX_ANALYTICS_LOG_MAX_BACKUPS"),
+		ConfigFile:         os.Getenv("NGINX_ANALYTICS_CONFIG"),
+		LocationDB:         os.Getenv("NGINX_ANALYTICS_LOCATION_DB"),
+		ASNDB:              os.Getenv("NGINX_ANALYTICS_ASN_DB"),
+		PushAddress:        os.Getenv("NGINX_ANALYTICS_PUSH_ADDRESS"),
+		PushProtocol:       os.Getenv("NGINX_ANALYTICS_PUSH_PROTOCOL"),
+		PushInterval:       os.Getenv("NGINX_ANALYTICS_PUSH_INTERVAL"),
+		PushPrefix:         os.Getenv("NGINX_ANALYTICS_PUSH_PREFIX"),
+		OTLPEndpoint:       os.Getenv("NGINX_ANALYTICS_OTLP_ENDPOINT"),
+		OTLPHeaders:        os.Getenv("NGINX_ANALYTICS_OTLP_HEADERS"),
+		OTLPBatchSize:      os.Getenv("NGINX_ANALYTICS_OTLP_BATCH_SIZE"),
+		OTLPFlushInterval:  os.Getenv("NGINX_ANALYTICS_OTLP_FLUSH_INTERVAL"),
+		OTLPBufferDir:      os.Getenv("NGINX_ANALYTICS_OTLP_BUFFER_DIR"),
+		OTLPBufferMaxSize:  os.Getenv("NGINX_ANALYTICS_OTLP_BUFFER_MAX_SIZE"),
+		SyslogAddress:      os.Getenv("NGINX_ANALYTICS_SYSLOG_ADDRESS"),
+		SyslogDir:          os.Getenv("NGINX_ANALYTICS_SYSLOG_DIR"),
+		SyslogMaxSize:      os.Getenv("NGINX_ANALYTICS_SYSLOG_MAX_SIZE"),
+		SyslogMaxBackups:   os.Getenv("NGINX_ANALYTICS_SYSLOG_MAX_BACKUPS"),
+		StoreDir:           os.Getenv("NGINX_ANALYTICS_STORE_DIR"),
+		StoreRetention:     os.Getenv("NGINX_ANALYTICS_STORE_RETENTION_DAYS"),
 	}
 }
+
+// lookupBool returns the value of a true or false env var, or nil if it is
+// unset or invalid.
+func lookupBool(name string) *bool {
+	value, err := strconv.ParseBool(os.Getenv(name))
+	if err != nil {
+		return nil
+	}
+	return &value
+}
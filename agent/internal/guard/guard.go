@@ -0,0 +1,270 @@
+package guard
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrDenied      = errors.New("client address not allowed")
+	ErrRateLimited = errors.New("rate limit exceeded")
+	ErrLockedOut   = errors.New("too many failed auth attempts")
+)
+
+// Config controls which clients may use the API and how often.
+type Config struct {
+	// Allow lists the networks clients must connect from. Every address is
+	// allowed if empty.
+	Allow []netip.Prefix
+	// Deny lists networks that are refused, even if allowed.
+	Deny []netip.Prefix
+	// RateLimit is the number of requests each client may make per minute,
+	// or 0 for no limit. Up to a minute's worth may be made in a burst.
+	RateLimit int
+	// MaxAuthFailures is the number of failed auth attempts within
+	// LockoutDuration that locks a client out for LockoutDuration, or 0 to
+	// never lock clients out.
+	MaxAuthFailures int
+	LockoutDuration time.Duration
+}
+
+// Stats counts the requests rejected by a guard.
+type Stats struct {
+	Denied       uint64 `json:"denied"`
+	RateLimited  uint64 `json:"rateLimited"`
+	LockedOut    uint64 `json:"lockedOut"`
+	AuthFailures uint64 `json:"authFailures"`
+	Lockouts     uint64 `json:"lockouts"`
+}
+
+type client struct {
+	tokens       float64
+	lastRequest  time.Time
+	failures     int
+	firstFailure time.Time
+	lockedUntil  time.Time
+}
+
+// sweepInterval is how often idle clients are forgotten.
+const sweepInterval = time.Minute
+
+// Guard applies a Config to incoming requests, tracking each client by its
+// address.
+type Guard struct {
+	cfg Config
+	now func() time.Time
+
+	mu        sync.Mutex
+	clients   map[netip.Addr]*client
+	lastSweep time.Time
+
+	denied       atomic.Uint64
+	rateLimited  atomic.Uint64
+	lockedOut    atomic.Uint64
+	authFailures atomic.Uint64
+	lockouts     atomic.Uint64
+}
+
+func New(cfg Config) *Guard {
+	return &Guard{cfg: cfg, now: time.Now, clients: make(map[netip.Addr]*client)}
+}
+
+// Check returns an error if the request should be rejected before it is
+// authenticated, because its address is denied, its client is locked out or
+// it exceeds the rate limit.
+func (g *Guard) Check(r *http.Request) error {
+	addr, ok := clientAddr(r)
+	if !ok || !g.allowed(addr) {
+		g.denied.Add(1)
+		return ErrDenied
+	}
+	if g.cfg.RateLimit <= 0 && g.cfg.MaxAuthFailures <= 0 {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	g.sweep(now)
+	c := g.client(addr, now)
+
+	if now.Before(c.lockedUntil) {
+		g.lockedOut.Add(1)
+		return ErrLockedOut
+	}
+
+	if g.cfg.RateLimit > 0 {
+		limit := float64(g.cfg.RateLimit)
+		c.tokens = min(limit, c.tokens+now.Sub(c.lastRequest).Minutes()*limit)
+		c.lastRequest = now
+		if c.tokens < 1 {
+			g.rateLimited.Add(1)
+			return ErrRateLimited
+		}
+		c.tokens--
+	}
+	return nil
+}
+
+// AuthFailed records a failed auth attempt by the request's client, locking
+// it out once it has failed too many times.
+func (g *Guard) AuthFailed(r *http.Request) {
+	g.authFailures.Add(1)
+	addr, ok := clientAddr(r)
+	if !ok || g.cfg.MaxAuthFailures <= 0 {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	c := g.client(addr, now)
+	if c.failures == 0 || now.Sub(c.firstFailure) > g.cfg.LockoutDuration {
+		c.failures = 0
+		c.firstFailure = now
+	}
+	c.failures++
+	if c.failures >= g.cfg.MaxAuthFailures {
+		c.failures = 0
+		c.lockedUntil = now.Add(g.cfg.LockoutDuration)
+		g.lockouts.Add(1)
+	}
+}
+
+// AuthSucceeded clears the failed auth attempts of the request's client.
+func (g *Guard) AuthSucceeded(r *http.Request) {
+	addr, ok := clientAddr(r)
+	if !ok || g.cfg.MaxAuthFailures <= 0 {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if c, ok := g.clients[addr]; ok {
+		c.failures = 0
+	}
+}
+
+// RetryAfter returns how long the request's client must wait before a
+// rejected request may succeed.
+func (g *Guard) RetryAfter(r *http.Request) time.Duration {
+	addr, ok := clientAddr(r)
+	if !ok {
+		return 0
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c, ok := g.clients[addr]
+	if !ok {
+		return 0
+	}
+	now := g.now()
+	if now.Before(c.lockedUntil) {
+		return c.lockedUntil.Sub(now)
+	}
+	if g.cfg.RateLimit > 0 && c.tokens < 1 {
+		return time.Duration((1 - c.tokens) / float64(g.cfg.RateLimit) * float64(time.Minute))
+	}
+	return 0
+}
+
+// Stats returns the number of requests rejected so far.
+func (g *Guard) Stats() Stats {
+	return Stats{
+		Denied:       g.denied.Load(),
+		RateLimited:  g.rateLimited.Load(),
+		LockedOut:    g.lockedOut.Load(),
+		AuthFailures: g.authFailures.Load(),
+		Lockouts:     g.lockouts.Load(),
+	}
+}
+
+func (g *Guard) allowed(addr netip.Addr) bool {
+	for _, prefix := range g.cfg.Deny {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	if len(g.cfg.Allow) == 0 {
+		return true
+	}
+	for _, prefix := range g.cfg.Allow {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// client returns the state of the client at addr, creating it if it's new.
+// Must be called with g.mu held.
+func (g *Guard) client(addr netip.Addr, now time.Time) *client {
+	c, ok := g.clients[addr]
+	if !ok {
+		c = &client{tokens: float64(g.cfg.RateLimit), lastRequest: now}
+		g.clients[addr] = c
+	}
+	return c
+}
+
+// sweep forgets clients that are neither locked out, part way through their
+// failed auth attempts, nor short of their full rate limit. Must be called
+// with g.mu held.
+func (g *Guard) sweep(now time.Time) {
+	if now.Sub(g.lastSweep) < sweepInterval {
+		return
+	}
+	g.lastSweep = now
+	for addr, c := range g.clients {
+		idle := now.Sub(c.lastRequest) >= time.Minute
+		failing := c.failures > 0 && now.Sub(c.firstFailure) <= g.cfg.LockoutDuration
+		if idle && !failing && !now.Before(c.lockedUntil) {
+			delete(g.clients, addr)
+		}
+	}
+}
+
+// clientAddr returns the address the request was made from.
+func clientAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// ParsePrefixes parses a list of CIDR networks. Single addresses are treated
+// as a network containing only that address.
+func ParsePrefixes(values []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %q: %w", value, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", value, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
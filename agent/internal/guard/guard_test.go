@@ -0,0 +1,131 @@
+package guard
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newRequest(remoteAddr string) *http.Request {
+	r := httptest.NewRequest("GET", "/api/status", nil)
+	r.RemoteAddr = remoteAddr
+	return r
+}
+
+func TestCheckNetworks(t *testing.T) {
+	allow, err := ParsePrefixes([]string{"10.0.0.0/8", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deny, err := ParsePrefixes([]string{"10.0.0.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := New(Config{Allow: allow, Deny: deny})
+
+	tests := []struct {
+		remoteAddr string
+		wantErr    error
+	}{
+		{"10.1.2.3:5000", nil},
+		{"[::ffff:10.1.2.3]:5000", nil},
+		{"[2001:db8::1]:5000", nil},
+		{"10.0.0.5:5000", ErrDenied},
+		{"192.168.1.1:5000", ErrDenied},
+		{"not-an-address", ErrDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.remoteAddr, func(t *testing.T) {
+			if err := g.Check(newRequest(tt.remoteAddr)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	if got := g.Stats().Denied; got != 3 {
+		t.Errorf("got %d denied requests, want 3", got)
+	}
+}
+
+func TestCheckRateLimit(t *testing.T) {
+	now := time.Unix(0, 0)
+	g := New(Config{RateLimit: 3})
+	g.now = func() time.Time { return now }
+
+	for i := range 3 {
+		if err := g.Check(newRequest("192.0.2.1:1234")); err != nil {
+			t.Fatalf("request %d: unexpected error %v", i+1, err)
+		}
+	}
+	if err := g.Check(newRequest("192.0.2.1:1234")); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("got error %v, want %v", err, ErrRateLimited)
+	}
+	if retryAfter := g.RetryAfter(newRequest("192.0.2.1:1234")); retryAfter <= 0 || retryAfter > 20*time.Second {
+		t.Errorf("unexpected retry after %s", retryAfter)
+	}
+
+	// Other clients have their own limit
+	if err := g.Check(newRequest("192.0.2.2:1234")); err != nil {
+		t.Errorf("unexpected error for another client: %v", err)
+	}
+
+	// A third of a minute refills one request
+	now = now.Add(20 * time.Second)
+	if err := g.Check(newRequest("192.0.2.1:1234")); err != nil {
+		t.Errorf("unexpected error after waiting: %v", err)
+	}
+	if got := g.Stats().RateLimited; got != 1 {
+		t.Errorf("got %d rate limited requests, want 1", got)
+	}
+}
+
+func TestLockout(t *testing.T) {
+	now := time.Unix(0, 0)
+	g := New(Config{MaxAuthFailures: 3, LockoutDuration: time.Minute})
+	g.now = func() time.Time { return now }
+	r := newRequest("192.0.2.1:1234")
+
+	// A successful attempt clears earlier failures
+	g.AuthFailed(r)
+	g.AuthFailed(r)
+	g.AuthSucceeded(r)
+	g.AuthFailed(r)
+	if err := g.Check(r); err != nil {
+		t.Fatalf("unexpected error before lockout: %v", err)
+	}
+
+	g.AuthFailed(r)
+	g.AuthFailed(r)
+	if err := g.Check(r); !errors.Is(err, ErrLockedOut) {
+		t.Fatalf("got error %v, want %v", err, ErrLockedOut)
+	}
+	if retryAfter := g.RetryAfter(r); retryAfter != time.Minute {
+		t.Errorf("got retry after %s, want %s", retryAfter, time.Minute)
+	}
+
+	now = now.Add(time.Minute)
+	if err := g.Check(r); err != nil {
+		t.Errorf("unexpected error after lockout expired: %v", err)
+	}
+
+	stats := g.Stats()
+	if stats.AuthFailures != 5 || stats.Lockouts != 1 || stats.LockedOut != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes([]string{"192.168.1.7/24", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefixes[0].String() != "192.168.1.0/24" || prefixes[1].String() != "::1/128" {
+		t.Errorf("unexpected prefixes: %v", prefixes)
+	}
+	for _, value := range []string{"10.0.0.0/33", "example.com"} {
+		if _, err := ParsePrefixes([]string{value}); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
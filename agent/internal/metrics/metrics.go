@@ -0,0 +1,343 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logs"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/system"
+)
+
+// ContentType is the media type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// durationBuckets are the upper bounds in seconds of the API request
+// duration histogram.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Methods outside this set are counted as OTHER, so that malformed requests
+// can't create an unbounded number of series.
+var knownMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE"}
+
+type requestKey struct {
+	source      string
+	method      string
+	statusClass string
+}
+
+type errorKey struct {
+	source string
+	level  string
+}
+
+type apiKey struct {
+	route  string
+	method string
+	status int
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Metrics counts the requests and errors written to each source's logs, and
+// the API requests served by the agent. Counts start from zero when the agent
+// starts, and only include log lines written since.
+type Metrics struct {
+	mu        sync.Mutex
+	requests  map[requestKey]uint64
+	bytes     map[string]uint64
+	errors    map[errorKey]uint64
+	api       map[apiKey]uint64
+	durations map[string]*histogram
+}
+
+func New() *Metrics {
+	return &Metrics{
+		requests:  make(map[requestKey]uint64),
+		bytes:     make(map[string]uint64),
+		errors:    make(map[errorKey]uint64),
+		api:       make(map[apiKey]uint64),
+		durations: make(map[string]*histogram),
+	}
+}
+
+// HandleAccess counts the requests in access log lines written to a source.
+func (m *Metrics) HandleAccess(source config.Source, lines []string) {
+	m.ObserveAccess(source.Name, nginx.ParseNginxLogs(lines, source.LogFormat))
+}
+
+// HandleErrors counts the messages in error log lines written to a source.
+func (m *Metrics) HandleErrors(source config.Source, lines []string) {
+	m.ObserveErrors(source.Name, lines)
+}
+
+// ObserveAccess counts parsed access log records written to a source.
+func (m *Metrics) ObserveAccess(source string, records []nginx.NGINXLog) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, record := range records {
+		method := record.Method
+		if !slices.Contains(knownMethods, method) {
+			method = "OTHER"
+		}
+		m.requests[requestKey{source: source, method: method, statusClass: statusClass(record.Status)}]++
+		if record.ResponseSize != nil && *record.ResponseSize > 0 {
+			m.bytes[source] += uint64(*record.ResponseSize)
+		}
+	}
+}
+
+// ObserveErrors counts error log lines written to a source by their level.
+// Continuation lines without a timestamp and level are ignored.
+func (m *Metrics) ObserveErrors(source string, lines []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, line := range lines {
+		if _, level, ok := nginx.ParseErrorPrefix(line); ok {
+			m.errors[errorKey{source: source, level: level}]++
+		}
+	}
+}
+
+// ObserveAPI counts a request served by the agent's API.
+func (m *Metrics) ObserveAPI(route string, method string, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.api[apiKey{route: route, method: method, status: status}]++
+
+	h, ok := m.durations[route]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(durationBuckets))}
+		m.durations[route] = h
+	}
+	seconds := duration.Seconds()
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// Totals are the traffic counts of a source since the agent started.
+type Totals struct {
+	Requests uint64
+	// StatusClasses counts requests by status class, such as 2xx
+	StatusClasses map[string]uint64
+	Bytes         uint64
+}
+
+// Totals returns the traffic counts of the named source.
+func (m *Metrics) Totals(source string) Totals {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	totals := Totals{StatusClasses: make(map[string]uint64), Bytes: m.bytes[source]}
+	for key, count := range m.requests {
+		if key.source == source {
+			totals.Requests += count
+			totals.StatusClasses[key.statusClass] += count
+		}
+	}
+	return totals
+}
+
+func statusClass(status *int) string {
+	if status == nil || *status < 100 || *status > 599 {
+		return "other"
+	}
+	return strconv.Itoa(*status/100) + "xx"
+}
+
+// Write writes every metric for sources in the Prometheus text format. Log
+// file sizes and system resources are only included with system monitoring
+// enabled.
+func (m *Metrics) Write(w io.Writer, sources []config.Source, systemMonitoring bool) error {
+	names := make([]string, len(sources))
+	for i, source := range sources {
+		names[i] = source.Name
+	}
+
+	e := &encoder{}
+	m.writeCounters(e, names)
+	if systemMonitoring {
+		writeLogSizes(e, sources)
+		writeSystem(e)
+	}
+	_, err := io.WriteString(w, e.String())
+	return err
+}
+
+func (m *Metrics) writeCounters(e *encoder, sources []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e.header("nginx_analytics_requests_total", "counter", "Requests written to the access log.")
+	for _, key := range sortedKeys(m.requests, func(a, b requestKey) bool {
+		return a.source+"\x00"+a.method+"\x00"+a.statusClass < b.source+"\x00"+b.method+"\x00"+b.statusClass
+	}) {
+		if slices.Contains(sources, key.source) {
+			e.sample("nginx_analytics_requests_total", labels("source", key.source, "method", key.method, "status", key.statusClass), float64(m.requests[key]))
+		}
+	}
+
+	e.header("nginx_analytics_response_bytes_total", "counter", "Response body bytes sent, from the access log.")
+	for _, source := range sortedKeys(m.bytes, func(a, b string) bool { return a < b }) {
+		if slices.Contains(sources, source) {
+			e.sample("nginx_analytics_response_bytes_total", labels("source", source), float64(m.bytes[source]))
+		}
+	}
+
+	e.header("nginx_analytics_error_log_messages_total", "counter", "Messages written to the error log by level.")
+	for _, key := range sortedKeys(m.errors, func(a, b errorKey) bool {
+		return a.source+"\x00"+a.level < b.source+"\x00"+b.level
+	}) {
+		if slices.Contains(sources, key.source) {
+			e.sample("nginx_analytics_error_log_messages_total", labels("source", key.source, "level", key.level), float64(m.errors[key]))
+		}
+	}
+
+	e.header("nginx_analytics_api_requests_total", "counter", "Requests served by the agent's API.")
+	for _, key := range sortedKeys(m.api, func(a, b apiKey) bool {
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	}) {
+		e.sample("nginx_analytics_api_requests_total", labels("route", key.route, "method", key.method, "code", strconv.Itoa(key.status)), float64(m.api[key]))
+	}
+
+	e.header("nginx_analytics_api_request_duration_seconds", "histogram", "Time taken to serve API requests.")
+	for _, route := range sortedKeys(m.durations, func(a, b string) bool { return a < b }) {
+		h := m.durations[route]
+		for i, bound := range durationBuckets {
+			e.sample("nginx_analytics_api_request_duration_seconds_bucket", labels("route", route, "le", formatFloat(bound)), float64(h.counts[i]))
+		}
+		e.sample("nginx_analytics_api_request_duration_seconds_bucket", labels("route", route, "le", "+Inf"), float64(h.count))
+		e.sample("nginx_analytics_api_request_duration_seconds_sum", labels("route", route), h.sum)
+		e.sample("nginx_analytics_api_request_duration_seconds_count", labels("route", route), float64(h.count))
+	}
+}
+
+// writeLogSizes writes the size of each file in the directories holding the
+// sources' logs.
+func writeLogSizes(e *encoder, sources []config.Source) {
+	e.header("nginx_analytics_log_file_size_bytes", "gauge", "Size of each file in the log directory.")
+	for _, source := range sources {
+		var dirs []string
+		for _, path := range []string{source.AccessLogPath(), source.ErrorLogPath()} {
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				path = filepath.Dir(path)
+			}
+			if !slices.Contains(dirs, path) {
+				dirs = append(dirs, path)
+			}
+		}
+		for _, dir := range dirs {
+			sizes, err := logs.GetLogSizes(dir)
+			if err != nil {
+				logger.Warnf("Failed to read log sizes for metrics: %v", err)
+				continue
+			}
+			for _, file := range sizes.Files {
+				e.sample("nginx_analytics_log_file_size_bytes", labels("source", source.Name, "file", filepath.Join(dir, file.Name)), float64(file.Size))
+			}
+		}
+	}
+}
+
+func writeSystem(e *encoder) {
+	info, err := system.MeasureSystem()
+	if err != nil {
+		logger.Warnf("Failed to measure system resources for metrics: %v", err)
+		return
+	}
+
+	e.header("nginx_analytics_system_uptime_seconds", "gauge", "Time since the host booted.")
+	e.sample("nginx_analytics_system_uptime_seconds", "", float64(info.Uptime))
+	e.header("nginx_analytics_system_cpu_cores", "gauge", "Number of CPU cores.")
+	e.sample("nginx_analytics_system_cpu_cores", "", float64(info.CPU.Cores))
+	e.header("nginx_analytics_system_cpu_usage_percent", "gauge", "CPU usage across every core.")
+	e.sample("nginx_analytics_system_cpu_usage_percent", "", info.CPU.Usage)
+	e.header("nginx_analytics_system_cpu_core_usage_percent", "gauge", "CPU usage of each core.")
+	for i, usage := range info.CPU.CoreUsage {
+		e.sample("nginx_analytics_system_cpu_core_usage_percent", labels("core", strconv.Itoa(i)), usage)
+	}
+
+	e.header("nginx_analytics_system_memory_bytes", "gauge", "Memory by state.")
+	e.sample("nginx_analytics_system_memory_bytes", labels("state", "total"), float64(info.Memory.Total))
+	e.sample("nginx_analytics_system_memory_bytes", labels("state", "used"), float64(info.Memory.Used))
+	e.sample("nginx_analytics_system_memory_bytes", labels("state", "available"), float64(info.Memory.Available))
+	e.sample("nginx_analytics_system_memory_bytes", labels("state", "free"), float64(info.Memory.Free))
+
+	e.header("nginx_analytics_system_disk_size_bytes", "gauge", "Size of each mounted filesystem.")
+	for _, disk := range info.Disk {
+		e.sample("nginx_analytics_system_disk_size_bytes", labels("filesystem", disk.Filesystem, "mountpoint", disk.MountedOn), float64(disk.Size))
+	}
+	e.header("nginx_analytics_system_disk_used_bytes", "gauge", "Space used on each mounted filesystem.")
+	for _, disk := range info.Disk {
+		e.sample("nginx_analytics_system_disk_used_bytes", labels("filesystem", disk.Filesystem, "mountpoint", disk.MountedOn), float64(disk.Used))
+	}
+}
+
+// encoder builds metrics in the Prometheus text exposition format.
+type encoder struct {
+	strings.Builder
+}
+
+func (e *encoder) header(name string, typ string, help string) {
+	fmt.Fprintf(e, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (e *encoder) sample(name string, labels string, value float64) {
+	fmt.Fprintf(e, "%s%s %s\n", name, labels, formatFloat(value))
+}
+
+// labels formats pairs of label names and values, escaping the values.
+func labels(pairs ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[K comparable, V any](m map[K]V, less func(a, b K) bool) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+	return keys
+}
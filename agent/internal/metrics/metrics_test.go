@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
+)
+
+func intPtr(v int) *int { return &v }
+
+func render(t *testing.T, m *Metrics, sources []config.Source) string {
+	t.Helper()
+	var b strings.Builder
+	if err := m.Write(&b, sources, false); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestWrite(t *testing.T) {
+	m := New()
+	m.ObserveAccess("api", []nginx.NGINXLog{
+		{Method: "GET", Status: intPtr(200), ResponseSize: intPtr(100)},
+		{Method: "GET", Status: intPtr(204)},
+		{Method: "\x16\x03", Status: intPtr(400), ResponseSize: intPtr(50)},
+	})
+	m.ObserveAccess("web", []nginx.NGINXLog{{Method: "POST", Status: intPtr(500)}})
+	m.ObserveErrors("api", []string{
+		"2024/01/01 12:00:00 [error] 1#1: *1 open() failed",
+		"2024/01/01 12:00:01 [warn] 1#1: upstream response buffered",
+		"continuation without a level",
+	})
+	m.ObserveAPI("/api/logs/access", "GET", 200, 30*time.Millisecond)
+
+	got := render(t, m, []config.Source{{Name: "api"}})
+	for _, want := range []string{
+		"# TYPE nginx_analytics_requests_total counter\n",
+		`nginx_analytics_requests_total{source="api",method="GET",status="2xx"} 2`,
+		`nginx_analytics_requests_total{source="api",method="OTHER",status="4xx"} 1`,
+		`nginx_analytics_response_bytes_total{source="api"} 150`,
+		`nginx_analytics_error_log_messages_total{source="api",level="error"} 1`,
+		`nginx_analytics_error_log_messages_total{source="api",level="warn"} 1`,
+		`nginx_analytics_api_requests_total{route="/api/logs/access",method="GET",code="200"} 1`,
+		`nginx_analytics_api_request_duration_seconds_bucket{route="/api/logs/access",le="0.025"} 0`,
+		`nginx_analytics_api_request_duration_seconds_bucket{route="/api/logs/access",le="0.05"} 1`,
+		`nginx_analytics_api_request_duration_seconds_bucket{route="/api/logs/access",le="+Inf"} 1`,
+		`nginx_analytics_api_request_duration_seconds_count{route="/api/logs/access"} 1`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+	if strings.Contains(got, `source="web"`) {
+		t.Error("expected metrics for unlisted sources to be left out")
+	}
+}
+
+func TestLabelsEscaped(t *testing.T) {
+	if got, want := labels("file", "a\"b\\c\nd"), `{file="a\"b\\c\nd"}`; got != want {
+		t.Errorf("labels() = %s, want %s", got, want)
+	}
+}
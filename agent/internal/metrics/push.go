@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
+)
+
+const pushTimeout = 5 * time.Second
+
+// pushedClasses are the status classes pushed for every source, including
+// those without requests, so that each series is continuous.
+var pushedClasses = []string{"1xx", "2xx", "3xx", "4xx", "5xx"}
+
+// Pusher periodically sends the traffic of each source over the last interval
+// to a StatsD or Graphite server.
+type Pusher struct {
+	cfg      config.Push
+	metrics  *Metrics
+	previous map[string]Totals
+	last     time.Time
+	now      func() time.Time
+}
+
+func NewPusher(cfg config.Push, m *Metrics) *Pusher {
+	return &Pusher{
+		cfg:      cfg,
+		metrics:  m,
+		previous: make(map[string]Totals),
+		last:     time.Now(),
+		now:      time.Now,
+	}
+}
+
+// Run pushes metrics for the sources returned by sources every interval until
+// ctx is cancelled. Failed pushes are logged and retried at the next
+// interval.
+func (p *Pusher) Run(ctx context.Context, sources func() []config.Source) {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Push(sources()); err != nil {
+				logger.Warnf("Failed to push metrics to %s: %v", p.cfg.Address, err)
+			}
+		}
+	}
+}
+
+// Push sends the request rate, request counts by status class, success rate
+// and bytes served of each source since the previous push.
+func (p *Pusher) Push(sources []config.Source) error {
+	now := p.now()
+	elapsed := now.Sub(p.last).Seconds()
+	p.last = now
+
+	var payloads []string
+	for _, source := range sources {
+		totals := p.metrics.Totals(source.Name)
+		previous := p.previous[source.Name]
+		p.previous[source.Name] = totals
+		payloads = append(payloads, p.format(source, delta(totals, previous), elapsed, now))
+	}
+	if len(payloads) == 0 {
+		return nil
+	}
+
+	network := "udp"
+	if p.cfg.Protocol == config.PushGraphite {
+		network = "tcp"
+	}
+	conn, err := net.DialTimeout(network, p.cfg.Address, pushTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(pushTimeout))
+
+	// Each source is written separately to keep UDP datagrams small
+	for _, payload := range payloads {
+		if _, err := conn.Write([]byte(payload)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delta returns the traffic counted between two totals.
+func delta(current, previous Totals) Totals {
+	d := Totals{
+		Requests:      current.Requests - previous.Requests,
+		StatusClasses: make(map[string]uint64, len(current.StatusClasses)),
+		Bytes:         current.Bytes - previous.Bytes,
+	}
+	for class, count := range current.StatusClasses {
+		d.StatusClasses[class] = count - previous.StatusClasses[class]
+	}
+	return d
+}
+
+func (p *Pusher) format(source config.Source, traffic Totals, elapsed float64, now time.Time) string {
+	tags := map[string]string{"source": source.Name}
+	for key, value := range source.Tags {
+		tags[key] = value
+	}
+
+	var b strings.Builder
+	write := func(name string, value float64, statsdType string) {
+		name = p.cfg.Prefix + "." + name
+		if p.cfg.Protocol == config.PushGraphite {
+			fmt.Fprintf(&b, "%s%s %s %d\n", sanitize(name), graphiteTags(tags), formatFloat(value), now.Unix())
+		} else {
+			fmt.Fprintf(&b, "%s:%s|%s%s\n", sanitize(name), formatFloat(value), statsdType, statsdTags(tags))
+		}
+	}
+
+	write("requests", float64(traffic.Requests), "c")
+	if elapsed > 0 {
+		write("request_rate", float64(traffic.Requests)/elapsed, "g")
+	}
+	for _, class := range pushedClasses {
+		write("status."+class, float64(traffic.StatusClasses[class]), "c")
+	}
+	if traffic.Requests > 0 {
+		successful := traffic.StatusClasses["1xx"] + traffic.StatusClasses["2xx"] + traffic.StatusClasses["3xx"]
+		write("success_rate", 100*float64(successful)/float64(traffic.Requests), "g")
+	}
+	write("bytes", float64(traffic.Bytes), "c")
+	return b.String()
+}
+
+// statsdTags formats tags in the DogStatsD extension to StatsD.
+func statsdTags(tags map[string]string) string {
+	var pairs []string
+	for _, key := range sortedTagKeys(tags) {
+		pairs = append(pairs, sanitize(key)+":"+sanitize(tags[key]))
+	}
+	return "|#" + strings.Join(pairs, ",")
+}
+
+// graphiteTags formats tags for Graphite's tagged series.
+func graphiteTags(tags map[string]string) string {
+	var b strings.Builder
+	for _, key := range sortedTagKeys(tags) {
+		b.WriteString(";" + sanitize(key) + "=" + sanitize(tags[key]))
+	}
+	return b.String()
+}
+
+func sortedTagKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// tagEscaper replaces the characters that separate names, tags and values in
+// either protocol.
+var tagEscaper = strings.NewReplacer(" ", "_", "\t", "_", "\n", "_", ":", "_", "|", "_", "#", "_", ",", "_", ";", "_", "=", "_", "~", "_")
+
+func sanitize(value string) string {
+	return tagEscaper.Replace(value)
+}
@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
+)
+
+func newTestPusher(cfg config.Push, m *Metrics) (*Pusher, *time.Time) {
+	p := NewPusher(cfg, m)
+	now := time.Unix(1700000000, 0)
+	p.last = now
+	p.now = func() time.Time { return now }
+	return p, &now
+}
+
+func TestPushStatsD(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	m := New()
+	p, now := newTestPusher(config.Push{Address: conn.LocalAddr().String(), Protocol: config.PushStatsD, Prefix: "nginx"}, m)
+	sources := []config.Source{{Name: "api", Tags: map[string]string{"env": "prod"}}}
+
+	m.ObserveAccess("api", []nginx.NGINXLog{
+		{Method: "GET", Status: intPtr(200), ResponseSize: intPtr(300)},
+		{Method: "GET", Status: intPtr(200), ResponseSize: intPtr(100)},
+		{Method: "GET", Status: intPtr(302)},
+		{Method: "GET", Status: intPtr(503)},
+	})
+	*now = now.Add(2 * time.Second)
+	if err := p.Push(sources); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(buf[:n])
+	for _, want := range []string{
+		"nginx.requests:4|c|#env:prod,source:api\n",
+		"nginx.request_rate:2|g|#env:prod,source:api\n",
+		"nginx.status.2xx:2|c|#env:prod,source:api\n",
+		"nginx.status.4xx:0|c|#env:prod,source:api\n",
+		"nginx.success_rate:75|g|#env:prod,source:api\n",
+		"nginx.bytes:400|c|#env:prod,source:api\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("payload missing %q:\n%s", want, got)
+		}
+	}
+
+	// Only the traffic since the previous push is sent
+	m.ObserveAccess("api", []nginx.NGINXLog{{Method: "GET", Status: intPtr(404), ResponseSize: intPtr(10)}})
+	*now = now.Add(time.Second)
+	if err := p.Push(sources); err != nil {
+		t.Fatal(err)
+	}
+	n, _, err = conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = string(buf[:n])
+	for _, want := range []string{"nginx.requests:1|c", "nginx.status.2xx:0|c", "nginx.success_rate:0|g", "nginx.bytes:10|c"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("payload missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestPushGraphite(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	m := New()
+	p, now := newTestPusher(config.Push{Address: listener.Addr().String(), Protocol: config.PushGraphite, Prefix: "web"}, m)
+	m.ObserveAccess("my site", []nginx.NGINXLog{{Method: "GET", Status: intPtr(200), ResponseSize: intPtr(5)}})
+	*now = now.Add(10 * time.Second)
+	if err := p.Push([]config.Source{{Name: "my site"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-received:
+		for _, want := range []string{
+			"web.requests;source=my_site 1 1700000010\n",
+			"web.request_rate;source=my_site 0.1 1700000010\n",
+			"web.success_rate;source=my_site 100 1700000010\n",
+			"web.bytes;source=my_site 5 1700000010\n",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("payload missing %q:\n%s", want, got)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for metrics")
+	}
+}
@@ -0,0 +1,134 @@
+package otlp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const batchExt = ".json"
+
+// buffer stores encoded batches as files in a directory until they are
+// exported. File names sort in the order the batches were added.
+type buffer struct {
+	dir     string
+	maxSize int64
+
+	mu  sync.Mutex
+	seq int
+}
+
+// openBuffer opens the buffer in dir, creating the directory if needed.
+// Batches left from a previous run are kept to be exported.
+func openBuffer(dir string, maxSize int64) (*buffer, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create OTLP buffer: %w", err)
+	}
+	// Remove batches that were being written when the agent stopped
+	if matches, err := filepath.Glob(filepath.Join(dir, "*.tmp")); err == nil {
+		for _, match := range matches {
+			os.Remove(match)
+		}
+	}
+	return &buffer{dir: dir, maxSize: maxSize}, nil
+}
+
+// add writes a batch to the buffer, then drops the oldest batches until the
+// buffer fits within its maximum size. It returns the number of batches
+// dropped.
+func (b *buffer) add(data []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	name := fmt.Sprintf("%020d-%06d%s", time.Now().UnixNano(), b.seq%1000000, batchExt)
+	tmp := filepath.Join(b.dir, name+".tmp")
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	// Rename so that a batch is never read before it is complete
+	if err := os.Rename(tmp, filepath.Join(b.dir, name)); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return b.trim()
+}
+
+// trim drops the oldest batches while the buffer is over its maximum size.
+// Must be called with b.mu held.
+func (b *buffer) trim() (int, error) {
+	names, sizes, err := b.list()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, size := range sizes {
+		total += size
+	}
+	dropped := 0
+	// The newest batch is always kept
+	for i := 0; total > b.maxSize && i < len(names)-1; i++ {
+		if err := os.Remove(filepath.Join(b.dir, names[i])); err != nil && !os.IsNotExist(err) {
+			return dropped, err
+		}
+		total -= sizes[i]
+		dropped++
+	}
+	return dropped, nil
+}
+
+// list returns the names of the buffered batches, oldest first, and their
+// sizes.
+func (b *buffer) list() ([]string, []int64, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), batchExt) {
+			names = append(names, entry.Name())
+		}
+	}
+	slices.Sort(names)
+
+	sizes := make([]int64, len(names))
+	for i, name := range names {
+		if info, err := os.Stat(filepath.Join(b.dir, name)); err == nil {
+			sizes[i] = info.Size()
+		}
+	}
+	return names, sizes, nil
+}
+
+// oldest returns the name and content of the oldest batch, or false if the
+// buffer is empty.
+func (b *buffer) oldest() (string, []byte, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	names, _, err := b.list()
+	if err != nil || len(names) == 0 {
+		return "", nil, false, err
+	}
+	data, err := os.ReadFile(filepath.Join(b.dir, names[0]))
+	if err != nil {
+		return "", nil, false, err
+	}
+	return names[0], data, true, nil
+}
+
+// remove deletes an exported batch.
+func (b *buffer) remove(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := os.Remove(filepath.Join(b.dir, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
+)
+
+const (
+	scopeName   = "nginx-analytics-agent"
+	serviceName = "nginx"
+
+	exportTimeout = 30 * time.Second
+	minBackoff    = time.Second
+	maxBackoff    = time.Minute
+)
+
+// Exporter sends the lines written to each source's logs to an OpenTelemetry
+// collector as OTLP log records. Records are collected into batches, which
+// are written to a disk buffer and removed once the collector accepts them,
+// so that they survive collector outages and agent restarts.
+type Exporter struct {
+	cfg      config.OTLP
+	client   *http.Client
+	buffer   *buffer
+	resource resource
+
+	mu      sync.Mutex
+	pending []logRecord
+
+	// full signals that a batch's worth of records is pending
+	full chan struct{}
+	// queued signals that a batch has been added to the buffer
+	queued chan struct{}
+}
+
+// New opens the exporter's buffer, ready to export any batches left from a
+// previous run.
+func New(cfg config.OTLP) (*Exporter, error) {
+	buf, err := openBuffer(cfg.BufferDir, cfg.MaxBufferSize)
+	if err != nil {
+		return nil, err
+	}
+	attributes := []keyValue{stringAttr("service.name", serviceName)}
+	if hostname, err := os.Hostname(); err == nil {
+		attributes = append(attributes, stringAttr("host.name", hostname))
+	}
+	return &Exporter{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: exportTimeout},
+		buffer:   buf,
+		resource: resource{Attributes: attributes},
+		full:     make(chan struct{}, 1),
+		queued:   make(chan struct{}, 1),
+	}, nil
+}
+
+// HandleAccess queues access log lines written to a source for export.
+func (e *Exporter) HandleAccess(source config.Source, lines []string) {
+	now := time.Now()
+	records := make([]logRecord, len(lines))
+	for i, line := range lines {
+		records[i] = accessRecord(source, line, now)
+	}
+	e.add(records)
+}
+
+// HandleErrors queues error log lines written to a source for export.
+func (e *Exporter) HandleErrors(source config.Source, lines []string) {
+	now := time.Now()
+	records := make([]logRecord, len(lines))
+	for i, line := range lines {
+		records[i] = errorRecord(source, line, now)
+	}
+	e.add(records)
+}
+
+func (e *Exporter) add(records []logRecord) {
+	e.mu.Lock()
+	e.pending = append(e.pending, records...)
+	full := len(e.pending) >= e.cfg.BatchSize
+	e.mu.Unlock()
+	if full {
+		signal(e.full)
+	}
+}
+
+// Run batches pending records and exports buffered batches until ctx is
+// cancelled.
+func (e *Exporter) Run(ctx context.Context) {
+	go e.send(ctx)
+
+	ticker := time.NewTicker(e.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-e.full:
+		}
+		if err := e.Flush(); err != nil {
+			logger.Errorf("Failed to buffer OTLP logs: %v", err)
+		}
+	}
+}
+
+// Flush writes the pending records to the buffer in batches.
+func (e *Exporter) Flush() error {
+	e.mu.Lock()
+	pending := e.pending
+	e.pending = nil
+	e.mu.Unlock()
+
+	for len(pending) > 0 {
+		n := min(len(pending), e.cfg.BatchSize)
+		data, err := json.Marshal(e.request(pending[:n]))
+		if err != nil {
+			return err
+		}
+		dropped, err := e.buffer.add(data)
+		if err != nil {
+			return err
+		}
+		if dropped > 0 {
+			logger.Warnf("OTLP buffer full, dropped the %d oldest batches", dropped)
+		}
+		pending = pending[n:]
+		signal(e.queued)
+	}
+	return nil
+}
+
+// Close writes any pending records to the buffer, to be exported when the
+// agent next runs if they can't be sent before then.
+func (e *Exporter) Close() error {
+	return e.Flush()
+}
+
+func (e *Exporter) request(records []logRecord) exportRequest {
+	return exportRequest{ResourceLogs: []resourceLogs{{
+		Resource: e.resource,
+		ScopeLogs: []scopeLogs{{
+			Scope:      scope{Name: scopeName},
+			LogRecords: records,
+		}},
+	}}}
+}
+
+// send exports buffered batches, oldest first, retrying with exponential
+// backoff while the collector is unavailable.
+func (e *Exporter) send(ctx context.Context) {
+	backoff := minBackoff
+	for {
+		name, data, ok, err := e.buffer.oldest()
+		if err != nil {
+			logger.Errorf("Failed to read OTLP buffer: %v", err)
+		}
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-e.queued:
+				continue
+			case <-time.After(maxBackoff):
+				continue
+			}
+		}
+
+		wait, err := e.export(ctx, data)
+		switch {
+		case err == nil:
+			backoff = minBackoff
+		case wait < 0:
+			// The collector rejected the batch, so retrying won't help
+			logger.Errorf("Dropping OTLP batch rejected by collector: %v", err)
+		default:
+			logger.Warnf("Failed to export OTLP logs, retrying in %s: %v", max(wait, backoff), err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(max(wait, backoff)):
+			}
+			backoff = min(2*backoff, maxBackoff)
+			continue
+		}
+		if err := e.buffer.remove(name); err != nil {
+			logger.Errorf("Failed to remove exported OTLP batch: %v", err)
+		}
+	}
+}
+
+// export sends a batch to the collector. On failure, it returns how long the
+// collector asked to wait before retrying, or a negative duration if the
+// batch shouldn't be retried.
+func (e *Exporter) export(ctx context.Context, data []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.Endpoint, bytes.NewReader(data))
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return 0, nil
+	}
+	err = fmt.Errorf("collector responded %s: %s", resp.Status, bytes.TrimSpace(body))
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return time.Duration(seconds) * time.Second, err
+	default:
+		return -1, err
+	}
+}
+
+// signal notifies a channel without blocking, coalescing repeated signals.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,249 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+)
+
+var testSource = config.Source{
+	Name:      "api",
+	LogFormat: config.DefaultConfig.LogFormat,
+}
+
+func attributes(record logRecord) map[string]string {
+	attrs := make(map[string]string)
+	for _, kv := range record.Attributes {
+		switch {
+		case kv.Value.StringValue != nil:
+			attrs[kv.Key] = *kv.Value.StringValue
+		case kv.Value.IntValue != nil:
+			attrs[kv.Key] = *kv.Value.IntValue
+		}
+	}
+	return attrs
+}
+
+func TestAccessRecord(t *testing.T) {
+	line := `192.168.1.1 - - [01/Jan/2024:12:00:00 +0000] "GET /api/users?page=2 HTTP/1.1" 503 1234 "-" "Mozilla/5.0"`
+	record := accessRecord(testSource, line, time.Now())
+
+	if *record.Body.StringValue != line {
+		t.Errorf("body = %q, want the raw line", *record.Body.StringValue)
+	}
+	if record.TimeUnixNano != "1704110400000000000" {
+		t.Errorf("timeUnixNano = %s", record.TimeUnixNano)
+	}
+	if record.SeverityNumber != severityError {
+		t.Errorf("severityNumber = %d, want %d", record.SeverityNumber, severityError)
+	}
+	want := map[string]string{
+		"nginx.source":              "api",
+		"nginx.log.type":            "access",
+		"http.request.method":       "GET",
+		"url.path":                  "/api/users",
+		"url.query":                 "page=2",
+		"http.response.status_code": "503",
+		"client.address":            "192.168.1.1",
+		"user_agent.original":       "Mozilla/5.0",
+		"network.protocol.version":  "1.1",
+		"http.response.body.size":   "1234",
+	}
+	got := attributes(record)
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("attribute %s = %q, want %q", key, got[key], value)
+		}
+	}
+
+	unparsed := accessRecord(testSource, "not an access log line", time.Now())
+	if unparsed.SeverityNumber != 0 || len(unparsed.Attributes) != 2 {
+		t.Errorf("expected an unparsed line to be sent with only its body, got %+v", unparsed)
+	}
+}
+
+func TestErrorRecord(t *testing.T) {
+	line := `2024/01/15 10:30:45 [crit] 12345#0: *1 connect() failed (111: Connection refused), client: 10.0.0.1, server: example.com, request: "POST /login HTTP/1.1", host: "example.com"`
+	record := errorRecord(testSource, line, time.Now())
+
+	if record.SeverityNumber != severityError2 || record.SeverityText != "crit" {
+		t.Errorf("severity = %d %s, want %d crit", record.SeverityNumber, record.SeverityText, severityError2)
+	}
+	want, _ := time.ParseInLocation("2006/01/02 15:04:05", "2024/01/15 10:30:45", time.Local)
+	if record.TimeUnixNano != unixNano(want) {
+		t.Errorf("timeUnixNano = %s, want %s", record.TimeUnixNano, unixNano(want))
+	}
+	got := attributes(record)
+	if got["client.address"] != "10.0.0.1" || got["http.request.method"] != "POST" || got["url.path"] != "/login" {
+		t.Errorf("unexpected attributes: %v", got)
+	}
+}
+
+func newTestExporter(t *testing.T, endpoint string) *Exporter {
+	t.Helper()
+	e, err := New(config.OTLP{
+		Endpoint:      endpoint,
+		Headers:       map[string]string{"Authorization": "Bearer secret"},
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+		BufferDir:     filepath.Join(t.TempDir(), "buffer"),
+		MaxBufferSize: 1024 * 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func bufferedBatches(t *testing.T, e *Exporter) int {
+	t.Helper()
+	names, _, err := e.buffer.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(names)
+}
+
+func TestExportRetries(t *testing.T) {
+	var attempts atomic.Int32
+	received := make(chan exportRequest, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+		// The collector is unavailable for the first attempt
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req exportRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("invalid export request: %v", err)
+		}
+		received <- req
+	}))
+	defer server.Close()
+
+	e := newTestExporter(t, server.URL+"/v1/logs")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+
+	// A full batch is flushed without waiting for the flush interval
+	e.HandleAccess(testSource, []string{"first", "second", "third"})
+
+	select {
+	case req := <-received:
+		records := req.ResourceLogs[0].ScopeLogs[0].LogRecords
+		if len(records) != 2 || *records[0].Body.StringValue != "first" {
+			t.Errorf("unexpected first batch: %+v", records)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the batch to be retried")
+	}
+	if attempts.Load() < 2 {
+		t.Error("expected the batch to be retried")
+	}
+
+	// Records short of a batch are exported once flushed
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case req := <-received:
+		if records := req.ResourceLogs[0].ScopeLogs[0].LogRecords; len(records) != 1 || *records[0].Body.StringValue != "third" {
+			t.Errorf("unexpected second batch: %+v", records)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the flushed batch")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for bufferedBatches(t, e) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected exported batches to be removed from the buffer")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestExportRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	e := newTestExporter(t, server.URL)
+	wait, err := e.export(context.Background(), []byte(`{}`))
+	if err == nil || wait >= 0 {
+		t.Errorf("expected a rejected batch not to be retried, got %s, %v", wait, err)
+	}
+}
+
+func TestBufferSurvivesRestart(t *testing.T) {
+	e := newTestExporter(t, "http://127.0.0.1:1/v1/logs")
+	e.HandleErrors(testSource, []string{"2024/01/15 10:30:45 [error] 1#0: *1 failed"})
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := openBuffer(e.cfg.BufferDir, e.cfg.MaxBufferSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, data, ok, err := reopened.oldest()
+	if err != nil || !ok {
+		t.Fatalf("expected the batch to be kept, got %v, %v", ok, err)
+	}
+	var req exportRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		t.Fatal(err)
+	}
+	if records := req.ResourceLogs[0].ScopeLogs[0].LogRecords; len(records) != 1 || records[0].SeverityText != "error" {
+		t.Errorf("unexpected buffered batch: %+v", records)
+	}
+}
+
+func TestBufferTrim(t *testing.T) {
+	dir := t.TempDir()
+	b, err := openBuffer(dir, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "partial.json.tmp"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, batch := range []string{"0123456789", "abcdefghij", "ABCDEFGHIJ"} {
+		if _, err := b.add([]byte(batch)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names, _, err := b.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 {
+		t.Fatalf("got %d batches, want the 2 newest", len(names))
+	}
+	if _, data, _, _ := b.oldest(); string(data) != "abcdefghij" {
+		t.Errorf("oldest batch = %q, want the oldest to be dropped", data)
+	}
+
+	if _, err := openBuffer(dir, 25); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "partial.json.tmp")); !os.IsNotExist(err) {
+		t.Error("expected partly written batches to be removed")
+	}
+}
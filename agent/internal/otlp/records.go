@@ -0,0 +1,178 @@
+package otlp
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
+)
+
+// The types below follow the JSON encoding of the OTLP logs protocol, in
+// which 64-bit integers are written as strings.
+
+type exportRequest struct {
+	ResourceLogs []resourceLogs `json:"resourceLogs"`
+}
+
+type resourceLogs struct {
+	Resource  resource    `json:"resource"`
+	ScopeLogs []scopeLogs `json:"scopeLogs"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeLogs struct {
+	Scope      scope       `json:"scope"`
+	LogRecords []logRecord `json:"logRecords"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type logRecord struct {
+	TimeUnixNano         string     `json:"timeUnixNano,omitempty"`
+	ObservedTimeUnixNano string     `json:"observedTimeUnixNano"`
+	SeverityNumber       int        `json:"severityNumber,omitempty"`
+	SeverityText         string     `json:"severityText,omitempty"`
+	Body                 anyValue   `json:"body"`
+	Attributes           []keyValue `json:"attributes,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+func stringValue(value string) anyValue {
+	return anyValue{StringValue: &value}
+}
+
+func stringAttr(key string, value string) keyValue {
+	return keyValue{Key: key, Value: stringValue(value)}
+}
+
+func intAttr(key string, value int) keyValue {
+	s := strconv.Itoa(value)
+	return keyValue{Key: key, Value: anyValue{IntValue: &s}}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// Severity numbers from the OpenTelemetry log data model
+const (
+	severityDebug  = 5
+	severityInfo   = 9
+	severityInfo2  = 10
+	severityWarn   = 13
+	severityError  = 17
+	severityError2 = 18
+	severityError3 = 19
+	severityFatal  = 21
+)
+
+var errorSeverities = map[string]int{
+	"debug":  severityDebug,
+	"info":   severityInfo,
+	"notice": severityInfo2,
+	"warn":   severityWarn,
+	"error":  severityError,
+	"crit":   severityError2,
+	"alert":  severityError3,
+	"emerg":  severityFatal,
+}
+
+// accessRecord converts an access log line to a log record, with the fields
+// parsed by the source's log format mapped to semantic convention attributes.
+// Lines that don't match the format are sent with only their body.
+func accessRecord(source config.Source, line string, observed time.Time) logRecord {
+	record := logRecord{
+		ObservedTimeUnixNano: unixNano(observed),
+		Body:                 stringValue(line),
+		Attributes:           []keyValue{stringAttr("nginx.source", source.Name), stringAttr("nginx.log.type", "access")},
+	}
+
+	parsed := nginx.ParseNginxLogs([]string{line}, source.LogFormat)
+	if len(parsed) == 0 {
+		return record
+	}
+	entry := parsed[0]
+	if entry.Timestamp != nil {
+		record.TimeUnixNano = unixNano(*entry.Timestamp)
+	}
+	record.SeverityNumber, record.SeverityText = severityInfo, "INFO"
+	if entry.Status != nil {
+		record.Attributes = append(record.Attributes, intAttr("http.response.status_code", *entry.Status))
+		switch {
+		case *entry.Status >= 500:
+			record.SeverityNumber, record.SeverityText = severityError, "ERROR"
+		case *entry.Status >= 400:
+			record.SeverityNumber, record.SeverityText = severityWarn, "WARN"
+		}
+	}
+	if entry.Method != "" {
+		record.Attributes = append(record.Attributes, stringAttr("http.request.method", entry.Method))
+	}
+	if entry.Path != "" {
+		path, query, hasQuery := strings.Cut(entry.Path, "?")
+		record.Attributes = append(record.Attributes, stringAttr("url.path", path))
+		if hasQuery {
+			record.Attributes = append(record.Attributes, stringAttr("url.query", query))
+		}
+	}
+	if version, ok := strings.CutPrefix(entry.HTTPVersion, "HTTP/"); ok {
+		record.Attributes = append(record.Attributes, stringAttr("network.protocol.version", version))
+	}
+	if entry.IPAddress != "" {
+		record.Attributes = append(record.Attributes, stringAttr("client.address", entry.IPAddress))
+	}
+	if entry.UserAgent != "" && entry.UserAgent != "-" {
+		record.Attributes = append(record.Attributes, stringAttr("user_agent.original", entry.UserAgent))
+	}
+	if entry.ResponseSize != nil {
+		record.Attributes = append(record.Attributes, intAttr("http.response.body.size", *entry.ResponseSize))
+	}
+	return record
+}
+
+// errorRecord converts an error log line to a log record, with its level as
+// the severity. The client and request that caused the error are included as
+// attributes when nginx logged them.
+func errorRecord(source config.Source, line string, observed time.Time) logRecord {
+	record := logRecord{
+		ObservedTimeUnixNano: unixNano(observed),
+		Body:                 stringValue(line),
+		Attributes:           []keyValue{stringAttr("nginx.source", source.Name), stringAttr("nginx.log.type", "error")},
+	}
+
+	entry, ok := nginx.ParseNginxError(line)
+	if !ok {
+		return record
+	}
+	record.TimeUnixNano = unixNano(entry.Timestamp)
+	record.SeverityNumber, record.SeverityText = errorSeverities[entry.Level], entry.Level
+
+	if entry.ClientAddress != nil {
+		record.Attributes = append(record.Attributes, stringAttr("client.address", *entry.ClientAddress))
+	}
+	if entry.Request != nil {
+		method, rest, _ := strings.Cut(*entry.Request, " ")
+		target, _, _ := strings.Cut(rest, " ")
+		if method != "" && target != "" {
+			path, _, _ := strings.Cut(target, "?")
+			record.Attributes = append(record.Attributes, stringAttr("http.request.method", method), stringAttr("url.path", path))
+		}
+	}
+	return record
+}
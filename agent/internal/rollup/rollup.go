@@ -0,0 +1,289 @@
+package rollup
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/internal/store"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/location"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logs"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
+)
+
+const (
+	// RawWindow is how far back statistics are computed from the logs
+	// themselves rather than from rollups
+	RawWindow = time.Hour
+	// pruneInterval is how often rollups past their tier's retention are
+	// removed
+	pruneInterval = 5 * time.Minute
+	// maxBuildBytes caps the log lines held in memory while building
+	maxBuildBytes = 4 * 1024 * 1024
+)
+
+// tier is a granularity that rollups are kept at.
+type tier struct {
+	slot time.Duration
+	// retention is how long rollups are kept for, or zero to keep them
+	// forever
+	retention time.Duration
+	// capacity is the number of entries each top-N list keeps
+	capacity int
+}
+
+// tiers are ordered from finest to coarsest. Coarser tiers hold fewer
+// rollups, so can keep them for longer with longer top-N lists.
+var tiers = []tier{
+	{slot: time.Minute, retention: 25 * time.Hour, capacity: 25},
+	{slot: time.Hour, retention: 32 * 24 * time.Hour, capacity: 100},
+	{slot: 24 * time.Hour, capacity: 4 * stats.DefaultLimit},
+}
+
+// Rollups keeps minute, hourly and daily rollups of each source's access
+// logs, so that statistics over long ranges can be summarized without
+// reading every request. New lines are added as they are written, and the
+// logs that already exist are added by Build.
+type Rollups struct {
+	mu       sync.RWMutex
+	sources  map[string][]map[time.Time]*stats.Rollup
+	ready    map[string]bool
+	building map[string]bool
+}
+
+func New() *Rollups {
+	return &Rollups{
+		sources:  make(map[string][]map[time.Time]*stats.Rollup),
+		ready:    make(map[string]bool),
+		building: make(map[string]bool),
+	}
+}
+
+// HandleAccess adds access log lines written to a source to its rollups.
+func (r *Rollups) HandleAccess(source config.Source, lines []string) {
+	r.add(source.Name, nginx.ParseNginxLogs(lines, source.LogFormat), time.Time{})
+}
+
+// HandleErrors ignores error log lines, which aren't rolled up.
+func (r *Rollups) HandleErrors(source config.Source, lines []string) {}
+
+// add adds logs to a source's rollups, skipping any logged after cutoff
+// unless it is zero. Locations are resolved before the lock is taken, so
+// that slow lookups don't hold up readers.
+func (r *Rollups) add(source string, records []nginx.NGINXLog, cutoff time.Time) {
+	locationLookup, networkLookup := lookups(records)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	slots, ok := r.sources[source]
+	if !ok {
+		slots = make([]map[time.Time]*stats.Rollup, len(tiers))
+		for i := range slots {
+			slots[i] = make(map[time.Time]*stats.Rollup)
+		}
+		r.sources[source] = slots
+	}
+	for _, record := range records {
+		if record.Timestamp == nil || !cutoff.IsZero() && record.Timestamp.After(cutoff) {
+			continue
+		}
+		for i, t := range tiers {
+			start := record.Timestamp.Truncate(t.slot)
+			rollup, ok := slots[i][start]
+			if !ok {
+				rollup = stats.NewRollup(start, t.capacity)
+				slots[i][start] = rollup
+			}
+			rollup.Add(record, locationLookup, networkLookup)
+		}
+	}
+}
+
+// lookups resolves the IP addresses of records, each at most once, and
+// returns a country lookup and a network lookup over the results, or nil for
+// those that are disabled.
+func lookups(records []nginx.NGINXLog) (locationLookup func(string) string, networkLookup func(string) (uint, string)) {
+	locationsEnabled, networksEnabled := location.LocationsEnabled(), location.NetworksEnabled()
+	if !locationsEnabled && !networksEnabled {
+		return nil, nil
+	}
+
+	resolved := make(map[string]location.Location)
+	for _, record := range records {
+		if record.IPAddress == "" {
+			continue
+		}
+		if _, ok := resolved[record.IPAddress]; !ok {
+			resolved[record.IPAddress], _ = location.LocationLookup(record.IPAddress)
+		}
+	}
+	if locationsEnabled {
+		locationLookup = func(ipAddress string) string {
+			return resolved[ipAddress].Country
+		}
+	}
+	if networksEnabled {
+		networkLookup = func(ipAddress string) (uint, string) {
+			loc := resolved[ipAddress]
+			return loc.ASN, loc.Organization
+		}
+	}
+	return locationLookup, networkLookup
+}
+
+// Build adds the logs that exist for each source to its rollups, unless
+// they have been added before. Logs are read from the log store for sources
+// it holds the full history of, and otherwise from the log files, including
+// compressed archives. Lines logged after Build is called are left to be
+// added as they are written.
+func (r *Rollups) Build(ctx context.Context, sources []config.Source, history *store.Store) {
+	cutoff := time.Now()
+	for _, source := range sources {
+		r.mu.Lock()
+		if r.ready[source.Name] || r.building[source.Name] {
+			r.mu.Unlock()
+			continue
+		}
+		r.building[source.Name] = true
+		r.mu.Unlock()
+
+		go func() {
+			err := r.build(ctx, source, history, cutoff)
+			r.mu.Lock()
+			delete(r.building, source.Name)
+			if err == nil {
+				r.ready[source.Name] = true
+			}
+			r.mu.Unlock()
+			if err != nil && ctx.Err() == nil {
+				logger.Errorf("Failed to build rollups for source %s: %v", source.Name, err)
+			}
+		}()
+	}
+}
+
+func (r *Rollups) build(ctx context.Context, source config.Source, history *store.Store, cutoff time.Time) error {
+	read := func(cursor logs.Cursor) (logs.LogResult, error) {
+		return logs.GetLogsPage(source.AccessLogPath(), cursor, false, true, logs.Limits{MaxBytes: maxBuildBytes})
+	}
+	if history != nil && history.Ready(source.Name) {
+		read = func(cursor logs.Cursor) (logs.LogResult, error) {
+			return history.Read(source.Name, false, time.Time{}, cutoff, cursor, logs.Limits{MaxBytes: maxBuildBytes})
+		}
+	} else if _, err := os.Stat(source.AccessLogPath()); os.IsNotExist(err) {
+		return nil
+	}
+	logger.Infof("Building rollups for source %s", source.Name)
+
+	var cursor logs.Cursor
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		result, err := read(cursor)
+		if err != nil {
+			return err
+		}
+		r.add(source.Name, nginx.ParseNginxLogs(result.Logs, source.LogFormat), cutoff)
+		if result.Cursor == "" {
+			break
+		}
+		if cursor, err = logs.ParseCursor(result.Cursor); err != nil {
+			return err
+		}
+	}
+	logger.Infof("Built rollups for source %s", source.Name)
+	return nil
+}
+
+// Ready reports whether a source's existing logs have been added to its
+// rollups.
+func (r *Rollups) Ready(source string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.ready[source]
+}
+
+// Stats summarizes the rollups of the sources over the range of opts, from
+// the finest tier that still holds its start. It reports false if the
+// statistics must be computed from the logs instead: when a filter is set,
+// when a source's rollups aren't built yet, when the range starts within the
+// raw window before now, or when the requested interval is finer than the
+// tier's slots.
+func (r *Rollups) Stats(sources []string, opts stats.Options, now time.Time) (stats.Stats, bool) {
+	if opts.Filter != (stats.Filter{}) {
+		return stats.Stats{}, false
+	}
+	if !opts.Start.IsZero() && opts.Start.After(now.Add(-RawWindow)) {
+		return stats.Stats{}, false
+	}
+	i := tierFor(opts.Start, now)
+	if opts.Interval%tiers[i].slot != 0 {
+		return stats.Stats{}, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var rollups []*stats.Rollup
+	for _, source := range sources {
+		if !r.ready[source] {
+			return stats.Stats{}, false
+		}
+		if slots, ok := r.sources[source]; ok {
+			for _, rollup := range slots[i] {
+				rollups = append(rollups, rollup)
+			}
+		}
+	}
+	return stats.Summarize(rollups, tiers[i].slot, opts), true
+}
+
+// tierFor returns the index of the finest tier that holds rollups from start,
+// which is zero for an unbounded range.
+func tierFor(start time.Time, now time.Time) int {
+	if !start.IsZero() {
+		for i, t := range tiers {
+			if t.retention == 0 || !start.Before(now.Add(-t.retention).Truncate(t.slot)) {
+				return i
+			}
+		}
+	}
+	return len(tiers) - 1
+}
+
+// Run removes rollups past their tier's retention until ctx is cancelled.
+func (r *Rollups) Run(ctx context.Context) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			r.Prune(now)
+		}
+	}
+}
+
+// Prune removes rollups of slots that ended more than their tier's retention
+// before now.
+func (r *Rollups) Prune(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, slots := range r.sources {
+		for i, t := range tiers {
+			if t.retention == 0 {
+				continue
+			}
+			cutoff := now.Add(-t.retention)
+			for start := range slots[i] {
+				if !start.Add(t.slot).After(cutoff) {
+					delete(slots[i], start)
+				}
+			}
+		}
+	}
+}
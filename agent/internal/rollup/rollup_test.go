@@ -0,0 +1,138 @@
+package rollup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
+)
+
+func accessLine(t time.Time, path string) string {
+	return fmt.Sprintf(`192.168.1.1 - - [%s] "GET %s HTTP/1.1" 200 612 "-" "curl/8.0"`, t.Format("02/Jan/2006:15:04:05 -0700"), path)
+}
+
+func waitReady(t *testing.T, r *Rollups, source string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !r.Ready(source) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the rollups to build")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStats(t *testing.T) {
+	now := time.Now()
+	dir := t.TempDir()
+	content := strings.Join([]string{
+		accessLine(now.Add(-72*time.Hour), "/a"),
+		accessLine(now.Add(-2*time.Hour), "/b"),
+		accessLine(now.Add(-10*time.Minute), "/c"),
+	}, "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "access.log"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := config.Source{Name: "api", AccessPath: dir, LogFormat: config.DefaultConfig.LogFormat}
+
+	r := New()
+	if _, ok := r.Stats([]string{"api"}, stats.Options{}, now); ok {
+		t.Error("expected no stats before the rollups are built")
+	}
+	r.Build(context.Background(), []config.Source{source}, nil)
+	waitReady(t, r, "api")
+	// Lines written since are added as they are tailed
+	r.HandleAccess(source, []string{accessLine(now, "/d")})
+
+	tests := []struct {
+		name     string
+		opts     stats.Options
+		ok       bool
+		requests int
+		interval int64
+	}{
+		{"all time from the daily tier", stats.Options{}, true, 4, 86400},
+		{"days from the hourly tier", stats.Options{Start: now.Add(-48 * time.Hour)}, true, 3, 3600},
+		{"hours from the minute tier", stats.Options{Start: now.Add(-3 * time.Hour)}, true, 3, 300},
+		{"within the raw window", stats.Options{Start: now.Add(-30 * time.Minute)}, false, 0, 0},
+		{"with a filter", stats.Options{Filter: stats.Filter{Path: "/a"}}, false, 0, 0},
+		{"with an interval finer than the slots", stats.Options{Interval: 90 * time.Minute}, false, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := r.Stats([]string{"api"}, tt.opts, now)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if got.Requests != tt.requests || got.Interval != tt.interval {
+				t.Errorf("got %d requests at interval %d, want %d at %d", got.Requests, got.Interval, tt.requests, tt.interval)
+			}
+		})
+	}
+
+	if _, ok := r.Stats([]string{"api", "other"}, stats.Options{}, now); ok {
+		t.Error("expected no stats while a source isn't built")
+	}
+}
+
+func TestBuildSkipsLinesAfterCutoff(t *testing.T) {
+	dir := t.TempDir()
+	future := time.Now().Add(time.Hour)
+	if err := os.WriteFile(filepath.Join(dir, "access.log"), []byte(accessLine(future, "/a")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := New()
+	r.Build(context.Background(), []config.Source{{Name: "api", AccessPath: dir, LogFormat: config.DefaultConfig.LogFormat}}, nil)
+	waitReady(t, r, "api")
+
+	// The line is left to be added as it is tailed
+	got, _ := r.Stats([]string{"api"}, stats.Options{}, time.Now())
+	if got.Requests != 0 {
+		t.Errorf("got %d requests, want 0", got.Requests)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	source := config.Source{Name: "api", LogFormat: config.DefaultConfig.LogFormat}
+	r := New()
+	r.HandleAccess(source, []string{
+		accessLine(now.Add(-40*24*time.Hour), "/a"),
+		accessLine(now.Add(-30*time.Hour), "/b"),
+		accessLine(now.Add(-time.Hour), "/c"),
+	})
+
+	r.Prune(now)
+	slots := r.sources["api"]
+	for i, want := range []int{1, 2, 3} {
+		if got := len(slots[i]); got != want {
+			t.Errorf("tier %d kept %d rollups, want %d", i, got, want)
+		}
+	}
+}
+
+func TestTierFor(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		start time.Time
+		want  int
+	}{
+		{time.Time{}, 2},
+		{now.Add(-24 * time.Hour), 0},
+		{now.Add(-25 * time.Hour), 0},
+		{now.Add(-26 * time.Hour), 1},
+		{now.Add(-30 * 24 * time.Hour), 1},
+		{now.Add(-180 * 24 * time.Hour), 2},
+	}
+	for _, tt := range tests {
+		if got := tierFor(tt.start, now); got != tt.want {
+			t.Errorf("tierFor(%v) = %d, want %d", tt.start, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/internal/store"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
+	logs "github.com/tom-draper/nginx-analytics/agent/pkg/logs"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
+)
+
+// ServeErrors serves the parsed error log entries of a source, with their
+// counts by level in total and per time bucket. Entries are read from the
+// log store when it holds the source's history, and otherwise from every
+// error log of the source, including compressed archives.
+func ServeErrors(w http.ResponseWriter, r *http.Request, source config.Source, history *store.Store) {
+	opts, err := parseErrorOptions(r.URL.Query())
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var lines []string
+	if history != nil && history.Ready(source.Name) {
+		if lines, err = history.Lines(source.Name, true, opts.Start, opts.End); err != nil {
+			respondWithError(w, fmt.Sprintf("error reading stored logs: %v", err), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		path := source.ErrorLogPath()
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			logger.Warn("File not found")
+			respondWithError(w, "file not found", http.StatusNotFound)
+			return
+		}
+		result, err := logs.GetLogs(path, nil, true, true)
+		if err != nil {
+			respondWithError(w, fmt.Sprintf("error reading logs: %v", err), http.StatusInternalServerError)
+			return
+		}
+		lines = result.Logs
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	respondWithJSON(w, stats.SummarizeErrors(nginx.ParseNginxErrors(lines), opts))
+}
+
+func parseErrorOptions(query url.Values) (stats.ErrorOptions, error) {
+	var opts stats.ErrorOptions
+	var err error
+
+	if opts.Start, err = parseTimeParam(query, "start"); err != nil {
+		return opts, err
+	}
+	if opts.End, err = parseTimeParam(query, "end"); err != nil {
+		return opts, err
+	}
+	if v := query.Get("interval"); v != "" {
+		if opts.Interval, err = time.ParseDuration(v); err != nil || opts.Interval <= 0 {
+			return opts, fmt.Errorf("invalid interval: %s", v)
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		if opts.Limit, err = strconv.Atoi(v); err != nil || opts.Limit <= 0 {
+			return opts, fmt.Errorf("invalid limit: %s", v)
+		}
+	}
+	if v := query.Get("level"); v != "" {
+		for _, level := range strings.Split(strings.ToLower(v), ",") {
+			if !slices.Contains(nginx.ErrorLevels, level) {
+				return opts, fmt.Errorf("invalid level: %s", level)
+			}
+			opts.Filter.Levels = append(opts.Filter.Levels, level)
+		}
+	}
+	if v := query.Get("client"); v != "" {
+		if opts.Filter.Client, err = parseAddressRange(v); err != nil {
+			return opts, fmt.Errorf("invalid client: %s", v)
+		}
+	}
+	opts.Filter.Host = query.Get("host")
+	opts.Filter.Upstream = query.Get("upstream")
+
+	return opts, nil
+}
+
+// parseAddressRange parses a CIDR range, or an IP address as the range
+// holding only itself.
+func parseAddressRange(v string) (netip.Prefix, error) {
+	if strings.Contains(v, "/") {
+		prefix, err := netip.ParsePrefix(v)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(v)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
+)
+
+func TestServeErrors(t *testing.T) {
+	dirPath := t.TempDir()
+	content := `2024/01/15 10:00:00 [error] 1#0: *1 connect() failed, client: 10.0.0.1, server: _, request: "GET / HTTP/1.1", upstream: "http://127.0.0.1:8080/", host: "example.com"` + "\n" +
+		`2024/01/15 10:02:00 [warn] 1#0: *2 an upstream response is buffered, client: 10.0.0.2, server: _, request: "GET /big HTTP/1.1", host: "example.com"` + "\n"
+	if err := os.WriteFile(filepath.Join(dirPath, "error.log"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := config.Source{Name: "default", ErrorPath: dirPath}
+
+	rr := httptest.NewRecorder()
+	ServeErrors(rr, httptest.NewRequest("GET", "/api/errors?level=error&client=10.0.0.0/8", nil), source, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status: got %d", rr.Code)
+	}
+	var result stats.ErrorStats
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+	if result.Total != 1 || len(result.Errors) != 1 || result.Levels["error"] != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if entry := result.Errors[0]; entry.Upstream == nil || *entry.Upstream != "http://127.0.0.1:8080/" {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+
+	for _, query := range []string{"?level=loud", "?client=nowhere", "?start=yesterday", "?limit=-1"} {
+		rr := httptest.NewRecorder()
+		ServeErrors(rr, httptest.NewRequest("GET", "/api/errors"+query, nil), source, nil)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", query, rr.Code, http.StatusBadRequest)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	ServeErrors(rr, httptest.NewRequest("GET", "/api/errors", nil), config.Source{Name: "default", ErrorPath: filepath.Join(dirPath, "missing.log")}, nil)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("got status %d for missing logs, want %d", rr.Code, http.StatusNotFound)
+	}
+}
@@ -10,7 +10,7 @@ import (
 )
 
 func ServeLocations(w http.ResponseWriter, r *http.Request) {
-	logger.Log.Println("Serving locations...")
+	logger.Debug("Serving locations...")
 
 	// Ensure request body is closed after reading
 	defer r.Body.Close()
@@ -18,24 +18,24 @@ func ServeLocations(w http.ResponseWriter, r *http.Request) {
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		logger.Log.Println("Failed to read request body:", err)
+		logger.Warnf("Failed to read request body: %v", err)
 		http.Error(w, "Failed to read request body", http.StatusBadRequest)
 		return
 	}
 
 	var ipAddresses []string
 	if err := json.Unmarshal(body, &ipAddresses); err != nil {
-		logger.Log.Println("Failed to parse request body:", err)
+		logger.Warnf("Failed to parse request body: %v", err)
 		http.Error(w, "Failed to parse request body", http.StatusBadRequest)
 		return
 	}
 
 	var locations []location.Location
 	if len(ipAddresses) > 0 {
-		logger.Log.Printf("Resolving %d locations\n", len(ipAddresses))
+		logger.Debugf("Resolving %d locations", len(ipAddresses))
 		locations, err = location.ResolveLocations(ipAddresses)
 		if err != nil {
-			logger.Log.Println("Failed to get locations:", err)
+			logger.Errorf("Failed to get locations: %v", err)
 			http.Error(w, "Failed to get locations", http.StatusInternalServerError)
 			return
 		}
@@ -47,6 +47,8 @@ func ServeLocations(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(locations)
 }
 
+// LocationsEnabled reports whether a database is loaded to resolve the
+// locations or networks of IP addresses.
 func LocationsEnabled() bool {
-	return location.LocationsEnabled()
+	return location.LocationsEnabled() || location.NetworksEnabled()
 }
@@ -2,73 +2,183 @@ package routes
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/internal/store"
 	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
 	logs "github.com/tom-draper/nginx-analytics/agent/pkg/logs"
 )
 
+// maxPageBytes caps the log lines held in memory for a single response, or
+// for each page of a streamed response.
+const maxPageBytes = 32 * 1024 * 1024
+
+// ServeLogs serves raw log lines from path. Responses are limited to
+// maxLines and maxBytes query parameters, capped at maxPageBytes, with a
+// cursor to fetch the next page when cut short. Clients that accept
+// application/x-ndjson receive every page as a stream of JSON lines instead.
 func ServeLogs(w http.ResponseWriter, r *http.Request, path string, positions []logs.Position, isErrorLog bool, includeCompressed bool) {
+	serveLogPages(w, r, path, positions, isErrorLog, includeCompressed, nil)
+}
+
+// ServeParsedLogs serves access logs as structured records, parsed on the
+// agent using the configured nginx log_format.
+func ServeParsedLogs(w http.ResponseWriter, r *http.Request, path string, positions []logs.Position, includeCompressed bool, logFormat string) {
+	serveLogPages(w, r, path, positions, false, includeCompressed, func(result logs.LogResult) logs.LogResult {
+		return logs.ParseLogs(result, logFormat)
+	})
+}
+
+func serveLogPages(w http.ResponseWriter, r *http.Request, path string, positions []logs.Position, isErrorLog bool, includeCompressed bool, transform func(logs.LogResult) logs.LogResult) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Check if we're serving a directory or a single file
-	fileInfo, err := os.Stat(path)
+	// Check if file exists
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		logger.Warn("File not found")
+		respondWithError(w, "file not found", http.StatusNotFound)
+		return
+	}
+
+	cursor, limits, err := parsePageOptions(r, positions)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("path error: %v", err), http.StatusInternalServerError)
+		respondWithError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if fileInfo.IsDir() {
-		// Serve logs from directory
-		serveLogs(w, path, positions, isErrorLog, includeCompressed)
-	} else {
-		// Serve a single log file
-		singlePos := int64(0)
-		if len(positions) > 0 {
-			singlePos = positions[0].Position
+	readPage := func(cursor logs.Cursor) (logs.LogResult, error) {
+		result, err := logs.GetLogsPage(path, cursor, isErrorLog, includeCompressed, limits)
+		if err != nil {
+			return logs.LogResult{}, err
 		}
-
-		serveLog(w, path, singlePos)
+		if transform != nil {
+			result = transform(result)
+		}
+		return result, nil
 	}
+
+	servePages(w, r, cursor, readPage)
 }
 
-func serveLogs(w http.ResponseWriter, dirPath string, positions []logs.Position, isErrorLog bool, includeCompressed bool) {
-	// Check if file exists
-	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
-		logger.Log.Println("File not found")
-		respondWithError(w, "file not found", http.StatusNotFound)
+// ServeStoredLogs serves the lines stored for a source that were logged
+// within the start and end query parameters, paged in the same way as lines
+// read from the source's log files.
+func ServeStoredLogs(w http.ResponseWriter, r *http.Request, history *store.Store, source config.Source, isErrorLog bool, parsed bool) {
+	w.Header().Set("Content-Type", "application/json")
+
+	start, err := parseTimeParam(r.URL.Query(), "start")
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	// Serve logs from directory
-	result, err := logs.GetDirectoryLogs(dirPath, positions, isErrorLog, includeCompressed)
+	end, err := parseTimeParam(r.URL.Query(), "end")
 	if err != nil {
-		respondWithError(w, fmt.Sprintf("error reading directory logs: %v", err), http.StatusInternalServerError)
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cursor, limits, err := parsePageOptions(r, nil)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	respondWithJSON(w, result)
+	servePages(w, r, cursor, func(cursor logs.Cursor) (logs.LogResult, error) {
+		result, err := history.Read(source.Name, isErrorLog, start, end, cursor, limits)
+		if err != nil {
+			return logs.LogResult{}, err
+		}
+		if parsed {
+			result = logs.ParseLogs(result, source.LogFormat)
+		}
+		return result, nil
+	})
 }
 
-func serveLog(w http.ResponseWriter, filePath string, position int64) {
-	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		logger.Log.Println("File not found")
-		respondWithError(w, "file not found", http.StatusNotFound)
+// servePages responds with the page of logs at cursor, or streams every page
+// from cursor to clients that accept application/x-ndjson.
+func servePages(w http.ResponseWriter, r *http.Request, cursor logs.Cursor, readPage func(logs.Cursor) (logs.LogResult, error)) {
+	if strings.Contains(r.Header.Get("Accept"), "application/x-ndjson") {
+		streamLogPages(w, cursor, readPage)
 		return
 	}
 
-	result, err := logs.GetLog(filePath, position)
+	result, err := readPage(cursor)
 	if err != nil {
-		respondWithError(w, fmt.Sprintf("error reading log file: %v", err), http.StatusInternalServerError)
+		respondWithError(w, fmt.Sprintf("error reading logs: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	respondWithJSON(w, result)
 }
 
+// streamLogPages writes each page of logs as a line of JSON as soon as it is
+// read, so only one page is held in memory at a time.
+func streamLogPages(w http.ResponseWriter, cursor logs.Cursor, readPage func(logs.Cursor) (logs.LogResult, error)) {
+	// Large responses can outlive the server's write timeout
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+	for {
+		result, err := readPage(cursor)
+		if err != nil {
+			logger.Errorf("Error reading logs: %v", err)
+			encoder.Encode(map[string]string{"error": fmt.Sprintf("error reading logs: %v", err)})
+			return
+		}
+		if err := encoder.Encode(result); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return
+		}
+		if result.Cursor == "" {
+			return
+		}
+		if cursor, err = logs.ParseCursor(result.Cursor); err != nil {
+			return
+		}
+	}
+}
+
+// parsePageOptions reads the cursor and limits for a page of logs from the
+// request. A cursor takes the place of positions.
+func parsePageOptions(r *http.Request, positions []logs.Position) (logs.Cursor, logs.Limits, error) {
+	query := r.URL.Query()
+
+	cursor := logs.Cursor{Positions: positions}
+	if token := query.Get("cursor"); token != "" {
+		var err error
+		if cursor, err = logs.ParseCursor(token); err != nil {
+			return cursor, logs.Limits{}, err
+		}
+	}
+
+	limits := logs.Limits{MaxBytes: maxPageBytes}
+	if v := query.Get("maxLines"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return cursor, limits, fmt.Errorf("invalid maxLines: %s", v)
+		}
+		limits.MaxLines = n
+	}
+	if v := query.Get("maxBytes"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return cursor, limits, fmt.Errorf("invalid maxBytes: %s", v)
+		}
+		limits.MaxBytes = min(n, maxPageBytes)
+	}
+	return cursor, limits, nil
+}
+
 func respondWithJSON(w http.ResponseWriter, data interface{}) {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
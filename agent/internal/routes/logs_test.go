@@ -0,0 +1,180 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/internal/store"
+	logs "github.com/tom-draper/nginx-analytics/agent/pkg/logs"
+)
+
+func TestServeParsedLogs(t *testing.T) {
+	dirPath := t.TempDir()
+	content := `192.168.1.1 - - [01/Jan/2024:12:00:00 +0000] "GET /api/users HTTP/1.1" 200 1234 "-" "Mozilla/5.0"` + "\n" +
+		"not an access log line\n"
+	if err := os.WriteFile(filepath.Join(dirPath, "access.log"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	ServeParsedLogs(rr, httptest.NewRequest("GET", "/api/logs/access?format=parsed", nil), dirPath, nil, false, "")
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status: got %d", rr.Code)
+	}
+
+	var result logs.LogResult
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+	if len(result.Logs) != 0 {
+		t.Errorf("expected no raw lines, got %v", result.Logs)
+	}
+	if len(result.Records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(result.Records))
+	}
+	record := result.Records[0]
+	if record.IPAddress != "192.168.1.1" || record.Path != "/api/users" || record.Status == nil || *record.Status != 200 {
+		t.Errorf("unexpected record: %+v", record)
+	}
+	if len(result.Positions) != 1 || result.Positions[0].Position != int64(len(content)) {
+		t.Errorf("unexpected positions: %+v", result.Positions)
+	}
+}
+
+func TestServeParsedLogsMissingPath(t *testing.T) {
+	rr := httptest.NewRecorder()
+	ServeParsedLogs(rr, httptest.NewRequest("GET", "/api/logs/access?format=parsed", nil), filepath.Join(t.TempDir(), "missing.log"), nil, false, "")
+
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status: got %d want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestServeLogsPaged(t *testing.T) {
+	dirPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dirPath, "access.log"), []byte("one\ntwo\nthree\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	target := "/api/logs/access?maxLines=2"
+	for range 3 {
+		rr := httptest.NewRecorder()
+		ServeLogs(rr, httptest.NewRequest("GET", target, nil), dirPath, nil, false, false)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("unexpected status: got %d", rr.Code)
+		}
+
+		var result logs.LogResult
+		if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+			t.Fatalf("failed to decode response body: %v", err)
+		}
+		got = append(got, result.Logs...)
+		if result.Cursor == "" {
+			break
+		}
+		target = "/api/logs/access?maxLines=2&cursor=" + url.QueryEscape(result.Cursor)
+	}
+
+	if !slices.Equal(got, []string{"one", "two", "three"}) {
+		t.Errorf("unexpected logs: %v", got)
+	}
+}
+
+func TestServeLogsNDJSON(t *testing.T) {
+	dirPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dirPath, "access.log"), []byte("one\ntwo\nthree\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/logs/access?maxLines=1", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	rr := httptest.NewRecorder()
+	ServeLogs(rr, req, dirPath, nil, false, false)
+
+	if ct := rr.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("unexpected content type: %s", ct)
+	}
+
+	var got []string
+	var pages int
+	decoder := json.NewDecoder(rr.Body)
+	for decoder.More() {
+		var result logs.LogResult
+		if err := decoder.Decode(&result); err != nil {
+			t.Fatalf("failed to decode page: %v", err)
+		}
+		got = append(got, result.Logs...)
+		pages++
+	}
+
+	if !slices.Equal(got, []string{"one", "two", "three"}) {
+		t.Errorf("unexpected logs: %v", got)
+	}
+	if pages != 3 {
+		t.Errorf("unexpected page count: %d", pages)
+	}
+}
+
+func TestServeLogsInvalidLimits(t *testing.T) {
+	dirPath := t.TempDir()
+	for _, query := range []string{"maxLines=0", "maxBytes=abc", "cursor=%21"} {
+		rr := httptest.NewRecorder()
+		ServeLogs(rr, httptest.NewRequest("GET", "/api/logs/access?"+query, nil), dirPath, nil, false, false)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: unexpected status: got %d want %d", query, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestServeStoredLogs(t *testing.T) {
+	history, err := store.Open(config.Store{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer history.Close()
+	source := config.Source{Name: "api"}
+	history.HandleErrors(source, []string{
+		"2024/01/01 12:00:00 [error] 1#0: first",
+		"2024/01/02 12:00:00 [error] 1#0: second",
+		"2024/01/03 12:00:00 [error] 1#0: third",
+		"2024/01/04 12:00:00 [error] 1#0: fourth",
+	})
+
+	var got []string
+	query := url.Values{"start": {"2024-01-02T00:00:00Z"}, "end": {"2024-01-04T00:00:00Z"}, "maxLines": {"1"}}
+	for range 3 {
+		rr := httptest.NewRecorder()
+		ServeStoredLogs(rr, httptest.NewRequest("GET", "/api/logs/error?"+query.Encode(), nil), history, source, true, false)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("unexpected status: got %d", rr.Code)
+		}
+		var result logs.LogResult
+		if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+			t.Fatalf("failed to decode response body: %v", err)
+		}
+		got = append(got, result.Logs...)
+		if result.Cursor == "" {
+			break
+		}
+		query.Set("cursor", result.Cursor)
+	}
+	want := []string{"2024/01/02 12:00:00 [error] 1#0: second", "2024/01/03 12:00:00 [error] 1#0: third"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	rr := httptest.NewRecorder()
+	ServeStoredLogs(rr, httptest.NewRequest("GET", "/api/logs/error?start=yesterday", nil), history, source, true, false)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status for an invalid start: got %d", rr.Code)
+	}
+}
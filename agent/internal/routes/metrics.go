@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/internal/metrics"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
+)
+
+// ServeMetrics writes the metrics for sources in the Prometheus text format.
+func ServeMetrics(w http.ResponseWriter, m *metrics.Metrics, sources []config.Source, systemMonitoring bool) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	if err := m.Write(w, sources, systemMonitoring); err != nil {
+		logger.Warnf("Failed to write metrics: %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/internal/store"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/location"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
+	logs "github.com/tom-draper/nginx-analytics/agent/pkg/logs"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/query"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
+)
+
+// queryGroups is the response to a query counting its matches by a field.
+type queryGroups struct {
+	Matched int           `json:"matched"`
+	Groups  []stats.Count `json:"groups"`
+}
+
+// ServeQuery serves the access logs of a source that match the filter
+// expression in the q parameter and were logged between the start and end
+// parameters. Matches are paged over the lines read, with the same limits
+// and cursor as other logs, so a page may hold few matches or none while its
+// cursor leads on to more. With groupBy, the matches in the whole range are
+// counted by that field instead. Logs are read from the log store when it
+// holds the source's history, and otherwise from its log files, including
+// compressed archives.
+func ServeQuery(w http.ResponseWriter, r *http.Request, source config.Source, history *store.Store) {
+	w.Header().Set("Content-Type", "application/json")
+	params := r.URL.Query()
+
+	filter, err := query.Parse(params.Get("q"))
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("invalid query: %v", err), http.StatusBadRequest)
+		return
+	}
+	start, err := parseTimeParam(params, "start")
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	end, err := parseTimeParam(params, "end")
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := params.Get("format")
+	if format != "" && format != "raw" && format != "parsed" {
+		respondWithError(w, fmt.Sprintf("unsupported format: %s", format), http.StatusBadRequest)
+		return
+	}
+	cursor, limits, err := parsePageOptions(r, nil)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	read := func(cursor logs.Cursor, limits logs.Limits) (logs.LogResult, error) {
+		return history.Read(source.Name, false, start, end, cursor, limits)
+	}
+	if history == nil || !history.Ready(source.Name) {
+		path := source.AccessLogPath()
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			logger.Warn("File not found")
+			respondWithError(w, "file not found", http.StatusNotFound)
+			return
+		}
+		read = func(cursor logs.Cursor, limits logs.Limits) (logs.LogResult, error) {
+			return logs.GetLogsPage(path, cursor, false, true, limits)
+		}
+	}
+
+	// match reduces a page of lines to those matching the query
+	match := func(result logs.LogResult, each func(line string, record nginx.NGINXLog)) {
+		for _, line := range result.Logs {
+			parsed := nginx.ParseNginxLogs([]string{line}, source.LogFormat)
+			if len(parsed) == 0 {
+				continue
+			}
+			record := parsed[0]
+			if (!start.IsZero() || !end.IsZero()) && (record.Timestamp == nil || !inTimeRange(*record.Timestamp, start, end)) {
+				continue
+			}
+			if filter.Match(record) {
+				each(line, record)
+			}
+		}
+	}
+
+	if field := params.Get("groupBy"); field != "" {
+		var lookup func(string) string
+		if location.LocationsEnabled() {
+			lookup, _ = cachedLookups()
+		}
+		grouper, err := query.NewGrouper(field, lookup)
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		limit := 0
+		if v := params.Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+				respondWithError(w, fmt.Sprintf("invalid limit: %s", v), http.StatusBadRequest)
+				return
+			}
+		}
+
+		matched := 0
+		for {
+			if err := r.Context().Err(); err != nil {
+				return
+			}
+			result, err := read(cursor, logs.Limits{MaxBytes: maxPageBytes})
+			if err != nil {
+				respondWithError(w, fmt.Sprintf("error reading logs: %v", err), http.StatusInternalServerError)
+				return
+			}
+			match(result, func(_ string, record nginx.NGINXLog) {
+				matched++
+				grouper.Add(record)
+			})
+			if result.Cursor == "" {
+				break
+			}
+			if cursor, err = logs.ParseCursor(result.Cursor); err != nil {
+				respondWithError(w, fmt.Sprintf("error reading logs: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+		respondWithJSON(w, queryGroups{Matched: matched, Groups: grouper.Groups(limit)})
+		return
+	}
+
+	servePages(w, r, cursor, func(cursor logs.Cursor) (logs.LogResult, error) {
+		result, err := read(cursor, limits)
+		if err != nil {
+			return logs.LogResult{}, err
+		}
+		lines := []string{}
+		var records []nginx.NGINXLog
+		match(result, func(line string, record nginx.NGINXLog) {
+			if format == "raw" {
+				lines = append(lines, line)
+			} else {
+				records = append(records, record)
+			}
+		})
+		result.Logs, result.Records = lines, records
+		return result, nil
+	})
+}
+
+// inTimeRange reports whether t is within start and end, either of which may
+// be zero to leave the range open.
+func inTimeRange(t time.Time, start, end time.Time) bool {
+	return (start.IsZero() || !t.Before(start)) && (end.IsZero() || !t.After(end))
+}
@@ -0,0 +1,146 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	logs "github.com/tom-draper/nginx-analytics/agent/pkg/logs"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
+)
+
+var queryLines = []string{
+	`10.0.0.1 - - [01/Jan/2024:12:00:00 +0000] "GET /api/users HTTP/1.1" 200 1234 "-" "Mozilla/5.0"`,
+	`10.0.0.2 - - [01/Jan/2024:12:30:00 +0000] "POST /api/users HTTP/1.1" 500 12 "-" "curl/8.0.1"`,
+	`192.168.1.1 - - [01/Jan/2024:13:00:00 +0000] "GET /api/items HTTP/1.1" 503 12 "-" "curl/8.0.1"`,
+	`10.0.0.1 - - [01/Jan/2024:14:00:00 +0000] "GET / HTTP/1.1" 404 0 "-" "Mozilla/5.0"`,
+	"not an access log line",
+}
+
+func newQuerySource(t *testing.T) config.Source {
+	t.Helper()
+	dirPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dirPath, "access.log"), []byte(strings.Join(queryLines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return config.Source{Name: "default", AccessPath: dirPath}
+}
+
+func serveQuery(t *testing.T, source config.Source, params url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	ServeQuery(rr, httptest.NewRequest("GET", "/api/query?"+params.Encode(), nil), source, nil)
+	return rr
+}
+
+func TestServeQuery(t *testing.T) {
+	source := newQuerySource(t)
+
+	tests := []struct {
+		name   string
+		params url.Values
+		want   []string
+	}{
+		{"every line", url.Values{}, queryLines[:4]},
+		{"status class", url.Values{"q": {"status:5xx"}}, queryLines[1:3]},
+		{"cidr and path", url.Values{"q": {"ip:10.0.0.0/8 path:/api/*"}}, queryLines[:2]},
+		{"negated pattern", url.Values{"q": {"-ua~^curl"}}, []string{queryLines[0], queryLines[3]}},
+		{"time range", url.Values{"q": {"status:5xx"}, "start": {"2024-01-01T12:45:00Z"}}, queryLines[2:3]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.params.Set("format", "raw")
+			rr := serveQuery(t, source, tt.params)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("unexpected status: got %d", rr.Code)
+			}
+			var result logs.LogResult
+			if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+				t.Fatalf("failed to decode response body: %v", err)
+			}
+			if !slices.Equal(result.Logs, tt.want) {
+				t.Errorf("got %q, want %q", result.Logs, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeQueryPages(t *testing.T) {
+	source := newQuerySource(t)
+	params := url.Values{"q": {"status:5xx"}, "maxLines": {"2"}}
+
+	var records int
+	for pages := 0; ; pages++ {
+		if pages > len(queryLines) {
+			t.Fatal("paging didn't end")
+		}
+		rr := serveQuery(t, source, params)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("unexpected status: got %d", rr.Code)
+		}
+		var result logs.LogResult
+		if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+			t.Fatalf("failed to decode response body: %v", err)
+		}
+		for _, record := range result.Records {
+			if record.Status == nil || *record.Status < 500 {
+				t.Errorf("unexpected record: %+v", record)
+			}
+		}
+		records += len(result.Records)
+		if result.Cursor == "" {
+			break
+		}
+		params.Set("cursor", result.Cursor)
+	}
+	if records != 2 {
+		t.Errorf("got %d records across pages, want 2", records)
+	}
+}
+
+func TestServeQueryGroups(t *testing.T) {
+	source := newQuerySource(t)
+	rr := serveQuery(t, source, url.Values{"q": {"ip:10.0.0.0/8"}, "groupBy": {"status"}, "limit": {"2"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status: got %d", rr.Code)
+	}
+	var result struct {
+		Matched int           `json:"matched"`
+		Groups  []stats.Count `json:"groups"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+	want := []stats.Count{{Name: "200", Count: 1}, {Name: "404", Count: 1}}
+	if result.Matched != 3 || !slices.Equal(result.Groups, want) {
+		t.Errorf("got %d matches in %+v, want 3 in %+v", result.Matched, result.Groups, want)
+	}
+}
+
+func TestServeQueryInvalid(t *testing.T) {
+	source := newQuerySource(t)
+	for _, params := range []url.Values{
+		{"q": {"status:abc"}},
+		{"q": {"host:example.com"}},
+		{"start": {"yesterday"}},
+		{"format": {"xml"}},
+		{"groupBy": {"unknown"}},
+		{"groupBy": {"path"}, "limit": {"0"}},
+	} {
+		if rr := serveQuery(t, source, params); rr.Code != http.StatusBadRequest {
+			t.Errorf("query %s: got status %d, want %d", params.Encode(), rr.Code, http.StatusBadRequest)
+		}
+	}
+
+	missing := config.Source{Name: "default", AccessPath: filepath.Join(t.TempDir(), "missing.log")}
+	if rr := serveQuery(t, missing, url.Values{}); rr.Code != http.StatusNotFound {
+		t.Errorf("got status %d for missing logs, want %d", rr.Code, http.StatusNotFound)
+	}
+}
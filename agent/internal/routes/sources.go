@@ -0,0 +1,39 @@
+package routes
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+)
+
+type SourceStatus struct {
+	Name            string `json:"name"`
+	LogFormat       string `json:"logFormat,omitempty"`
+	AccessLogStatus string `json:"accessLogStatus"`
+	ErrorLogStatus  string `json:"errorLogStatus"`
+}
+
+// ServeSources lists the configured log sources, in the order they were
+// configured. The first source is served when a request doesn't name one.
+func ServeSources(w http.ResponseWriter, sources []config.Source) {
+	statuses := make([]SourceStatus, len(sources))
+	for i, source := range sources {
+		statuses[i] = SourceStatus{
+			Name:            source.Name,
+			LogFormat:       source.LogFormat,
+			AccessLogStatus: pathStatus(source.AccessLogPath()),
+			ErrorLogStatus:  pathStatus(source.ErrorLogPath()),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	respondWithJSON(w, statuses)
+}
+
+func pathStatus(path string) string {
+	if _, err := os.Stat(path); err != nil {
+		return "not found"
+	}
+	return "ok"
+}
@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+)
+
+func TestServeSources(t *testing.T) {
+	dirPath := t.TempDir()
+	accessPath := filepath.Join(dirPath, "access.log")
+	if err := os.WriteFile(accessPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	ServeSources(rr, []config.Source{
+		{Name: "api", AccessPath: dirPath, ErrorPath: dirPath, LogFormat: "$remote_addr"},
+		{Name: "www", AccessPath: accessPath, ErrorPath: filepath.Join(dirPath, "error.log")},
+	})
+
+	var got []SourceStatus
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+	want := []SourceStatus{
+		{Name: "api", LogFormat: "$remote_addr", AccessLogStatus: "ok", ErrorLogStatus: "ok"},
+		{Name: "www", AccessLogStatus: "ok", ErrorLogStatus: "not found"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,169 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/internal/rollup"
+	"github.com/tom-draper/nginx-analytics/agent/internal/store"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/location"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
+	logs "github.com/tom-draper/nginx-analytics/agent/pkg/logs"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
+)
+
+// ServeStats serves aggregated statistics computed from every access log of
+// the sources, including compressed archives. Each source's logs are parsed
+// with its own log format. Sources with their full history in the log store
+// are read from there instead, so that statistics cover logs that have since
+// been rotated away. Ranges reaching back beyond the recent raw window are
+// summarized from the sources' rollups when they are available.
+func ServeStats(w http.ResponseWriter, r *http.Request, sources []config.Source, history *store.Store, rollups *rollup.Rollups) {
+	opts, err := parseStatsOptions(r.URL.Query())
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	locationLookup, networkLookup := cachedLookups()
+	if location.LocationsEnabled() {
+		opts.LocationLookup = locationLookup
+	}
+	if location.NetworksEnabled() {
+		opts.NetworkLookup = networkLookup
+	}
+
+	if rollups != nil {
+		names := make([]string, len(sources))
+		for i, source := range sources {
+			names[i] = source.Name
+		}
+		if summary, ok := rollups.Stats(names, opts, time.Now()); ok {
+			w.Header().Set("Content-Type", "application/json")
+			respondWithJSON(w, summary)
+			return
+		}
+	}
+
+	var records []nginx.NGINXLog
+	found := false
+	for _, source := range sources {
+		if history != nil && history.Ready(source.Name) {
+			lines, err := history.Lines(source.Name, false, opts.Start, opts.End)
+			if err != nil {
+				respondWithError(w, fmt.Sprintf("error reading stored logs: %v", err), http.StatusInternalServerError)
+				return
+			}
+			records = append(records, nginx.ParseNginxLogs(lines, source.LogFormat)...)
+			found = true
+			continue
+		}
+
+		path := source.AccessLogPath()
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			logger.Warnf("Access logs not found for source %s", source.Name)
+			continue
+		}
+		found = true
+
+		result, err := logs.GetLogs(path, nil, false, true)
+		if err != nil {
+			respondWithError(w, fmt.Sprintf("error reading logs: %v", err), http.StatusInternalServerError)
+			return
+		}
+		records = append(records, nginx.ParseNginxLogs(result.Logs, source.LogFormat)...)
+	}
+	if !found {
+		logger.Warn("File not found")
+		respondWithError(w, "file not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	respondWithJSON(w, stats.Compute(records, opts))
+}
+
+func parseStatsOptions(query url.Values) (stats.Options, error) {
+	var opts stats.Options
+	var err error
+
+	if opts.Start, err = parseTimeParam(query, "start"); err != nil {
+		return opts, err
+	}
+	if opts.End, err = parseTimeParam(query, "end"); err != nil {
+		return opts, err
+	}
+	if v := query.Get("interval"); v != "" {
+		if opts.Interval, err = time.ParseDuration(v); err != nil || opts.Interval <= 0 {
+			return opts, fmt.Errorf("invalid interval: %s", v)
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		if opts.Limit, err = strconv.Atoi(v); err != nil || opts.Limit <= 0 {
+			return opts, fmt.Errorf("invalid limit: %s", v)
+		}
+	}
+	if v := query.Get("status"); v != "" {
+		if opts.Filter.Status, err = strconv.Atoi(v); err != nil {
+			return opts, fmt.Errorf("invalid status: %s", v)
+		}
+	}
+
+	opts.Filter.Path = query.Get("path")
+	opts.Filter.Method = query.Get("method")
+	opts.Filter.Referrer = query.Get("referrer")
+	opts.Filter.Client = query.Get("client")
+	opts.Filter.OS = query.Get("os")
+	opts.Filter.Device = query.Get("device")
+	opts.Filter.Version = query.Get("version")
+	opts.Filter.Location = query.Get("location")
+	if v := query.Get("network"); v != "" {
+		asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(v), "AS"), 10, 32)
+		if err != nil || asn == 0 {
+			return opts, fmt.Errorf("invalid network: %s", v)
+		}
+		opts.Filter.Network = uint(asn)
+	}
+
+	return opts, nil
+}
+
+func parseTimeParam(query url.Values, name string) (time.Time, error) {
+	v := query.Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: %s", name, v)
+	}
+	return t, nil
+}
+
+// cachedLookups returns a country lookup and a network lookup sharing a
+// cache, so that each IP address is resolved at most once per request.
+func cachedLookups() (func(string) string, func(string) (uint, string)) {
+	cache := make(map[string]location.Location)
+	resolve := func(ipAddress string) location.Location {
+		loc, ok := cache[ipAddress]
+		if !ok {
+			loc, _ = location.LocationLookup(ipAddress)
+			cache[ipAddress] = loc
+		}
+		return loc
+	}
+	countryLookup := func(ipAddress string) string {
+		return resolve(ipAddress).Country
+	}
+	networkLookup := func(ipAddress string) (uint, string) {
+		loc := resolve(ipAddress)
+		return loc.ASN, loc.Organization
+	}
+	return countryLookup, networkLookup
+}
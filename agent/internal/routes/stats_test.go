@@ -0,0 +1,174 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/internal/rollup"
+	"github.com/tom-draper/nginx-analytics/agent/internal/store"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
+)
+
+func TestServeStats(t *testing.T) {
+	dirPath := t.TempDir()
+	content := `192.168.1.1 - - [01/Jan/2024:12:00:00 +0000] "GET /api/users HTTP/1.1" 200 1234 "-" "Mozilla/5.0"` + "\n" +
+		`192.168.1.2 - - [01/Jan/2024:13:00:00 +0000] "POST /api/users HTTP/1.1" 500 12 "-" "curl/8.0.1"` + "\n" +
+		`192.168.1.1 - - [02/Jan/2024:12:00:00 +0000] "GET /api/items HTTP/1.1" 200 1234 "-" "Mozilla/5.0"` + "\n"
+	if err := os.WriteFile(filepath.Join(dirPath, "access.log"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		code     int
+		requests int
+		users    int
+	}{
+		{"all", "", http.StatusOK, 3, 2},
+		{"time range", "?end=2024-01-01T23:59:59Z", http.StatusOK, 2, 2},
+		{"path filter", "?path=/api/users&method=POST", http.StatusOK, 1, 1},
+		{"invalid start", "?start=yesterday", http.StatusBadRequest, 0, 0},
+		{"invalid interval", "?interval=0s", http.StatusBadRequest, 0, 0},
+		{"invalid network", "?network=ASX", http.StatusBadRequest, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			ServeStats(rr, httptest.NewRequest("GET", "/api/stats"+tt.query, nil), []config.Source{{Name: "default", AccessPath: dirPath}}, nil, nil)
+
+			if rr.Code != tt.code {
+				t.Fatalf("unexpected status: got %d want %d", rr.Code, tt.code)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			var result stats.Stats
+			if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+				t.Fatalf("failed to decode response body: %v", err)
+			}
+			if result.Requests != tt.requests || result.Users != tt.users {
+				t.Errorf("got %d requests and %d users, want %d and %d", result.Requests, result.Users, tt.requests, tt.users)
+			}
+		})
+	}
+}
+
+func TestServeStatsMergesSources(t *testing.T) {
+	apiPath := filepath.Join(t.TempDir(), "access.log")
+	apiLogs := `192.168.1.1 - - [01/Jan/2024:12:00:00 +0000] "GET /api/users HTTP/1.1" 200 1234 "-" "Mozilla/5.0"` + "\n"
+	if err := os.WriteFile(apiPath, []byte(apiLogs), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wwwPath := filepath.Join(t.TempDir(), "access.log")
+	wwwLogs := `192.168.1.2 [01/Jan/2024:13:00:00 +0000] "GET / HTTP/1.1" 200` + "\n"
+	if err := os.WriteFile(wwwPath, []byte(wwwLogs), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sources := []config.Source{
+		{Name: "api", AccessPath: apiPath},
+		{Name: "www", AccessPath: wwwPath, LogFormat: `$remote_addr [$time_local] "$request" $status`},
+		{Name: "missing", AccessPath: filepath.Join(t.TempDir(), "missing.log")},
+	}
+
+	rr := httptest.NewRecorder()
+	ServeStats(rr, httptest.NewRequest("GET", "/api/stats?source=*", nil), sources, nil, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status: got %d", rr.Code)
+	}
+
+	var result stats.Stats
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+	if result.Requests != 2 || result.Users != 2 {
+		t.Errorf("got %d requests and %d users, want 2 and 2", result.Requests, result.Users)
+	}
+}
+
+func TestServeStatsFromStore(t *testing.T) {
+	history, err := store.Open(config.Store{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer history.Close()
+
+	dirPath := t.TempDir()
+	content := `192.168.1.1 - - [01/Jan/2024:12:00:00 +0000] "GET /api/users HTTP/1.1" 200 1234 "-" "Mozilla/5.0"` + "\n" +
+		`192.168.1.2 - - [01/Jan/2024:13:00:00 +0000] "POST /api/users HTTP/1.1" 500 12 "-" "curl/8.0.1"` + "\n"
+	if err := os.WriteFile(filepath.Join(dirPath, "access.log"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := config.Source{Name: "default", AccessPath: dirPath}
+	history.Backfill(context.Background(), []config.Source{source})
+	deadline := time.Now().Add(5 * time.Second)
+	for !history.Ready(source.Name) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the backfill")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Stored logs are still served once the log file has rotated away
+	if err := os.Remove(filepath.Join(dirPath, "access.log")); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	ServeStats(rr, httptest.NewRequest("GET", "/api/stats?start=2024-01-01T12:30:00Z", nil), []config.Source{source}, history, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status: got %d", rr.Code)
+	}
+	var result stats.Stats
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+	if result.Requests != 1 {
+		t.Errorf("got %d requests, want 1", result.Requests)
+	}
+}
+
+func TestServeStatsFromRollups(t *testing.T) {
+	dirPath := t.TempDir()
+	content := `192.168.1.1 - - [01/Jan/2024:12:00:00 +0000] "GET /api/users HTTP/1.1" 200 1234 "-" "Mozilla/5.0"` + "\n" +
+		`192.168.1.2 - - [01/Jan/2024:13:00:00 +0000] "POST /api/users HTTP/1.1" 500 12 "-" "curl/8.0.1"` + "\n"
+	if err := os.WriteFile(filepath.Join(dirPath, "access.log"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := config.Source{Name: "default", AccessPath: dirPath}
+	rollups := rollup.New()
+	rollups.Build(context.Background(), []config.Source{source}, nil)
+	deadline := time.Now().Add(5 * time.Second)
+	for !rollups.Ready(source.Name) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the rollups to build")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rr := httptest.NewRecorder()
+	ServeStats(rr, httptest.NewRequest("GET", "/api/stats", nil), []config.Source{source}, nil, rollups)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status: got %d", rr.Code)
+	}
+	var result stats.Stats
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+	// All time is summarized from the daily rollups
+	if result.Requests != 2 || result.Interval != 86400 {
+		t.Errorf("got %d requests at interval %d, want 2 at 86400", result.Requests, result.Interval)
+	}
+	if result.StatusClasses["5xx"] != 1 || result.Bytes != 1246 {
+		t.Errorf("unexpected status classes %v and bytes %d", result.StatusClasses, result.Bytes)
+	}
+}
@@ -5,6 +5,10 @@ import (
 	"net/http"
 	"os"
 	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/guard"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/location"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logs"
 )
 
 
@@ -16,16 +20,28 @@ type Status struct {
 	AccessLogStatus  string `json:"accessLogStatus"`
 	ErrorLogStatus   string `json:"errorLogStatus"`
 	LogFormat        string `json:"logFormat,omitempty"`
+	// AccessLogFiles and ErrorLogFiles list the files found under the log
+	// paths, with whether each is read and why
+	AccessLogFiles []logs.FileMatch `json:"accessLogFiles,omitempty"`
+	ErrorLogFiles  []logs.FileMatch `json:"errorLogFiles,omitempty"`
+	// Rejections counts the requests refused by address, rate limit or
+	// lockout since the agent started
+	Rejections guard.Stats `json:"rejections"`
+	// LocationDatabases are the GeoLite2 databases loaded, with their types
+	// and build dates
+	LocationDatabases []location.Database `json:"locationDatabases,omitempty"`
 }
 
-func ServeServerStatus(w http.ResponseWriter, nginxAccessPath string, nginxErrorPath string, startTime time.Time, logFormat string) {
+func ServeServerStatus(w http.ResponseWriter, nginxAccessPath string, nginxErrorPath string, startTime time.Time, logFormat string, rejections guard.Stats, locationDatabases []location.Database) {
 	// Create an instance of Status struct
 	status := Status{
-		Status:    "ok",
-		Uptime:    time.Since(startTime).String(),
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
-		Version:   "1.0.0",
-		LogFormat: logFormat,
+		Status:            "ok",
+		Uptime:            time.Since(startTime).String(),
+		Timestamp:         time.Now().UTC().Format(time.RFC3339),
+		Version:           "1.0.0",
+		LogFormat:         logFormat,
+		Rejections:        rejections,
+		LocationDatabases: locationDatabases,
 	}
 
 	// Check if the access log file exists
@@ -42,6 +58,9 @@ func ServeServerStatus(w http.ResponseWriter, nginxAccessPath string, nginxError
 		status.ErrorLogStatus = "ok"
 	}
 
+	status.AccessLogFiles, _ = logs.MatchLogFiles(nginxAccessPath, false)
+	status.ErrorLogFiles, _ = logs.MatchLogFiles(nginxErrorPath, true)
+
 	// Send status as JSON response
 	data, err := json.Marshal(status)
 	if err != nil {
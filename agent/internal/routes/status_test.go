@@ -5,8 +5,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/guard"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/location"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logs"
 )
 
 func TestServeServerStatus(t *testing.T) {
@@ -101,7 +106,7 @@ func TestServeServerStatus(t *testing.T) {
 			// Create a response recorder to capture the output
 			rr := httptest.NewRecorder()
 			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				ServeServerStatus(w, tt.nginxAccessPath, tt.nginxErrorPath, startTime, "")
+				ServeServerStatus(w, tt.nginxAccessPath, tt.nginxErrorPath, startTime, "", guard.Stats{}, nil)
 			})
 
 			// Execute the handler
@@ -141,3 +146,54 @@ func TestServeServerStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestServeServerStatusLogFiles(t *testing.T) {
+	dirPath := t.TempDir()
+	for _, name := range []string{"access.log", "error.log"} {
+		if err := os.WriteFile(filepath.Join(dirPath, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	ServeServerStatus(rr, dirPath, dirPath, time.Now(), "", guard.Stats{}, nil)
+
+	var status Status
+	if err := json.NewDecoder(rr.Body).Decode(&status); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+
+	matched := func(files []logs.FileMatch) []string {
+		var names []string
+		for _, file := range files {
+			if file.Matched {
+				names = append(names, filepath.Base(file.Path))
+			}
+			if file.Reason == "" {
+				t.Errorf("no reason given for %s", file.Path)
+			}
+		}
+		return names
+	}
+	if names := matched(status.AccessLogFiles); len(names) != 1 || names[0] != "access.log" {
+		t.Errorf("unexpected access log files: %+v", status.AccessLogFiles)
+	}
+	if names := matched(status.ErrorLogFiles); len(names) != 1 || names[0] != "error.log" {
+		t.Errorf("unexpected error log files: %+v", status.ErrorLogFiles)
+	}
+}
+
+func TestServeServerStatusLocationDatabases(t *testing.T) {
+	databases := []location.Database{{Path: "GeoLite2-City.mmdb", Type: "GeoLite2-City", BuildDate: time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC)}}
+
+	rr := httptest.NewRecorder()
+	ServeServerStatus(rr, "", "", time.Now(), "", guard.Stats{}, databases)
+
+	var status Status
+	if err := json.NewDecoder(rr.Body).Decode(&status); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+	if len(status.LocationDatabases) != 1 || status.LocationDatabases[0] != databases[0] {
+		t.Errorf("unexpected location databases: %+v", status.LocationDatabases)
+	}
+}
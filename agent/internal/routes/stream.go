@@ -0,0 +1,136 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
+	logs "github.com/tom-draper/nginx-analytics/agent/pkg/logs"
+)
+
+const streamHeartbeatInterval = 15 * time.Second
+
+// ServeLogStream streams new log lines under path as Server-Sent Events as
+// they are written. Each "logs" event carries a LogResult as data and its
+// positions as the event ID, so a reconnecting client resumes where it left
+// off by sending the Last-Event-ID header. Without positions, streaming starts
+// from the current end of the logs.
+func ServeLogStream(w http.ResponseWriter, r *http.Request, path string, positions []logs.Position, isErrorLog bool, parsed bool, logFormat string) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		logger.Warn("File not found")
+		respondWithError(w, "file not found", http.StatusNotFound)
+		return
+	}
+
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		if err := json.Unmarshal([]byte(lastEventID), &positions); err != nil {
+			respondWithError(w, fmt.Sprintf("invalid Last-Event-ID: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var err error
+	if positions == nil {
+		positions, err = logs.CurrentPositions(path, isErrorLog)
+		if err != nil {
+			respondWithError(w, fmt.Sprintf("error reading logs: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	changes, err := logs.Watch(r.Context(), path)
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("error watching logs: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Streams outlive the server's write timeout
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		logger.Errorf("Streaming not supported: %v", err)
+		return
+	}
+
+	// Large backlogs are sent as several events of at most maxPageBytes
+	sendNewLogs := func() error {
+		cursor := logs.Cursor{Positions: positions}
+		for {
+			result, err := logs.GetLogsPage(path, cursor, isErrorLog, false, logs.Limits{MaxBytes: maxPageBytes})
+			if err != nil {
+				// The file may be mid-rotation; retry on the next change
+				logger.Warnf("Error reading logs for stream: %v", err)
+				return nil
+			}
+			if len(result.Positions) > 0 {
+				positions = result.Positions
+			}
+			more := result.Cursor != ""
+			result.Cursor = ""
+			if len(result.Logs) > 0 {
+				if parsed {
+					result = logs.ParseLogs(result, logFormat)
+				}
+				if err := writeEvent(w, rc, "logs", positions, result); err != nil {
+					return err
+				}
+			}
+			if !more {
+				return nil
+			}
+			cursor = logs.Cursor{Positions: positions}
+		}
+	}
+
+	// Catch up on anything written since the client's positions
+	if err := sendNewLogs(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case _, ok := <-changes:
+			if !ok {
+				return
+			}
+			if err := sendNewLogs(); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, rc *http.ResponseController, event string, positions []logs.Position, data any) error {
+	id, err := json.Marshal(positions)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", id, event, body); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
@@ -0,0 +1,158 @@
+package routes
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	logs "github.com/tom-draper/nginx-analytics/agent/pkg/logs"
+)
+
+const streamTestLine = `192.168.1.1 - - [01/Jan/2024:12:00:00 +0000] "GET /api/users HTTP/1.1" 200 1234 "-" "Mozilla/5.0"`
+
+type streamEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// readEvent reads the next event from an SSE stream, skipping comments.
+func readEvent(t *testing.T, reader *bufio.Reader) streamEvent {
+	t.Helper()
+	var ev streamEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if ev.event != "" {
+				return ev
+			}
+		case strings.HasPrefix(line, "id: "):
+			ev.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			ev.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func openStream(t *testing.T, path string, query string, lastEventID string) *bufio.Reader {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeLogStream(w, r, path, nil, false, r.URL.Query().Get("format") == "parsed", "")
+	}))
+	t.Cleanup(server.Close)
+
+	req, err := http.NewRequest("GET", server.URL+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	// Bound the whole stream so a missing event fails rather than hangs
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type: %s", ct)
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+func appendLine(t *testing.T, path string, line string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(line + "\n"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServeLogStream(t *testing.T) {
+	dirPath := t.TempDir()
+	logPath := filepath.Join(dirPath, "access.log")
+	if err := os.WriteFile(logPath, []byte("old line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := openStream(t, dirPath, "?format=parsed", "")
+
+	// Give the watcher a moment to start before writing
+	time.Sleep(100 * time.Millisecond)
+	appendLine(t, logPath, streamTestLine)
+
+	ev := readEvent(t, reader)
+	if ev.event != "logs" {
+		t.Fatalf("unexpected event type: %s", ev.event)
+	}
+	var result logs.LogResult
+	if err := json.Unmarshal([]byte(ev.data), &result); err != nil {
+		t.Fatalf("failed to decode event data: %v", err)
+	}
+	if len(result.Records) != 1 || result.Records[0].Path != "/api/users" {
+		t.Errorf("unexpected records: %+v", result.Records)
+	}
+
+	var positions []logs.Position
+	if err := json.Unmarshal([]byte(ev.id), &positions); err != nil {
+		t.Fatalf("failed to decode event id: %v", err)
+	}
+	want := int64(len("old line\n") + len(streamTestLine) + 1)
+	if len(positions) != 1 || positions[0].Filename != "access.log" || positions[0].Position != want {
+		t.Errorf("unexpected positions: %+v", positions)
+	}
+}
+
+func TestServeLogStreamResume(t *testing.T) {
+	dirPath := t.TempDir()
+	logPath := filepath.Join(dirPath, "access.log")
+	content := "first line\nsecond line\n"
+	if err := os.WriteFile(logPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resuming after the first line should deliver the second immediately
+	reader := openStream(t, dirPath, "", `[{"position":11,"filename":"access.log"}]`)
+	ev := readEvent(t, reader)
+
+	var result logs.LogResult
+	if err := json.Unmarshal([]byte(ev.data), &result); err != nil {
+		t.Fatalf("failed to decode event data: %v", err)
+	}
+	if len(result.Logs) != 1 || result.Logs[0] != "second line" {
+		t.Errorf("unexpected logs: %v", result.Logs)
+	}
+}
+
+func TestServeLogStreamInvalidLastEventID(t *testing.T) {
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/logs/stream", nil)
+	req.Header.Set("Last-Event-ID", "not json")
+	ServeLogStream(rr, req, t.TempDir(), nil, false, false, "")
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: got %d want %d", rr.Code, http.StatusBadRequest)
+	}
+}
@@ -11,7 +11,7 @@ import (
 func ServeSystemResources(w http.ResponseWriter, r *http.Request) {
 	systemInfo, err := system.MeasureSystem()
 	if err != nil {
-		logger.Log.Printf("Error collecting system info: %v", err)
+		logger.Errorf("Error collecting system info: %v", err)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{
@@ -0,0 +1,256 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logs"
+)
+
+// Segments hold a day of a source's access or error log lines, named by the
+// log type and the UTC day, such as access-2024-01-15.log. Each line is the
+// unix time the line was logged, a space, then the line itself. Segments of
+// past days are compressed, and a day's content is that of its compressed
+// segment followed by that of its uncompressed one, so that offsets into a
+// day are unchanged when it is compressed.
+
+const (
+	dayFormat     = "2006-01-02"
+	segmentExt    = ".log"
+	compressedExt = ".log.gz"
+	accessLogType = "access"
+	errorLogType  = "error"
+	day           = 24 * time.Hour
+)
+
+// entry is a log line with the time it was logged.
+type entry struct {
+	time time.Time
+	line string
+}
+
+func logType(isErrorLog bool) string {
+	if isErrorLog {
+		return errorLogType
+	}
+	return accessLogType
+}
+
+func segmentName(logType string, date string) string {
+	return logType + "-" + date + segmentExt
+}
+
+// parseSegmentName returns the log type and day of a segment, and whether it
+// is compressed.
+func parseSegmentName(name string) (logType string, date time.Time, compressed bool, ok bool) {
+	base, compressed := strings.CutSuffix(name, compressedExt)
+	if !compressed {
+		if base, ok = strings.CutSuffix(name, segmentExt); !ok {
+			return "", time.Time{}, false, false
+		}
+	}
+	logType, dateStr, found := strings.Cut(base, "-")
+	if !found || (logType != accessLogType && logType != errorLogType) {
+		return "", time.Time{}, false, false
+	}
+	date, err := time.Parse(dayFormat, dateStr)
+	if err != nil {
+		return "", time.Time{}, false, false
+	}
+	return logType, date, compressed, true
+}
+
+// listDays returns the days that dir holds segments of a log type for, in
+// order.
+func listDays(dir string, logType string) ([]string, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var days []string
+	for _, dirEntry := range dirEntries {
+		t, date, _, ok := parseSegmentName(dirEntry.Name())
+		if !ok || t != logType {
+			continue
+		}
+		if d := date.Format(dayFormat); !slices.Contains(days, d) {
+			days = append(days, d)
+		}
+	}
+	slices.Sort(days)
+	return days, nil
+}
+
+// encodeEntries writes entries in the segment line format.
+func encodeEntries(entries []entry) []byte {
+	var buf bytes.Buffer
+	for _, e := range entries {
+		buf.WriteString(strconv.FormatInt(e.time.Unix(), 10))
+		buf.WriteByte(' ')
+		buf.WriteString(e.line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// compress returns data as a gzip member, which can be appended to or
+// prepended to a gzip file to extend its content.
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeFile writes a file by renaming a temporary file into place, so that
+// readers holding the previous file open keep reading its old content.
+func writeFile(path string, parts ...[]byte) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	for _, part := range parts {
+		if _, err := file.Write(part); err != nil {
+			file.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readOptional returns the content of a file, or nothing if it doesn't
+// exist.
+func readOptional(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// dayReader reads the content of a day's segments.
+type dayReader struct {
+	io.Reader
+	files []*os.File
+}
+
+// openDay opens a day's segments for reading. It must be called with the
+// store's lock held, so that a segment being compressed isn't read twice.
+func openDay(dir string, logType string, date string) (*dayReader, error) {
+	r := &dayReader{}
+	var readers []io.Reader
+	name := segmentName(logType, date)
+	for _, path := range []string{filepath.Join(dir, name+".gz"), filepath.Join(dir, name)} {
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.files = append(r.files, file)
+		if strings.HasSuffix(path, ".gz") {
+			gz, err := gzip.NewReader(bufio.NewReader(file))
+			if err != nil {
+				r.Close()
+				return nil, fmt.Errorf("error reading %s: %w", path, err)
+			}
+			readers = append(readers, gz)
+		} else {
+			readers = append(readers, file)
+		}
+	}
+	r.Reader = io.MultiReader(readers...)
+	return r, nil
+}
+
+func (r *dayReader) Close() error {
+	var errs []error
+	for _, file := range r.files {
+		errs = append(errs, file.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// page collects the lines of a page of logs until its limits are reached.
+type page struct {
+	lines  []string
+	size   int64
+	limits logs.Limits
+}
+
+// full reports whether adding line would exceed the limits. A page always
+// holds at least one line so that paging makes progress.
+func (p *page) full(line string) bool {
+	if len(p.lines) == 0 {
+		return false
+	}
+	return p.limits.MaxLines > 0 && len(p.lines)+1 > p.limits.MaxLines ||
+		p.limits.MaxBytes > 0 && p.size+int64(len(line)) > p.limits.MaxBytes
+}
+
+// readDay adds the lines of a day logged between start and end to p, from
+// offset until p is full. It returns the offset reached, and whether reading
+// stopped because p is full rather than at the end of the day.
+func readDay(reader io.Reader, offset int64, start, end time.Time, p *page) (int64, bool, error) {
+	if _, err := io.CopyN(io.Discard, reader, offset); err != nil {
+		if errors.Is(err, io.EOF) {
+			return offset, false, nil
+		}
+		return offset, false, err
+	}
+
+	buffered := bufio.NewReader(reader)
+	for {
+		raw, err := buffered.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			// An incomplete final line is still being written
+			return offset, false, nil
+		}
+		if err != nil {
+			return offset, false, err
+		}
+
+		timestamp, line, ok := strings.Cut(strings.TrimSuffix(raw, "\n"), " ")
+		unix, parseErr := strconv.ParseInt(timestamp, 10, 64)
+		if ok && parseErr == nil && inRange(time.Unix(unix, 0), start, end) {
+			if p.full(line) {
+				return offset, true, nil
+			}
+			p.lines = append(p.lines, line)
+			p.size += int64(len(line))
+		}
+		offset += int64(len(raw))
+	}
+}
+
+// inRange reports whether t is within start and end, either of which may be
+// zero to leave the range open.
+func inRange(t time.Time, start, end time.Time) bool {
+	return (start.IsZero() || !t.Before(start)) && (end.IsZero() || !t.After(end))
+}
@@ -0,0 +1,513 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logs"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
+)
+
+const (
+	// sweepInterval is how often past days are compressed and expired days
+	// are removed
+	sweepInterval = time.Hour
+	// maxBackfillBytes caps the log lines held in memory while backfilling
+	maxBackfillBytes = 4 * 1024 * 1024
+	// backfilledMarker is created in a source's directory once the logs that
+	// existed when it was first stored have been copied in
+	backfilledMarker = "backfilled"
+	// backfillDir holds the segments of a backfill until it completes
+	backfillDir = "backfill"
+)
+
+// Store keeps the lines written to each source's logs in daily segments on
+// disk, so that their history outlives log rotation and can be read by time
+// range. New lines are added as they are written, and the logs that already
+// exist when a source is first stored are backfilled.
+type Store struct {
+	cfg config.Store
+
+	// mu guards the open segments, and is held while segments are replaced
+	// so that readers see each day's content once
+	mu     sync.RWMutex
+	files  map[string]*os.File
+	closed bool
+
+	backfillMu  sync.Mutex
+	backfilling map[string]bool
+	backfilled  map[string]bool
+}
+
+// Open creates the store's directory if needed.
+func Open(cfg config.Store) (*Store, error) {
+	if err := os.MkdirAll(cfg.Dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+	return &Store{
+		cfg:         cfg,
+		files:       make(map[string]*os.File),
+		backfilling: make(map[string]bool),
+		backfilled:  make(map[string]bool),
+	}, nil
+}
+
+// HandleAccess stores access log lines written to a source, at the time
+// parsed from each with the source's log format.
+func (s *Store) HandleAccess(source config.Source, lines []string) {
+	entries := timestamped(lines, time.Now(), accessTime(source.LogFormat))
+	if err := s.write(s.cfg.SourceDir(source.Name), accessLogType, entries); err != nil {
+		logger.Errorf("Failed to store access logs for source %s: %v", source.Name, err)
+	}
+}
+
+// HandleErrors stores error log lines written to a source.
+func (s *Store) HandleErrors(source config.Source, lines []string) {
+	entries := timestamped(lines, time.Now(), errorTime)
+	if err := s.write(s.cfg.SourceDir(source.Name), errorLogType, entries); err != nil {
+		logger.Errorf("Failed to store error logs for source %s: %v", source.Name, err)
+	}
+}
+
+// timestamped pairs each line with the time parsed from it. Lines without a
+// time, such as the continuation of a multi-line error, take the time of the
+// line before, or fallback for the first line.
+func timestamped(lines []string, fallback time.Time, parse func(string) (time.Time, bool)) []entry {
+	entries := make([]entry, len(lines))
+	last := fallback
+	for i, line := range lines {
+		if t, ok := parse(line); ok {
+			last = t
+		}
+		entries[i] = entry{time: last, line: line}
+	}
+	return entries
+}
+
+func accessTime(logFormat string) func(string) (time.Time, bool) {
+	return func(line string) (time.Time, bool) {
+		parsed := nginx.ParseNginxLogs([]string{line}, logFormat)
+		if len(parsed) == 0 || parsed[0].Timestamp == nil {
+			return time.Time{}, false
+		}
+		return *parsed[0].Timestamp, true
+	}
+}
+
+// errorTime parses the time an error log line starts with, which is in the
+// server's local time.
+func errorTime(line string) (time.Time, bool) {
+	t, _, ok := nginx.ParseErrorPrefix(line)
+	return t, ok
+}
+
+// write appends entries to the segments of the days they were logged on.
+func (s *Store) write(dir string, logType string, entries []entry) error {
+	byDay := make(map[string][]entry)
+	for _, e := range entries {
+		date := e.time.UTC().Format(dayFormat)
+		byDay[date] = append(byDay[date], e)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("store closed")
+	}
+	var errs []error
+	for date, dayEntries := range byDay {
+		file, err := s.segment(filepath.Join(dir, segmentName(logType, date)))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, err := file.Write(encodeEntries(dayEntries)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// segment returns the open segment at path, opening it if needed. It must be
+// called with the lock held.
+func (s *Store) segment(path string) (*os.File, error) {
+	if file, ok := s.files[path]; ok {
+		return file, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, err
+	}
+	s.files[path] = file
+	return file, nil
+}
+
+// closeSegment closes the segment at path if it is open. It must be called
+// with the lock held.
+func (s *Store) closeSegment(path string) {
+	if file, ok := s.files[path]; ok {
+		file.Close()
+		delete(s.files, path)
+	}
+}
+
+// Read returns a page of the lines stored for a source that were logged
+// between start and end, either of which may be zero to leave the range
+// open. Lines are in the order they were stored within each day. If the page
+// is cut short by limits, the result's Cursor is set to a token for the next
+// page, holding the day and offset reached.
+func (s *Store) Read(source string, isErrorLog bool, start, end time.Time, cursor logs.Cursor, limits logs.Limits) (logs.LogResult, error) {
+	dir := s.cfg.SourceDir(source)
+	t := logType(isErrorLog)
+	days, err := listDays(dir, t)
+	if err != nil {
+		return logs.LogResult{}, err
+	}
+
+	var from logs.Position
+	if len(cursor.Positions) > 0 {
+		from = cursor.Positions[0]
+	}
+	p := &page{lines: []string{}, limits: limits}
+	for _, date := range days {
+		if date < from.Filename || !dayInRange(date, start, end) {
+			continue
+		}
+		var offset int64
+		if date == from.Filename {
+			offset = from.Position
+		}
+
+		s.mu.RLock()
+		reader, err := openDay(dir, t, date)
+		s.mu.RUnlock()
+		if err != nil {
+			return logs.LogResult{}, err
+		}
+		offset, more, err := readDay(reader, offset, start, end, p)
+		reader.Close()
+		if err != nil {
+			return logs.LogResult{}, fmt.Errorf("error reading stored logs for %s: %w", date, err)
+		}
+		if more {
+			next := logs.Cursor{Positions: []logs.Position{{Filename: date, Position: offset}}}
+			token, err := next.Encode()
+			if err != nil {
+				return logs.LogResult{}, fmt.Errorf("error encoding cursor: %w", err)
+			}
+			return logs.LogResult{Logs: p.lines, Cursor: token}, nil
+		}
+	}
+	return logs.LogResult{Logs: p.lines}, nil
+}
+
+// Lines returns every line stored for a source that was logged between
+// start and end.
+func (s *Store) Lines(source string, isErrorLog bool, start, end time.Time) ([]string, error) {
+	result, err := s.Read(source, isErrorLog, start, end, logs.Cursor{}, logs.Limits{})
+	return result.Logs, err
+}
+
+// dayInRange reports whether any of a UTC day falls between start and end.
+func dayInRange(date string, start, end time.Time) bool {
+	t, err := time.Parse(dayFormat, date)
+	if err != nil {
+		return false
+	}
+	return (start.IsZero() || t.Add(day).After(start)) && (end.IsZero() || !t.After(end))
+}
+
+// Ready reports whether a source's existing logs have been backfilled, so
+// that the store holds its full history.
+func (s *Store) Ready(source string) bool {
+	s.backfillMu.Lock()
+	defer s.backfillMu.Unlock()
+	return s.backfilled[source]
+}
+
+// Backfill copies the logs that exist for each source into the store, unless
+// they have been copied before. Lines logged after Backfill is called are
+// left to be stored as they are written.
+func (s *Store) Backfill(ctx context.Context, sources []config.Source) {
+	cutoff := time.Now()
+	for _, source := range sources {
+		dir := s.cfg.SourceDir(source.Name)
+		s.backfillMu.Lock()
+		if s.backfilled[source.Name] || s.backfilling[source.Name] {
+			s.backfillMu.Unlock()
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, backfilledMarker)); err == nil {
+			s.backfilled[source.Name] = true
+			s.backfillMu.Unlock()
+			continue
+		}
+		s.backfilling[source.Name] = true
+		s.backfillMu.Unlock()
+
+		go func() {
+			err := s.backfill(ctx, source, cutoff)
+			s.backfillMu.Lock()
+			delete(s.backfilling, source.Name)
+			if err == nil {
+				s.backfilled[source.Name] = true
+			}
+			s.backfillMu.Unlock()
+			if err != nil && ctx.Err() == nil {
+				logger.Errorf("Failed to backfill stored logs for source %s: %v", source.Name, err)
+			}
+		}()
+	}
+}
+
+// backfill copies a source's logs, including compressed archives, into
+// segments in a staging directory, then merges them ahead of the lines
+// stored since. A backfill that is interrupted starts again from scratch.
+func (s *Store) backfill(ctx context.Context, source config.Source, cutoff time.Time) error {
+	dir := s.cfg.SourceDir(source.Name)
+	staging := filepath.Join(dir, backfillDir)
+	if err := os.RemoveAll(staging); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(staging, 0750); err != nil {
+		return err
+	}
+	logger.Infof("Backfilling stored logs for source %s", source.Name)
+
+	for _, isErrorLog := range []bool{false, true} {
+		path := source.AccessLogPath()
+		parse := accessTime(source.LogFormat)
+		if isErrorLog {
+			path, parse = source.ErrorLogPath(), errorTime
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+
+		last := cutoff
+		var cursor logs.Cursor
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			result, err := logs.GetLogsPage(path, cursor, isErrorLog, true, logs.Limits{MaxBytes: maxBackfillBytes})
+			if err != nil {
+				return err
+			}
+			entries := timestamped(result.Logs, last, parse)
+			if len(entries) > 0 {
+				last = entries[len(entries)-1].time
+			}
+			// Later lines are stored as they are written
+			before := entries[:0]
+			for _, e := range entries {
+				if !e.time.After(cutoff) {
+					before = append(before, e)
+				}
+			}
+			if err := appendStaged(staging, logType(isErrorLog), before); err != nil {
+				return err
+			}
+			if result.Cursor == "" {
+				break
+			}
+			if cursor, err = logs.ParseCursor(result.Cursor); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := s.merge(dir, staging); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, backfilledMarker), nil, 0640); err != nil {
+		return err
+	}
+	logger.Infof("Backfilled stored logs for source %s", source.Name)
+	return os.RemoveAll(staging)
+}
+
+// appendStaged appends entries to the staged segments of their days.
+func appendStaged(staging string, logType string, entries []entry) error {
+	byDay := make(map[string][]entry)
+	for _, e := range entries {
+		date := e.time.UTC().Format(dayFormat)
+		byDay[date] = append(byDay[date], e)
+	}
+	for date, dayEntries := range byDay {
+		file, err := os.OpenFile(filepath.Join(staging, segmentName(logType, date)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+		if err != nil {
+			return err
+		}
+		_, err = file.Write(encodeEntries(dayEntries))
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge moves staged segments into dir, ahead of the content already stored
+// for their days.
+func (s *Store) merge(dir string, staging string) error {
+	staged, err := os.ReadDir(staging)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("store closed")
+	}
+	for _, dirEntry := range staged {
+		name := dirEntry.Name()
+		data, err := os.ReadFile(filepath.Join(staging, name))
+		if err != nil {
+			return err
+		}
+
+		// A day's compressed content comes first, so staged lines are
+		// prepended to it if it exists
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path + ".gz"); err == nil {
+			member, err := compress(data)
+			if err != nil {
+				return err
+			}
+			existing, err := os.ReadFile(path + ".gz")
+			if err != nil {
+				return err
+			}
+			if err := writeFile(path+".gz", member, existing); err != nil {
+				return err
+			}
+			continue
+		}
+
+		existing, err := readOptional(path)
+		if err != nil {
+			return err
+		}
+		s.closeSegment(path)
+		if err := writeFile(path, data, existing); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run compresses the segments of past days and removes those older than the
+// retention period, until ctx is cancelled.
+func (s *Store) Run(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.Sweep(time.Now()); err != nil {
+			logger.Errorf("Failed to sweep log store: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep compresses the segments of days before now and removes those that
+// ended more than the retention period before now.
+func (s *Store) Sweep(now time.Time) error {
+	sourceDirs, err := os.ReadDir(s.cfg.Dir)
+	if err != nil {
+		return err
+	}
+	today := now.UTC().Format(dayFormat)
+
+	var errs []error
+	for _, sourceDir := range sourceDirs {
+		if !sourceDir.IsDir() {
+			continue
+		}
+		dir := filepath.Join(s.cfg.Dir, sourceDir.Name())
+		segments, err := os.ReadDir(dir)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, segment := range segments {
+			_, date, compressed, ok := parseSegmentName(segment.Name())
+			if !ok {
+				continue
+			}
+			path := filepath.Join(dir, segment.Name())
+			switch {
+			case s.cfg.Retention > 0 && now.Sub(date.Add(day)) > s.cfg.Retention:
+				errs = append(errs, s.remove(path))
+			case !compressed && date.Format(dayFormat) < today:
+				errs = append(errs, s.compressSegment(path))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Store) remove(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeSegment(path)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// compressSegment moves an uncompressed segment onto the end of its day's
+// compressed segment.
+func (s *Store) compressSegment(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeSegment(path)
+
+	data, err := readOptional(path)
+	if err != nil || data == nil {
+		return err
+	}
+	member, err := compress(data)
+	if err != nil {
+		return err
+	}
+	existing, err := readOptional(path + ".gz")
+	if err != nil {
+		return err
+	}
+	if err := writeFile(path+".gz", existing, member); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Close closes the open segments. Lines handled after Close are dropped.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for path, file := range s.files {
+		errs = append(errs, file.Close())
+		delete(s.files, path)
+	}
+	s.closed = true
+	return errors.Join(errs...)
+}
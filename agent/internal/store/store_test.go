@@ -0,0 +1,180 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logs"
+)
+
+func newTestStore(t *testing.T, retention time.Duration) *Store {
+	t.Helper()
+	s, err := Open(config.Store{Dir: t.TempDir(), Retention: retention})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+var testSource = config.Source{Name: "api", LogFormat: config.DefaultConfig.LogFormat}
+
+func accessLine(t time.Time, path string) string {
+	return fmt.Sprintf(`192.168.1.1 - - [%s] "GET %s HTTP/1.1" 200 612 "-" "curl/8.0"`, t.Format("02/Jan/2006:15:04:05 -0700"), path)
+}
+
+func TestReadTimeRange(t *testing.T) {
+	s := newTestStore(t, 0)
+	day1 := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	s.HandleAccess(testSource, []string{accessLine(day1, "/a"), accessLine(day1.Add(time.Hour), "/b"), accessLine(day2, "/c"), "unparsed"})
+
+	all, err := s.Lines("api", false, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 {
+		t.Errorf("got %d lines, want 4", len(all))
+	}
+
+	// Lines without a time take the time of the line before
+	lines, err := s.Lines("api", false, day1.Add(30*time.Minute), day2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(lines, []string{accessLine(day1.Add(time.Hour), "/b"), accessLine(day2, "/c"), "unparsed"}) {
+		t.Errorf("unexpected lines in range: %q", lines)
+	}
+
+	if errors, _ := s.Lines("api", true, time.Time{}, time.Time{}); len(errors) != 0 {
+		t.Errorf("expected no error logs, got %q", errors)
+	}
+}
+
+func TestReadPages(t *testing.T) {
+	s := newTestStore(t, 0)
+	start := time.Date(2024, 1, 15, 23, 0, 0, 0, time.UTC)
+	var want []string
+	for i := range 5 {
+		want = append(want, accessLine(start.Add(time.Duration(i)*30*time.Minute), fmt.Sprintf("/%d", i)))
+	}
+	s.HandleAccess(testSource, want)
+
+	var got []string
+	var cursor logs.Cursor
+	for pages := 1; ; pages++ {
+		result, err := s.Read("api", false, time.Time{}, time.Time{}, cursor, logs.Limits{MaxLines: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, result.Logs...)
+		if result.Cursor == "" {
+			if pages != 3 {
+				t.Errorf("got %d pages, want 3", pages)
+			}
+			break
+		}
+		if cursor, err = logs.ParseCursor(result.Cursor); err != nil {
+			t.Fatal(err)
+		}
+
+		// Pages continue from the same place once a day is compressed
+		if pages == 1 {
+			if err := s.Sweep(start.Add(48 * time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	s := newTestStore(t, 7*24*time.Hour)
+	now := time.Date(2024, 1, 20, 12, 0, 0, 0, time.UTC)
+	old, recent := now.Add(-10*24*time.Hour), now.Add(-2*24*time.Hour)
+	s.HandleAccess(testSource, []string{accessLine(old, "/old"), accessLine(recent, "/recent"), accessLine(now, "/now")})
+	s.HandleErrors(testSource, []string{recent.Local().Format("2006/01/02 15:04:05") + " [error] 1#0: failed", "continued"})
+
+	// Lines for a day that has been compressed are added after its content
+	if err := s.Sweep(now); err != nil {
+		t.Fatal(err)
+	}
+	s.HandleAccess(testSource, []string{accessLine(recent.Add(time.Minute), "/late")})
+	if err := s.Sweep(now); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := s.cfg.SourceDir("api")
+	var names []string
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	want := []string{"access-2024-01-18.log.gz", "access-2024-01-20.log", "error-2024-01-18.log.gz"}
+	if !slices.Equal(names, want) {
+		t.Errorf("got segments %v, want %v", names, want)
+	}
+
+	lines, err := s.Lines("api", false, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(lines, []string{accessLine(recent, "/recent"), accessLine(recent.Add(time.Minute), "/late"), accessLine(now, "/now")}) {
+		t.Errorf("unexpected lines after sweep: %q", lines)
+	}
+	errors, _ := s.Lines("api", true, recent, recent)
+	if len(errors) != 2 {
+		t.Errorf("expected a continuation line to take the time of the line before, got %q", errors)
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	s := newTestStore(t, 0)
+	logDir := t.TempDir()
+	source := testSource
+	source.AccessPath = filepath.Join(logDir, "access.log")
+	source.ErrorPath = filepath.Join(logDir, "error.log")
+
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	existing := accessLine(past, "/existing")
+	future := accessLine(time.Now().Add(time.Hour), "/future")
+	if err := os.WriteFile(source.AccessPath, []byte(existing+"\n"+future+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lines stored as they are written are kept after the backfilled lines
+	live := accessLine(past.Add(time.Second), "/live")
+	s.HandleAccess(source, []string{live})
+	s.Backfill(context.Background(), []config.Source{source})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !s.Ready("api") {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the backfill")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	lines, err := s.Lines("api", false, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(lines, []string{existing, live}) {
+		t.Errorf("got %q, want the existing line before the live line", lines)
+	}
+
+	// Sources are only backfilled once
+	reopened := newTestStore(t, 0)
+	reopened.cfg = s.cfg
+	reopened.Backfill(context.Background(), []config.Source{source})
+	if !reopened.Ready("api") {
+		t.Error("expected a backfilled source to be ready when reopened")
+	}
+}
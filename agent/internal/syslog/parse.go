@@ -0,0 +1,121 @@
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is a syslog message with its envelope removed.
+type Message struct {
+	Facility int
+	Severity int
+	// Tag is the TAG of an RFC 3164 message or the APP-NAME of an RFC 5424
+	// message, which nginx sets with the tag parameter.
+	Tag     string
+	Content string
+}
+
+var errInvalidPriority = errors.New("invalid syslog priority")
+
+// Parse parses an RFC 5424 or RFC 3164 syslog message.
+func Parse(data []byte) (Message, error) {
+	var msg Message
+	data = bytes.TrimRight(data, "\r\n\x00")
+
+	// <PRI> holds the facility and severity
+	end := bytes.IndexByte(data, '>')
+	if len(data) == 0 || data[0] != '<' || end < 2 || end > 4 {
+		return msg, errInvalidPriority
+	}
+	priority, err := strconv.Atoi(string(data[1:end]))
+	if err != nil || priority < 0 || priority > 191 {
+		return msg, errInvalidPriority
+	}
+	msg.Facility, msg.Severity = priority/8, priority%8
+
+	rest := string(data[end+1:])
+	if strings.HasPrefix(rest, "1 ") {
+		msg.Tag, msg.Content = parse5424(rest[2:])
+	} else {
+		msg.Tag, msg.Content = parse3164(rest)
+	}
+	return msg, nil
+}
+
+// parse5424 returns the APP-NAME and MSG of the part of an RFC 5424 message
+// after the version: TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG.
+func parse5424(rest string) (string, string) {
+	var fields [5]string
+	for i := range fields {
+		fields[i], rest, _ = strings.Cut(rest, " ")
+	}
+	tag := fields[2]
+	if tag == "-" {
+		tag = ""
+	}
+	rest = skipStructuredData(rest)
+	rest = strings.TrimPrefix(rest, " ")
+	// MSG may start with a byte order mark to show it's UTF-8
+	return tag, strings.TrimPrefix(rest, "\ufeff")
+}
+
+// skipStructuredData returns what follows the STRUCTURED-DATA at the start of
+// s, which is either "-" or a series of [elements] whose quoted values may
+// contain escaped quotes and brackets.
+func skipStructuredData(s string) string {
+	if strings.HasPrefix(s, "-") {
+		return s[1:]
+	}
+	i := 0
+	for i < len(s) && s[i] == '[' {
+		quoted := false
+		for i++; i < len(s); i++ {
+			c := s[i]
+			if quoted && c == '\\' {
+				i++
+			} else if c == '"' {
+				quoted = !quoted
+			} else if c == ']' && !quoted {
+				i++
+				break
+			}
+		}
+	}
+	return s[min(i, len(s)):]
+}
+
+// parse3164 returns the TAG and content of the part of an RFC 3164 message
+// after the priority: TIMESTAMP HOSTNAME TAG[PID]: CONTENT. Senders differ in
+// whether they include the hostname and in their timestamp format, so both
+// are optional.
+func parse3164(rest string) (string, string) {
+	if len(rest) >= len(time.Stamp) {
+		if _, err := time.Parse(time.Stamp, rest[:len(time.Stamp)]); err == nil {
+			rest = strings.TrimPrefix(rest[len(time.Stamp):], " ")
+		}
+	}
+	if first, after, ok := strings.Cut(rest, " "); ok {
+		if _, err := time.Parse(time.RFC3339, first); err == nil {
+			rest = after
+		}
+	}
+
+	// The tag is the first word ending with a colon or [PID], after an
+	// optional hostname
+	content := rest
+	for range 2 {
+		word, after, _ := strings.Cut(rest, " ")
+		if i := strings.IndexAny(word, "[:"); i > 0 {
+			// The content follows the colon ending the tag
+			if _, content, ok := strings.Cut(rest, ":"); ok {
+				return word[:i], strings.TrimPrefix(content, " ")
+			}
+			return word[:i], after
+		}
+		rest = after
+	}
+	return "", content
+}
@@ -0,0 +1,58 @@
+package syslog
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    Message
+		wantErr bool
+	}{
+		{
+			name: "RFC 3164 from nginx",
+			data: `<190>Jan 15 10:30:45 web1 nginx: 192.168.1.1 - - [15/Jan/2024:10:30:45 +0000] "GET / HTTP/1.1" 200 612 "-" "curl/8.0"`,
+			want: Message{Facility: 23, Severity: 6, Tag: "nginx", Content: `192.168.1.1 - - [15/Jan/2024:10:30:45 +0000] "GET / HTTP/1.1" 200 612 "-" "curl/8.0"`},
+		},
+		{
+			name: "RFC 3164 without hostname",
+			data: "<11>Jan  5 08:00:00 api_error: 2024/01/05 08:00:00 [error] 1#0: *1 failed\n",
+			want: Message{Facility: 1, Severity: 3, Tag: "api_error", Content: "2024/01/05 08:00:00 [error] 1#0: *1 failed"},
+		},
+		{
+			name: "RFC 3164 with pid",
+			data: "<14>Jan 15 10:30:45 web1 api[1234]: line: with colons",
+			want: Message{Facility: 1, Severity: 6, Tag: "api", Content: "line: with colons"},
+		},
+		{
+			name: "RFC 3164 without tag",
+			data: "<14>just some text",
+			want: Message{Facility: 1, Severity: 6, Content: "just some text"},
+		},
+		{
+			name: "RFC 5424 with structured data",
+			data: `<165>1 2024-01-15T10:30:45.003Z web1 api - ID47 [exampleSDID@32473 iut="3" eventSource="App\]lication"] ` + "\ufeffGET /users",
+			want: Message{Facility: 20, Severity: 5, Tag: "api", Content: "GET /users"},
+		},
+		{
+			name: "RFC 5424 without app name",
+			data: "<13>1 2024-01-15T10:30:45Z web1 - - - - message",
+			want: Message{Facility: 1, Severity: 5, Content: "message"},
+		},
+		{name: "missing priority", data: "Jan 15 10:30:45 web1 nginx: line", wantErr: true},
+		{name: "priority out of range", data: "<192>Jan 15 10:30:45 web1 nginx: line", wantErr: true},
+		{name: "empty", data: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
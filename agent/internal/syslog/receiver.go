@@ -0,0 +1,225 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
+)
+
+// maxMessageSize is the largest message accepted, which is also the largest
+// UDP datagram.
+const maxMessageSize = 64 * 1024
+
+// Receiver listens for syslog messages and stores each as a line in the
+// access or error log of the source its tag is routed to. The logs are kept
+// in each source's syslog directory and rotated by size, so that they can be
+// read like any other log files.
+type Receiver struct {
+	cfg config.Syslog
+
+	mu     sync.RWMutex
+	routes map[string]*logger.RotatingFile
+	files  map[string]*logger.RotatingFile
+}
+
+func New(cfg config.Syslog) *Receiver {
+	return &Receiver{
+		cfg:    cfg,
+		routes: make(map[string]*logger.RotatingFile),
+		files:  make(map[string]*logger.RotatingFile),
+	}
+}
+
+// Route sends messages with each source's access and error tags to the
+// source's logs, creating them if needed so that they can be read before any
+// messages arrive. Logs of sources no longer listed are closed.
+func (r *Receiver) Route(sources []config.Source) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	routes := make(map[string]*logger.RotatingFile)
+	files := make(map[string]*logger.RotatingFile)
+	var errs []error
+	for _, source := range sources {
+		if source.AccessTag == "" && source.ErrorTag == "" {
+			continue
+		}
+		dir := r.cfg.SourceDir(source.Name)
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			errs = append(errs, fmt.Errorf("failed to create syslog directory for source %s: %w", source.Name, err))
+			continue
+		}
+		for _, log := range []struct{ tag, name string }{{source.AccessTag, "access.log"}, {source.ErrorTag, "error.log"}} {
+			path := filepath.Join(dir, log.name)
+			file, ok := r.files[path]
+			if !ok {
+				var err error
+				if file, err = logger.OpenRotatingFile(path, r.cfg.MaxSize, r.cfg.MaxBackups); err != nil {
+					errs = append(errs, fmt.Errorf("failed to open syslog log for source %s: %w", source.Name, err))
+					continue
+				}
+			}
+			files[path] = file
+			if log.tag != "" {
+				routes[log.tag] = file
+			}
+		}
+	}
+
+	for path, file := range r.files {
+		if _, ok := files[path]; !ok {
+			file.Close()
+		}
+	}
+	r.routes, r.files = routes, files
+	return errors.Join(errs...)
+}
+
+// Listen receives messages over UDP and TCP on the configured address until
+// ctx is cancelled.
+func (r *Receiver) Listen(ctx context.Context) error {
+	packetConn, err := net.ListenPacket("udp", r.cfg.Address)
+	if err != nil {
+		return fmt.Errorf("failed to listen for syslog over UDP: %w", err)
+	}
+	listener, err := net.Listen("tcp", r.cfg.Address)
+	if err != nil {
+		packetConn.Close()
+		return fmt.Errorf("failed to listen for syslog over TCP: %w", err)
+	}
+	context.AfterFunc(ctx, func() {
+		packetConn.Close()
+		listener.Close()
+	})
+
+	go r.serveUDP(packetConn)
+	go r.serveTCP(ctx, listener)
+	return nil
+}
+
+func (r *Receiver) serveUDP(conn net.PacketConn) {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Errorf("Failed to receive syslog message: %v", err)
+			}
+			return
+		}
+		r.receive(buf[:n])
+	}
+}
+
+func (r *Receiver) serveTCP(ctx context.Context, listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Errorf("Failed to accept syslog connection: %v", err)
+			}
+			return
+		}
+		go func() {
+			stop := context.AfterFunc(ctx, func() { conn.Close() })
+			defer stop()
+			defer conn.Close()
+			if err := readFrames(bufio.NewReaderSize(conn, maxMessageSize), r.receive); err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				logger.Warnf("Closing syslog connection from %s: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// readFrames reads messages from a TCP stream, framed either by a length
+// prefix (octet counting) or by a trailing newline, as described in RFC 6587.
+func readFrames(reader *bufio.Reader, handle func([]byte)) error {
+	for {
+		first, err := reader.Peek(1)
+		if err != nil {
+			return err
+		}
+
+		if first[0] >= '0' && first[0] <= '9' {
+			length, err := reader.ReadString(' ')
+			if err != nil {
+				return err
+			}
+			n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+			if err != nil || n <= 0 || n > maxMessageSize {
+				return fmt.Errorf("invalid message length %q", length)
+			}
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(reader, msg); err != nil {
+				return err
+			}
+			handle(msg)
+			continue
+		}
+
+		line, err := reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			// Skip the rest of a message that is too long
+			for errors.Is(err, bufio.ErrBufferFull) {
+				_, err = reader.ReadSlice('\n')
+			}
+			logger.Warn("Dropped syslog message over the maximum size")
+			continue
+		}
+		if len(line) > 0 {
+			handle(line)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// receive stores a message in the log its tag is routed to. Messages with
+// unknown tags are dropped.
+func (r *Receiver) receive(data []byte) {
+	msg, err := Parse(data)
+	if err != nil {
+		logger.Debugf("Dropped syslog message: %v", err)
+		return
+	}
+
+	// Each message is stored as a single line
+	line := strings.ReplaceAll(strings.TrimRight(msg.Content, "\r\n"), "\n", " ")
+
+	// The lock is held while writing so that rerouting can't close the file
+	// underneath the write
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	file, ok := r.routes[msg.Tag]
+	if !ok {
+		logger.Debugf("Dropped syslog message with unknown tag %q", msg.Tag)
+		return
+	}
+	if _, err := file.Write([]byte(line + "\n")); err != nil {
+		logger.Errorf("Failed to store syslog message: %v", err)
+	}
+}
+
+// Close closes the stored logs.
+func (r *Receiver) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for _, file := range r.files {
+		errs = append(errs, file.Close())
+	}
+	r.routes, r.files = nil, nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,109 @@
+package syslog
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+)
+
+func newTestReceiver(t *testing.T) (*Receiver, config.Syslog) {
+	t.Helper()
+	cfg := config.Syslog{
+		Address:    "127.0.0.1:0",
+		Dir:        t.TempDir(),
+		MaxSize:    1024 * 1024,
+		MaxBackups: 1,
+	}
+	r := New(cfg)
+	t.Cleanup(func() { r.Close() })
+	sources := []config.Source{{Name: "api", AccessTag: "api", ErrorTag: "api_error"}}
+	if err := r.Route(sources); err != nil {
+		t.Fatal(err)
+	}
+	return r, cfg
+}
+
+func waitForLines(t *testing.T, path string, want []string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(path)
+		got := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		if strings.Join(got, "\n") == strings.Join(want, "\n") {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s = %q, want %q", filepath.Base(path), got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRouteCreatesLogs(t *testing.T) {
+	_, cfg := newTestReceiver(t)
+	for _, name := range []string{"access.log", "error.log"} {
+		if _, err := os.Stat(filepath.Join(cfg.SourceDir("api"), name)); err != nil {
+			t.Errorf("expected %s to be created: %v", name, err)
+		}
+	}
+}
+
+func TestReceive(t *testing.T) {
+	r, cfg := newTestReceiver(t)
+	r.receive([]byte("<190>Jan 15 10:30:45 web1 api: first line\n"))
+	r.receive([]byte("<190>Jan 15 10:30:45 web1 api: multi\nline"))
+	r.receive([]byte("<187>Jan 15 10:30:45 web1 api_error: 2024/01/15 10:30:45 [error] 1#0: failed"))
+	r.receive([]byte("<190>Jan 15 10:30:45 web1 other: dropped"))
+	r.receive([]byte("not syslog"))
+
+	dir := cfg.SourceDir("api")
+	waitForLines(t, filepath.Join(dir, "access.log"), []string{"first line", "multi line"})
+	waitForLines(t, filepath.Join(dir, "error.log"), []string{"2024/01/15 10:30:45 [error] 1#0: failed"})
+}
+
+func TestListen(t *testing.T) {
+	r, cfg := newTestReceiver(t)
+
+	// Find a free port that is available for both UDP and TCP
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.cfg.Address = packetConn.LocalAddr().String()
+	packetConn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := r.Listen(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	udp, err := net.Dial("udp", r.cfg.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	if _, err := udp.Write([]byte("<190>Jan 15 10:30:45 web1 api: over udp")); err != nil {
+		t.Fatal(err)
+	}
+	waitForLines(t, filepath.Join(cfg.SourceDir("api"), "access.log"), []string{"over udp"})
+
+	tcp, err := net.Dial("tcp", r.cfg.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	framed := "<187>1 2024-01-15T10:30:45Z web1 api_error - - - octet counted"
+	stream := fmt.Sprintf("%d %s", len(framed), framed) + "<187>Jan 15 10:30:45 web1 api_error: newline delimited\n"
+	if _, err := tcp.Write([]byte(stream)); err != nil {
+		t.Fatal(err)
+	}
+	waitForLines(t, filepath.Join(cfg.SourceDir("api"), "error.log"), []string{"octet counted", "newline delimited"})
+}
@@ -0,0 +1,124 @@
+package tail
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logs"
+)
+
+const maxPageBytes = 4 * 1024 * 1024
+
+// Handler receives the lines written to each source's logs. Its methods are
+// called concurrently for different sources and log types.
+type Handler interface {
+	HandleAccess(source config.Source, lines []string)
+	HandleErrors(source config.Source, lines []string)
+}
+
+// Tailer follows the logs of each source and passes new lines to its
+// handlers.
+type Tailer struct {
+	handlers []Handler
+
+	mu    sync.Mutex
+	tails map[tailKey]context.CancelFunc
+}
+
+func New(handlers ...Handler) *Tailer {
+	return &Tailer{handlers: handlers, tails: make(map[tailKey]context.CancelFunc)}
+}
+
+// Follow tails the access and error logs of each source from their current
+// end until ctx is cancelled. Sources already followed carry on from where
+// they were, and any no longer listed are stopped.
+func (t *Tailer) Follow(ctx context.Context, sources []config.Source) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	keep := make(map[tailKey]bool, len(sources))
+	for _, source := range sources {
+		keep[newTailKey(source)] = true
+	}
+	for key, cancel := range t.tails {
+		if !keep[key] {
+			cancel()
+			delete(t.tails, key)
+		}
+	}
+	for _, source := range sources {
+		key := newTailKey(source)
+		if _, ok := t.tails[key]; ok {
+			continue
+		}
+		tailCtx, cancel := context.WithCancel(ctx)
+		t.tails[key] = cancel
+		go t.tail(tailCtx, source, false)
+		go t.tail(tailCtx, source, true)
+	}
+}
+
+// tailKey identifies a source by the settings that affect how its logs are
+// read.
+type tailKey struct {
+	name       string
+	accessPath string
+	errorPath  string
+	logFormat  string
+}
+
+func newTailKey(source config.Source) tailKey {
+	return tailKey{name: source.Name, accessPath: source.AccessPath, errorPath: source.ErrorPath, logFormat: source.LogFormat}
+}
+
+func (t *Tailer) tail(ctx context.Context, source config.Source, isErrorLog bool) {
+	path := source.AccessLogPath()
+	if isErrorLog {
+		path = source.ErrorLogPath()
+	}
+
+	positions, err := logs.CurrentPositions(path, isErrorLog)
+	if err != nil {
+		logger.Warnf("Failed to read logs to follow from %s: %v", path, err)
+		return
+	}
+	changes, err := logs.Watch(ctx, path)
+	if err != nil {
+		logger.Warnf("Failed to watch logs to follow at %s: %v", path, err)
+		return
+	}
+
+	for range changes {
+		positions = t.readNew(source, path, positions, isErrorLog)
+	}
+}
+
+// readNew passes the lines written since positions to the handlers and
+// returns the positions reached.
+func (t *Tailer) readNew(source config.Source, path string, positions []logs.Position, isErrorLog bool) []logs.Position {
+	for {
+		result, err := logs.GetLogsPage(path, logs.Cursor{Positions: positions}, isErrorLog, false, logs.Limits{MaxBytes: maxPageBytes})
+		if err != nil {
+			// The file may be mid-rotation; retry on the next change
+			logger.Debugf("Error reading logs to follow: %v", err)
+			return positions
+		}
+		if len(result.Positions) > 0 {
+			positions = result.Positions
+		}
+		if len(result.Logs) > 0 {
+			for _, handler := range t.handlers {
+				if isErrorLog {
+					handler.HandleErrors(source, result.Logs)
+				} else {
+					handler.HandleAccess(source, result.Logs)
+				}
+			}
+		}
+		if result.Cursor == "" {
+			return positions
+		}
+	}
+}
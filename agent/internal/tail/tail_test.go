@@ -0,0 +1,120 @@
+package tail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/internal/config"
+)
+
+type recorder struct {
+	mu     sync.Mutex
+	access []string
+	errors []string
+}
+
+func (r *recorder) HandleAccess(source config.Source, lines []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, line := range lines {
+		r.access = append(r.access, source.Name+": "+line)
+	}
+}
+
+func (r *recorder) HandleErrors(source config.Source, lines []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, line := range lines {
+		r.errors = append(r.errors, source.Name+": "+line)
+	}
+}
+
+func (r *recorder) lines() ([]string, []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.access), slices.Clone(r.errors)
+}
+
+func appendLine(t *testing.T, path string, line string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(line + "\n"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	dir := t.TempDir()
+	accessPath := filepath.Join(dir, "access.log")
+	errorPath := filepath.Join(dir, "error.log")
+	if err := os.WriteFile(accessPath, []byte("written before following\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(errorPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := &recorder{}
+	tailer := New(handler)
+	tailer.Follow(ctx, []config.Source{{Name: "default", AccessPath: accessPath, ErrorPath: errorPath}})
+	// Give the watchers time to start before writing
+	time.Sleep(100 * time.Millisecond)
+
+	appendLine(t, accessPath, "GET /login")
+	appendLine(t, errorPath, "[crit] handshake failed")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		access, errors := handler.lines()
+		if len(access) > 0 && len(errors) > 0 {
+			if !slices.Equal(access, []string{"default: GET /login"}) {
+				t.Errorf("got access lines %q", access)
+			}
+			if !slices.Equal(errors, []string{"default: [crit] handshake failed"}) {
+				t.Errorf("got error lines %q", errors)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out with access lines %q and error lines %q", access, errors)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestFollowStopsRemovedSources(t *testing.T) {
+	dir := t.TempDir()
+	accessPath := filepath.Join(dir, "access.log")
+	if err := os.WriteFile(accessPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := &recorder{}
+	tailer := New(handler)
+	source := config.Source{Name: "default", AccessPath: accessPath, ErrorPath: accessPath}
+	tailer.Follow(ctx, []config.Source{source})
+	tailer.Follow(ctx, nil)
+	if len(tailer.tails) != 0 {
+		t.Fatalf("expected no sources to be followed, got %d", len(tailer.tails))
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	appendLine(t, accessPath, "GET /")
+	time.Sleep(200 * time.Millisecond)
+	if access, _ := handler.lines(); len(access) > 0 {
+		t.Errorf("expected a removed source to stop being followed, got %q", access)
+	}
+}
@@ -1,8 +1,12 @@
 package location
 
 import (
+	"errors"
 	"net"
+	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/oschwald/geoip2-golang"
 	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
@@ -13,59 +17,257 @@ type Location struct {
 	IPAddress string `json:"ipAddress"`
 	Country   string `json:"country,omitempty"`
 	City      string `json:"city,omitempty"`
+	// ASN and Organization identify the network the address belongs to,
+	// when a GeoLite2 ASN database is loaded
+	ASN          uint   `json:"asn,omitempty"`
+	Organization string `json:"organization,omitempty"`
 }
 
+// Database describes a loaded GeoLite2 database
+type Database struct {
+	Path      string    `json:"path"`
+	Type      string    `json:"type"`
+	BuildDate time.Time `json:"buildDate"`
+}
+
+// database is an open GeoLite2 database
+type database struct {
+	reader *geoip2.Reader
+	info   Database
+}
+
+// Databases looked for in the working directory when no path is set, in
+// order of preference
+const (
+	defaultCityPath    = "GeoLite2-City.mmdb"
+	defaultCountryPath = "GeoLite2-Country.mmdb"
+	defaultASNPath     = "GeoLite2-ASN.mmdb"
+)
+
 var (
-	cityReader    *geoip2.Reader
-	countryReader *geoip2.Reader
-	initOnce      sync.Once
-	initErr       error
-	initDone      = make(chan struct{})
+	// mu guards the loaded databases, which are replaced when reloaded.
+	// Lookups hold the read lock so that a database isn't closed while in
+	// use.
+	mu        sync.RWMutex
+	cityDB    *database
+	countryDB *database
+	asnDB     *database
+	loaded    bool
+	loadErr   error
+	// loadMu serializes loading databases
+	loadMu sync.Mutex
+	// databasePath is a GeoLite2 City or Country database to load instead of
+	// looking in the working directory
+	databasePath string
+	// asnDatabasePath is a GeoLite2 ASN database to load instead of looking
+	// in the working directory
+	asnDatabasePath string
 )
 
+// SetDatabasePath sets the GeoLite2 City or Country database to load. A
+// path different to the one loaded is loaded by the next lookup.
+func SetDatabasePath(path string) {
+	setPath(&databasePath, path)
+}
+
+// SetASNDatabasePath sets the GeoLite2 ASN database to load. A path
+// different to the one loaded is loaded by the next lookup.
+func SetASNDatabasePath(path string) {
+	setPath(&asnDatabasePath, path)
+}
+
+func setPath(current *string, path string) {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	if path == *current {
+		return
+	}
+	*current = path
+	mu.Lock()
+	loaded = false
+	mu.Unlock()
+}
+
+// DatabasePaths returns the files databases are loaded from, which are
+// reloaded when they change.
+func DatabasePaths() []string {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	paths := []string{defaultCityPath, defaultCountryPath}
+	if databasePath != "" {
+		paths = []string{databasePath}
+	}
+	if asnDatabasePath != "" {
+		return append(paths, asnDatabasePath)
+	}
+	return append(paths, defaultASNPath)
+}
+
 func LocationsEnabled() bool {
-	err := InitializeLookups()
-	return err == nil && (cityReader != nil || countryReader != nil)
+	InitializeLookups()
+	mu.RLock()
+	defer mu.RUnlock()
+	return cityDB != nil || countryDB != nil
+}
+
+// NetworksEnabled reports whether an ASN database is loaded to resolve the
+// networks of IP addresses.
+func NetworksEnabled() bool {
+	InitializeLookups()
+	mu.RLock()
+	defer mu.RUnlock()
+	return asnDB != nil
 }
 
 // InitializeLookups ensures the MaxMind databases are loaded
 func InitializeLookups() error {
-	initOnce.Do(func() {
-		// Try to open the city database first
-		var cityErr error
-		cityReader, cityErr = geoip2.Open("GeoLite2-City.mmdb")
-		if cityErr != nil {
-			// If city database fails, try to open the country database
-			var countryErr error
-			countryReader, countryErr = geoip2.Open("GeoLite2-Country.mmdb")
-			if countryErr != nil {
-				logger.Log.Println("Failed to load GeoLite2 City database:", cityErr)
-				logger.Log.Println("Failed to load GeoLite2 Country database:", countryErr)
-				initErr = countryErr
-			} else {
-				logger.Log.Println("GeoLite2 Country database loaded successfully")
-			}
-		} else {
-			logger.Log.Println("GeoLite2 City database loaded successfully")
+	mu.RLock()
+	done, err := loaded, loadErr
+	mu.RUnlock()
+	if done {
+		return err
+	}
+
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	// Another caller may have loaded the databases while waiting
+	mu.RLock()
+	done, err = loaded, loadErr
+	mu.RUnlock()
+	if done {
+		return err
+	}
+	return load()
+}
+
+// Reload opens the databases again, such as after they're updated or first
+// downloaded, and swaps them for those loaded. If they can't be opened, the
+// databases already loaded are kept.
+func Reload() error {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	return load()
+}
+
+// load opens the databases and replaces those loaded. loadMu must be held.
+func load() error {
+	city, country, geoErr := openDatabases(databasePath)
+	asn, asnErr := openASNDatabase(asnDatabasePath)
+
+	mu.Lock()
+	defer mu.Unlock()
+	loaded = true
+	// No lookups are in progress while the write lock is held
+	if geoErr == nil {
+		closeDatabase(cityDB)
+		closeDatabase(countryDB)
+		cityDB, countryDB = city, country
+	}
+	if asn != nil {
+		closeDatabase(asnDB)
+		asnDB = asn
+	}
+	err := errors.Join(geoErr, asnErr)
+	if cityDB != nil || countryDB != nil || asnDB != nil {
+		loadErr = nil
+	} else {
+		loadErr = err
+	}
+	return err
+}
+
+// openDatabases opens the database at path as the city or country database,
+// depending on its type. Without a path, the city database is looked for in
+// the working directory, then the country database.
+func openDatabases(path string) (city *database, country *database, err error) {
+	if path != "" {
+		db, err := openDatabase(path)
+		if err != nil {
+			logger.Warnf("Failed to load GeoLite2 database %s: %v", path, err)
+			return nil, nil, err
+		}
+		logger.Infof("GeoLite2 database %s loaded successfully", path)
+		if strings.Contains(db.info.Type, "City") {
+			return db, nil, nil
+		}
+		return nil, db, nil
+	}
+
+	// Try to open the city database first
+	city, cityErr := openDatabase(defaultCityPath)
+	if cityErr == nil {
+		logger.Info("GeoLite2 City database loaded successfully")
+		return city, nil, nil
+	}
+	// If city database fails, try to open the country database
+	country, countryErr := openDatabase(defaultCountryPath)
+	if countryErr != nil {
+		logger.Infof("Failed to load GeoLite2 City database: %v", cityErr)
+		logger.Infof("Failed to load GeoLite2 Country database: %v", countryErr)
+		return nil, nil, countryErr
+	}
+	logger.Info("GeoLite2 Country database loaded successfully")
+	return nil, country, nil
+}
+
+// openASNDatabase opens the ASN database at path. Without a path, the ASN
+// database is looked for in the working directory, and is optional.
+func openASNDatabase(path string) (*database, error) {
+	if path == "" {
+		if _, err := os.Stat(defaultASNPath); err != nil {
+			return nil, nil
 		}
-		close(initDone)
-	})
+		path = defaultASNPath
+	}
+	db, err := openDatabase(path)
+	if err != nil {
+		logger.Warnf("Failed to load GeoLite2 ASN database %s: %v", path, err)
+		return nil, err
+	}
+	logger.Infof("GeoLite2 ASN database %s loaded successfully", path)
+	return db, nil
+}
+
+func openDatabase(path string) (*database, error) {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	metadata := reader.Metadata()
+	return &database{
+		reader: reader,
+		info: Database{
+			Path:      path,
+			Type:      metadata.DatabaseType,
+			BuildDate: time.Unix(int64(metadata.BuildEpoch), 0).UTC(),
+		},
+	}, nil
+}
+
+func closeDatabase(db *database) {
+	if db != nil {
+		db.reader.Close()
+	}
+}
 
-	// Wait for initialization to complete
-	<-initDone
-	return initErr
+// Databases returns the databases loaded, or nil if locations are disabled.
+func Databases() []Database {
+	InitializeLookups()
+	mu.RLock()
+	defer mu.RUnlock()
+	var databases []Database
+	for _, db := range []*database{cityDB, countryDB, asnDB} {
+		if db != nil {
+			databases = append(databases, db.info)
+		}
+	}
+	return databases
 }
 
 // LocationLookup returns geolocation information for a single IP address
 func LocationLookup(ipAddress string) (Location, error) {
 	// Ensure databases are initialized
-	if err := InitializeLookups(); err != nil && cityReader == nil && countryReader == nil {
-		return Location{
-			IPAddress: ipAddress,
-			Country:   "",
-			City:      "",
-		}, nil
-	}
+	InitializeLookups()
 
 	// Parse the IP address
 	ip := net.ParseIP(ipAddress)
@@ -81,9 +283,19 @@ func LocationLookup(ipAddress string) (Location, error) {
 		IPAddress: ipAddress,
 	}
 
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if asnDB != nil {
+		if asn, err := asnDB.reader.ASN(ip); err == nil {
+			location.ASN = asn.AutonomousSystemNumber
+			location.Organization = asn.AutonomousSystemOrganization
+		}
+	}
+
 	// Try city lookup first if available
-	if cityReader != nil {
-		city, err := cityReader.City(ip)
+	if cityDB != nil {
+		city, err := cityDB.reader.City(ip)
 		if err == nil {
 			location.Country = city.Country.IsoCode
 			if city.City.Names != nil {
@@ -94,8 +306,8 @@ func LocationLookup(ipAddress string) (Location, error) {
 	}
 
 	// Fall back to country lookup if available
-	if countryReader != nil {
-		country, err := countryReader.Country(ip)
+	if countryDB != nil {
+		country, err := countryDB.reader.Country(ip)
 		if err == nil {
 			location.Country = country.Country.IsoCode
 			return location, nil
@@ -109,8 +321,8 @@ func LocationLookup(ipAddress string) (Location, error) {
 // GetLocations performs geolocation lookups for multiple IP addresses
 func ResolveLocations(ipAddresses []string) ([]Location, error) {
 	// Ensure databases are initialized
-	if err := InitializeLookups(); err != nil && cityReader == nil && countryReader == nil {
-		// Return empty locations if neither database is available
+	if !LocationsEnabled() && !NetworksEnabled() {
+		// Return empty locations if no database is available
 		locations := make([]Location, len(ipAddresses))
 		for i, ip := range ipAddresses {
 			locations[i] = Location{
@@ -143,10 +355,10 @@ func ResolveLocations(ipAddresses []string) ([]Location, error) {
 
 // Close releases resources used by MaxMind readers
 func Close() {
-	if cityReader != nil {
-		cityReader.Close()
-	}
-	if countryReader != nil {
-		countryReader.Close()
-	}
+	mu.Lock()
+	defer mu.Unlock()
+	closeDatabase(cityDB)
+	closeDatabase(countryDB)
+	closeDatabase(asnDB)
+	cityDB, countryDB, asnDB = nil, nil, nil
 }
@@ -0,0 +1,170 @@
+package location
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCityDatabase writes a GeoLite2 City database that locates every IPv4
+// address in city.
+func writeCityDatabase(t *testing.T, path string, city string, buildEpoch uint64) {
+	t.Helper()
+	writeDatabase(t, path, "GeoLite2-City", map[string]any{
+		"country": map[string]any{"iso_code": "GB"},
+		"city":    map[string]any{"names": map[string]any{"en": city}},
+	}, buildEpoch)
+}
+
+// writeDatabase writes a database of the given type with a single record
+// for every IPv4 address.
+func writeDatabase(t *testing.T, path string, databaseType string, data map[string]any, buildEpoch uint64) {
+	t.Helper()
+	var b bytes.Buffer
+	// A single node whose records both point to the first data record
+	const nodeCount = 1
+	record := []byte{0, 0, nodeCount + 16}
+	b.Write(record)
+	b.Write(record)
+	b.Write(make([]byte, 16))
+	writeMap(&b, data)
+	b.WriteString("\xab\xcd\xefMaxMind.com")
+	writeMap(&b, map[string]any{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(24),
+		"ip_version":                  uint16(4),
+		"database_type":               databaseType,
+		"languages":                   []any{"en"},
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 buildEpoch,
+	})
+	if err := os.WriteFile(path, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeMap encodes a map in the MaxMind DB data format.
+func writeMap(b *bytes.Buffer, m map[string]any) {
+	b.WriteByte(7<<5 | byte(len(m)))
+	for key, value := range m {
+		writeValue(b, key)
+		writeValue(b, value)
+	}
+}
+
+func writeValue(b *bytes.Buffer, value any) {
+	switch v := value.(type) {
+	case string:
+		// Sizes from 29 take an extra byte
+		if len(v) < 29 {
+			b.WriteByte(2<<5 | byte(len(v)))
+		} else {
+			b.Write([]byte{2<<5 | 29, byte(len(v) - 29)})
+		}
+		b.WriteString(v)
+	case uint16:
+		b.WriteByte(5<<5 | 2)
+		binary.Write(b, binary.BigEndian, v)
+	case uint32:
+		b.WriteByte(6<<5 | 4)
+		binary.Write(b, binary.BigEndian, v)
+	case uint64:
+		// Extended type 9
+		b.Write([]byte{8, 9 - 7})
+		binary.Write(b, binary.BigEndian, v)
+	case []any:
+		// Extended type 11
+		b.Write([]byte{byte(len(v)), 11 - 7})
+		for _, item := range v {
+			writeValue(b, item)
+		}
+	case map[string]any:
+		writeMap(b, v)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "GeoLite2-City.mmdb")
+	SetDatabasePath(path)
+	t.Cleanup(func() {
+		Close()
+		SetDatabasePath("")
+	})
+
+	// Locations stay disabled while the database is missing
+	if LocationsEnabled() {
+		t.Fatal("expected locations to be disabled without a database")
+	}
+
+	writeCityDatabase(t, path, "London", 1700000000)
+	if err := Reload(); err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	if location, _ := LocationLookup("81.2.69.160"); location.City != "London" || location.Country != "GB" {
+		t.Errorf("unexpected location: %+v", location)
+	}
+
+	// An updated database replaces the loaded one
+	next := filepath.Join(dir, "next.mmdb")
+	writeCityDatabase(t, next, "Manchester", 1700600000)
+	if err := os.Rename(next, path); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(); err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	if location, _ := LocationLookup("81.2.69.160"); location.City != "Manchester" {
+		t.Errorf("unexpected location after update: %+v", location)
+	}
+	databases := Databases()
+	if len(databases) != 1 || databases[0].Type != "GeoLite2-City" || !databases[0].BuildDate.Equal(time.Unix(1700600000, 0)) || databases[0].Path != path {
+		t.Errorf("unexpected databases: %+v", databases)
+	}
+
+	// A database that fails to open keeps the loaded one
+	if err := os.WriteFile(next, []byte("not a database"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(next, path); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(); err == nil {
+		t.Error("expected an error reloading an invalid database")
+	}
+	if location, _ := LocationLookup("81.2.69.160"); location.City != "Manchester" {
+		t.Errorf("unexpected location after a failed reload: %+v", location)
+	}
+}
+
+func TestLocationLookupNetwork(t *testing.T) {
+	dir := t.TempDir()
+	cityPath, asnPath := filepath.Join(dir, "GeoLite2-City.mmdb"), filepath.Join(dir, "GeoLite2-ASN.mmdb")
+	writeCityDatabase(t, cityPath, "London", 1700000000)
+	writeDatabase(t, asnPath, "GeoLite2-ASN", map[string]any{
+		"autonomous_system_number":       uint32(13335),
+		"autonomous_system_organization": "CLOUDFLARENET",
+	}, 1700000000)
+	SetDatabasePath(cityPath)
+	SetASNDatabasePath(asnPath)
+	t.Cleanup(func() {
+		Close()
+		SetDatabasePath("")
+		SetASNDatabasePath("")
+	})
+
+	if !NetworksEnabled() {
+		t.Fatal("expected networks to be enabled")
+	}
+	locations, _ := ResolveLocations([]string{"104.16.0.1"})
+	if len(locations) != 1 || locations[0].ASN != 13335 || locations[0].Organization != "CLOUDFLARENET" || locations[0].City != "London" {
+		t.Errorf("unexpected locations: %+v", locations)
+	}
+	if databases := Databases(); len(databases) != 2 || databases[1].Type != "GeoLite2-ASN" {
+		t.Errorf("unexpected databases: %+v", databases)
+	}
+}
@@ -1,16 +1,111 @@
 package logger
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"strings"
+	"sync/atomic"
 )
 
-var Log *log.Logger
+// Stderr is the output that writes logs to standard error.
+const Stderr = "stderr"
 
+// Config controls the level, format and destination of log messages.
+type Config struct {
+	Level slog.Level
+	// JSON writes each message as a line of JSON instead of text
+	JSON bool
+	// Output is Stderr or the path of a file to append to
+	Output string
+	// MaxSize is the size in bytes a log file reaches before it is rotated,
+	// or 0 to never rotate. MaxBackups rotated files are kept.
+	MaxSize    int64
+	MaxBackups int
+	// Quiet discards every message
+	Quiet bool
+}
+
+var current atomic.Pointer[slog.Logger]
+
+// Until Setup is called, warnings and errors are written to stderr
 func init() {
-	f, err := os.OpenFile("debug.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
-	if err != nil {
-		log.Fatalf("Failed to open log file: %v", err)
+	current.Store(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+}
+
+// Setup replaces the logger with one built from cfg. The returned closer
+// closes the log file, if any.
+func Setup(cfg Config) (io.Closer, error) {
+	var w io.Writer
+	var closer io.Closer = io.NopCloser(nil)
+	switch {
+	case cfg.Quiet:
+		w = io.Discard
+	case cfg.Output == "" || cfg.Output == Stderr:
+		w = os.Stderr
+	default:
+		file, err := OpenRotatingFile(cfg.Output, cfg.MaxSize, cfg.MaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		w, closer = file, file
+	}
+
+	opts := &slog.HandlerOptions{Level: cfg.Level}
+	var handler slog.Handler
+	if cfg.JSON {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
 	}
-	Log = log.New(f, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile)
+	current.Store(slog.New(handler))
+	return closer, nil
+}
+
+// ParseLevel parses a level name: debug, info, warn or error.
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(name))); err != nil {
+		return level, fmt.Errorf("invalid log level %q", name)
+	}
+	return level, nil
+}
+
+func write(level slog.Level, msg string) {
+	current.Load().Log(context.Background(), level, msg)
+}
+
+func logf(level slog.Level, format string, args ...any) {
+	if l := current.Load(); l.Enabled(context.Background(), level) {
+		l.Log(context.Background(), level, fmt.Sprintf(format, args...))
+	}
+}
+
+// Debug logs detail that is only useful when diagnosing a problem, such as
+// each request handled.
+func Debug(msg string) { write(slog.LevelDebug, msg) }
+
+// Info logs normal operation, such as the configuration in use.
+func Info(msg string) { write(slog.LevelInfo, msg) }
+
+// Warn logs a problem that was recovered from.
+func Warn(msg string) { write(slog.LevelWarn, msg) }
+
+// Error logs a failure.
+func Error(msg string) { write(slog.LevelError, msg) }
+
+func Debugf(format string, args ...any) { logf(slog.LevelDebug, format, args...) }
+
+func Infof(format string, args ...any) { logf(slog.LevelInfo, format, args...) }
+
+func Warnf(format string, args ...any) { logf(slog.LevelWarn, format, args...) }
+
+func Errorf(format string, args ...any) { logf(slog.LevelError, format, args...) }
+
+// Fatalf logs an error and exits.
+func Fatalf(format string, args ...any) {
+	logf(slog.LevelError, format, args...)
+	os.Exit(1)
 }
@@ -0,0 +1,133 @@
+package logger
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetupJSONFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	closer, err := Setup(Config{Level: slog.LevelInfo, JSON: true, Output: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Debug("hidden")
+	Infof("Serving %d sources", 2)
+	Warn("careful")
+	closer.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), data)
+	}
+
+	var entry struct {
+		Level string `json:"level"`
+		Msg   string `json:"msg"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Level != "INFO" || entry.Msg != "Serving 2 sources" {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+}
+
+func TestSetupQuiet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	closer, err := Setup(Config{Level: slog.LevelDebug, Output: path, Quiet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+	Error("discarded")
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected no log file in quiet mode")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]slog.Level{"debug": slog.LevelDebug, "INFO": slog.LevelInfo, "warn": slog.LevelWarn, "error": slog.LevelError} {
+		if got, err := ParseLevel(name); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	line := []byte("0123456789\n")
+	f, err := OpenRotatingFile(path, int64(2*len(line)), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for range 7 {
+		if _, err := f.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range map[string]int{path: 1, path + ".1": 2, path + ".2": 2} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Count(string(data), "\n"); got != want {
+			t.Errorf("%s has %d lines, want %d", filepath.Base(name), got, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("expected only two backups to be kept")
+	}
+}
+
+func TestRotatingFileRotateFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	line := []byte("0123456789\n")
+	f, err := OpenRotatingFile(path, int64(len(line)), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// A non-empty directory in place of the backup stops the rename
+	backup := path + ".1"
+	if err := os.MkdirAll(filepath.Join(backup, "dir"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(line); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(line); err == nil {
+		t.Fatal("expected an error when the file cannot be rotated")
+	}
+
+	if err := os.RemoveAll(backup); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(line); err != nil {
+		t.Fatalf("write after a failed rotation: %v", err)
+	}
+	for name, want := range map[string]int{path: 1, backup: 1} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Count(string(data), "\n"); got != want {
+			t.Errorf("%s has %d lines, want %d", filepath.Base(name), got, want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// RotatingFile appends to a file, moving it aside once it reaches a maximum
+// size. Rotated files are named path.1 (newest) to path.N (oldest).
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenRotatingFile opens path for appending, creating it if needed. The file
+// is rotated when a write would take it over maxSize bytes, unless maxSize is
+// 0, and at most maxBackups rotated files are kept.
+func OpenRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, size, err := openAppend(f.path)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	f.size = size
+	return nil
+}
+
+func openAppend(path string) (*os.File, int64, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+// Write appends p to the file, rotating it first if p would take it over its
+// maximum size. Each write is kept whole within a single file.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate shifts each rotated file up by one, dropping the oldest, and starts
+// a new file. The current file stays open until the new one is, so that if
+// rotation fails, writes carry on appending to the current file. Must be
+// called with f.mu held.
+func (f *RotatingFile) rotate() error {
+	if err := f.moveAside(); err != nil {
+		// Carry on appending to the file at the path, wherever the failure
+		// left it
+		if file, size, openErr := openAppend(f.path); openErr == nil {
+			f.swap(file, size)
+		}
+		return fmt.Errorf("failed to rotate %s: %w", f.path, err)
+	}
+	file, size, err := openAppend(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", f.path, err)
+	}
+	f.swap(file, size)
+	return nil
+}
+
+// moveAside renames the current file to the first backup, or removes it if
+// no backups are kept.
+func (f *RotatingFile) moveAside() error {
+	if f.maxBackups == 0 {
+		return os.Remove(f.path)
+	}
+	os.Remove(backupPath(f.path, f.maxBackups))
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		os.Rename(backupPath(f.path, i), backupPath(f.path, i+1))
+	}
+	return os.Rename(f.path, backupPath(f.path, 1))
+}
+
+// swap closes the current file and writes to file from then on.
+func (f *RotatingFile) swap(file *os.File, size int64) {
+	f.file.Close()
+	f.file = file
+	f.size = size
+}
+
+// Close closes the file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func backupPath(path string, n int) string {
+	return path + "." + strconv.Itoa(n)
+}
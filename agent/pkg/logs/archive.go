@@ -0,0 +1,208 @@
+package logs
+
+import (
+	"container/list"
+	"os"
+	"sort"
+	"sync"
+)
+
+// DefaultArchiveCacheSize is the default memory budget for decompressed
+// archives, in bytes.
+const DefaultArchiveCacheSize = 256 * 1024 * 1024
+
+// archives caches the decompressed content of rotated archives. Archives
+// never change once written, so they only need to be decompressed once.
+var archives = newArchiveCache(DefaultArchiveCacheSize)
+
+// SetArchiveCacheSize sets the memory budget for decompressed archives in
+// bytes, evicting the least recently used archives to fit. Zero disables the
+// cache.
+func SetArchiveCacheSize(maxBytes int64) {
+	archives.resize(maxBytes)
+}
+
+// archiveKey identifies an archive by path, size and modification time, so
+// that an archive replaced under the same name isn't served from the cache.
+type archiveKey struct {
+	path    string
+	size    int64
+	modTime int64
+}
+
+func newArchiveKey(filePath string, info os.FileInfo) archiveKey {
+	return archiveKey{path: filePath, size: info.Size(), modTime: info.ModTime().UnixNano()}
+}
+
+type archiveEntry struct {
+	key   archiveKey
+	chunk chunk
+	size  int64
+}
+
+// maxOversized bounds the number of archives remembered as too large to
+// cache.
+const maxOversized = 1024
+
+type archiveCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	entries  map[archiveKey]*list.Element
+	// order holds entries from most to least recently used
+	order *list.List
+	// oversized holds archives found too large for the budget, so that they
+	// aren't decompressed again only to be discarded
+	oversized map[archiveKey]struct{}
+}
+
+func newArchiveCache(maxBytes int64) *archiveCache {
+	return &archiveCache{
+		maxBytes:  maxBytes,
+		entries:   make(map[archiveKey]*list.Element),
+		order:     list.New(),
+		oversized: make(map[archiveKey]struct{}),
+	}
+}
+
+func (c *archiveCache) limit() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.maxBytes
+}
+
+func (c *archiveCache) get(key archiveKey) (chunk, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return chunk{}, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*archiveEntry).chunk, true
+}
+
+func (c *archiveCache) add(key archiveKey, content chunk) {
+	size := chunkSize(content)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if size > c.maxBytes {
+		return
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&archiveEntry{key: key, chunk: content, size: size})
+	c.size += size
+	c.evict()
+}
+
+// markOversized records that the archive doesn't fit in the budget.
+func (c *archiveCache) markOversized(key archiveKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.oversized) >= maxOversized {
+		clear(c.oversized)
+	}
+	c.oversized[key] = struct{}{}
+}
+
+func (c *archiveCache) isOversized(key archiveKey) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.oversized[key]
+	return ok
+}
+
+func (c *archiveCache) resize(maxBytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxBytes = maxBytes
+	// Archives too large before may fit a new budget
+	clear(c.oversized)
+	c.evict()
+}
+
+// evict removes the least recently used archives until the cache fits its
+// budget. The caller must hold the lock.
+func (c *archiveCache) evict() {
+	for c.size > c.maxBytes && c.order.Len() > 0 {
+		entry := c.order.Remove(c.order.Back()).(*archiveEntry)
+		delete(c.entries, entry.key)
+		c.size -= entry.size
+	}
+}
+
+// chunkSize estimates the memory held by a chunk, including slice and string
+// headers.
+func chunkSize(c chunk) int64 {
+	size := int64(len(c.lines)) * (16 + 8)
+	for _, line := range c.lines {
+		size += int64(len(line))
+	}
+	return size
+}
+
+// sliceChunk returns the lines of an archive read from its start that end
+// after offset, up to the limits.
+func sliceChunk(c chunk, offset int64, limits Limits) chunk {
+	i := sort.Search(len(c.ends), func(i int) bool { return c.ends[i] > offset })
+	j := i
+	var size int64
+	for ; j < len(c.lines); j++ {
+		if j > i && exceeds(limits, j-i+1, size+int64(len(c.lines[j]))) {
+			break
+		}
+		size += int64(len(c.lines[j]))
+	}
+
+	result := chunk{lines: c.lines[i:j], ends: c.ends[i:j], end: max(offset, c.end)}
+	if j < len(c.lines) {
+		result.end = c.ends[j-1]
+		result.more = true
+	}
+	return result
+}
+
+// identifyArchive records the identity of a compressed archive on pos. The
+// fingerprint covers the compressed bytes, which never change.
+func identifyArchive(filePath string, pos *Position) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	pos.Device, pos.Inode = fileID(info)
+	pos.Fingerprint, err = fingerprint(filePath, min(info.Size(), fingerprintSize))
+	return err
+}
+
+// archivePosition returns the decompressed offset the client has already
+// read from the archive at filePath, and whether it has been read in full.
+// Archives are matched by fingerprint so that they are recognised after
+// being renamed by log rotation, and by name for positions without an
+// identity.
+func archivePosition(filePath string, name string, info os.FileInfo, positions []Position) (offset int64, complete bool) {
+	current, err := fingerprint(filePath, min(info.Size(), fingerprintSize))
+	if err != nil || current == "" {
+		return 0, false
+	}
+
+	device, inode := fileID(info)
+	for _, p := range positions {
+		if p.Fingerprint != current {
+			continue
+		}
+		if p.hasIdentity() && inode != 0 && (p.Device != device || p.Inode != inode) {
+			continue
+		}
+		if !p.hasIdentity() && p.Filename != name {
+			continue
+		}
+		return p.Position, p.Complete
+	}
+	return 0, false
+}
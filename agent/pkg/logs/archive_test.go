@@ -0,0 +1,143 @@
+package logs
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestArchiveCache(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "access.log.2.gz")
+	writeGzipFile(t, filePath, "one\ntwo\n")
+
+	result, err := GetLogs(filePath, nil, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Logs, []string{"one", "two"}) {
+		t.Fatalf("unexpected logs: %v", result.Logs)
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := archives.get(newArchiveKey(filePath, info)); !ok {
+		t.Fatal("archive was not cached")
+	}
+
+	// A replaced archive is read again rather than served from the cache
+	writeGzipFile(t, filePath, "three\nfour\nfive\n")
+	result, err = GetLogs(filePath, nil, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Logs, []string{"three", "four", "five"}) {
+		t.Fatalf("unexpected logs after replacement: %v", result.Logs)
+	}
+}
+
+func TestArchiveCacheEviction(t *testing.T) {
+	cache := newArchiveCache(100)
+	content := chunk{lines: []string{"0123456789"}, ends: []int64{11}, end: 11}
+	for i := range 5 {
+		cache.add(archiveKey{path: string(rune('a' + i))}, content)
+	}
+
+	if cache.size > cache.maxBytes {
+		t.Errorf("cache exceeds budget: %d > %d", cache.size, cache.maxBytes)
+	}
+	if _, ok := cache.get(archiveKey{path: "a"}); ok {
+		t.Error("least recently used archive was not evicted")
+	}
+	if _, ok := cache.get(archiveKey{path: "e"}); !ok {
+		t.Error("most recently used archive was evicted")
+	}
+
+	cache.resize(0)
+	if cache.order.Len() != 0 || cache.size != 0 {
+		t.Errorf("disabled cache still holds %d archives", cache.order.Len())
+	}
+}
+
+func TestGetLogsSkipsArchivesAlreadyRead(t *testing.T) {
+	dirPath := t.TempDir()
+	appendToFile(t, filepath.Join(dirPath, "access.log"), "current\n")
+	writeGzipFile(t, filepath.Join(dirPath, "access.log.2.gz"), "archived\n")
+
+	result, err := GetLogs(dirPath, nil, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Logs, []string{"current", "archived"}) {
+		t.Fatalf("unexpected logs: %v", result.Logs)
+	}
+
+	// Archives are recognised after being renamed by the next rotation
+	if err := os.Rename(filepath.Join(dirPath, "access.log.2.gz"), filepath.Join(dirPath, "access.log.3.gz")); err != nil {
+		t.Fatal(err)
+	}
+	writeGzipFile(t, filepath.Join(dirPath, "access.log.2.gz"), "newly archived\n")
+
+	result, err = GetLogs(dirPath, result.Positions, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Logs, []string{"newly archived"}) {
+		t.Fatalf("unexpected logs: %v", result.Logs)
+	}
+	for _, pos := range result.Positions {
+		if filepath.Ext(pos.Filename) == ".gz" && !pos.Complete {
+			t.Errorf("archive %s not marked complete", pos.Filename)
+		}
+	}
+}
+
+func TestGetLogsPageWithoutArchiveCache(t *testing.T) {
+	SetArchiveCacheSize(0)
+	defer SetArchiveCacheSize(DefaultArchiveCacheSize)
+
+	filePath := filepath.Join(t.TempDir(), "access.log.2.gz")
+	writeGzipFile(t, filePath, "one\ntwo\nthree\n")
+
+	lines, last, pages := readAllPages(t, filePath, Limits{MaxLines: 2})
+	if !slices.Equal(lines, []string{"one", "two", "three"}) {
+		t.Errorf("unexpected logs: %v", lines)
+	}
+	if pages != 2 {
+		t.Errorf("unexpected page count: %d", pages)
+	}
+	if !last.Positions[0].Complete {
+		t.Errorf("archive not marked complete: %+v", last.Positions[0])
+	}
+}
+
+func TestGetLogsPageOversizedArchive(t *testing.T) {
+	SetArchiveCacheSize(16)
+	defer SetArchiveCacheSize(DefaultArchiveCacheSize)
+
+	filePath := filepath.Join(t.TempDir(), "access.log.2.gz")
+	writeGzipFile(t, filePath, "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\n")
+
+	lines, _, pages := readAllPages(t, filePath, Limits{MaxLines: 3})
+	if !slices.Equal(lines, []string{"one", "two", "three", "four", "five", "six", "seven", "eight"}) {
+		t.Errorf("unexpected logs: %v", lines)
+	}
+	if pages != 3 {
+		t.Errorf("unexpected page count: %d", pages)
+	}
+
+	// The archive is remembered as too large rather than cached
+	info, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := newArchiveKey(filePath, info)
+	if _, ok := archives.get(key); ok {
+		t.Error("oversized archive was cached")
+	}
+	if !archives.isOversized(key) {
+		t.Error("oversized archive was not remembered")
+	}
+}
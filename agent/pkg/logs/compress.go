@@ -0,0 +1,54 @@
+package logs
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// compressedExtensions are the archive formats that rotated logs are read
+// from, as produced by logrotate's compresscmd.
+var compressedExtensions = []string{".gz", ".zst", ".bz2", ".xz"}
+
+// isCompressedLogFile reports whether name is a compressed archive that can
+// be decompressed.
+func isCompressedLogFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range compressedExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// newDecompressor returns a reader of the decompressed content of r, chosen
+// by the extension of name.
+func newDecompressor(name string, r io.Reader) (io.ReadCloser, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".gz":
+		return gzip.NewReader(r)
+	case ".zst":
+		decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	case ".bz2":
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	case ".xz":
+		reader, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(reader), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", name)
+	}
+}
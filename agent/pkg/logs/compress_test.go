@@ -0,0 +1,102 @@
+package logs
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// bzip2Logs is "bzip2 logs\n" compressed with bzip2, which the standard
+// library can only decompress.
+const bzip2Logs = "\x42\x5a\x68\x39\x31\x41\x59\x26\x53\x59\xba\xc5\x91\x1a\x00\x00\x01\xd9\x80\x00\x10\x40\x00\x10\x00\x10\xa4\xc8\x10\x20\x00\x22\x98\x06\xd4\x20\x1a\x69\xa1\x42\x84\x58\x07\x0b\xb9\x22\x9c\x28\x48\x5d\x62\xc8\x8d\x00"
+
+func writeZstdFile(t *testing.T, path string, content string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeXzFile(t *testing.T, path string, content string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	xw, err := xz.NewWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := xw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := xw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetDirectoryLogsCompressedFormats(t *testing.T) {
+	dirPath := t.TempDir()
+	appendToFile(t, filepath.Join(dirPath, "access.log"), "plain logs\n")
+	writeGzipFile(t, filepath.Join(dirPath, "access.log.2.gz"), "gzip logs\n")
+	writeZstdFile(t, filepath.Join(dirPath, "access.log.3.zst"), "zstd logs\n")
+	if err := os.WriteFile(filepath.Join(dirPath, "access.log.4.bz2"), []byte(bzip2Logs), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeXzFile(t, filepath.Join(dirPath, "access.log.5.xz"), "xz logs\n")
+
+	result, err := GetDirectoryLogs(dirPath, nil, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"plain logs", "gzip logs", "zstd logs", "bzip2 logs", "xz logs"}
+	if !slices.Equal(result.Logs, want) {
+		t.Errorf("unexpected logs: got %v want %v", result.Logs, want)
+	}
+
+	result, err = GetDirectoryLogs(dirPath, nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Logs, []string{"plain logs"}) {
+		t.Errorf("compressed logs returned without includeCompressed: %v", result.Logs)
+	}
+
+	sizes, err := GetLogSizes(dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sizes.Summary.CompressedFilesCount != 4 {
+		t.Errorf("unexpected compressed file count: %d", sizes.Summary.CompressedFilesCount)
+	}
+}
+
+func TestGetLogCompressedFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "access.log.1.zst")
+	writeZstdFile(t, filePath, "one\ntwo\n")
+
+	result, err := GetLog(filePath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Logs, []string{"one", "two"}) {
+		t.Errorf("unexpected logs: %v", result.Logs)
+	}
+}
@@ -0,0 +1,207 @@
+package logs
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// Patterns selects log files by glob, using the syntax of path.Match. A
+// pattern containing a slash is matched against the file's path relative to
+// the log directory, and any other pattern against the file name alone. A
+// file is selected if it matches an include pattern and no exclude pattern.
+type Patterns struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// Discovery configures which files in a log directory are read as access and
+// error logs.
+type Discovery struct {
+	Access Patterns `json:"access"`
+	Error  Patterns `json:"error"`
+	// Recursive also reads log files in subdirectories.
+	Recursive bool `json:"recursive,omitempty"`
+}
+
+// DefaultDiscovery reads .log files, their numbered rotations and compressed
+// archives, treating those with "error" in their name as error logs.
+var DefaultDiscovery = Discovery{
+	Access: Patterns{Include: logFilePatterns(""), Exclude: []string{"*error*"}},
+	Error:  Patterns{Include: logFilePatterns("*error")},
+}
+
+func logFilePatterns(prefix string) []string {
+	patterns := []string{prefix + "*.log", prefix + "*.log.[0-9]*"}
+	for _, ext := range compressedExtensions {
+		patterns = append(patterns, prefix+"*"+ext)
+	}
+	return patterns
+}
+
+var discovery atomic.Pointer[Discovery]
+
+func init() {
+	SetDiscovery(DefaultDiscovery)
+}
+
+// SetDiscovery sets the patterns used to find log files in directories.
+func SetDiscovery(d Discovery) {
+	discovery.Store(&d)
+}
+
+// CurrentDiscovery returns the patterns used to find log files in
+// directories.
+func CurrentDiscovery() Discovery {
+	return *discovery.Load()
+}
+
+// WithOverrides returns the patterns with include and exclude replaced by any
+// that are given. Replacing the includes also drops the default excludes, as
+// they were chosen to suit the default includes.
+func (p Patterns) WithOverrides(include []string, exclude []string) Patterns {
+	if len(include) > 0 {
+		p = Patterns{Include: include}
+	}
+	if len(exclude) > 0 {
+		p.Exclude = exclude
+	}
+	return p
+}
+
+// Validate checks that every pattern is well formed.
+func (d Discovery) Validate() error {
+	for _, patterns := range [][]string{d.Access.Include, d.Access.Exclude, d.Error.Include, d.Error.Exclude} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (d Discovery) patterns(isErrorLog bool) Patterns {
+	if isErrorLog {
+		return d.Error
+	}
+	return d.Access
+}
+
+// match reports whether the file at relPath, relative to the log directory,
+// is selected, along with the reason why.
+func (p Patterns) match(relPath string) (bool, string) {
+	relPath = filepath.ToSlash(relPath)
+	name := path.Base(relPath)
+	matches := func(pattern string) bool {
+		target := name
+		if strings.Contains(pattern, "/") {
+			target = relPath
+		}
+		ok, _ := path.Match(pattern, target)
+		return ok
+	}
+
+	for _, pattern := range p.Exclude {
+		if matches(pattern) {
+			return false, fmt.Sprintf("matches exclude pattern %q", pattern)
+		}
+	}
+	for _, pattern := range p.Include {
+		if matches(pattern) {
+			return true, fmt.Sprintf("matches include pattern %q", pattern)
+		}
+	}
+	return false, "matches no include pattern"
+}
+
+// FileMatch describes whether a file is read as a log, and why.
+type FileMatch struct {
+	Path    string `json:"path"`
+	Matched bool   `json:"matched"`
+	Reason  string `json:"reason"`
+}
+
+// MatchLogFiles lists the files under logPath with whether each is read as
+// an access or error log. A path to a single file is always read.
+func MatchLogFiles(logPath string, isErrorLog bool) ([]FileMatch, error) {
+	fileInfo, err := os.Stat(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("path error: %w", err)
+	}
+	if !fileInfo.IsDir() {
+		return []FileMatch{{Path: logPath, Matched: true, Reason: "configured as a file"}}, nil
+	}
+
+	d := CurrentDiscovery()
+	files, err := walkFiles(logPath, d.Recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]FileMatch, len(files))
+	for i, file := range files {
+		matched, reason := d.patterns(isErrorLog).match(file)
+		matches[i] = FileMatch{Path: filepath.Join(logPath, file), Matched: matched, Reason: reason}
+	}
+	return matches, nil
+}
+
+// listLogFiles returns the sorted paths, relative to dirPath, of the access or
+// error log files in a directory.
+func listLogFiles(dirPath string, isErrorLog bool, includeCompressed bool) ([]string, error) {
+	d := CurrentDiscovery()
+	files, err := walkFiles(dirPath, d.Recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	var logFiles []string
+	for _, file := range files {
+		if isCompressedLogFile(file) && !includeCompressed {
+			continue
+		}
+		if matched, _ := d.patterns(isErrorLog).match(file); matched {
+			logFiles = append(logFiles, file)
+		}
+	}
+	return logFiles, nil
+}
+
+// walkFiles returns the sorted paths, relative to dirPath, of the files in a
+// directory and, if recursive, its subdirectories.
+func walkFiles(dirPath string, recursive bool) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dirPath, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if filePath == dirPath {
+				return err
+			}
+			// Skip unreadable subdirectories
+			return fs.SkipDir
+		}
+		if entry.IsDir() {
+			if filePath != dirPath && !recursive {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dirPath, filePath)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
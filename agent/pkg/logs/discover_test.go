@@ -0,0 +1,164 @@
+package logs
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func setDiscovery(t *testing.T, d Discovery) {
+	t.Helper()
+	previous := CurrentDiscovery()
+	SetDiscovery(d)
+	t.Cleanup(func() { SetDiscovery(previous) })
+}
+
+func writeLogFiles(t *testing.T, dirPath string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		filePath := filepath.Join(dirPath, name)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestListLogFilesDefault(t *testing.T) {
+	dirPath := t.TempDir()
+	writeLogFiles(t, dirPath, map[string]string{
+		"access.log":      "",
+		"access.log.1":    "",
+		"access.log.2.gz": "",
+		"access.log.old":  "",
+		"error.log":       "",
+		"error.log.1":     "",
+		"notes.txt":       "",
+		"api/access.log":  "",
+	})
+
+	access, err := listLogFiles(dirPath, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"access.log", "access.log.1", "access.log.2.gz"}; !slices.Equal(access, want) {
+		t.Errorf("access logs: got %v, want %v", access, want)
+	}
+
+	errors, err := listLogFiles(dirPath, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"error.log", "error.log.1"}; !slices.Equal(errors, want) {
+		t.Errorf("error logs: got %v, want %v", errors, want)
+	}
+}
+
+func TestListLogFilesPatterns(t *testing.T) {
+	dirPath := t.TempDir()
+	writeLogFiles(t, dirPath, map[string]string{
+		"api-errors-proxy.access.log": "",
+		"shop.access":                 "",
+		"shop.error":                  "",
+		"debug.access":                "",
+	})
+	setDiscovery(t, Discovery{
+		Access: DefaultDiscovery.Access.WithOverrides([]string{"*.access", "*.access.log"}, []string{"debug.*"}),
+		Error:  DefaultDiscovery.Error.WithOverrides([]string{"*.error"}, nil),
+	})
+
+	access, err := listLogFiles(dirPath, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"api-errors-proxy.access.log", "shop.access"}; !slices.Equal(access, want) {
+		t.Errorf("access logs: got %v, want %v", access, want)
+	}
+
+	errors, err := listLogFiles(dirPath, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"shop.error"}; !slices.Equal(errors, want) {
+		t.Errorf("error logs: got %v, want %v", errors, want)
+	}
+}
+
+func TestGetDirectoryLogsRecursive(t *testing.T) {
+	dirPath := t.TempDir()
+	writeLogFiles(t, dirPath, map[string]string{
+		"access.log":          "root\n",
+		"api/access.log":      "api\n",
+		"shop/v2/access.log":  "shop\n",
+		"shop/v2/archive.txt": "ignored\n",
+	})
+	setDiscovery(t, Discovery{
+		Access:    DefaultDiscovery.Access.WithOverrides(nil, []string{"shop/*/*"}),
+		Error:     DefaultDiscovery.Error,
+		Recursive: true,
+	})
+
+	result, err := GetLogs(dirPath, nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"root", "api"}; !slices.Equal(result.Logs, want) {
+		t.Errorf("got logs %v, want %v", result.Logs, want)
+	}
+	if len(result.Positions) != 2 || result.Positions[1].Filename != filepath.Join("api", "access.log") {
+		t.Fatalf("unexpected positions: %+v", result.Positions)
+	}
+
+	// Reading resumes from positions in subdirectories
+	result, err = GetLogs(dirPath, result.Positions, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Logs) != 0 {
+		t.Errorf("expected no new logs, got %v", result.Logs)
+	}
+}
+
+func TestMatchLogFiles(t *testing.T) {
+	dirPath := t.TempDir()
+	writeLogFiles(t, dirPath, map[string]string{
+		"access.log": "",
+		"error.log":  "",
+		"notes.txt":  "",
+	})
+
+	matches, err := MatchLogFiles(dirPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileMatch{
+		{Path: filepath.Join(dirPath, "access.log"), Matched: true, Reason: `matches include pattern "*.log"`},
+		{Path: filepath.Join(dirPath, "error.log"), Matched: false, Reason: `matches exclude pattern "*error*"`},
+		{Path: filepath.Join(dirPath, "notes.txt"), Matched: false, Reason: "matches no include pattern"},
+	}
+	if !slices.Equal(matches, want) {
+		t.Errorf("got %+v, want %+v", matches, want)
+	}
+
+	filePath := filepath.Join(dirPath, "notes.txt")
+	matches, err = MatchLogFiles(filePath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || !matches[0].Matched || matches[0].Path != filePath {
+		t.Errorf("expected a configured file to match, got %+v", matches)
+	}
+}
+
+func TestDiscoveryValidate(t *testing.T) {
+	if err := DefaultDiscovery.Validate(); err != nil {
+		t.Errorf("default discovery is invalid: %v", err)
+	}
+	d := Discovery{Access: Patterns{Include: []string{"[a-"}}}
+	if err := d.Validate(); err == nil {
+		t.Error("expected an error for a malformed pattern")
+	}
+}
@@ -0,0 +1,126 @@
+package logs
+
+import (
+	"encoding/hex"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// fingerprintSize is the maximum number of leading bytes hashed to detect a
+// file whose inode has been reused or whose content has been rewritten.
+const fingerprintSize = 1024
+
+// identify records the identity of the file at filePath on pos. The
+// fingerprint covers only bytes before pos.Position, which have already been
+// read and so never change while the file is only appended to.
+func identify(filePath string, pos *Position) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	pos.Device, pos.Inode = fileID(info)
+	pos.Fingerprint, err = fingerprint(filePath, min(pos.Position, fingerprintSize))
+	return err
+}
+
+// fingerprint hashes the first n bytes of a file. It returns an empty string
+// if the file is shorter than n bytes.
+func fingerprint(filePath string, n int64) (string, error) {
+	if n <= 0 {
+		return "", nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(file, buf); err == io.ErrUnexpectedEOF || err == io.EOF {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	h := fnv.New64a()
+	h.Write(buf)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hasIdentity reports whether a position was recorded with a file identity,
+// rather than by an older client that only tracks filenames.
+func (p Position) hasIdentity() bool {
+	return p.Inode != 0
+}
+
+// sameFile reports whether the file described by info is the file p was
+// recorded from.
+func (p Position) sameFile(info os.FileInfo) bool {
+	device, inode := fileID(info)
+	return p.hasIdentity() && p.Device == device && p.Inode == inode
+}
+
+// unchanged reports whether the content p has already read from filePath is
+// still intact, so reading can resume from p.Position.
+func (p Position) unchanged(filePath string) bool {
+	current, err := fingerprint(filePath, min(p.Position, fingerprintSize))
+	return err == nil && current == p.Fingerprint
+}
+
+// resumePosition returns the offset to continue reading the file at filePath
+// from, given the client's stored positions. Positions are matched to the file
+// by identity so that a renamed file keeps its offset, and by name for
+// positions without an identity. rotated is true when the file matched by
+// name has been replaced or truncated since it was last read.
+func resumePosition(filePath string, name string, info os.FileInfo, positions []Position) (position int64, rotated bool) {
+	for _, p := range positions {
+		if p.sameFile(info) {
+			if p.Position > info.Size() || !p.unchanged(filePath) {
+				return 0, true
+			}
+			return p.Position, false
+		}
+	}
+	for _, p := range positions {
+		if p.Filename == name || p.Filename == "" && len(positions) == 1 {
+			if p.hasIdentity() {
+				// A different file now has this name
+				return 0, true
+			}
+			return p.Position, false
+		}
+	}
+	return 0, false
+}
+
+// findRenamed searches a directory for the uncompressed file that p was
+// recorded from, such as an access.log moved to access.log.1 by logrotate.
+// Subdirectories are searched too when discovery is recursive, matching the
+// files read from the directory.
+func findRenamed(dirPath string, p Position) (string, bool) {
+	if !p.hasIdentity() {
+		return "", false
+	}
+
+	files, err := walkFiles(dirPath, CurrentDiscovery().Recursive)
+	if err != nil {
+		return "", false
+	}
+	for _, file := range files {
+		if isCompressedLogFile(file) {
+			continue
+		}
+		filePath := filepath.Join(dirPath, file)
+		info, err := os.Stat(filePath)
+		if err != nil {
+			continue
+		}
+		if p.sameFile(info) && p.unchanged(filePath) {
+			return filePath, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package logs
+
+import "os"
+
+// fileID reports no identity on platforms without inodes, so positions fall
+// back to being matched by filename.
+func fileID(info os.FileInfo) (device uint64, inode uint64) {
+	return 0, 0
+}
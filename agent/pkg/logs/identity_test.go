@@ -0,0 +1,178 @@
+package logs
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func appendToFile(t *testing.T, path string, content string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetDirectoryLogsFollowsRenamedFile(t *testing.T) {
+	dirPath := t.TempDir()
+	logPath := filepath.Join(dirPath, "access.log")
+	appendToFile(t, logPath, "first\n")
+
+	result, err := GetDirectoryLogs(dirPath, nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Rotated {
+		t.Error("unexpected rotation on first read")
+	}
+
+	// Lines written before rotation but not yet read, then logrotate renames
+	// the file and nginx starts a new one
+	appendToFile(t, logPath, "second\n")
+	if err := os.Rename(logPath, filepath.Join(dirPath, "access.log.1")); err != nil {
+		t.Fatal(err)
+	}
+	appendToFile(t, logPath, "third\n")
+
+	result, err = GetDirectoryLogs(dirPath, result.Positions, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Logs, []string{"third", "second"}) {
+		t.Errorf("unexpected logs: %v", result.Logs)
+	}
+	if !result.Rotated {
+		t.Error("expected rotation to be reported")
+	}
+
+	// With the new positions, nothing is delivered twice
+	result, err = GetDirectoryLogs(dirPath, result.Positions, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Logs) != 0 || result.Rotated {
+		t.Errorf("unexpected result after rotation: %+v", result)
+	}
+}
+
+func TestGetDirectoryLogsDetectsRewrittenFile(t *testing.T) {
+	dirPath := t.TempDir()
+	logPath := filepath.Join(dirPath, "access.log")
+	appendToFile(t, logPath, "original line\n")
+
+	result, err := GetDirectoryLogs(dirPath, nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Truncated in place (copytruncate) and written past the old offset
+	if err := os.WriteFile(logPath, []byte("replacement line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = GetDirectoryLogs(dirPath, result.Positions, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Logs, []string{"replacement line"}) {
+		t.Errorf("unexpected logs: %v", result.Logs)
+	}
+	if !result.Rotated {
+		t.Error("expected rotation to be reported")
+	}
+}
+
+func TestGetLogsFollowsRenamedSingleFile(t *testing.T) {
+	dirPath := t.TempDir()
+	logPath := filepath.Join(dirPath, "access.log")
+	appendToFile(t, logPath, "first\n")
+
+	result, err := GetLogs(logPath, nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appendToFile(t, logPath, "second\n")
+	if err := os.Rename(logPath, filepath.Join(dirPath, "access.log.1")); err != nil {
+		t.Fatal(err)
+	}
+	appendToFile(t, logPath, "third\n")
+
+	result, err = GetLogs(logPath, result.Positions, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Logs, []string{"second", "third"}) {
+		t.Errorf("unexpected logs: %v", result.Logs)
+	}
+	if !result.Rotated {
+		t.Error("expected rotation to be reported")
+	}
+	if result.Positions[0].Position != int64(len("third\n")) {
+		t.Errorf("unexpected position: %+v", result.Positions[0])
+	}
+}
+
+func TestGetDirectoryLogsLegacyPositions(t *testing.T) {
+	dirPath := t.TempDir()
+	appendToFile(t, filepath.Join(dirPath, "access.log"), "first\nsecond\n")
+
+	// Positions from clients that only track filenames still resume
+	positions := []Position{{Filename: "access.log", Position: int64(len("first\n"))}}
+	result, err := GetDirectoryLogs(dirPath, positions, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Logs, []string{"second"}) || result.Rotated {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestGetLogsFollowsRenamedFileInSubdirectory(t *testing.T) {
+	setDiscovery(t, Discovery{
+		Access:    DefaultDiscovery.Access,
+		Error:     DefaultDiscovery.Error,
+		Recursive: true,
+	})
+	dirPath := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dirPath, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	logPath := filepath.Join(dirPath, "sub", "access.log")
+	appendToFile(t, logPath, "first\n")
+
+	result, err := GetLogs(dirPath, nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appendToFile(t, logPath, "second\n")
+	if err := os.Rename(logPath, filepath.Join(dirPath, "sub", "access.log.1")); err != nil {
+		t.Fatal(err)
+	}
+	appendToFile(t, logPath, "third\n")
+
+	result, err = GetLogs(dirPath, result.Positions, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(result.Logs)
+	if !slices.Equal(result.Logs, []string{"second", "third"}) {
+		t.Errorf("unexpected logs: %v", result.Logs)
+	}
+
+	// The renamed file is also found for a position recorded without a name
+	pos := Position{Position: int64(len("first\n"))}
+	if err := identify(filepath.Join(dirPath, "sub", "access.log.1"), &pos); err != nil {
+		t.Fatal(err)
+	}
+	if renamed, ok := findRenamed(dirPath, pos); !ok || renamed != filepath.Join(dirPath, "sub", "access.log.1") {
+		t.Errorf("renamed file not found: %q", renamed)
+	}
+}
@@ -2,29 +2,43 @@ package logs
 
 import (
 	"bufio"
-	"compress/gzip"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
 )
 
 const maxLogLineSize = 10 * 1024 * 1024
 
+// Position is the offset reached in a log file. Device, Inode and Fingerprint
+// identify the file independently of its name, so that reading can continue
+// from the same offset after the file is renamed by log rotation. For
+// compressed archives, the offset is into the decompressed content and
+// Complete is set once the archive has been read in full.
 type Position struct {
-	Position int64  `json:"position"`
-	Filename string `json:"filename,omitempty"`
+	Position    int64  `json:"position"`
+	Filename    string `json:"filename,omitempty"`
+	Device      uint64 `json:"device,omitempty"`
+	Inode       uint64 `json:"inode,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Complete    bool   `json:"complete,omitempty"`
 }
 
 type LogResult struct {
-	Logs      []string   `json:"logs"`
-	Positions []Position `json:"positions,omitempty"`
+	Logs      []string         `json:"logs"`
+	Records   []nginx.NGINXLog `json:"records,omitempty"`
+	Positions []Position       `json:"positions,omitempty"`
+	// Rotated is set when a previously read file has been replaced or
+	// truncated, and so has been read again from the start.
+	Rotated bool `json:"rotated,omitempty"`
+	// Cursor is set when the result was cut short by a limit, and fetches
+	// the next page when passed back.
+	Cursor string `json:"cursor,omitempty"`
 }
 
 func isNumericExtension(ext string) bool {
@@ -44,32 +58,21 @@ func isRotatedLogFile(name string) bool {
 }
 
 func GetLogs(path string, positions []Position, isErrorLog bool, includeCompressed bool) (LogResult, error) {
-	// Check if we're serving a directory or a single file
-	fileInfo, err := os.Stat(path)
-	if err != nil {
-		return LogResult{}, fmt.Errorf("path error: %w", err)
-	}
-
-	var result LogResult
-	if fileInfo.IsDir() {
-		// Serve logs from directory
-		result, err = GetDirectoryLogs(path, positions, isErrorLog, includeCompressed)
-	} else {
-		// Serve a single log file
-		singlePos := int64(0)
-		if len(positions) > 0 {
-			singlePos = positions[0].Position
-		}
-		result, err = GetLog(path, singlePos)
-	}
+	return GetLogsPage(path, Cursor{Positions: positions}, isErrorLog, includeCompressed, Limits{})
+}
 
-	return result, err
+// ParseLogs replaces the raw lines in a result with structured records parsed
+// using the given nginx log_format.
+func ParseLogs(result LogResult, logFormat string) LogResult {
+	result.Records = nginx.ParseNginxLogs(result.Logs, logFormat)
+	result.Logs = []string{}
+	return result
 }
 
 func GetLog(filePath string, position int64) (LogResult, error) {
 	// Check if file exists
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		logger.Log.Println("File not found")
+		logger.Warn("File not found")
 		return LogResult{}, fmt.Errorf("file not found: %s", filePath)
 	}
 
@@ -77,7 +80,7 @@ func GetLog(filePath string, position int64) (LogResult, error) {
 	var err error
 
 	// Handle different file types
-	if strings.HasSuffix(filePath, ".gz") {
+	if isCompressedLogFile(filePath) {
 		result, err = readCompressedLogFile(filePath)
 		if err != nil {
 			return LogResult{}, fmt.Errorf("error reading compressed log file: %w", err)
@@ -93,97 +96,25 @@ func GetLog(filePath string, position int64) (LogResult, error) {
 }
 
 func readLogFile(filePath string, position int64) (LogResult, error) {
-	// Get file info
-	fileInfo, err := os.Stat(filePath)
-	if err != nil {
-		return LogResult{}, err
-	}
-
-	fileSize := fileInfo.Size()
-
-	// A rotated log may be truncated or replaced. Start from the beginning
-	// rather than retaining an offset that can no longer be reached.
-	if position > fileSize {
-		position = 0
-	}
-
-	// If position is at the file size, there are no new logs.
-	if position == fileSize {
-		return LogResult{Logs: []string{}, Positions: []Position{{Position: position}}}, nil
-	}
-
-	// Open file for reading
-	file, err := os.Open(filePath)
+	c, err := readLogChunk(filePath, position, Limits{})
 	if err != nil {
 		return LogResult{}, err
 	}
-	defer file.Close()
-
-	// Seek to position
-	if _, err = file.Seek(position, 0); err != nil {
-		return LogResult{}, err
-	}
-
-	var logs []string
-	scanner := newLogScanner(file)
-	for scanner.Scan() {
-		if line := scanner.Text(); line != "" {
-			logs = append(logs, line)
-		}
-	}
-	if err := scanner.Err(); err != nil {
-		return LogResult{}, err
-	}
-
-	newPosition := fileSize
-	lastByte := []byte{0}
-	if _, err := file.ReadAt(lastByte, fileSize-1); err != nil {
-		return LogResult{}, err
-	}
-	if lastByte[0] != '\n' {
-		if len(logs) > 0 {
-			newPosition -= int64(len(logs[len(logs)-1]))
-			logs = logs[:len(logs)-1]
-		} else {
-			newPosition = position
-		}
-	}
-
 	return LogResult{
-		Logs:      logs,
-		Positions: []Position{{Position: newPosition}},
+		Logs:      c.lines,
+		Positions: []Position{{Position: c.end}},
+		Rotated:   c.rotated,
 	}, nil
 }
 
 func readCompressedLogFile(filePath string) (LogResult, error) {
-	// Open file
-	file, err := os.Open(filePath)
+	c, err := readCompressedChunk(filePath, 0, Limits{})
 	if err != nil {
 		return LogResult{}, err
 	}
-	defer file.Close()
-
-	// Create gzip reader
-	gzReader, err := gzip.NewReader(file)
-	if err != nil {
-		return LogResult{}, err
-	}
-	defer gzReader.Close()
-
-	var logs []string
-	scanner := newLogScanner(gzReader)
-	for scanner.Scan() {
-		if line := scanner.Text(); line != "" {
-			logs = append(logs, line)
-		}
-	}
-	if err := scanner.Err(); err != nil {
-		return LogResult{}, err
-	}
-
 	return LogResult{
-		Logs:      logs,
-		Positions: []Position{{Position: 0}}, // Always return 0 as position for gzipped files
+		Logs:      c.lines,
+		Positions: []Position{{Position: 0}}, // Always return 0 as position for compressed files
 	}, nil
 }
 
@@ -194,121 +125,30 @@ func newLogScanner(reader io.Reader) *bufio.Scanner {
 }
 
 func GetDirectoryLogs(dirPath string, positions []Position, isErrorLog bool, includeCompressed bool) (LogResult, error) {
-	// Read directory entries
-	entries, err := os.ReadDir(dirPath)
-	if err != nil {
-		return LogResult{}, fmt.Errorf("failed to read directory: %w", err)
-	}
+	result, _, err := readDirectoryPage(dirPath, Cursor{Positions: positions}, isErrorLog, includeCompressed, Limits{})
+	return result, err
+}
 
-	// Filter log files
-	var logFiles []string
-	for _, entry := range entries {
-		if entry.IsDir() {
+// initializeFilePositions initializes positions for each log file, following
+// files that have been renamed since the stored positions were recorded. It
+// reports whether any previously read file has been replaced or truncated.
+func initializeFilePositions(dirPath string, logFiles []string, positions []Position) ([]Position, bool) {
+	filePositions := make([]Position, len(logFiles))
+	rotated := false
+	for i, filename := range logFiles {
+		filePositions[i] = Position{Filename: filename}
+		if isCompressedLogFile(filename) {
 			continue
 		}
-		fileName := entry.Name()
-		// Check if it's a log file
-		isLogFile := strings.HasSuffix(fileName, ".log")
-		isGzipFile := strings.HasSuffix(fileName, ".gz")
-		isRotated := isRotatedLogFile(fileName)
-
-		// Filter by log type and extension
-		if (isLogFile || isRotated || (isGzipFile && includeCompressed)) &&
-			(isErrorLog && strings.Contains(fileName, "error") || !isErrorLog && !strings.Contains(fileName, "error")) {
-			logFiles = append(logFiles, fileName)
-		}
-	}
-
-	// Sort log files alphabetically
-	sort.Strings(logFiles)
-
-	if len(logFiles) == 0 {
-		return LogResult{Logs: []string{}}, nil
-	}
-
-	// Initialize file positions
-	filePositions := initializeFilePositions(logFiles, positions)
-
-	type fileResult struct {
-		logs     []string
-		position Position
-		hasPos   bool
-	}
-
-	// Read all files concurrently, preserving order
-	results := make([]fileResult, len(filePositions))
-	var wg sync.WaitGroup
 
-	for i, filePos := range filePositions {
-		isGzFile := strings.HasSuffix(filePos.Filename, ".gz")
-		if isGzFile && !includeCompressed {
+		info, err := os.Stat(filepath.Join(dirPath, filename))
+		if err != nil {
 			continue
 		}
-
-		wg.Add(1)
-		go func(idx int, fp Position) {
-			defer wg.Done()
-			fullPath := filepath.Join(dirPath, fp.Filename)
-			isGz := strings.HasSuffix(fp.Filename, ".gz")
-
-			var result LogResult
-			var err error
-			if isGz {
-				result, err = readCompressedLogFile(fullPath)
-			} else {
-				result, err = readLogFile(fullPath, fp.Position)
-			}
-			if err != nil {
-				logger.Log.Printf("Error reading file %s: %v", fullPath, err)
-				return
-			}
-
-			r := fileResult{logs: result.Logs}
-			if !strings.HasSuffix(fp.Filename, ".gz") {
-				var pos int64
-				if len(result.Positions) > 0 {
-					pos = result.Positions[0].Position
-				}
-				r.position = Position{Filename: fp.Filename, Position: pos}
-				r.hasPos = true
-			}
-			results[idx] = r
-		}(i, filePos)
-	}
-
-	wg.Wait()
-
-	// Collect results in order
-	var allLogs []string
-	var newPositions []Position
-	for _, r := range results {
-		allLogs = append(allLogs, r.logs...)
-		if r.hasPos {
-			newPositions = append(newPositions, r.position)
-		}
-	}
-
-	return LogResult{
-		Logs:      allLogs,
-		Positions: newPositions,
-	}, nil
-}
-
-// initializeFilePositions initializes positions for each log file
-func initializeFilePositions(logFiles []string, positions []Position) []Position {
-	posMap := make(map[string]int64, len(positions))
-	for _, pos := range positions {
-		posMap[pos.Filename] = pos.Position
-	}
-
-	filePositions := make([]Position, len(logFiles))
-	for i, filename := range logFiles {
-		position := posMap[filename] // 0 if not found
-		if strings.HasSuffix(filename, ".gz") {
-			position = 0
-		}
-		filePositions[i] = Position{Filename: filename, Position: position}
+		position, replaced := resumePosition(filepath.Join(dirPath, filename), filename, info, positions)
+		filePositions[i].Position = position
+		rotated = rotated || replaced
 	}
 
-	return filePositions
+	return filePositions, rotated
 }
@@ -70,7 +70,7 @@ func TestGetDirectoryLogs_RotatedFiles(t *testing.T) {
 			isErrorLog:        false,
 			includeCompressed: true,
 			wantLogs:          []string{"today logs", "yesterday logs", "older logs"},
-			wantPositions:     []string{"access.log", "access.log.1"},
+			wantPositions:     []string{"access.log", "access.log.1", "access.log.2.gz"},
 		},
 		{
 			name:              "Error logs",
@@ -0,0 +1,446 @@
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
+)
+
+// maxReadWorkers bounds the number of log files read concurrently.
+const maxReadWorkers = 4
+
+// Limits caps the size of a single page of logs. Zero values are unlimited.
+// A page always holds at least one line so that paging makes progress.
+type Limits struct {
+	MaxLines int
+	MaxBytes int64
+}
+
+// Cursor marks where a page of logs stopped, so the next page continues from
+// there. Positions of compressed archives hold the offset reached in their
+// decompressed content.
+type Cursor struct {
+	Positions []Position `json:"positions,omitempty"`
+}
+
+// Encode returns the cursor as an opaque URL-safe token.
+func (c Cursor) Encode() (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// ParseCursor decodes a token returned by Cursor.Encode.
+func ParseCursor(token string) (Cursor, error) {
+	var c Cursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor: %w", err)
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("invalid cursor: %w", err)
+	}
+	return c, nil
+}
+
+// GetLogsPage reads logs under path from the cursor, stopping once limits are
+// reached. If the page is cut short, the result's Cursor is set to a token
+// for the next page.
+func GetLogsPage(path string, cursor Cursor, isErrorLog bool, includeCompressed bool, limits Limits) (LogResult, error) {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return LogResult{}, fmt.Errorf("path error: %w", err)
+	}
+
+	var result LogResult
+	var next *Cursor
+	if fileInfo.IsDir() {
+		result, next, err = readDirectoryPage(path, cursor, isErrorLog, includeCompressed, limits)
+	} else {
+		result, next, err = readFilePage(path, fileInfo, cursor, limits)
+	}
+	if err != nil {
+		return LogResult{}, err
+	}
+
+	if next != nil {
+		if result.Cursor, err = next.Encode(); err != nil {
+			return LogResult{}, fmt.Errorf("error encoding cursor: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// chunk is the content read from one log file, with the offset just past
+// each line so that a page can stop partway through.
+type chunk struct {
+	lines []string
+	ends  []int64
+	// end is the offset reached, and more is set if reading stopped at a
+	// limit rather than at the end of the file
+	end     int64
+	more    bool
+	rotated bool
+}
+
+// readLogChunk reads complete lines from an uncompressed log file starting at
+// position. An incomplete final line is left for a later read.
+func readLogChunk(filePath string, position int64, limits Limits) (chunk, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return chunk{}, err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return chunk{}, err
+	}
+
+	// A rotated log may be truncated or replaced. Start from the beginning
+	// rather than retaining an offset that can no longer be reached.
+	rotated := false
+	if position > fileInfo.Size() {
+		position = 0
+		rotated = true
+	}
+
+	if _, err := file.Seek(position, io.SeekStart); err != nil {
+		return chunk{}, err
+	}
+
+	c, err := scanChunk(file, position, false, limits)
+	c.rotated = rotated
+	return c, err
+}
+
+// readCompressedChunk reads lines from a compressed log file, skipping
+// the first offset bytes of decompressed content. Archives that fit in the
+// archive cache are decompressed in full once and then served from memory.
+// Archives too large for the cache are remembered, so that later pages only
+// decompress what they need.
+func readCompressedChunk(filePath string, offset int64, limits Limits) (chunk, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return chunk{}, err
+	}
+
+	key := newArchiveKey(filePath, info)
+	if c, ok := archives.get(key); ok {
+		return sliceChunk(c, offset, limits), nil
+	}
+	if budget := archives.limit(); budget > 0 && !archives.isOversized(key) {
+		c, err := decompressChunk(filePath, 0, Limits{MaxBytes: budget})
+		if err != nil {
+			return chunk{}, err
+		}
+		if !c.more {
+			archives.add(key, c)
+			return sliceChunk(c, offset, limits), nil
+		}
+		archives.markOversized(key)
+		// Serve the page from what was read if it ends within it
+		if page := sliceChunk(c, offset, limits); page.more {
+			return page, nil
+		}
+	}
+	return decompressChunk(filePath, offset, limits)
+}
+
+func decompressChunk(filePath string, offset int64, limits Limits) (chunk, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return chunk{}, err
+	}
+	defer file.Close()
+
+	reader, err := newDecompressor(filePath, file)
+	if err != nil {
+		return chunk{}, err
+	}
+	defer reader.Close()
+
+	if offset > 0 {
+		if _, err := io.CopyN(io.Discard, reader, offset); err != nil && err != io.EOF {
+			return chunk{}, err
+		}
+	}
+
+	return scanChunk(reader, offset, true, limits)
+}
+
+// scanChunk reads non-empty lines from reader, which begins at offset start,
+// until the limits are reached. Unless complete is set, a final line without
+// a trailing newline is treated as still being written and left unread.
+func scanChunk(reader io.Reader, start int64, complete bool, limits Limits) (chunk, error) {
+	c := chunk{end: start}
+	offset := start
+
+	scanner := newLogScanner(reader)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && !complete && bytes.IndexByte(data, '\n') < 0 {
+			return 0, nil, nil
+		}
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		offset += int64(advance)
+		return advance, token, err
+	})
+
+	var size int64
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			c.end = offset
+			continue
+		}
+		if len(c.lines) > 0 && exceeds(limits, len(c.lines)+1, size+int64(len(line))) {
+			c.more = true
+			return c, nil
+		}
+		c.lines = append(c.lines, line)
+		c.ends = append(c.ends, offset)
+		c.end = offset
+		size += int64(len(line))
+	}
+	return c, scanner.Err()
+}
+
+func exceeds(limits Limits, lines int, size int64) bool {
+	return limits.MaxLines > 0 && lines > limits.MaxLines ||
+		limits.MaxBytes > 0 && size > limits.MaxBytes
+}
+
+// readFilePage reads a page from a single log file, first finishing the tail
+// of the file it replaced if that has been renamed by log rotation.
+func readFilePage(filePath string, fileInfo os.FileInfo, cursor Cursor, limits Limits) (LogResult, *Cursor, error) {
+	if isCompressedLogFile(filePath) {
+		offset, complete := archivePosition(filePath, filepath.Base(filePath), fileInfo, cursor.Positions)
+		pos := Position{Position: offset, Complete: complete}
+		result := LogResult{Logs: []string{}}
+		if !complete {
+			c, err := readCompressedChunk(filePath, offset, limits)
+			if err != nil {
+				return LogResult{}, nil, fmt.Errorf("error reading compressed log file: %w", err)
+			}
+			result.Logs = c.lines
+			pos = Position{Position: c.end, Complete: !c.more}
+		}
+		if err := identifyArchive(filePath, &pos); err != nil {
+			return LogResult{}, nil, fmt.Errorf("error identifying log file: %w", err)
+		}
+		result.Positions = []Position{pos}
+		if !pos.Complete {
+			return result, &Cursor{Positions: result.Positions}, nil
+		}
+		return result, nil, nil
+	}
+
+	positions := cursor.Positions
+	position, rotated := resumePosition(filePath, filepath.Base(filePath), fileInfo, positions)
+
+	var logs []string
+	if rotated && len(positions) > 0 {
+		if renamed, ok := findRenamed(filepath.Dir(filePath), positions[0]); ok {
+			tail, err := readLogChunk(renamed, positions[0].Position, limits)
+			if err != nil {
+				logger.Warnf("Error reading rotated file %s: %v", renamed, err)
+			} else if tail.more {
+				// Stay on the old file until its tail has been read
+				pos := Position{Position: tail.end}
+				if err := identify(renamed, &pos); err != nil {
+					return LogResult{}, nil, fmt.Errorf("error identifying log file: %w", err)
+				}
+				result := LogResult{Logs: tail.lines, Positions: []Position{pos}, Rotated: true}
+				return result, &Cursor{Positions: result.Positions}, nil
+			} else {
+				logs = tail.lines
+				limits = remaining(limits, tail.lines)
+			}
+		}
+	}
+
+	c, err := readLogChunk(filePath, position, limits)
+	if err != nil {
+		return LogResult{}, nil, fmt.Errorf("error reading log file: %w", err)
+	}
+
+	pos := Position{Position: c.end}
+	if err := identify(filePath, &pos); err != nil {
+		return LogResult{}, nil, fmt.Errorf("error identifying log file: %w", err)
+	}
+	result := LogResult{
+		Logs:      append(logs, c.lines...),
+		Positions: []Position{pos},
+		Rotated:   rotated || c.rotated,
+	}
+	if result.Logs == nil {
+		result.Logs = []string{}
+	}
+	if c.more {
+		return result, &Cursor{Positions: result.Positions}, nil
+	}
+	return result, nil, nil
+}
+
+// remaining returns what is left of limits after lines have been read. At
+// least one more line is always allowed, matching the first line of a page.
+func remaining(limits Limits, lines []string) Limits {
+	if limits.MaxLines > 0 {
+		limits.MaxLines = max(limits.MaxLines-len(lines), 1)
+	}
+	if limits.MaxBytes > 0 {
+		for _, line := range lines {
+			limits.MaxBytes -= int64(len(line))
+		}
+		limits.MaxBytes = max(limits.MaxBytes, 1)
+	}
+	return limits
+}
+
+// readDirectoryPage reads a page from the log files in a directory, in
+// filename order. Files are read concurrently by a bounded pool of workers,
+// each reading at most a full page, and the results are then trimmed in order
+// to fit the limits.
+func readDirectoryPage(dirPath string, cursor Cursor, isErrorLog bool, includeCompressed bool, limits Limits) (LogResult, *Cursor, error) {
+	logFiles, err := listLogFiles(dirPath, isErrorLog, includeCompressed)
+	if err != nil {
+		return LogResult{}, nil, err
+	}
+
+	if len(logFiles) == 0 {
+		return LogResult{Logs: []string{}}, nil, nil
+	}
+
+	// Initialize file positions
+	filePositions, rotated := initializeFilePositions(dirPath, logFiles, cursor.Positions)
+
+	type task struct {
+		position   Position
+		start      int64
+		compressed bool
+		// complete is set for archives the client has already read in full
+		complete bool
+		result   chunk
+		err      error
+		done     chan struct{}
+	}
+
+	var tasks []*task
+	for _, fp := range filePositions {
+		compressed := isCompressedLogFile(fp.Filename)
+		t := &task{position: fp, start: fp.Position, compressed: compressed, done: make(chan struct{})}
+		if compressed {
+			if !includeCompressed {
+				continue
+			}
+			fullPath := filepath.Join(dirPath, fp.Filename)
+			info, err := os.Stat(fullPath)
+			if err != nil {
+				continue
+			}
+			t.start, t.complete = archivePosition(fullPath, fp.Filename, info, cursor.Positions)
+		}
+		tasks = append(tasks, t)
+	}
+
+	// Read files with a bounded pool of workers. Once the page is full, the
+	// remaining files are skipped.
+	var full atomic.Bool
+	jobs := make(chan *task)
+	var wg sync.WaitGroup
+	for range min(maxReadWorkers, len(tasks)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range jobs {
+				if !full.Load() && !t.complete {
+					fullPath := filepath.Join(dirPath, t.position.Filename)
+					if t.compressed {
+						t.result, t.err = readCompressedChunk(fullPath, t.start, limits)
+					} else {
+						t.result, t.err = readLogChunk(fullPath, t.start, limits)
+					}
+				}
+				close(t.done)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, t := range tasks {
+			jobs <- t
+		}
+	}()
+	defer wg.Wait()
+
+	// Collect results in order
+	allLogs := []string{}
+	var newPositions []Position
+	var next *Cursor
+	var size int64
+	for _, t := range tasks {
+		<-t.done
+
+		pos, complete := t.start, t.complete
+		if next == nil && t.err != nil {
+			logger.Warnf("Error reading file %s: %v", filepath.Join(dirPath, t.position.Filename), t.err)
+			continue
+		}
+		if next == nil && !t.complete {
+			r := t.result
+			take := len(r.lines)
+			for i, line := range r.lines {
+				if len(allLogs)+i > 0 && exceeds(limits, len(allLogs)+i+1, size+int64(len(line))) {
+					take = i
+					break
+				}
+				size += int64(len(line))
+			}
+
+			allLogs = append(allLogs, r.lines[:take]...)
+			rotated = rotated || r.rotated
+			pos, complete = r.end, t.compressed
+			if take < len(r.lines) || r.more {
+				pos, complete = t.start, false
+				if take > 0 {
+					pos = r.ends[take-1]
+				}
+				next = &Cursor{}
+				full.Store(true)
+			}
+		}
+
+		fullPath := filepath.Join(dirPath, t.position.Filename)
+		position := Position{Filename: t.position.Filename, Position: pos}
+		if t.compressed {
+			position.Complete = complete
+			err = identifyArchive(fullPath, &position)
+		} else {
+			err = identify(fullPath, &position)
+		}
+		if err != nil {
+			logger.Warnf("Error identifying file %s: %v", fullPath, err)
+		}
+		newPositions = append(newPositions, position)
+	}
+
+	if next != nil {
+		next.Positions = newPositions
+	}
+	return LogResult{
+		Logs:      allLogs,
+		Positions: newPositions,
+		Rotated:   rotated,
+	}, next, nil
+}
@@ -0,0 +1,145 @@
+package logs
+
+import (
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func writeGzipFile(t *testing.T, path string, content string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	if _, err := gw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readAllPages follows cursors until the last page, returning every line
+// read and the number of pages.
+func readAllPages(t *testing.T, path string, limits Limits) ([]string, LogResult, int) {
+	t.Helper()
+	var lines []string
+	var cursor Cursor
+	for pages := 1; ; pages++ {
+		result, err := GetLogsPage(path, cursor, false, true, limits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, result.Logs...)
+		if result.Cursor == "" {
+			return lines, result, pages
+		}
+		if pages > 100 {
+			t.Fatal("paging did not finish")
+		}
+		if cursor, err = ParseCursor(result.Cursor); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetLogsPageDirectory(t *testing.T) {
+	dirPath := t.TempDir()
+	var want []string
+	for _, name := range []string{"access.log", "access.log.1", "access.log.2.gz", "access.log.3.gz"} {
+		content := ""
+		for i := range 5 {
+			line := fmt.Sprintf("%s line %d", name, i)
+			content += line + "\n"
+			want = append(want, line)
+		}
+		if filepath.Ext(name) == ".gz" {
+			writeGzipFile(t, filepath.Join(dirPath, name), content)
+		} else {
+			appendToFile(t, filepath.Join(dirPath, name), content)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		limits    Limits
+		wantPages int
+	}{
+		{"unlimited", Limits{}, 1},
+		{"max lines", Limits{MaxLines: 3}, 7},
+		{"max bytes", Limits{MaxBytes: 40}, 15},
+		{"line larger than max bytes", Limits{MaxBytes: 1}, 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, last, pages := readAllPages(t, dirPath, tt.limits)
+			if !slices.Equal(lines, want) {
+				t.Errorf("unexpected logs: got %v want %v", lines, want)
+			}
+			if pages != tt.wantPages {
+				t.Errorf("unexpected page count: got %d want %d", pages, tt.wantPages)
+			}
+
+			// The last page's positions only return new lines
+			logPath := filepath.Join(dirPath, "access.log")
+			original, err := os.ReadFile(logPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.WriteFile(logPath, original, 0644)
+			appendToFile(t, logPath, "new line\n")
+			result, err := GetLogs(dirPath, last.Positions, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(result.Logs, []string{"new line"}) {
+				t.Errorf("unexpected logs after paging: %v", result.Logs)
+			}
+		})
+	}
+}
+
+func TestGetLogsPageSingleFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "access.log")
+	appendToFile(t, filePath, "one\ntwo\nthree\npartial")
+
+	lines, last, pages := readAllPages(t, filePath, Limits{MaxLines: 2})
+	if !slices.Equal(lines, []string{"one", "two", "three"}) {
+		t.Errorf("unexpected logs: %v", lines)
+	}
+	if pages != 2 {
+		t.Errorf("unexpected page count: %d", pages)
+	}
+	if last.Positions[0].Position != int64(len("one\ntwo\nthree\n")) {
+		t.Errorf("unexpected position: %+v", last.Positions[0])
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := Cursor{Positions: []Position{
+		{Filename: "access.log", Position: 42, Inode: 7},
+		{Filename: "access.log.2.gz", Position: 1024, Complete: true},
+	}}
+	token, err := cursor.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseCursor(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got.Positions, cursor.Positions) {
+		t.Errorf("unexpected cursor: got %+v want %+v", got, cursor)
+	}
+
+	if _, err := ParseCursor("not a cursor"); err == nil {
+		t.Error("expected an error for an invalid cursor")
+	}
+}
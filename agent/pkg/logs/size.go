@@ -66,7 +66,7 @@ func GetLogSizes(dirPath string) (LogSizes, error) {
 		if extension == ".log" || isRotatedLogFile(fileName) {
 			summary.LogFilesSize += fileSize
 			summary.LogFilesCount++
-		} else if extension == ".gz" || extension == ".zip" || extension == ".tar" {
+		} else if isCompressedLogFile(fileName) || extension == ".zip" || extension == ".tar" {
 			summary.CompressedFilesSize += fileSize
 			summary.CompressedFilesCount++
 		}
@@ -110,7 +110,7 @@ func GetLogSize(filePath string) (LogSizes, error) {
 	if extension == ".log" || isRotatedLogFile(fileName) {
 		response.Summary.LogFilesSize = fileSize
 		response.Summary.LogFilesCount = 1
-	} else if extension == ".gz" || extension == ".zip" || extension == ".tar" {
+	} else if isCompressedLogFile(fileName) || extension == ".zip" || extension == ".tar" {
 		response.Summary.CompressedFilesSize = fileSize
 		response.Summary.CompressedFilesCount = 1
 	}
@@ -0,0 +1,173 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
+)
+
+// Watch signals on the returned channel whenever a log file at path changes.
+// Signals are coalesced, so a slow receiver sees a single pending signal
+// rather than one per write. The channel is closed when ctx is cancelled.
+func Watch(ctx context.Context, path string) (<-chan struct{}, error) {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("path error: %w", err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+
+	// Watch the parent directory of a single file so that the file is still
+	// followed after logrotate replaces it.
+	dir, target := path, ""
+	if !fileInfo.IsDir() {
+		dir, target = filepath.Dir(path), filepath.Clean(path)
+	}
+	recursive := target == "" && CurrentDiscovery().Recursive
+	if err := addWatches(watcher, dir, recursive); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+		defer watcher.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op == fsnotify.Chmod {
+					continue
+				}
+				if target != "" && filepath.Clean(event.Name) != target {
+					continue
+				}
+				if recursive && event.Has(fsnotify.Create) {
+					// Follow subdirectories created after the watch started
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						if err := addWatches(watcher, event.Name, true); err != nil {
+							logger.Warnf("Error watching %s: %v", event.Name, err)
+						}
+					}
+				}
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Warnf("Error watching %s: %v", path, err)
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
+// addWatches watches dir and, if recursive, every subdirectory beneath it.
+func addWatches(watcher *fsnotify.Watcher, dir string, recursive bool) error {
+	if !recursive {
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+		return nil
+	}
+	return filepath.WalkDir(dir, func(subdir string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return err
+		}
+		if err := watcher.Add(subdir); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", subdir, err)
+		}
+		return nil
+	})
+}
+
+// CurrentPositions returns the end of the last complete line of each
+// uncompressed log file at path, so that reading can start from the tail.
+func CurrentPositions(path string, isErrorLog bool) ([]Position, error) {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("path error: %w", err)
+	}
+
+	if !fileInfo.IsDir() {
+		position, err := lastLineEnd(path)
+		if err != nil {
+			return nil, err
+		}
+		pos := Position{Position: position}
+		if err := identify(path, &pos); err != nil {
+			return nil, err
+		}
+		return []Position{pos}, nil
+	}
+
+	logFiles, err := listLogFiles(path, isErrorLog, false)
+	if err != nil {
+		return nil, err
+	}
+
+	positions := make([]Position, 0, len(logFiles))
+	for _, filename := range logFiles {
+		filePath := filepath.Join(path, filename)
+		position, err := lastLineEnd(filePath)
+		if err != nil {
+			return nil, err
+		}
+		pos := Position{Filename: filename, Position: position}
+		if err := identify(filePath, &pos); err != nil {
+			return nil, err
+		}
+		positions = append(positions, pos)
+	}
+	return positions, nil
+}
+
+// lastLineEnd returns the offset just past the final newline in a file,
+// leaving any partially written line to be read once it is complete.
+func lastLineEnd(filePath string) (int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	const chunkSize = 64 * 1024
+	buf := make([]byte, chunkSize)
+	for end := fileInfo.Size(); end > 0; end -= chunkSize {
+		start := max(end-chunkSize, 0)
+		n, err := file.ReadAt(buf[:end-start], start)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if i := strings.LastIndexByte(string(buf[:n]), '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+	}
+	return 0, nil
+}
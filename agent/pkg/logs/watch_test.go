@@ -0,0 +1,83 @@
+package logs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCurrentPositions(t *testing.T) {
+	dirPath := t.TempDir()
+	files := map[string]string{
+		"access.log":   "line one\nline two\n",
+		"access.log.1": "complete\npartial",
+		"error.log":    "error line\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dirPath, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	positions, err := CurrentPositions(dirPath, false)
+	if err != nil {
+		t.Fatalf("CurrentPositions failed: %v", err)
+	}
+
+	want := []Position{
+		{Filename: "access.log", Position: int64(len("line one\nline two\n"))},
+		{Filename: "access.log.1", Position: int64(len("complete\n"))},
+	}
+	if len(positions) != len(want) {
+		t.Fatalf("got %d positions, want %d", len(positions), len(want))
+	}
+	for i := range want {
+		if positions[i].Filename != want[i].Filename || positions[i].Position != want[i].Position {
+			t.Errorf("position %d: got %+v, want %+v", i, positions[i], want[i])
+		}
+	}
+
+	// Nothing new should be read from the current positions
+	result, err := GetLogs(dirPath, positions, false, false)
+	if err != nil {
+		t.Fatalf("GetLogs failed: %v", err)
+	}
+	if len(result.Logs) != 0 {
+		t.Errorf("expected no logs, got %v", result.Logs)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dirPath := t.TempDir()
+	logPath := filepath.Join(dirPath, "access.log")
+	if err := os.WriteFile(logPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, err := Watch(ctx, logPath)
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+
+	// Writes to other files in the directory are ignored when watching a file
+	if err := os.WriteFile(filepath.Join(dirPath, "other.log"), []byte("x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(logPath, []byte("line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for change")
+	}
+
+	cancel()
+	for range changes {
+		// Drain until closed
+	}
+}
@@ -0,0 +1,142 @@
+package nginx
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NGINXError represents a parsed nginx error log entry
+type NGINXError struct {
+	Timestamp     time.Time `json:"timestamp"`
+	Level         string    `json:"level"`
+	PID           int       `json:"pid"`
+	TID           string    `json:"tid"`
+	CID           string    `json:"cid"`
+	Message       string    `json:"message"`
+	ClientAddress *string   `json:"clientAddress,omitempty"`
+	ServerAddress *string   `json:"serverAddress,omitempty"`
+	Request       *string   `json:"request,omitempty"`
+	Upstream      *string   `json:"upstream,omitempty"`
+	Referrer      *string   `json:"referrer,omitempty"`
+	Host          *string   `json:"host,omitempty"`
+}
+
+// ErrorLevels are the levels of error log entries, from least to most
+// severe.
+var ErrorLevels = []string{"debug", "info", "notice", "warn", "error", "crit", "alert", "emerg"}
+
+const errorTimeLayout = "2006/01/02 15:04:05"
+
+var (
+	errorPrefixPattern = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) \[(\w+)\]`)
+	pidPattern         = regexp.MustCompile(`(\d+)#(\d+)`)
+	cidPattern         = regexp.MustCompile(`\*(\d+)`)
+	clientPattern      = regexp.MustCompile(`client: ([^,\s]+)`)
+	serverPattern      = regexp.MustCompile(`server: ([^,\s]+)`)
+	requestPattern     = regexp.MustCompile(`request: "([^"]+)"`)
+	upstreamPattern    = regexp.MustCompile(`upstream: "([^"]+)"`)
+	referrerPattern    = regexp.MustCompile(`referrer: "([^"]+)"`)
+	hostPattern        = regexp.MustCompile(`host: "([^"]+)"`)
+)
+
+// ParseErrorPrefix returns the time and level an error log line starts
+// with. Times are in the server's local time. Lines that don't start with
+// both, such as the continuation of a multi-line error, report false.
+func ParseErrorPrefix(line string) (time.Time, string, bool) {
+	match := errorPrefixPattern.FindStringSubmatch(line)
+	if match == nil {
+		return time.Time{}, "", false
+	}
+	t, err := time.ParseInLocation(errorTimeLayout, match[1], time.Local)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	return t, strings.ToLower(match[2]), true
+}
+
+// ParseNginxErrors parses raw error log lines, skipping blank lines. Lines
+// without a time and level are kept with a zero timestamp and an unknown
+// level.
+func ParseNginxErrors(logLines []string) []NGINXError {
+	var errors []NGINXError
+	for _, line := range logLines {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		errorEntry, _ := ParseNginxError(line)
+		errors = append(errors, errorEntry)
+	}
+	return errors
+}
+
+// ParseNginxError parses an error log line, reporting whether it starts with
+// a time and level.
+func ParseNginxError(line string) (NGINXError, bool) {
+	errorEntry := NGINXError{Level: "unknown", TID: "0", CID: "0"}
+
+	t, level, ok := ParseErrorPrefix(line)
+	if ok {
+		errorEntry.Timestamp, errorEntry.Level = t, level
+	}
+
+	// Extract PID and TID
+	if pidMatch := pidPattern.FindStringSubmatch(line); len(pidMatch) > 2 {
+		if pid, err := strconv.Atoi(pidMatch[1]); err == nil {
+			errorEntry.PID = pid
+		}
+		errorEntry.TID = pidMatch[2]
+	}
+
+	// Extract connection ID
+	if cidMatch := cidPattern.FindStringSubmatch(line); len(cidMatch) > 1 {
+		errorEntry.CID = cidMatch[1]
+	}
+
+	// Extract optional fields
+	errorEntry.ClientAddress = submatch(clientPattern, line)
+	errorEntry.ServerAddress = submatch(serverPattern, line)
+	errorEntry.Request = submatch(requestPattern, line)
+	errorEntry.Upstream = submatch(upstreamPattern, line)
+	errorEntry.Referrer = submatch(referrerPattern, line)
+	errorEntry.Host = submatch(hostPattern, line)
+
+	errorEntry.Message = extractMessage(line, errorEntry.CID, errorEntry.Level, errorEntry.PID, errorEntry.TID)
+	return errorEntry, ok
+}
+
+func submatch(pattern *regexp.Regexp, line string) *string {
+	if match := pattern.FindStringSubmatch(line); len(match) > 1 {
+		return &match[1]
+	}
+	return nil
+}
+
+func extractMessage(line, cid, level string, pid int, tid string) string {
+	// Try to extract message after CID
+	if cid != "0" {
+		cidPattern := "*" + cid
+		if cidIndex := strings.Index(line, cidPattern); cidIndex != -1 {
+			message := line[cidIndex+len(cidPattern):]
+			return strings.TrimSpace(message)
+		}
+	}
+
+	// Fallback: try to extract message after level and PID
+	levelPattern := "[" + level + "]"
+	pidPattern := strconv.Itoa(pid) + "#"
+
+	levelIndex := strings.Index(line, levelPattern)
+	pidIndex := strings.Index(line, pidPattern)
+
+	if levelIndex != -1 && pidIndex != -1 {
+		startIndex := pidIndex + len(pidPattern) + len(tid) + 1
+		if startIndex < len(line) {
+			return strings.TrimSpace(line[startIndex:])
+		}
+	}
+
+	return line
+}
@@ -0,0 +1,117 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseNginxErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []string
+		expected int
+	}{
+		{
+			name: "valid error log entry",
+			input: []string{
+				`2024/01/15 10:30:45 [error] 12345#0: *1 connect() failed (111: Connection refused)`,
+			},
+			expected: 1,
+		},
+		{
+			name: "multiple error entries",
+			input: []string{
+				`2024/01/15 10:30:45 [error] 12345#0: *1 connect() failed (111: Connection refused)`,
+				`2024/01/15 10:31:00 [warn] 12345#0: *2 upstream server temporarily disabled`,
+			},
+			expected: 2,
+		},
+		{name: "empty input", input: []string{}, expected: 0},
+		{name: "blank lines", input: []string{``, `   `}, expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ParseNginxErrors(tt.input)
+
+			if len(result) != tt.expected {
+				t.Errorf("ParseNginxErrors() returned %d errors, expected %d", len(result), tt.expected)
+			}
+
+			if tt.expected > 0 && len(result) > 0 {
+				err := result[0]
+				if err.Level == "" {
+					t.Error("Expected Level to be set")
+				}
+				if err.PID == 0 {
+					t.Error("Expected PID to be set")
+				}
+			}
+		})
+	}
+}
+
+func TestParseNginxErrorsExtractsIPv6Client(t *testing.T) {
+	errors := ParseNginxErrors([]string{
+		`2024/01/15 10:30:45 [error] 12345#0: *1 failed, client: 2001:db8::1, server: example.com`,
+	})
+	if len(errors) != 1 || errors[0].ClientAddress == nil || *errors[0].ClientAddress != "2001:db8::1" {
+		t.Fatalf("unexpected client address: %#v", errors)
+	}
+}
+
+// Benchmarks
+func BenchmarkParseNginxErrors(b *testing.B) {
+	input := []string{
+		`2024/01/15 10:30:45 [error] 12345#0: *1 connect() failed (111: Connection refused)`,
+		`2024/01/15 10:31:00 [warn] 12345#0: *2 upstream server temporarily disabled`,
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ParseNginxErrors(input)
+	}
+}
+
+func TestParseNginxErrorFields(t *testing.T) {
+	line := `2024/01/15 10:30:45 [error] 12345#0: *7 upstream timed out (110: Connection timed out) while reading response header from upstream, client: 10.0.0.1, server: example.com, request: "GET /api/users HTTP/1.1", upstream: "http://127.0.0.1:8080/api/users", host: "example.com", referrer: "https://example.com/"`
+	entry, ok := ParseNginxError(line)
+	if !ok {
+		t.Fatal("expected the line to start with a time and level")
+	}
+	if want := time.Date(2024, 1, 15, 10, 30, 45, 0, time.Local); !entry.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", entry.Timestamp, want)
+	}
+	if entry.Level != "error" || entry.PID != 12345 || entry.TID != "0" || entry.CID != "7" {
+		t.Errorf("unexpected prefix fields: %+v", entry)
+	}
+	for _, field := range []struct {
+		name string
+		got  *string
+		want string
+	}{
+		{"client", entry.ClientAddress, "10.0.0.1"},
+		{"server", entry.ServerAddress, "example.com"},
+		{"request", entry.Request, "GET /api/users HTTP/1.1"},
+		{"upstream", entry.Upstream, "http://127.0.0.1:8080/api/users"},
+		{"host", entry.Host, "example.com"},
+		{"referrer", entry.Referrer, "https://example.com/"},
+	} {
+		if field.got == nil || *field.got != field.want {
+			t.Errorf("%s = %v, want %q", field.name, field.got, field.want)
+		}
+	}
+	if !strings.HasPrefix(entry.Message, "upstream timed out") {
+		t.Errorf("unexpected message: %q", entry.Message)
+	}
+}
+
+func TestParseNginxErrorContinuation(t *testing.T) {
+	entry, ok := ParseNginxError("stack trace continued")
+	if ok || !entry.Timestamp.IsZero() || entry.Level != "unknown" {
+		t.Errorf("unexpected continuation entry: %+v", entry)
+	}
+	if _, _, ok := ParseErrorPrefix("2024/01/15 10:30:45 no level"); ok {
+		t.Error("expected a line without a level to have no prefix")
+	}
+}
@@ -0,0 +1,193 @@
+package nginx
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ---------------------------------------------------------------------------
+// Default compiled regex (handles standard combined + NPM vcombined prefix)
+// ---------------------------------------------------------------------------
+
+var nginxLogRegex = regexp.MustCompile(`^(?:\S+ )?(\S+) - \S+ \[([^\]]+)\] "(\S+) (\S+) (\S+)" (\d{3}) (\d+) "([^"]*)" "([^"]*)"`)
+
+type fieldMapping struct {
+	IPAddress    int
+	Timestamp    int
+	Method       int
+	Path         int
+	HTTPVersion  int
+	Status       int
+	ResponseSize int
+	Referrer     int
+	UserAgent    int
+}
+
+var defaultFieldMapping = fieldMapping{
+	IPAddress: 1, Timestamp: 2, Method: 3, Path: 4,
+	HTTPVersion: 5, Status: 6, ResponseSize: 7, Referrer: 8, UserAgent: 9,
+}
+
+type compiledFormat struct {
+	regex  *regexp.Regexp
+	fields fieldMapping
+}
+
+var defaultCompiled = &compiledFormat{regex: nginxLogRegex, fields: defaultFieldMapping}
+
+// ---------------------------------------------------------------------------
+// Log format → regex conversion
+// ---------------------------------------------------------------------------
+
+type varInfo struct {
+	pattern string
+	// fieldIndices maps each capture group offset (0-based within this variable)
+	// to the corresponding fieldMapping field pointer index (see setField below).
+	fieldIndices []int
+}
+
+const (
+	fIPAddress    = iota // 0
+	fTimestamp           // 1
+	fMethod              // 2
+	fPath                // 3
+	fHTTPVersion         // 4
+	fStatus              // 5
+	fResponseSize        // 6
+	fReferrer            // 7
+	fUserAgent           // 8
+)
+
+var capturedVars = map[string]varInfo{
+	"remote_addr":     {`(\S+)`, []int{fIPAddress}},
+	"time_local":      {`([^\]]+)`, []int{fTimestamp}},
+	"time_iso8601":    {`(\S+)`, []int{fTimestamp}},
+	"request":         {`(\S+) (\S+) (\S+)`, []int{fMethod, fPath, fHTTPVersion}},
+	"request_method":  {`(\S+)`, []int{fMethod}},
+	"request_uri":     {`(\S+)`, []int{fPath}},
+	"uri":             {`(\S+)`, []int{fPath}},
+	"server_protocol": {`(\S+)`, []int{fHTTPVersion}},
+	"status":          {`(\d{3})`, []int{fStatus}},
+	"body_bytes_sent": {`(\d+)`, []int{fResponseSize}},
+	"bytes_sent":      {`(\d+)`, []int{fResponseSize}},
+	"http_referer":    {`([^"]*)`, []int{fReferrer}},
+	"http_user_agent": {`([^"]*)`, []int{fUserAgent}},
+}
+
+var uncapturedVars = map[string]string{
+	"remote_user":            `\S+`,
+	"host":                   `\S+`,
+	"server_name":            `\S+`,
+	"server_port":            `\d+`,
+	"scheme":                 `\S+`,
+	"upstream_addr":          `\S+`,
+	"upstream_cache_status":  `\S+`,
+	"upstream_status":        `\d+`,
+	"request_time":           `[\d.]+`,
+	"upstream_response_time": `[\d.-]+`,
+	"upstream_connect_time":  `[\d.-]+`,
+	"upstream_header_time":   `[\d.-]+`,
+	"gzip_ratio":             `[\d.]+`,
+	"connection":             `\d+`,
+	"connection_requests":    `\d+`,
+	"pipe":                   `\S+`,
+	"http_x_forwarded_for":   `[^"]*`,
+	"http_cookie":            `[^"]*`,
+	"msec":                   `[\d.]+`,
+	"request_length":         `\d+`,
+	"ssl_protocol":           `\S+`,
+	"ssl_cipher":             `\S+`,
+}
+
+func setField(fm *fieldMapping, fieldConst int, groupIdx int) {
+	switch fieldConst {
+	case fIPAddress:
+		fm.IPAddress = groupIdx
+	case fTimestamp:
+		fm.Timestamp = groupIdx
+	case fMethod:
+		fm.Method = groupIdx
+	case fPath:
+		fm.Path = groupIdx
+	case fHTTPVersion:
+		fm.HTTPVersion = groupIdx
+	case fStatus:
+		fm.Status = groupIdx
+	case fResponseSize:
+		fm.ResponseSize = groupIdx
+	case fReferrer:
+		fm.Referrer = groupIdx
+	case fUserAgent:
+		fm.UserAgent = groupIdx
+	}
+}
+
+func isWordChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+		(c >= '0' && c <= '9') || c == '_'
+}
+
+func buildLogRegex(format string) (*compiledFormat, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	groupIndex := 0
+	var fields fieldMapping
+
+	i := 0
+	for i < len(format) {
+		if format[i] == '$' {
+			j := i + 1
+			for j < len(format) && isWordChar(format[j]) {
+				j++
+			}
+			varName := format[i+1 : j]
+
+			if info, ok := capturedVars[varName]; ok {
+				for idx, f := range info.fieldIndices {
+					setField(&fields, f, groupIndex+1+idx)
+				}
+				groupIndex += len(info.fieldIndices)
+				sb.WriteString(info.pattern)
+			} else if pat, ok := uncapturedVars[varName]; ok {
+				sb.WriteString(pat)
+			} else {
+				sb.WriteString(`\S+`)
+			}
+			i = j
+		} else {
+			sb.WriteString(regexp.QuoteMeta(string(format[i])))
+			i++
+		}
+	}
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, err
+	}
+	return &compiledFormat{regex: re, fields: fields}, nil
+}
+
+// Small cache keyed by format string. The agent and TUI each use a single
+// format in practice, so this rarely holds more than one entry.
+var (
+	compiledFormats = make(map[string]*compiledFormat)
+	cacheMu         sync.Mutex
+)
+
+func getCompiledFormat(logFormat string) *compiledFormat {
+	if logFormat == "" {
+		return defaultCompiled
+	}
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if cf, ok := compiledFormats[logFormat]; ok {
+		return cf
+	}
+	cf, err := buildLogRegex(logFormat)
+	if err != nil {
+		cf = defaultCompiled
+	}
+	compiledFormats[logFormat] = cf
+	return cf
+}
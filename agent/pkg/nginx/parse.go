@@ -0,0 +1,96 @@
+package nginx
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	dateColonRegex = regexp.MustCompile(`^([^:]+):`)
+	monthRegex     = regexp.MustCompile(`([A-Za-z]{3})`)
+)
+
+// ParseNginxLogs parses raw access log lines using the given nginx log_format.
+// An empty format falls back to the standard combined format. Lines that do
+// not match the format are skipped.
+func ParseNginxLogs(logs []string, logFormat string) []NGINXLog {
+	cf := getCompiledFormat(logFormat)
+	var data []NGINXLog
+
+	for _, row := range logs {
+		if logData, ok := cf.parse(row); ok {
+			data = append(data, logData)
+		}
+	}
+
+	return data
+}
+
+func (cf *compiledFormat) parse(row string) (NGINXLog, bool) {
+	matches := cf.regex.FindStringSubmatch(row)
+	if len(matches) == 0 {
+		return NGINXLog{}, false
+	}
+
+	get := func(idx int) string {
+		if idx > 0 && idx < len(matches) {
+			return matches[idx]
+		}
+		return ""
+	}
+
+	logData := NGINXLog{
+		IPAddress:    get(cf.fields.IPAddress),
+		Timestamp:    parseDate(get(cf.fields.Timestamp)),
+		Method:       get(cf.fields.Method),
+		Path:         get(cf.fields.Path),
+		HTTPVersion:  get(cf.fields.HTTPVersion),
+		Status:       parseIntPtr(get(cf.fields.Status)),
+		ResponseSize: parseIntPtr(get(cf.fields.ResponseSize)),
+		Referrer:     get(cf.fields.Referrer),
+		UserAgent:    get(cf.fields.UserAgent),
+	}
+
+	return logData, logData.IPAddress != ""
+}
+
+func parseDate(dateStr string) *time.Time {
+	if dateStr == "" {
+		return nil
+	}
+
+	// Replace first colon with space and capitalize month abbreviation
+	dateStr = dateColonRegex.ReplaceAllString(dateStr, "$1 ")
+
+	// Capitalize month abbreviation
+	dateStr = monthRegex.ReplaceAllStringFunc(dateStr, func(match string) string {
+		return strings.ToUpper(match[:1]) + strings.ToLower(match[1:])
+	})
+
+	// Parse the date
+	layouts := []string{
+		"02/Jan/2006 15:04:05 -0700",
+		"02/Jan/2006:15:04:05 -0700",
+		time.RFC3339,
+	}
+
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, dateStr); err == nil {
+			return &t
+		}
+	}
+
+	return nil
+}
+
+func parseIntPtr(s string) *int {
+	if s == "" {
+		return nil
+	}
+	if val, err := strconv.Atoi(s); err == nil {
+		return &val
+	}
+	return nil
+}
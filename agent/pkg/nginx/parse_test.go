@@ -1,4 +1,4 @@
-package logs
+package nginx
 
 import (
 	"testing"
@@ -326,61 +326,6 @@ func TestParseIntPtr(t *testing.T) {
 	}
 }
 
-func TestParseNginxErrors(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    []string
-		expected int
-	}{
-		{
-			name: "valid error log entry",
-			input: []string{
-				`2024/01/15 10:30:45 [error] 12345#0: *1 connect() failed (111: Connection refused)`,
-			},
-			expected: 1,
-		},
-		{
-			name: "multiple error entries",
-			input: []string{
-				`2024/01/15 10:30:45 [error] 12345#0: *1 connect() failed (111: Connection refused)`,
-				`2024/01/15 10:31:00 [warn] 12345#0: *2 upstream server temporarily disabled`,
-			},
-			expected: 2,
-		},
-		{name: "empty input", input: []string{}, expected: 0},
-		{name: "blank lines", input: []string{``, `   `}, expected: 0},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := ParseNginxErrors(tt.input)
-
-			if len(result) != tt.expected {
-				t.Errorf("ParseNginxErrors() returned %d errors, expected %d", len(result), tt.expected)
-			}
-
-			if tt.expected > 0 && len(result) > 0 {
-				err := result[0]
-				if err.Level == "" {
-					t.Error("Expected Level to be set")
-				}
-				if err.PID == 0 {
-					t.Error("Expected PID to be set")
-				}
-			}
-		})
-	}
-}
-
-func TestParseNginxErrorsExtractsIPv6Client(t *testing.T) {
-	errors := ParseNginxErrors([]string{
-		`2024/01/15 10:30:45 [error] 12345#0: *1 failed, client: 2001:db8::1, server: example.com`,
-	})
-	if len(errors) != 1 || errors[0].ClientAddress == nil || *errors[0].ClientAddress != "2001:db8::1" {
-		t.Fatalf("unexpected client address: %#v", errors)
-	}
-}
-
 // Helper
 func intPtr(i int) *int { return &i }
 
@@ -396,14 +341,3 @@ func BenchmarkParseNginxLogs(b *testing.B) {
 		ParseNginxLogs(input, "")
 	}
 }
-
-func BenchmarkParseNginxErrors(b *testing.B) {
-	input := []string{
-		`2024/01/15 10:30:45 [error] 12345#0: *1 connect() failed (111: Connection refused)`,
-		`2024/01/15 10:31:00 [warn] 12345#0: *2 upstream server temporarily disabled`,
-	}
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		ParseNginxErrors(input)
-	}
-}
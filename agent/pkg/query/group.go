@@ -0,0 +1,109 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/useragent"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/version"
+)
+
+// Grouper counts logs by the value of a field. Logs without a value for the
+// field aren't counted.
+type Grouper struct {
+	key func(nginx.NGINXLog) string
+	// chronological is set for fields that are times, whose groups are
+	// listed in order of time rather than by count
+	chronological bool
+	counts        map[string]int
+}
+
+// NewGrouper returns a Grouper counting logs by field, which is one of
+// status, class, method, path, ip, referrer, ua, client, os, device,
+// version, location, hour or day. Hours and days are in UTC, in RFC 3339
+// format. locationLookup resolves an IP address to a country code, and is
+// required to group by location.
+func NewGrouper(field string, locationLookup func(ipAddress string) string) (*Grouper, error) {
+	g := &Grouper{counts: make(map[string]int)}
+	detector := useragent.NewUserAgentDetector()
+	switch field {
+	case "status":
+		g.key = func(log nginx.NGINXLog) string {
+			if log.Status == nil {
+				return ""
+			}
+			return strconv.Itoa(*log.Status)
+		}
+	case "class":
+		g.key = func(log nginx.NGINXLog) string {
+			if log.Status == nil || *log.Status < 100 || *log.Status > 599 {
+				return ""
+			}
+			return strconv.Itoa(*log.Status/100) + "xx"
+		}
+	case "method", "path", "referrer", "ua":
+		g.key = textFields[field]
+	case "ip":
+		g.key = func(log nginx.NGINXLog) string { return log.IPAddress }
+	case "client":
+		g.key = func(log nginx.NGINXLog) string { return detector.GetClient(log.UserAgent) }
+	case "os":
+		g.key = func(log nginx.NGINXLog) string { return detector.GetOS(log.UserAgent) }
+	case "device":
+		g.key = func(log nginx.NGINXLog) string { return detector.GetDevice(log.UserAgent) }
+	case "version":
+		versionDetector := version.NewInlineVersionDetector()
+		g.key = func(log nginx.NGINXLog) string { return versionDetector.GetVersion(log.Path) }
+	case "location":
+		if locationLookup == nil {
+			return nil, fmt.Errorf("grouping by location requires locations to be enabled")
+		}
+		g.key = func(log nginx.NGINXLog) string { return locationLookup(log.IPAddress) }
+	case "hour", "day":
+		size := time.Hour
+		if field == "day" {
+			size = 24 * time.Hour
+		}
+		g.key = func(log nginx.NGINXLog) string {
+			if log.Timestamp == nil {
+				return ""
+			}
+			return log.Timestamp.UTC().Truncate(size).Format(time.RFC3339)
+		}
+		g.chronological = true
+	default:
+		return nil, fmt.Errorf("unknown group field: %s", field)
+	}
+	return g, nil
+}
+
+// Add counts a log under its value of the field.
+func (g *Grouper) Add(log nginx.NGINXLog) {
+	if key := g.key(log); key != "" {
+		g.counts[key]++
+	}
+}
+
+// Groups returns the count of each value, in order of time for hours and
+// days, and otherwise from the most to the least frequent. Only the first
+// limit groups are returned, unless limit is zero.
+func (g *Grouper) Groups(limit int) []stats.Count {
+	groups := make([]stats.Count, 0, len(g.counts))
+	for name, count := range g.counts {
+		groups = append(groups, stats.Count{Name: name, Count: count})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if !g.chronological && groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].Name < groups[j].Name
+	})
+	if limit > 0 && len(groups) > limit {
+		groups = groups[:limit]
+	}
+	return groups
+}
@@ -0,0 +1,286 @@
+// Package query matches parsed access logs against filter expressions.
+//
+// An expression is a list of terms separated by spaces, all of which a log
+// must match. Each term is a field, an operator and a value:
+//
+//	status:5xx method:GET,POST path:/api/* -ip:10.0.0.0/8 ua:"Mozilla/5.0 (X11"
+//
+// The ":" operator matches values in the field's own way, and any of a
+// comma-separated list of them. The "~" operator matches a regular
+// expression instead, for the fields that hold text. A leading "-" excludes
+// the logs that match the term. Values containing spaces are double-quoted,
+// with \" and \\ escaping quotes and backslashes within.
+//
+// Fields:
+//
+//	status    a status (404), class (4xx) or range (400-499)
+//	method    a method, ignoring case
+//	path      a glob, where * matches any run of characters and ? any one
+//	ip        an IP address or CIDR range
+//	referrer  a glob
+//	ua        a substring of the user agent, ignoring case
+package query
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
+)
+
+// Filter is a parsed filter expression. The zero Filter matches every log.
+type Filter struct {
+	terms []term
+}
+
+type term struct {
+	negate bool
+	match  func(nginx.NGINXLog) bool
+}
+
+// Parse parses a filter expression.
+func Parse(expr string) (Filter, error) {
+	var f Filter
+	s := scanner{input: expr}
+	for {
+		raw, ok, err := s.next()
+		if err != nil {
+			return Filter{}, err
+		}
+		if !ok {
+			return f, nil
+		}
+		t, err := parseTerm(raw)
+		if err != nil {
+			return Filter{}, err
+		}
+		f.terms = append(f.terms, t)
+	}
+}
+
+// Match reports whether a log matches every term of the filter.
+func (f Filter) Match(log nginx.NGINXLog) bool {
+	for _, t := range f.terms {
+		if t.match(log) == t.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// rawTerm is a term as written, with its value unquoted.
+type rawTerm struct {
+	negate bool
+	field  string
+	op     byte
+	value  string
+	quoted bool
+}
+
+// scanner splits an expression into terms.
+type scanner struct {
+	input string
+	pos   int
+}
+
+func (s *scanner) next() (rawTerm, bool, error) {
+	var t rawTerm
+	for s.pos < len(s.input) && s.input[s.pos] == ' ' {
+		s.pos++
+	}
+	if s.pos == len(s.input) {
+		return t, false, nil
+	}
+	start := s.pos
+	if s.input[s.pos] == '-' {
+		t.negate = true
+		s.pos++
+	}
+
+	i := strings.IndexAny(s.input[s.pos:], ":~ ")
+	if i <= 0 || s.input[s.pos+i] == ' ' {
+		end := strings.IndexByte(s.input[start:], ' ')
+		if end < 0 {
+			end = len(s.input) - start
+		}
+		return t, false, fmt.Errorf("invalid term %q: expected field:value or field~pattern", s.input[start:start+end])
+	}
+	t.field = strings.ToLower(s.input[s.pos : s.pos+i])
+	t.op = s.input[s.pos+i]
+	s.pos += i + 1
+
+	if s.pos < len(s.input) && s.input[s.pos] == '"' {
+		var value strings.Builder
+		for s.pos++; ; s.pos++ {
+			if s.pos == len(s.input) {
+				return t, false, fmt.Errorf("unterminated quote in %s term", t.field)
+			}
+			c := s.input[s.pos]
+			if c == '\\' && s.pos+1 < len(s.input) && (s.input[s.pos+1] == '"' || s.input[s.pos+1] == '\\') {
+				s.pos++
+				c = s.input[s.pos]
+			} else if c == '"' {
+				s.pos++
+				break
+			}
+			value.WriteByte(c)
+		}
+		t.value, t.quoted = value.String(), true
+		return t, true, nil
+	}
+
+	end := strings.IndexByte(s.input[s.pos:], ' ')
+	if end < 0 {
+		end = len(s.input) - s.pos
+	}
+	t.value = s.input[s.pos : s.pos+end]
+	s.pos += end
+	if t.value == "" {
+		return t, false, fmt.Errorf("missing value in %s term", t.field)
+	}
+	return t, true, nil
+}
+
+// textFields return the text of the fields that can be matched by pattern.
+var textFields = map[string]func(nginx.NGINXLog) string{
+	"method":   func(log nginx.NGINXLog) string { return log.Method },
+	"path":     func(log nginx.NGINXLog) string { return log.Path },
+	"referrer": func(log nginx.NGINXLog) string { return log.Referrer },
+	"ua":       func(log nginx.NGINXLog) string { return log.UserAgent },
+}
+
+func parseTerm(raw rawTerm) (term, error) {
+	t := term{negate: raw.negate}
+	if _, ok := textFields[raw.field]; !ok && raw.field != "status" && raw.field != "ip" {
+		return t, fmt.Errorf("unknown field: %s", raw.field)
+	}
+
+	if raw.op == '~' {
+		text, ok := textFields[raw.field]
+		if !ok {
+			return t, fmt.Errorf("field %s can't be matched by a pattern", raw.field)
+		}
+		re, err := regexp.Compile(raw.value)
+		if err != nil {
+			return t, fmt.Errorf("invalid %s pattern: %w", raw.field, err)
+		}
+		t.match = func(log nginx.NGINXLog) bool { return re.MatchString(text(log)) }
+		return t, nil
+	}
+
+	values := []string{raw.value}
+	if !raw.quoted {
+		values = strings.Split(raw.value, ",")
+	}
+	var matchers []func(nginx.NGINXLog) bool
+	for _, value := range values {
+		m, err := parseValue(raw.field, value)
+		if err != nil {
+			return t, err
+		}
+		matchers = append(matchers, m)
+	}
+	t.match = func(log nginx.NGINXLog) bool {
+		for _, m := range matchers {
+			if m(log) {
+				return true
+			}
+		}
+		return false
+	}
+	return t, nil
+}
+
+// parseValue returns a matcher for a single value of a field.
+func parseValue(field string, value string) (func(nginx.NGINXLog) bool, error) {
+	switch field {
+	case "status":
+		low, high, err := parseStatusRange(value)
+		if err != nil {
+			return nil, err
+		}
+		return func(log nginx.NGINXLog) bool {
+			return log.Status != nil && *log.Status >= low && *log.Status <= high
+		}, nil
+	case "method":
+		return func(log nginx.NGINXLog) bool { return strings.EqualFold(log.Method, value) }, nil
+	case "path", "referrer":
+		re := globRegex(value)
+		text := textFields[field]
+		return func(log nginx.NGINXLog) bool { return re.MatchString(text(log)) }, nil
+	case "ip":
+		prefix, err := parsePrefix(value)
+		if err != nil {
+			return nil, err
+		}
+		return func(log nginx.NGINXLog) bool {
+			addr, err := netip.ParseAddr(log.IPAddress)
+			return err == nil && prefix.Contains(addr.Unmap())
+		}, nil
+	case "ua":
+		lower := strings.ToLower(value)
+		return func(log nginx.NGINXLog) bool {
+			return strings.Contains(strings.ToLower(log.UserAgent), lower)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown field: %s", field)
+}
+
+// parseStatusRange returns the bounds of a status, status class or range of
+// statuses.
+func parseStatusRange(value string) (int, int, error) {
+	if len(value) == 3 && strings.HasSuffix(strings.ToLower(value), "xx") {
+		if class := value[0] - '0'; class >= 1 && class <= 5 {
+			return int(class) * 100, int(class)*100 + 99, nil
+		}
+	} else if from, to, ok := strings.Cut(value, "-"); ok {
+		low, lowErr := strconv.Atoi(from)
+		high, highErr := strconv.Atoi(to)
+		if lowErr == nil && highErr == nil && low <= high {
+			return low, high, nil
+		}
+	} else if status, err := strconv.Atoi(value); err == nil {
+		return status, status, nil
+	}
+	return 0, 0, fmt.Errorf("invalid status: %s", value)
+}
+
+// parsePrefix parses an IP address or CIDR range. Addresses match only
+// themselves.
+func parsePrefix(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return prefix, fmt.Errorf("invalid CIDR range: %s", value)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP address: %s", value)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// globRegex returns a regular expression matching the whole of the text
+// that a glob matches.
+func globRegex(glob string) *regexp.Regexp {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			pattern.WriteString(".*")
+		case '?':
+			pattern.WriteString(".")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	pattern.WriteString("$")
+	return regexp.MustCompile(pattern.String())
+}
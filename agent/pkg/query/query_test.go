@@ -0,0 +1,125 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
+)
+
+func testLog(ip, method, path string, status int, referrer, userAgent string) nginx.NGINXLog {
+	ts := time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC)
+	return nginx.NGINXLog{
+		IPAddress: ip,
+		Timestamp: &ts,
+		Method:    method,
+		Path:      path,
+		Status:    &status,
+		Referrer:  referrer,
+		UserAgent: userAgent,
+	}
+}
+
+func TestMatch(t *testing.T) {
+	log := testLog("10.1.2.3", "GET", "/api/v1/users?page=2", 503, "https://www.google.com/search", "Mozilla/5.0 (X11; Linux x86_64) Firefox/120.0")
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"", true},
+		{"status:503", true},
+		{"status:5xx", true},
+		{"status:500-502", false},
+		{"status:404,500-599", true},
+		{"-status:5xx", false},
+		{"method:get", true},
+		{"method:POST,PUT", false},
+		{"path:/api/*", true},
+		{"path:/api/v?/users*", true},
+		{"path:/api", false},
+		{"path~^/api/v[0-9]+/", true},
+		{"path~^/v1", false},
+		{"ip:10.0.0.0/8", true},
+		{"ip:10.1.2.3", true},
+		{"ip:192.168.0.0/16,10.1.2.0/24", true},
+		{"-ip:10.0.0.0/8", false},
+		{"referrer:*google*", true},
+		{"ua:firefox", true},
+		{`ua:"(X11; Linux"`, true},
+		{`ua~"Firefox/1[0-9]{2}\.0"`, true},
+		{"status:5xx method:GET ua:curl", false},
+		{"status:5xx  method:GET path:/api/*", true},
+	}
+	for _, tt := range tests {
+		f, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if got := f.Match(log); got != tt.want {
+			t.Errorf("Parse(%q).Match = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"status",
+		":500",
+		"status:",
+		"status:abc",
+		"status:500-400",
+		"status~5..",
+		"ip:10.0.0.0/33",
+		"ip:not-an-ip",
+		"host:example.com",
+		"path~[",
+		`ua:"unterminated`,
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestGrouper(t *testing.T) {
+	logs := []nginx.NGINXLog{
+		testLog("1.1.1.1", "GET", "/a", 200, "", "curl/8.0"),
+		testLog("1.1.1.1", "GET", "/b", 404, "", "curl/8.0"),
+		testLog("2.2.2.2", "POST", "/a", 201, "", "curl/8.0"),
+		{IPAddress: "3.3.3.3", Path: "/c"},
+	}
+
+	tests := []struct {
+		field string
+		limit int
+		want  []stats.Count
+	}{
+		{"path", 0, []stats.Count{{Name: "/a", Count: 2}, {Name: "/b", Count: 1}, {Name: "/c", Count: 1}}},
+		{"path", 1, []stats.Count{{Name: "/a", Count: 2}}},
+		{"class", 0, []stats.Count{{Name: "2xx", Count: 2}, {Name: "4xx", Count: 1}}},
+		{"hour", 0, []stats.Count{{Name: "2024-01-01T12:00:00Z", Count: 3}}},
+	}
+	for _, tt := range tests {
+		g, err := NewGrouper(tt.field, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, log := range logs {
+			g.Add(log)
+		}
+		if got := g.Groups(tt.limit); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("groups by %s = %+v, want %+v", tt.field, got, tt.want)
+		}
+	}
+
+	if _, err := NewGrouper("location", nil); err == nil {
+		t.Error("expected grouping by location without a lookup to fail")
+	}
+	if _, err := NewGrouper("unknown", nil); err == nil {
+		t.Error("expected grouping by an unknown field to fail")
+	}
+}
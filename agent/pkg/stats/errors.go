@@ -0,0 +1,156 @@
+package stats
+
+import (
+	"net/netip"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
+)
+
+// DefaultErrorLimit is the number of entries returned when no limit is
+// requested.
+const DefaultErrorLimit = 1000
+
+// ErrorFilter narrows the error log entries included. Empty fields match
+// every entry.
+type ErrorFilter struct {
+	// Levels lists the levels to include.
+	Levels []string
+	// Client is an IP address or CIDR range the client must be within.
+	Client netip.Prefix
+	// Host is the host the request was made to, ignoring case.
+	Host string
+	// Upstream is a substring of the upstream the request was passed to.
+	Upstream string
+}
+
+// ErrorOptions controls how error log entries are summarized.
+type ErrorOptions struct {
+	// Start and End bound the time range. Zero values are unbounded.
+	Start time.Time
+	End   time.Time
+	// Interval is the bucket size of the level counts. Zero picks an
+	// interval based on the span of the entries.
+	Interval time.Duration
+	// Limit caps the number of entries returned. Zero uses
+	// DefaultErrorLimit.
+	Limit  int
+	Filter ErrorFilter
+}
+
+// ErrorBucket counts error log entries by level for a single time interval.
+type ErrorBucket struct {
+	Timestamp time.Time      `json:"timestamp"`
+	Levels    map[string]int `json:"levels"`
+}
+
+// ErrorStats is a summary of error logs over a time range.
+type ErrorStats struct {
+	// Start and End are the timestamps of the first and last matching entry.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Interval is the bucket size of the level counts in seconds.
+	Interval int64 `json:"interval"`
+	Total    int   `json:"total"`
+	// Levels counts the matching entries by level.
+	Levels  map[string]int `json:"levels"`
+	Buckets []ErrorBucket  `json:"buckets"`
+	// Errors are the most recent matching entries, oldest first.
+	Errors []nginx.NGINXError `json:"errors"`
+}
+
+// SummarizeErrors counts the error log entries matching opts by level, in
+// total and per time bucket, and keeps the most recent of them. Entries
+// without a timestamp are skipped.
+func SummarizeErrors(entries []nginx.NGINXError, opts ErrorOptions) ErrorStats {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultErrorLimit
+	}
+
+	var matched []nginx.NGINXError
+	for _, entry := range entries {
+		if entry.Timestamp.IsZero() {
+			continue
+		}
+		if !opts.Start.IsZero() && entry.Timestamp.Before(opts.Start) {
+			continue
+		}
+		if !opts.End.IsZero() && entry.Timestamp.After(opts.End) {
+			continue
+		}
+		if !matchesError(entry, opts.Filter) {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+
+	stats := ErrorStats{
+		Levels:  make(map[string]int),
+		Buckets: []ErrorBucket{},
+		Errors:  []nginx.NGINXError{},
+	}
+	if len(matched) == 0 {
+		return stats
+	}
+	// Logs read from several files aren't necessarily in order
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Timestamp.Before(matched[j].Timestamp)
+	})
+	stats.Start, stats.End = matched[0].Timestamp, matched[len(matched)-1].Timestamp
+
+	interval := opts.Interval
+	if interval <= 0 {
+		span := stats.End.Sub(stats.Start)
+		if !opts.Start.IsZero() {
+			span = stats.End.Sub(opts.Start)
+		}
+		interval = AdaptiveBucketInterval(span)
+	}
+	stats.Interval = int64(interval / time.Second)
+
+	buckets := make(map[time.Time]map[string]int)
+	for _, entry := range matched {
+		stats.Levels[entry.Level]++
+		t := entry.Timestamp.Truncate(interval)
+		if buckets[t] == nil {
+			buckets[t] = make(map[string]int)
+		}
+		buckets[t][entry.Level]++
+	}
+	for t, levels := range buckets {
+		stats.Buckets = append(stats.Buckets, ErrorBucket{Timestamp: t, Levels: levels})
+	}
+	sort.Slice(stats.Buckets, func(i, j int) bool {
+		return stats.Buckets[i].Timestamp.Before(stats.Buckets[j].Timestamp)
+	})
+
+	stats.Total = len(matched)
+	stats.Errors = matched[max(0, len(matched)-limit):]
+	return stats
+}
+
+func matchesError(entry nginx.NGINXError, f ErrorFilter) bool {
+	if len(f.Levels) > 0 && !slices.Contains(f.Levels, entry.Level) {
+		return false
+	}
+	if f.Client.IsValid() {
+		if entry.ClientAddress == nil {
+			return false
+		}
+		addr, err := netip.ParseAddr(*entry.ClientAddress)
+		if err != nil || !f.Client.Contains(addr.Unmap()) {
+			return false
+		}
+	}
+	if f.Host != "" && (entry.Host == nil || !strings.EqualFold(*entry.Host, f.Host)) {
+		return false
+	}
+	if f.Upstream != "" && (entry.Upstream == nil || !strings.Contains(*entry.Upstream, f.Upstream)) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package stats
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
+)
+
+func TestSummarizeErrors(t *testing.T) {
+	entries := nginx.ParseNginxErrors([]string{
+		`2024/01/15 10:00:00 [error] 1#0: *1 connect() failed, client: 10.0.0.1, server: _, request: "GET / HTTP/1.1", upstream: "http://127.0.0.1:8080/", host: "example.com"`,
+		`2024/01/15 10:02:00 [warn] 1#0: *2 an upstream response is buffered, client: 10.0.0.2, server: _, request: "GET /big HTTP/1.1", upstream: "http://127.0.0.1:9090/big", host: "api.example.com"`,
+		`2024/01/15 10:20:00 [error] 1#0: *3 open() failed, client: 192.168.1.1, server: _, request: "GET /missing HTTP/1.1", host: "example.com"`,
+		`2024/01/15 09:55:00 [crit] 1#0: *4 out of memory`,
+		"continuation without a time",
+	})
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.Local)
+
+	got := SummarizeErrors(entries, ErrorOptions{Interval: 15 * time.Minute})
+	if got.Total != 4 || got.Levels["error"] != 2 || got.Levels["warn"] != 1 || got.Levels["crit"] != 1 {
+		t.Errorf("unexpected totals: %d %v", got.Total, got.Levels)
+	}
+	if len(got.Buckets) != 3 || got.Buckets[1].Levels["error"] != 1 || got.Buckets[1].Levels["warn"] != 1 {
+		t.Errorf("unexpected buckets: %+v", got.Buckets)
+	}
+	if !got.Start.Equal(base.Add(-5*time.Minute)) || !got.End.Equal(base.Add(20*time.Minute)) {
+		t.Errorf("unexpected range: %v to %v", got.Start, got.End)
+	}
+	// Entries are sorted by time, keeping the most recent
+	limited := SummarizeErrors(entries, ErrorOptions{Limit: 2})
+	if len(limited.Errors) != 2 || limited.Errors[1].CID != "3" || limited.Total != 4 {
+		t.Errorf("unexpected limited entries: %+v", limited.Errors)
+	}
+
+	tests := []struct {
+		name string
+		opts ErrorOptions
+		want int
+	}{
+		{"levels", ErrorOptions{Filter: ErrorFilter{Levels: []string{"warn", "crit"}}}, 2},
+		{"time range", ErrorOptions{Start: base, End: base.Add(5 * time.Minute)}, 2},
+		{"client range", ErrorOptions{Filter: ErrorFilter{Client: netip.MustParsePrefix("10.0.0.0/8")}}, 2},
+		{"host", ErrorOptions{Filter: ErrorFilter{Host: "EXAMPLE.com"}}, 2},
+		{"upstream", ErrorOptions{Filter: ErrorFilter{Upstream: ":9090"}}, 1},
+	}
+	for _, tt := range tests {
+		if got := SummarizeErrors(entries, tt.opts); got.Total != tt.want || len(got.Errors) != tt.want {
+			t.Errorf("%s: got %d entries, want %d", tt.name, got.Total, tt.want)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package stats
+
+import (
+	"sort"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/user"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/useragent"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/version"
+)
+
+// The detectors are shared by every rollup, and are safe for concurrent use.
+var (
+	rollupDetector        = useragent.NewUserAgentDetector()
+	rollupVersionDetector = version.NewInlineVersionDetector()
+)
+
+// Rollup holds the statistics of the access logs in a time slot in a fixed
+// amount of memory, so that statistics over a long range can be summarized
+// from a rollup per slot rather than from every request. Users are counted
+// approximately, and each top-N list keeps only its most frequent entries.
+type Rollup struct {
+	// Start is the start of the slot.
+	Start time.Time
+
+	first         time.Time
+	last          time.Time
+	requests      int
+	success       int
+	total         int
+	bytes         int64
+	statusClasses map[string]int
+	users         hyperLogLog
+	usageTime     [24]int
+	endpoints     topK[endpointID]
+	referrers     topK[endpointID]
+	clients       topK[string]
+	os            topK[string]
+	devices       topK[string]
+	versions      topK[string]
+	locations     topK[string]
+	networks      topK[network]
+}
+
+// network identifies an autonomous system in a rollup.
+type network struct {
+	asn          uint
+	organization string
+}
+
+// NewRollup returns an empty rollup of the slot starting at start, whose
+// top-N lists each keep up to capacity entries.
+func NewRollup(start time.Time, capacity int) *Rollup {
+	return &Rollup{
+		Start:         start,
+		statusClasses: make(map[string]int),
+		endpoints:     newTopK[endpointID](capacity),
+		referrers:     newTopK[endpointID](capacity),
+		clients:       newTopK[string](capacity),
+		os:            newTopK[string](capacity),
+		devices:       newTopK[string](capacity),
+		versions:      newTopK[string](capacity),
+		locations:     newTopK[string](capacity),
+		networks:      newTopK[network](capacity),
+	}
+}
+
+// Add counts an access log in the rollup. Logs without a timestamp are
+// skipped. locationLookup resolves the log's IP address to a country code,
+// and networkLookup to its autonomous system. Either may be nil to leave
+// locations or networks uncounted.
+func (r *Rollup) Add(log nginx.NGINXLog, locationLookup func(ipAddress string) string, networkLookup func(ipAddress string) (uint, string)) {
+	if log.Timestamp == nil {
+		return
+	}
+	if r.requests == 0 || log.Timestamp.Before(r.first) {
+		r.first = *log.Timestamp
+	}
+	if r.requests == 0 || log.Timestamp.After(r.last) {
+		r.last = *log.Timestamp
+	}
+	r.requests++
+	r.users.add(user.UserID(log))
+
+	if log.Status != nil {
+		r.total++
+		if isSuccess(*log.Status) {
+			r.success++
+		}
+		if class, ok := statusClass(*log.Status); ok {
+			r.statusClasses[class]++
+		}
+		if log.Path != "" {
+			r.endpoints.add(endpointID{path: log.Path, method: log.Method, status: *log.Status}, 1)
+		}
+		if log.Referrer != "" && log.Referrer != "-" {
+			r.referrers.add(endpointID{path: log.Referrer, method: log.Method, status: *log.Status}, 1)
+		}
+	}
+	if log.ResponseSize != nil {
+		r.bytes += int64(*log.ResponseSize)
+	}
+
+	r.usageTime[log.Timestamp.Hour()]++
+
+	if v := rollupDetector.GetClient(log.UserAgent); v != "" {
+		r.clients.add(v, 1)
+	}
+	if v := rollupDetector.GetOS(log.UserAgent); v != "" {
+		r.os.add(v, 1)
+	}
+	if v := rollupDetector.GetDevice(log.UserAgent); v != "" {
+		r.devices.add(v, 1)
+	}
+	if v := rollupVersionDetector.GetVersion(log.Path); v != "" {
+		r.versions.add(v, 1)
+	}
+	if locationLookup != nil && log.IPAddress != "" {
+		if v := locationLookup(log.IPAddress); v != "" {
+			r.locations.add(v, 1)
+		}
+	}
+	if networkLookup != nil && log.IPAddress != "" {
+		if asn, organization := networkLookup(log.IPAddress); asn != 0 {
+			r.networks.add(network{asn: asn, organization: organization}, 1)
+		}
+	}
+}
+
+// Merge adds the counts of other to the rollup.
+func (r *Rollup) Merge(other *Rollup) {
+	if other.requests == 0 {
+		return
+	}
+	if r.requests == 0 || other.first.Before(r.first) {
+		r.first = other.first
+	}
+	if r.requests == 0 || other.last.After(r.last) {
+		r.last = other.last
+	}
+	r.requests += other.requests
+	r.success += other.success
+	r.total += other.total
+	r.bytes += other.bytes
+	for class, count := range other.statusClasses {
+		r.statusClasses[class] += count
+	}
+	r.users.merge(&other.users)
+	for hour, count := range other.usageTime {
+		r.usageTime[hour] += count
+	}
+	r.endpoints.merge(other.endpoints)
+	r.referrers.merge(other.referrers)
+	r.clients.merge(other.clients)
+	r.os.merge(other.os)
+	r.devices.merge(other.devices)
+	r.versions.merge(other.versions)
+	r.locations.merge(other.locations)
+	r.networks.merge(other.networks)
+}
+
+// Summarize aggregates rollups of slots of the given size into Stats, like
+// Compute does for the logs they hold. Rollups of slots that overlap the
+// time range are included whole. The bucket interval is rounded up to a
+// multiple of the slot size, and the filter is not applied, as rollups don't
+// keep the requests it would need.
+func Summarize(rollups []*Rollup, slot time.Duration, opts Options) Stats {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+
+	var included []*Rollup
+	for _, r := range rollups {
+		if r.requests == 0 {
+			continue
+		}
+		if !opts.Start.IsZero() && !r.Start.Add(slot).After(opts.Start) {
+			continue
+		}
+		if !opts.End.IsZero() && r.Start.After(opts.End) {
+			continue
+		}
+		included = append(included, r)
+	}
+
+	stats := newStats()
+	if len(included) == 0 {
+		return stats
+	}
+
+	capacity := included[0].endpoints.capacity
+	summary := NewRollup(time.Time{}, capacity)
+	for _, r := range included {
+		summary.Merge(r)
+	}
+	stats.Start, stats.End = summary.first, summary.last
+
+	interval := opts.Interval
+	if interval <= 0 {
+		span := stats.End.Sub(stats.Start)
+		if !opts.Start.IsZero() {
+			span = stats.End.Sub(opts.Start)
+		}
+		interval = AdaptiveBucketInterval(span)
+	}
+	// Each slot must fall within a single bucket
+	interval = (interval + slot - 1) / slot * slot
+	stats.Interval = int64(interval / time.Second)
+
+	buckets := make(map[time.Time]*Rollup)
+	for _, r := range included {
+		t := r.Start.Truncate(interval)
+		b, ok := buckets[t]
+		if !ok {
+			b = &Rollup{statusClasses: make(map[string]int)}
+			buckets[t] = b
+		}
+		b.requests += r.requests
+		b.success += r.success
+		b.total += r.total
+		b.users.merge(&r.users)
+	}
+	for t, b := range buckets {
+		stats.Buckets = append(stats.Buckets, Bucket{
+			Timestamp: t,
+			Requests:  b.requests,
+			Users:     b.users.count(),
+			Success:   b.success,
+			Total:     b.total,
+		})
+	}
+	sort.Slice(stats.Buckets, func(i, j int) bool {
+		return stats.Buckets[i].Timestamp.Before(stats.Buckets[j].Timestamp)
+	})
+
+	stats.Requests = summary.requests
+	stats.Users = summary.users.count()
+	if summary.total > 0 {
+		stats.SuccessRate = float64(summary.success) / float64(summary.total)
+	}
+	stats.StatusClasses = summary.statusClasses
+	stats.Bytes = summary.bytes
+	copy(stats.UsageTime, summary.usageTime[:])
+
+	stats.Endpoints = topEndpoints(summary.endpoints.counts, limit)
+	stats.Referrers = topReferrers(summary.referrers.counts, limit)
+	stats.Clients = topCounts(summary.clients.counts, limit)
+	stats.OS = topCounts(summary.os.counts, limit)
+	stats.Devices = topCounts(summary.devices.counts, limit)
+	stats.Versions = topCounts(summary.versions.counts, limit)
+	if opts.LocationLookup != nil {
+		stats.Locations = topCounts(summary.locations.counts, limit)
+	}
+	if opts.NetworkLookup != nil {
+		stats.Networks = make([]Network, 0, len(summary.networks.counts))
+		for n, count := range summary.networks.counts {
+			stats.Networks = append(stats.Networks, Network{ASN: n.asn, Organization: n.organization, Requests: count})
+		}
+		stats.Networks = topNetworks(stats.Networks, limit)
+	}
+
+	return stats
+}
@@ -0,0 +1,94 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
+)
+
+func TestSummarize(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	chrome := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	size := 100
+	logs := []nginx.NGINXLog{
+		testLog(base, "1.1.1.1", "GET", "/api/v1/users", 200, "https://example.com", chrome),
+		testLog(base.Add(time.Minute), "1.1.1.1", "GET", "/api/v1/users", 200, "-", chrome),
+		testLog(base.Add(10*time.Minute), "2.2.2.2", "POST", "/api/v2/items", 500, "", "curl/8.0.1"),
+		testLog(base.Add(2*time.Hour), "3.3.3.3", "GET", "/", 404, "", chrome),
+		testLog(base.Add(26*time.Hour), "1.1.1.1", "GET", "/", 301, "", chrome),
+	}
+	for i := range logs {
+		logs[i].ResponseSize = &size
+	}
+
+	rollups := make(map[time.Time]*Rollup)
+	for _, log := range logs {
+		start := log.Timestamp.Truncate(time.Hour)
+		if rollups[start] == nil {
+			rollups[start] = NewRollup(start, 10)
+		}
+		rollups[start].Add(log, nil, nil)
+	}
+	var slots []*Rollup
+	for _, r := range rollups {
+		slots = append(slots, r)
+	}
+
+	for _, opts := range []Options{
+		{Interval: time.Hour},
+		{Interval: 3 * time.Hour, Limit: 2},
+		{Start: base.Add(time.Hour), End: base.Add(3 * time.Hour), Interval: time.Hour},
+	} {
+		want := Compute(logs, opts)
+		got := Summarize(slots, time.Hour, opts)
+		// Rollups of counts this small are exact
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Summarize(%+v) = %+v\nwant %+v", opts, got, want)
+		}
+	}
+}
+
+func TestSummarizeInterval(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var slots []*Rollup
+	for i := range 3 {
+		start := base.Add(time.Duration(i) * 24 * time.Hour)
+		r := NewRollup(start, 10)
+		r.Add(testLog(start.Add(time.Hour), "1.1.1.1", "GET", "/", 200, "", ""), nil, nil)
+		slots = append(slots, r)
+	}
+
+	// Buckets are no finer than the slots
+	got := Summarize(slots, 24*time.Hour, Options{Interval: time.Hour})
+	if got.Interval != 86400 {
+		t.Errorf("Interval = %d, want 86400", got.Interval)
+	}
+	if len(got.Buckets) != 3 || got.Buckets[0].Timestamp != base {
+		t.Errorf("unexpected buckets: %+v", got.Buckets)
+	}
+	if got.Users != 1 || got.Requests != 3 {
+		t.Errorf("got %d users and %d requests, want 1 and 3", got.Users, got.Requests)
+	}
+}
+
+func TestSummarizeNetworks(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	lookup := func(ip string) (uint, string) {
+		if ip == "1.1.1.1" {
+			return 13335, "CLOUDFLARENET"
+		}
+		return 0, ""
+	}
+	r := NewRollup(start, 10)
+	r.Add(testLog(start, "1.1.1.1", "GET", "/", 200, "", ""), nil, lookup)
+	r.Add(testLog(start.Add(time.Minute), "1.1.1.1", "GET", "/", 200, "", ""), nil, lookup)
+	r.Add(testLog(start.Add(2*time.Minute), "2.2.2.2", "GET", "/", 200, "", ""), nil, lookup)
+
+	// Rollups count the requests of each network, but not its users
+	got := Summarize([]*Rollup{r}, time.Hour, Options{NetworkLookup: lookup})
+	if len(got.Networks) != 1 || got.Networks[0] != (Network{ASN: 13335, Organization: "CLOUDFLARENET", Requests: 2}) {
+		t.Errorf("unexpected networks: %+v", got.Networks)
+	}
+}
@@ -0,0 +1,120 @@
+package stats
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// hllPrecision sets the number of HyperLogLog registers to 2^hllPrecision,
+// giving a standard error of about 3% in distinct counts.
+const hllPrecision = 10
+
+// hyperLogLog estimates the number of distinct values added to it, in a fixed
+// amount of memory, and can be merged with others to count the distinct
+// values added to any of them.
+type hyperLogLog struct {
+	registers [1 << hllPrecision]uint8
+}
+
+func (h *hyperLogLog) add(value string) {
+	hash := fnv.New64a()
+	hash.Write([]byte(value))
+	x := mix(hash.Sum64())
+	// The low bits pick the register, and the rest give the rank: the
+	// position of their first set bit
+	index := x & (1<<hllPrecision - 1)
+	rank := uint8(bits.LeadingZeros64(x>>hllPrecision|1)) - hllPrecision + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+// mix spreads the entropy of a hash across all of its bits, as FNV leaves the
+// high bits of similar values alike.
+func mix(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+func (h *hyperLogLog) merge(other *hyperLogLog) {
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+func (h *hyperLogLog) count() int {
+	const m = float64(1 << hllPrecision)
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += math.Pow(2, -float64(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// Small counts are estimated more accurately from the empty registers
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int(math.Round(estimate))
+}
+
+// topK counts the most frequent keys added to it, keeping at most capacity
+// keys with the space-saving algorithm. When full, a new key replaces the
+// least frequent one and takes over its count, so counts may be overstated
+// but the most frequent keys are kept.
+type topK[K comparable] struct {
+	capacity int
+	counts   map[K]int
+}
+
+func newTopK[K comparable](capacity int) topK[K] {
+	return topK[K]{capacity: capacity, counts: make(map[K]int)}
+}
+
+func (t *topK[K]) add(key K, count int) {
+	if _, ok := t.counts[key]; ok || len(t.counts) < t.capacity {
+		t.counts[key] += count
+		return
+	}
+	var minKey K
+	minCount := math.MaxInt
+	for k, c := range t.counts {
+		if c < minCount {
+			minKey, minCount = k, c
+		}
+	}
+	delete(t.counts, minKey)
+	t.counts[key] = minCount + count
+}
+
+// merge adds the counts of other, keeping the most frequent keys of the two
+// combined.
+func (t *topK[K]) merge(other topK[K]) {
+	for k, c := range other.counts {
+		t.counts[k] += c
+	}
+	if len(t.counts) <= t.capacity {
+		return
+	}
+	type entry struct {
+		key   K
+		count int
+	}
+	entries := make([]entry, 0, len(t.counts))
+	for k, c := range t.counts {
+		entries = append(entries, entry{k, c})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].count > entries[j].count })
+	for _, e := range entries[t.capacity:] {
+		delete(t.counts, e.key)
+	}
+}
@@ -0,0 +1,64 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 1000, 100000} {
+		var h hyperLogLog
+		for i := range n {
+			// Repeats don't change the count
+			h.add(fmt.Sprintf("user-%d", i))
+			h.add(fmt.Sprintf("user-%d", i))
+		}
+		if got := h.count(); math.Abs(float64(got-n)) > 0.1*float64(n) {
+			t.Errorf("count of %d distinct values = %d", n, got)
+		}
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	var a, b hyperLogLog
+	for i := range 2000 {
+		a.add(fmt.Sprintf("user-%d", i))
+	}
+	for i := 1000; i < 3000; i++ {
+		b.add(fmt.Sprintf("user-%d", i))
+	}
+	a.merge(&b)
+	if got := a.count(); math.Abs(float64(got-3000)) > 300 {
+		t.Errorf("merged count = %d, want about 3000", got)
+	}
+}
+
+func TestTopK(t *testing.T) {
+	top := newTopK[string](10)
+	// Keys more frequent than 1/capacity of the total are always kept
+	for i := range 1000 {
+		top.add(fmt.Sprintf("rare-%d", i), 1)
+		if i%10 == 0 {
+			top.add("frequent-a", 3)
+			top.add("frequent-b", 2)
+		}
+	}
+	if len(top.counts) != 10 {
+		t.Errorf("kept %d keys, want 10", len(top.counts))
+	}
+	if top.counts["frequent-a"] < 300 || top.counts["frequent-b"] < 200 {
+		t.Errorf("frequent keys undercounted: %v", top.counts)
+	}
+
+	other := newTopK[string](10)
+	other.add("frequent-b", 500)
+	other.add("other", 1)
+	top.merge(other)
+	if len(top.counts) != 10 {
+		t.Errorf("kept %d keys after merge, want 10", len(top.counts))
+	}
+	if top.counts["frequent-b"] < 700 {
+		t.Errorf("merged count of frequent-b = %d, want at least 700", top.counts["frequent-b"])
+	}
+}
@@ -0,0 +1,472 @@
+package stats
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/user"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/useragent"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/version"
+)
+
+// DefaultLimit is the number of entries kept in each top-N list when no limit
+// is requested.
+const DefaultLimit = 50
+
+// Filter narrows the requests included in the statistics. Empty fields match
+// every request.
+type Filter struct {
+	Path     string `json:"path,omitempty"`
+	Method   string `json:"method,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Referrer string `json:"referrer,omitempty"`
+	Client   string `json:"client,omitempty"`
+	OS       string `json:"os,omitempty"`
+	Device   string `json:"device,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Location string `json:"location,omitempty"`
+	// Network is the number of the autonomous system of the client.
+	Network uint `json:"network,omitempty"`
+}
+
+// Options controls how statistics are computed.
+type Options struct {
+	// Start and End bound the time range. Zero values are unbounded.
+	Start time.Time
+	End   time.Time
+	// Interval is the bucket size of the time series. Zero picks an interval
+	// based on the span of the data.
+	Interval time.Duration
+	// Limit caps the length of each top-N list. Zero uses DefaultLimit.
+	Limit  int
+	Filter Filter
+	// LocationLookup resolves an IP address to a country code. When nil,
+	// location filtering and the locations list are skipped.
+	LocationLookup func(ipAddress string) string
+	// NetworkLookup resolves an IP address to the number and organization of
+	// its autonomous system, with a zero number when it isn't known. When
+	// nil, network filtering and the networks list are skipped.
+	NetworkLookup func(ipAddress string) (asn uint, organization string)
+}
+
+// Bucket holds request metrics for a single time interval.
+type Bucket struct {
+	Timestamp time.Time `json:"timestamp"`
+	Requests  int       `json:"requests"`
+	Users     int       `json:"users"`
+	// Success and Total count requests with a 1xx-3xx status and requests
+	// with any status, for computing the success rate of the bucket.
+	Success int `json:"success"`
+	Total   int `json:"total"`
+}
+
+// Count is a named entry in a top-N list.
+type Count struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Endpoint counts requests to a path by method and status.
+type Endpoint struct {
+	Path   string `json:"path"`
+	Method string `json:"method"`
+	Status int    `json:"status"`
+	Count  int    `json:"count"`
+}
+
+// Referrer counts requests from a referrer by method and status.
+type Referrer struct {
+	Referrer string `json:"referrer"`
+	Method   string `json:"method"`
+	Status   int    `json:"status"`
+	Count    int    `json:"count"`
+}
+
+// Network counts the requests and users from an autonomous system.
+type Network struct {
+	ASN          uint   `json:"asn"`
+	Organization string `json:"organization"`
+	Requests     int    `json:"requests"`
+	// Users is zero when summarized from rollups, which don't count the
+	// users of each network.
+	Users int `json:"users"`
+}
+
+// Stats is a precomputed summary of access logs over a time range.
+type Stats struct {
+	// Start and End are the timestamps of the first and last matching request.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Interval is the bucket size of the time series in seconds.
+	Interval    int64   `json:"interval"`
+	Requests    int     `json:"requests"`
+	Users       int     `json:"users"`
+	SuccessRate float64 `json:"successRate"` // -1 when no request has a status
+	// StatusClasses counts requests by status class, such as 2xx.
+	StatusClasses map[string]int `json:"statusClasses"`
+	// Bytes is the total response size of the requests.
+	Bytes   int64    `json:"bytes"`
+	Buckets []Bucket `json:"buckets"`
+	// UsageTime counts requests by hour of the day.
+	UsageTime []int      `json:"usageTime"`
+	Endpoints []Endpoint `json:"endpoints"`
+	Referrers []Referrer `json:"referrers"`
+	Clients   []Count    `json:"clients"`
+	OS        []Count    `json:"os"`
+	Devices   []Count    `json:"devices"`
+	Versions  []Count    `json:"versions"`
+	Locations []Count    `json:"locations,omitempty"`
+	Networks  []Network  `json:"networks,omitempty"`
+}
+
+type bucketCounts struct {
+	requests int
+	success  int
+	total    int
+	users    map[string]struct{}
+}
+
+type networkCounts struct {
+	organization string
+	requests     int
+	users        map[string]struct{}
+}
+
+type endpointID struct {
+	path   string
+	method string
+	status int
+}
+
+// Compute aggregates the given access logs into Stats.
+func Compute(logs []nginx.NGINXLog, opts Options) Stats {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+
+	detector := useragent.NewUserAgentDetector()
+	versionDetector := version.NewInlineVersionDetector()
+
+	matched := make([]nginx.NGINXLog, 0, len(logs))
+	for _, log := range logs {
+		if log.Timestamp == nil {
+			continue
+		}
+		if !opts.Start.IsZero() && log.Timestamp.Before(opts.Start) {
+			continue
+		}
+		if !opts.End.IsZero() && log.Timestamp.After(opts.End) {
+			continue
+		}
+		if !matches(log, opts, detector, versionDetector) {
+			continue
+		}
+		matched = append(matched, log)
+	}
+
+	stats := newStats()
+	if len(matched) == 0 {
+		return stats
+	}
+
+	stats.Start, stats.End = *matched[0].Timestamp, *matched[0].Timestamp
+	for _, log := range matched {
+		if log.Timestamp.Before(stats.Start) {
+			stats.Start = *log.Timestamp
+		}
+		if log.Timestamp.After(stats.End) {
+			stats.End = *log.Timestamp
+		}
+	}
+
+	interval := opts.Interval
+	if interval <= 0 {
+		span := stats.End.Sub(stats.Start)
+		if !opts.Start.IsZero() {
+			span = stats.End.Sub(opts.Start)
+		}
+		interval = AdaptiveBucketInterval(span)
+	}
+	stats.Interval = int64(interval / time.Second)
+
+	users := make(map[string]struct{})
+	buckets := make(map[time.Time]*bucketCounts)
+	endpoints := make(map[endpointID]int)
+	referrers := make(map[endpointID]int)
+	clients := make(map[string]int)
+	operatingSystems := make(map[string]int)
+	devices := make(map[string]int)
+	versions := make(map[string]int)
+	locations := make(map[string]int)
+	networks := make(map[uint]*networkCounts)
+	success, total := 0, 0
+
+	for _, log := range matched {
+		userID := user.UserID(log)
+		users[userID] = struct{}{}
+
+		t := log.Timestamp.Truncate(interval)
+		b, ok := buckets[t]
+		if !ok {
+			b = &bucketCounts{users: make(map[string]struct{})}
+			buckets[t] = b
+		}
+		b.requests++
+		b.users[userID] = struct{}{}
+
+		if log.Status != nil {
+			b.total++
+			total++
+			if isSuccess(*log.Status) {
+				b.success++
+				success++
+			}
+			if class, ok := statusClass(*log.Status); ok {
+				stats.StatusClasses[class]++
+			}
+			if log.Path != "" {
+				endpoints[endpointID{path: log.Path, method: log.Method, status: *log.Status}]++
+			}
+			if log.Referrer != "" && log.Referrer != "-" {
+				referrers[endpointID{path: log.Referrer, method: log.Method, status: *log.Status}]++
+			}
+		}
+
+		if log.ResponseSize != nil {
+			stats.Bytes += int64(*log.ResponseSize)
+		}
+
+		stats.UsageTime[log.Timestamp.Hour()]++
+
+		if v := detector.GetClient(log.UserAgent); v != "" {
+			clients[v]++
+		}
+		if v := detector.GetOS(log.UserAgent); v != "" {
+			operatingSystems[v]++
+		}
+		if v := detector.GetDevice(log.UserAgent); v != "" {
+			devices[v]++
+		}
+		if v := versionDetector.GetVersion(log.Path); v != "" {
+			versions[v]++
+		}
+		if opts.LocationLookup != nil && log.IPAddress != "" {
+			if v := opts.LocationLookup(log.IPAddress); v != "" {
+				locations[v]++
+			}
+		}
+		if opts.NetworkLookup != nil && log.IPAddress != "" {
+			if asn, organization := opts.NetworkLookup(log.IPAddress); asn != 0 {
+				n, ok := networks[asn]
+				if !ok {
+					n = &networkCounts{organization: organization, users: make(map[string]struct{})}
+					networks[asn] = n
+				}
+				n.requests++
+				n.users[userID] = struct{}{}
+			}
+		}
+	}
+
+	stats.Requests = len(matched)
+	stats.Users = len(users)
+	if total > 0 {
+		stats.SuccessRate = float64(success) / float64(total)
+	}
+
+	for t, b := range buckets {
+		stats.Buckets = append(stats.Buckets, Bucket{
+			Timestamp: t,
+			Requests:  b.requests,
+			Users:     len(b.users),
+			Success:   b.success,
+			Total:     b.total,
+		})
+	}
+	sort.Slice(stats.Buckets, func(i, j int) bool {
+		return stats.Buckets[i].Timestamp.Before(stats.Buckets[j].Timestamp)
+	})
+
+	stats.Endpoints = topEndpoints(endpoints, limit)
+	stats.Referrers = topReferrers(referrers, limit)
+	stats.Clients = topCounts(clients, limit)
+	stats.OS = topCounts(operatingSystems, limit)
+	stats.Devices = topCounts(devices, limit)
+	stats.Versions = topCounts(versions, limit)
+	if opts.LocationLookup != nil {
+		stats.Locations = topCounts(locations, limit)
+	}
+	if opts.NetworkLookup != nil {
+		stats.Networks = make([]Network, 0, len(networks))
+		for asn, n := range networks {
+			stats.Networks = append(stats.Networks, Network{ASN: asn, Organization: n.organization, Requests: n.requests, Users: len(n.users)})
+		}
+		stats.Networks = topNetworks(stats.Networks, limit)
+	}
+
+	return stats
+}
+
+// newStats returns the Stats of no requests.
+func newStats() Stats {
+	return Stats{
+		SuccessRate:   -1,
+		StatusClasses: make(map[string]int),
+		UsageTime:     make([]int, 24),
+		Buckets:       []Bucket{},
+	}
+}
+
+func matches(log nginx.NGINXLog, opts Options, detector *useragent.UserAgentDetector, versionDetector *version.InlineVersionDetector) bool {
+	f := opts.Filter
+	if f.Path != "" && log.Path != f.Path {
+		return false
+	}
+	if f.Method != "" && log.Method != f.Method {
+		return false
+	}
+	if f.Status != 0 && (log.Status == nil || *log.Status != f.Status) {
+		return false
+	}
+	if f.Referrer != "" && log.Referrer != f.Referrer {
+		return false
+	}
+	if f.Client != "" && detector.GetClient(log.UserAgent) != f.Client {
+		return false
+	}
+	if f.OS != "" && detector.GetOS(log.UserAgent) != f.OS {
+		return false
+	}
+	if f.Device != "" && detector.GetDevice(log.UserAgent) != f.Device {
+		return false
+	}
+	if f.Version != "" && versionDetector.GetVersion(log.Path) != f.Version {
+		return false
+	}
+	if f.Location != "" && (opts.LocationLookup == nil || opts.LocationLookup(log.IPAddress) != f.Location) {
+		return false
+	}
+	if f.Network != 0 {
+		if opts.NetworkLookup == nil {
+			return false
+		}
+		if asn, _ := opts.NetworkLookup(log.IPAddress); asn != f.Network {
+			return false
+		}
+	}
+	return true
+}
+
+func isSuccess(status int) bool {
+	return status >= 100 && status < 400
+}
+
+// statusClass returns the class of a status, such as 2xx, if it is valid.
+func statusClass(status int) (string, bool) {
+	if status < 100 || status > 599 {
+		return "", false
+	}
+	return strconv.Itoa(status/100) + "xx", true
+}
+
+// AdaptiveBucketInterval picks a bucket size so that the span produces at
+// most ~1500 buckets, matching the resolution used by the dashboard charts.
+func AdaptiveBucketInterval(span time.Duration) time.Duration {
+	const defaultInterval = 5 * time.Minute
+	if span <= 0 {
+		return defaultInterval
+	}
+	targets := []time.Duration{
+		5 * time.Minute,
+		15 * time.Minute,
+		30 * time.Minute,
+		1 * time.Hour,
+		3 * time.Hour,
+		6 * time.Hour,
+		12 * time.Hour,
+		24 * time.Hour,
+	}
+	const targetBuckets = 1500
+	for _, d := range targets {
+		if span/d <= targetBuckets {
+			return d
+		}
+	}
+	return 24 * time.Hour
+}
+
+func topCounts(counts map[string]int, limit int) []Count {
+	sorted := make([]Count, 0, len(counts))
+	for name, count := range counts {
+		sorted = append(sorted, Count{Name: name, Count: count})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	if len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+	return sorted
+}
+
+// topNetworks sorts networks by requests, keeping up to limit of them.
+func topNetworks(networks []Network, limit int) []Network {
+	sort.Slice(networks, func(i, j int) bool {
+		if networks[i].Requests != networks[j].Requests {
+			return networks[i].Requests > networks[j].Requests
+		}
+		return networks[i].ASN < networks[j].ASN
+	})
+	if len(networks) > limit {
+		networks = networks[:limit]
+	}
+	return networks
+}
+
+func sortedIDs(counts map[endpointID]int, limit int) []endpointID {
+	ids := make([]endpointID, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := ids[i], ids[j]
+		if counts[a] != counts[b] {
+			return counts[a] > counts[b]
+		}
+		if a.path != b.path {
+			return a.path < b.path
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	return ids
+}
+
+func topEndpoints(counts map[endpointID]int, limit int) []Endpoint {
+	ids := sortedIDs(counts, limit)
+	endpoints := make([]Endpoint, len(ids))
+	for i, id := range ids {
+		endpoints[i] = Endpoint{Path: id.path, Method: id.method, Status: id.status, Count: counts[id]}
+	}
+	return endpoints
+}
+
+func topReferrers(counts map[endpointID]int, limit int) []Referrer {
+	ids := sortedIDs(counts, limit)
+	referrers := make([]Referrer, len(ids))
+	for i, id := range ids {
+		referrers[i] = Referrer{Referrer: id.path, Method: id.method, Status: id.status, Count: counts[id]}
+	}
+	return referrers
+}
@@ -0,0 +1,166 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
+)
+
+func testLog(ts time.Time, ip, method, path string, status int, referrer, userAgent string) nginx.NGINXLog {
+	return nginx.NGINXLog{
+		IPAddress: ip,
+		Timestamp: &ts,
+		Method:    method,
+		Path:      path,
+		Status:    &status,
+		Referrer:  referrer,
+		UserAgent: userAgent,
+	}
+}
+
+func TestCompute(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	chrome := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	logs := []nginx.NGINXLog{
+		testLog(base, "1.1.1.1", "GET", "/api/v1/users", 200, "https://example.com", chrome),
+		testLog(base.Add(time.Minute), "1.1.1.1", "GET", "/api/v1/users", 200, "-", chrome),
+		testLog(base.Add(10*time.Minute), "2.2.2.2", "POST", "/api/v2/items", 500, "", "curl/8.0.1"),
+		testLog(base.Add(2*time.Hour), "3.3.3.3", "GET", "/", 404, "", chrome),
+	}
+
+	stats := Compute(logs, Options{Interval: time.Hour})
+
+	if stats.Requests != 4 {
+		t.Errorf("Requests = %d, want 4", stats.Requests)
+	}
+	if stats.Users != 3 {
+		t.Errorf("Users = %d, want 3", stats.Users)
+	}
+	if stats.SuccessRate != 0.5 {
+		t.Errorf("SuccessRate = %v, want 0.5", stats.SuccessRate)
+	}
+	if stats.Interval != 3600 {
+		t.Errorf("Interval = %d, want 3600", stats.Interval)
+	}
+	if len(stats.Buckets) != 2 {
+		t.Fatalf("got %d buckets, want 2", len(stats.Buckets))
+	}
+	if b := stats.Buckets[0]; b.Requests != 3 || b.Users != 2 || b.Success != 2 || b.Total != 3 {
+		t.Errorf("unexpected first bucket: %+v", b)
+	}
+	if stats.UsageTime[12] != 3 || stats.UsageTime[14] != 1 {
+		t.Errorf("unexpected usage time: %v", stats.UsageTime)
+	}
+	if len(stats.Endpoints) != 3 || stats.Endpoints[0].Path != "/api/v1/users" || stats.Endpoints[0].Count != 2 {
+		t.Errorf("unexpected endpoints: %+v", stats.Endpoints)
+	}
+	if len(stats.Referrers) != 1 || stats.Referrers[0].Referrer != "https://example.com" {
+		t.Errorf("unexpected referrers: %+v", stats.Referrers)
+	}
+	if len(stats.Versions) != 2 || stats.Versions[0] != (Count{Name: "v1", Count: 2}) {
+		t.Errorf("unexpected versions: %+v", stats.Versions)
+	}
+	if len(stats.Clients) == 0 || stats.Clients[0] != (Count{Name: "Chrome", Count: 3}) {
+		t.Errorf("unexpected clients: %+v", stats.Clients)
+	}
+	if stats.Locations != nil {
+		t.Errorf("expected no locations without a lookup, got %+v", stats.Locations)
+	}
+}
+
+func TestComputeFilters(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	logs := []nginx.NGINXLog{
+		testLog(base, "1.1.1.1", "GET", "/a", 200, "", ""),
+		testLog(base.Add(time.Hour), "2.2.2.2", "GET", "/a", 404, "", ""),
+		testLog(base.Add(2*time.Hour), "3.3.3.3", "POST", "/b", 200, "", ""),
+	}
+	lookup := func(ip string) string {
+		if ip == "3.3.3.3" {
+			return "GB"
+		}
+		return "US"
+	}
+	networkLookup := func(ip string) (uint, string) {
+		if ip == "1.1.1.1" {
+			return 13335, "CLOUDFLARENET"
+		}
+		return 0, ""
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		want int
+	}{
+		{"no filter", Options{}, 3},
+		{"start bound", Options{Start: base.Add(30 * time.Minute)}, 2},
+		{"end bound", Options{End: base.Add(30 * time.Minute)}, 1},
+		{"path", Options{Filter: Filter{Path: "/a"}}, 2},
+		{"endpoint", Options{Filter: Filter{Path: "/a", Method: "GET", Status: 404}}, 1},
+		{"location", Options{Filter: Filter{Location: "GB"}, LocationLookup: lookup}, 1},
+		{"location without lookup", Options{Filter: Filter{Location: "GB"}}, 0},
+		{"network", Options{Filter: Filter{Network: 13335}, NetworkLookup: networkLookup}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Compute(logs, tt.opts).Requests; got != tt.want {
+				t.Errorf("Requests = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeEmpty(t *testing.T) {
+	stats := Compute(nil, Options{})
+	if stats.Requests != 0 || stats.SuccessRate != -1 || len(stats.UsageTime) != 24 {
+		t.Errorf("unexpected empty stats: %+v", stats)
+	}
+}
+
+func TestComputeLimit(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var logs []nginx.NGINXLog
+	for _, path := range []string{"/a", "/b", "/c", "/a"} {
+		logs = append(logs, testLog(base, "1.1.1.1", "GET", path, 200, "", ""))
+	}
+
+	stats := Compute(logs, Options{Limit: 2})
+	if len(stats.Endpoints) != 2 || stats.Endpoints[0].Path != "/a" {
+		t.Errorf("unexpected endpoints: %+v", stats.Endpoints)
+	}
+}
+
+func TestComputeNetworks(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	logs := []nginx.NGINXLog{
+		testLog(base, "1.1.1.1", "GET", "/", 200, "", "curl/8.0.1"),
+		testLog(base.Add(time.Minute), "1.1.1.1", "GET", "/", 200, "", "curl/8.0.1"),
+		testLog(base.Add(2*time.Minute), "1.0.0.1", "GET", "/", 200, "", "curl/8.0.1"),
+		testLog(base.Add(3*time.Minute), "8.8.8.8", "GET", "/", 200, "", "curl/8.0.1"),
+		testLog(base.Add(4*time.Minute), "10.0.0.1", "GET", "/", 200, "", "curl/8.0.1"),
+	}
+	lookup := func(ip string) (uint, string) {
+		switch ip {
+		case "1.1.1.1", "1.0.0.1":
+			return 13335, "CLOUDFLARENET"
+		case "8.8.8.8":
+			return 15169, "GOOGLE"
+		}
+		return 0, ""
+	}
+
+	stats := Compute(logs, Options{NetworkLookup: lookup})
+	want := []Network{
+		{ASN: 13335, Organization: "CLOUDFLARENET", Requests: 3, Users: 2},
+		{ASN: 15169, Organization: "GOOGLE", Requests: 1, Users: 1},
+	}
+	if len(stats.Networks) != len(want) || stats.Networks[0] != want[0] || stats.Networks[1] != want[1] {
+		t.Errorf("unexpected networks: %+v", stats.Networks)
+	}
+	if stats := Compute(logs, Options{}); stats.Networks != nil {
+		t.Errorf("expected no networks without a lookup, got %+v", stats.Networks)
+	}
+}
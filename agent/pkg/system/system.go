@@ -183,11 +183,11 @@ func getUptime() (int64, error) {
 func getCPUInfo() (CPUInfo, error) {
 	cpuInfo, err := getCPUInfoCached()
 	if err != nil {
-		logger.Log.Printf("gopsutil cpu.Info() failed: %v, trying OS-specific fallback", err)
+		logger.Debugf("gopsutil cpu.Info() failed: %v, trying OS-specific fallback", err)
 		return getCPUInfoFallback()
 	}
 	if len(cpuInfo) == 0 {
-		logger.Log.Printf("gopsutil returned empty CPU info, trying OS-specific fallback")
+		logger.Debug("gopsutil returned empty CPU info, trying OS-specific fallback")
 		return getCPUInfoFallback()
 	}
 
@@ -379,7 +379,7 @@ func getDiskInfo() ([]DiskInfo, error) {
 	for _, partition := range partitions {
 		usage, err := disk.Usage(partition.Mountpoint)
 		if err != nil {
-			logger.Log.Printf("Error getting disk usage for %s: %v", partition.Mountpoint, err)
+			logger.Warnf("Error getting disk usage for %s: %v", partition.Mountpoint, err)
 			continue // Skip this partition if there's an error
 		}
 
@@ -0,0 +1,139 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// issue creates a certificate signed by parent, or self-signed if parent is
+// nil, and writes it and its key as PEM files in dir.
+func issue(t *testing.T, dir string, name string, parent *testCert, isCA bool) (testCert, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if isCA {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return testCert{cert: cert, key: key}, certFile, keyFile
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caFile, _ := issue(t, dir, "ca", nil, true)
+	_, serverCert, serverKey := issue(t, dir, "server", &ca, false)
+	_, clientCert, clientKey := issue(t, dir, "client", &ca, false)
+	_, otherCAFile, _ := issue(t, dir, "other-ca", nil, true)
+
+	serverConfig, err := Server(serverCert, serverKey, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = serverConfig
+	server.StartTLS()
+	defer server.Close()
+
+	get := func(clientConfig *tls.Config) error {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	tests := []struct {
+		name     string
+		caFile   string
+		certFile string
+		keyFile  string
+		wantErr  bool
+	}{
+		{"pinned CA with client certificate", caFile, clientCert, clientKey, false},
+		{"missing client certificate", caFile, "", "", true},
+		{"server signed by another CA", otherCAFile, clientCert, clientKey, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientConfig, err := Client(tt.caFile, tt.certFile, tt.keyFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := get(clientConfig); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClientConfig(t *testing.T) {
+	if cfg, err := Client("", "", ""); cfg != nil || err != nil {
+		t.Errorf("expected no config when nothing is set, got %v, %v", cfg, err)
+	}
+	if _, err := Client("", "client.crt", ""); err == nil {
+		t.Error("expected an error for a certificate without a key")
+	}
+	if _, err := Client(filepath.Join(t.TempDir(), "missing.pem"), "", ""); err == nil {
+		t.Error("expected an error for a missing CA bundle")
+	}
+}
@@ -1,9 +1,9 @@
 package user
 
-import "github.com/tom-draper/nginx-analytics/tui/internal/logs/nginx"
+import "github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
 
 const deliminer = "::"
 
 func UserID(log nginx.NGINXLog) string {
 	return log.IPAddress + deliminer + log.UserAgent
-}
\ No newline at end of file
+}
@@ -32,7 +32,7 @@ func NewVersionDetector() *VersionDetector {
 		{"v2.0", "/v2.0/", false, nil, 0},
 		{"v2.1", "/v2.1/", false, nil, 0},
 		{"v3.0", "/v3.0/", false, nil, 0},
-		
+
 		// API prefix patterns
 		{"v1", "/api/v1/", false, nil, 0},
 		{"v2", "/api/v2/", false, nil, 0},
@@ -44,7 +44,7 @@ func NewVersionDetector() *VersionDetector {
 		{"v2.0", "/api/v2.0/", false, nil, 0},
 		{"v2.1", "/api/v2.1/", false, nil, 0},
 		{"v3.0", "/api/v3.0/", false, nil, 0},
-		
+
 		// Complex patterns that need regex
 		{"dynamic", "", true, regexp.MustCompile(`/api/v(\d+)(?:\.(\d+))?/`), 0},
 		{"dynamic", "", true, regexp.MustCompile(`/v(\d+)(?:\.(\d+))?/`), 0},
@@ -109,13 +109,13 @@ func (d *FastVersionDetector) GetVersion(path string) string {
 	}
 
 	version := d.extractVersionFast(path)
-	
+
 	if version != "" {
 		d.mu.Lock()
 		d.versionStats[version]++
 		d.mu.Unlock()
 	}
-	
+
 	return version
 }
 
@@ -128,11 +128,11 @@ func (d *FastVersionDetector) extractVersionFast(path string) string {
 	if idx := strings.Index(path, "/version/"); idx != -1 {
 		return d.extractVersionFromIndex(path, idx+9) // Skip "/version/"
 	}
-	
+
 	if idx := strings.Index(path, "/v"); idx != -1 {
 		return d.extractVersionFromIndex(path, idx+2) // Skip "/v"
 	}
-	
+
 	return ""
 }
 
@@ -140,31 +140,31 @@ func (d *FastVersionDetector) extractVersionFromIndex(path string, startIdx int)
 	if startIdx >= len(path) {
 		return ""
 	}
-	
+
 	// Find the end of version string (next slash or end of string)
 	endIdx := startIdx
 	for endIdx < len(path) && path[endIdx] != '/' {
 		endIdx++
 	}
-	
+
 	if endIdx == startIdx {
 		return ""
 	}
-	
+
 	versionStr := path[startIdx:endIdx]
-	
+
 	// Validate it looks like a version (starts with digit)
 	if len(versionStr) > 0 && versionStr[0] >= '0' && versionStr[0] <= '9' {
 		return "v" + versionStr
 	}
-	
+
 	return ""
 }
 
 func (d *FastVersionDetector) GetStats() map[string]uint64 {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
-	
+
 	stats := make(map[string]uint64)
 	for k, v := range d.versionStats {
 		stats[k] = v
@@ -278,7 +278,7 @@ func (d *InlineVersionDetector) extractVersionFromPos(path string, pos int) stri
 func (d *InlineVersionDetector) GetStats() map[string]uint64 {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
-	
+
 	stats := map[string]uint64{
 		"v1": d.v1Matches,
 		"v2": d.v2Matches,
@@ -286,11 +286,11 @@ func (d *InlineVersionDetector) GetStats() map[string]uint64 {
 		"v4": d.v4Matches,
 		"v5": d.v5Matches,
 	}
-	
+
 	for k, v := range d.otherStats {
 		stats[k] = v
 	}
-	
+
 	return stats
 }
 
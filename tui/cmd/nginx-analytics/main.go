@@ -1,23 +1,54 @@
 package main
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 
 	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logs"
 	"github.com/tom-draper/nginx-analytics/agent/pkg/system"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/tlsconfig"
 	"github.com/tom-draper/nginx-analytics/tui/internal/config"
 	"github.com/tom-draper/nginx-analytics/tui/internal/env"
+	"github.com/tom-draper/nginx-analytics/tui/internal/logs/location"
 	"github.com/tom-draper/nginx-analytics/tui/internal/model"
 )
 
 func main() {
-	logger.Log.Println("Starting Nginx Analytics CLI...")
 	cfg := config.LoadConfig()
 	e := env.LoadEnv()
 
+	// Log to a file only, as the dashboard occupies the terminal
+	logFile, err := setupLogging(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging configuration: %v\n", err)
+		os.Exit(1)
+	}
+	defer logFile.Close()
+	logger.Info("Starting Nginx Analytics CLI...")
+
+	// Select which files are read from local log directories
+	if err := cfg.Discovery.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid log file patterns: %v\n", err)
+		os.Exit(1)
+	}
+	logs.SetDiscovery(cfg.Discovery)
+
+	// Pin the agent's CA and present a client certificate if configured
+	tlsConfig, err := tlsconfig.Client(cfg.ServerCA, cfg.ClientCert, cfg.ClientKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid TLS configuration: %v\n", err)
+		os.Exit(1)
+	}
+	if tlsConfig != nil {
+		model.SetTLSConfig(tlsConfig)
+		location.SetTLSConfig(tlsConfig)
+	}
+
 	// In local mode, start the background CPU sampler so MeasureSystem()
 	// doesn't block for a second on every poll.
 	if e.ServerURL == "" {
@@ -32,7 +63,27 @@ func main() {
 
 	// Run the program
 	if _, err := p.Run(); err != nil {
-		logger.Log.Fatalf("Error running program: %v", err)
+		logger.Errorf("Error running program: %v", err)
+		fmt.Fprintf(os.Stderr, "Error running program: %v\n", err)
+		logFile.Close()
 		os.Exit(1)
 	}
 }
+
+func setupLogging(cfg config.Config) (io.Closer, error) {
+	level, err := logger.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.LogOutput == logger.Stderr {
+		return nil, fmt.Errorf("logs must be written to a file while the dashboard is running")
+	}
+	return logger.Setup(logger.Config{
+		Level:      level,
+		JSON:       cfg.LogJSON,
+		Output:     cfg.LogOutput,
+		MaxSize:    10 * 1024 * 1024,
+		MaxBackups: 1,
+		Quiet:      cfg.LogOutput == "",
+	})
+}
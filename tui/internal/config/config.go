@@ -1,6 +1,9 @@
 package config
 
 import (
+	"strings"
+
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logs"
 	"github.com/tom-draper/nginx-analytics/tui/internal/env"
 )
 
@@ -11,6 +14,21 @@ type Config struct {
 	SystemMonitoring bool
 	AuthToken        string
 	LogFormat        string
+	StatsMode        bool
+	// Discovery selects the access and error log files read from local log
+	// directories
+	Discovery logs.Discovery
+	// ServerCA pins the CA bundle the agent's certificate must be signed by
+	ServerCA string
+	// ClientCert and ClientKey are presented to agents that require client
+	// certificates
+	ClientCert string
+	ClientKey  string
+	// LogOutput is a file to write log messages to. Nothing is logged if
+	// empty, as the dashboard occupies the terminal.
+	LogOutput string
+	LogLevel  string
+	LogJSON   bool
 }
 
 var DefaultConfig = Config{
@@ -20,6 +38,9 @@ var DefaultConfig = Config{
 	SystemMonitoring: false,
 	AuthToken:        "",
 	LogFormat:        "$remote_addr - $remote_user [$time_local] \"$request\" $status $body_bytes_sent \"$http_referer\" \"$http_user_agent\"",
+	StatsMode:        false,
+	Discovery:        logs.DefaultDiscovery,
+	LogLevel:         "info",
 }
 
 func LoadConfig() Config {
@@ -39,7 +60,30 @@ func LoadConfig() Config {
 		SystemMonitoring: resolveBool(env.SystemMonitoring, DefaultConfig.SystemMonitoring),
 		AuthToken:        resolveValue(env.AuthToken, DefaultConfig.AuthToken),
 		LogFormat:        resolveValue(env.LogFormat, DefaultConfig.LogFormat),
+		StatsMode:        resolveBool(env.StatsMode, DefaultConfig.StatsMode),
+		Discovery: logs.Discovery{
+			Access:    DefaultConfig.Discovery.Access.WithOverrides(splitPatterns(env.AccessInclude), splitPatterns(env.AccessExclude)),
+			Error:     DefaultConfig.Discovery.Error.WithOverrides(splitPatterns(env.ErrorInclude), splitPatterns(env.ErrorExclude)),
+			Recursive: resolveBool(env.Recursive, DefaultConfig.Discovery.Recursive),
+		},
+		ServerCA:   env.ServerCA,
+		ClientCert: env.ClientCert,
+		ClientKey:  env.ClientKey,
+		LogOutput:  env.LogOutput,
+		LogLevel:   resolveValue(env.LogLevel, DefaultConfig.LogLevel),
+		LogJSON:    resolveBool(env.LogJSON, DefaultConfig.LogJSON),
+	}
+}
+
+// splitPatterns splits a comma-separated list of glob patterns
+func splitPatterns(value string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
 	}
+	return patterns
 }
 
 func resolveValue(envVal, defaultVal string) string {
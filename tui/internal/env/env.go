@@ -14,12 +14,24 @@ type Env struct {
 	SystemMonitoring bool
 	AuthToken        string
 	LogFormat        string
+	StatsMode        bool
+	AccessInclude    string
+	AccessExclude    string
+	ErrorInclude     string
+	ErrorExclude     string
+	Recursive        bool
+	ServerCA         string
+	ClientCert       string
+	ClientKey        string
+	LogLevel         string
+	LogOutput        string
+	LogJSON          bool
 }
 
 func LoadEnv() Env {
 	// Load .env file if present
 	if err := godotenv.Load(); err != nil {
-		logger.Log.Println("No .env file found, using system environment variables")
+		logger.Debug("No .env file found, using system environment variables")
 	}
 
 	return Env{
@@ -29,5 +41,17 @@ func LoadEnv() Env {
 		SystemMonitoring: os.Getenv("NGINX_ANALYTICS_SYSTEM_MONITORING") == "true",
 		AuthToken:        os.Getenv("NGINX_ANALYTICS_AUTH_TOKEN"),
 		LogFormat:        os.Getenv("NGINX_ANALYTICS_LOG_FORMAT"),
+		StatsMode:        os.Getenv("NGINX_ANALYTICS_STATS_MODE") == "true",
+		AccessInclude:    os.Getenv("NGINX_ANALYTICS_ACCESS_INCLUDE"),
+		AccessExclude:    os.Getenv("NGINX_ANALYTICS_ACCESS_EXCLUDE"),
+		ErrorInclude:     os.Getenv("NGINX_ANALYTICS_ERROR_INCLUDE"),
+		ErrorExclude:     os.Getenv("NGINX_ANALYTICS_ERROR_EXCLUDE"),
+		Recursive:        os.Getenv("NGINX_ANALYTICS_RECURSIVE") == "true",
+		ServerCA:         os.Getenv("NGINX_ANALYTICS_SERVER_CA"),
+		ClientCert:       os.Getenv("NGINX_ANALYTICS_CLIENT_CERT"),
+		ClientKey:        os.Getenv("NGINX_ANALYTICS_CLIENT_KEY"),
+		LogLevel:         os.Getenv("NGINX_ANALYTICS_LOG_LEVEL"),
+		LogOutput:        os.Getenv("NGINX_ANALYTICS_LOG_OUTPUT"),
+		LogJSON:          os.Getenv("NGINX_ANALYTICS_LOG_JSON") == "true",
 	}
 }
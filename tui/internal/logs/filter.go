@@ -87,6 +87,27 @@ func FilterByLocation(logs []nginx.NGINXLog, filter *LocationFilter, locationLoo
 	return filteredLogs
 }
 
+// NetworkFilter represents a filter for the autonomous system of the client
+type NetworkFilter struct {
+	ASN uint
+}
+
+// FilterByNetwork filters logs to only include those matching the network filter
+func FilterByNetwork(logs []nginx.NGINXLog, filter *NetworkFilter, networkLookup func(string) uint) []nginx.NGINXLog {
+	if filter == nil {
+		return logs
+	}
+
+	filteredLogs := make([]nginx.NGINXLog, 0)
+	for _, log := range logs {
+		if log.IPAddress != "" && networkLookup(log.IPAddress) == filter.ASN {
+			filteredLogs = append(filteredLogs, log)
+		}
+	}
+
+	return filteredLogs
+}
+
 // DeviceFilter represents a filter for device/client data
 type DeviceFilter struct {
 	Device string
@@ -273,6 +273,64 @@ func TestFilterByLocation(t *testing.T) {
 	}
 }
 
+func TestFilterByNetwork(t *testing.T) {
+	logs := []nginx.NGINXLog{
+		{IPAddress: "1.1.1.1"}, // AS13335
+		{IPAddress: "2.2.2.2"}, // AS3320
+		{IPAddress: "1.0.0.1"}, // AS13335
+		{IPAddress: ""},        // Empty IP
+	}
+
+	// Mock network lookup function
+	networkLookup := func(ip string) uint {
+		switch ip {
+		case "1.1.1.1", "1.0.0.1":
+			return 13335
+		case "2.2.2.2":
+			return 3320
+		default:
+			return 0
+		}
+	}
+
+	tests := []struct {
+		name     string
+		filter   *NetworkFilter
+		expected int
+	}{
+		{
+			name:     "filter by AS13335",
+			filter:   &NetworkFilter{ASN: 13335},
+			expected: 2,
+		},
+		{
+			name:     "filter by AS3320",
+			filter:   &NetworkFilter{ASN: 3320},
+			expected: 1,
+		},
+		{
+			name:     "filter with no matches",
+			filter:   &NetworkFilter{ASN: 15169},
+			expected: 0,
+		},
+		{
+			name:     "nil filter returns all logs",
+			filter:   nil,
+			expected: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := FilterByNetwork(logs, tt.filter, networkLookup)
+
+			if len(result) != tt.expected {
+				t.Errorf("FilterByNetwork() returned %d logs, expected %d", len(result), tt.expected)
+			}
+		})
+	}
+}
+
 func TestFilterByDevice(t *testing.T) {
 	logs := []nginx.NGINXLog{
 		{UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 14_0 like Mac OS X)"},
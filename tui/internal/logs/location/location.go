@@ -2,6 +2,7 @@ package location
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -10,6 +11,8 @@ import (
 
 	"github.com/tom-draper/nginx-analytics/agent/pkg/location"
 	loc "github.com/tom-draper/nginx-analytics/agent/pkg/location"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/user"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/nginx"
 )
 
@@ -20,6 +23,13 @@ var (
 	}
 )
 
+// SetTLSConfig sets the TLS config used for location requests to the agent.
+func SetTLSConfig(cfg *tls.Config) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+	locationClient.Transport = transport
+}
+
 const maxCachedLocations = 10_000
 
 type Location struct {
@@ -29,11 +39,13 @@ type Location struct {
 
 type Locations struct {
 	Locations []Location
-	cache     map[string]loc.Location
+	// Networks are the autonomous systems requests came from, by requests
+	Networks []stats.Network
+	cache    map[string]loc.Location
 }
 
 func (l *Locations) UpdateLocations(logs []nginx.NGINXLog, serverURL string, authToken string) {
-	if serverURL == "" && !loc.LocationsEnabled() {
+	if serverURL == "" && !loc.LocationsEnabled() && !loc.NetworksEnabled() {
 		return
 	}
 
@@ -41,11 +53,44 @@ func (l *Locations) UpdateLocations(logs []nginx.NGINXLog, serverURL string, aut
 	l.updateLocations(logs)
 }
 
+// SetCounts replaces the locations with counts precomputed elsewhere, such as
+// by the agent's stats endpoint
+func (l *Locations) SetCounts(counts map[string]int) {
+	locations := make([]Location, 0, len(counts))
+	for loc, count := range counts {
+		locations = append(locations, Location{Location: loc, Count: count})
+	}
+
+	sort.Slice(locations, func(i, j int) bool {
+		return locations[i].Count > locations[j].Count
+	})
+
+	l.Locations = locations
+}
+
+// SetNetworks replaces the networks with those precomputed elsewhere, such
+// as by the agent's stats endpoint
+func (l *Locations) SetNetworks(networks []stats.Network) {
+	l.Networks = networks
+}
+
 func (l *Locations) updateLocations(logs []nginx.NGINXLog) {
 	locationCounter := make(map[string]int)
+	networks := make(map[uint]*stats.Network)
+	networkUsers := make(map[uint]map[string]struct{})
 
 	for _, log := range logs {
 		location := l.cache[log.IPAddress]
+		if location.ASN != 0 {
+			network, ok := networks[location.ASN]
+			if !ok {
+				network = &stats.Network{ASN: location.ASN, Organization: location.Organization}
+				networks[location.ASN] = network
+				networkUsers[location.ASN] = make(map[string]struct{})
+			}
+			network.Requests++
+			networkUsers[location.ASN][user.UserID(log)] = struct{}{}
+		}
 		if location.Country == "" {
 			continue
 		}
@@ -53,16 +98,20 @@ func (l *Locations) updateLocations(logs []nginx.NGINXLog) {
 		locationCounter[location.Country]++
 	}
 
-	locations := make([]Location, 0, len(locationCounter))
-	for loc, count := range locationCounter {
-		locations = append(locations, Location{Location: loc, Count: count})
-	}
+	l.SetCounts(locationCounter)
 
-	sort.Slice(locations, func(i, j int) bool {
-		return locations[i].Count > locations[j].Count
+	sorted := make([]stats.Network, 0, len(networks))
+	for asn, network := range networks {
+		network.Users = len(networkUsers[asn])
+		sorted = append(sorted, *network)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Requests != sorted[j].Requests {
+			return sorted[i].Requests > sorted[j].Requests
+		}
+		return sorted[i].ASN < sorted[j].ASN
 	})
-
-	l.Locations = locations
+	l.SetNetworks(sorted)
 }
 
 func (l *Locations) maintainCache(logs []nginx.NGINXLog, serverURL string, authToken string) {
@@ -171,6 +220,15 @@ func filterCached(ipAddresses []string, cache map[string]loc.Location) []string
 	return filtered
 }
 
+// GetNetworkForIP returns the autonomous system number for a given IP
+// address, or zero if it isn't known
+func (l *Locations) GetNetworkForIP(ip string) uint {
+	if l.cache == nil {
+		return 0
+	}
+	return l.cache[ip].ASN
+}
+
 // GetLocationForIP returns the country for a given IP address
 func (l *Locations) GetLocationForIP(ip string) string {
 	if l.cache == nil {
@@ -1,16 +1,7 @@
 package nginx
 
-import "time"
+import "github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
 
-// NginxLog represents a parsed nginx access log entry
-type NGINXLog struct {
-	IPAddress    string     `json:"ipAddress"`
-	Timestamp    *time.Time `json:"timestamp"`
-	Method       string     `json:"method"`
-	Path         string     `json:"path"`
-	HTTPVersion  string     `json:"httpVersion"`
-	Status       *int       `json:"status"`
-	ResponseSize *int       `json:"responseSize"`
-	Referrer     string     `json:"referrer"`
-	UserAgent    string     `json:"userAgent"`
-}
+// NGINXLog represents a parsed nginx access log entry. It is shared with the
+// agent so records parsed server-side decode directly into the same type.
+type NGINXLog = nginx.NGINXLog
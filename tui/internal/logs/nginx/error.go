@@ -1,18 +1,7 @@
 package nginx
 
-import "time"
+import "github.com/tom-draper/nginx-analytics/agent/pkg/nginx"
 
-// NginxError represents a parsed nginx error log entry
-type NGINXError struct {
-	Timestamp     time.Time `json:"timestamp"`
-	Level         string    `json:"level"`
-	PID           int       `json:"pid"`
-	TID           string    `json:"tid"`
-	CID           string    `json:"cid"`
-	Message       string    `json:"message"`
-	ClientAddress *string   `json:"clientAddress,omitempty"`
-	ServerAddress *string   `json:"serverAddress,omitempty"`
-	Request       *string   `json:"request,omitempty"`
-	Referrer      *string   `json:"referrer,omitempty"`
-	Host          *string   `json:"host,omitempty"`
-}
+// NGINXError represents a parsed nginx error log entry. It is shared with the
+// agent so entries parsed server-side decode directly into the same type.
+type NGINXError = nginx.NGINXError
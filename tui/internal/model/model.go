@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"strings"
 	"time"
 
@@ -8,9 +9,11 @@ import (
 	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
 
 	"github.com/tom-draper/nginx-analytics/tui/internal/config"
 	parse "github.com/tom-draper/nginx-analytics/agent/pkg/logs"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
 	"github.com/tom-draper/nginx-analytics/agent/pkg/system"
 	l "github.com/tom-draper/nginx-analytics/tui/internal/logs"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/nginx"
@@ -48,15 +51,30 @@ type DataManager struct {
 	currentLogs    []nginx.NGINXLog
 	calculatable   []c.CalculatedCard
 	systemCards    []c.CalculatedSystemCard
-	positions      []parse.Position // Track the last log position for incremental loading
+	positions      map[string][]parse.Position // Track the last log positions of each source for incremental loading
+	backlog        map[string]bool             // Sources whose existing logs are still being loaded a page at a time
+	sources        []string                    // Named sources configured on the agent
+	source         string                      // Selected source, or empty to merge every source
+	epoch          int                         // Incremented on switching source so that stale updates are dropped
 	endpointFilter *l.EndpointFilter
 	referrerFilter *l.ReferrerFilter
 	locationFilter *l.LocationFilter
 	locationLookup func(string) string
+	networkFilter  *l.NetworkFilter
+	networkLookup  func(string) uint
 	deviceFilter   *l.DeviceFilter
 	deviceLookup   func(string) string
+	deviceMode     c.DeviceMode
 	versionFilter  *l.VersionFilter
 	versionLookup  func(string) string
+	logStream      <-chan UpdateLogsMsg
+	cancelStream   context.CancelFunc
+	statsMode      bool // Render cards from agent-computed stats rather than raw logs
+	stats          stats.Stats
+	statsCards     []c.StatsCard
+	statsRequest   int   // Incremented on each stats fetch so that stale results are dropped
+	statsErr       error // Error of the latest stats fetch, shown until one succeeds
+	periodRequest  int   // Fetch of all-time stats that picks the initial period
 }
 
 // UIManager handles UI rendering and layout
@@ -82,6 +100,20 @@ type UpdateSystemDataMsg struct {
 type UpdateLogsMsg struct {
 	NewLogs      []nginx.NGINXLog
 	NewPositions []parse.Position
+	Source       string
+	Epoch        int
+	More         bool // More logs are waiting to be loaded from NewPositions
+	Backlog      bool // Loaded from the existing logs, before following new ones
+}
+type RefreshStatsMsg struct{}
+type StatsMsg struct {
+	Stats   stats.Stats
+	Period  period.Period
+	Request int
+}
+type StatsErrMsg struct {
+	Err     error
+	Request int
 }
 
 // New creates a new Model instance
@@ -94,7 +126,7 @@ func NewModel(cfg config.Config, serverURL string, authToken string) Model {
 	dataManager := newDataManager(cfg, serverURL, authToken)
 
 	// Initialize navigation manager
-	navManager := newNavigationManager(dataManager.logs)
+	navManager := newNavigationManager(dataManager.getLogStart())
 
 	// Get current logs for selected period
 	currentLogs := dataManager.getCurrentLogs(navManager.getCurrentPeriod())
@@ -117,28 +149,39 @@ func NewModel(cfg config.Config, serverURL string, authToken string) Model {
 func newDataManager(cfg config.Config, serverURL string, authToken string) *DataManager {
 	logService := NewLogService(serverURL, authToken, cfg.LogFormat)
 
-	// Load initial logs
-	logs, positions, err := logService.LoadLogs(cfg.AccessPath, []parse.Position{}, false, true)
+	logSizes, err := logService.LoadLogSizes(cfg.AccessPath)
 	if err != nil {
-		logs = []nginx.NGINXLog{}
+		logSizes = parse.LogSizes{}
 	}
 
-	logSizes, err := logService.LoadLogSizes(cfg.AccessPath)
+	// Older agents don't list their sources, and serve a single one
+	sources, err := logService.LoadSources()
 	if err != nil {
-		logSizes = parse.LogSizes{}
+		sources = nil
 	}
 
-	return &DataManager{
+	dm := &DataManager{
 		serverURL: serverURL,
 		authToken: authToken,
-		logs:      logs,
+		logs:      []nginx.NGINXLog{},
 		logSizes:  logSizes,
-		positions: positions,
+		sources:   sources,
 	}
+
+	if cfg.StatsMode {
+		// Stats are fetched in the background once the model starts, starting
+		// with all-time totals to pick the initial period
+		dm.statsMode = true
+		return dm
+	}
+
+	// Load initial logs
+	dm.loadLogs(cfg.AccessPath, cfg.LogFormat)
+	return dm
 }
 
 // newNavigationManager creates a new NavigationManager
-func newNavigationManager(logs []nginx.NGINXLog) *NavigationManager {
+func newNavigationManager(logStart time.Time) *NavigationManager {
 	periods := []period.Period{
 		period.Period1Hour,
 		period.Period24Hours,
@@ -148,7 +191,7 @@ func newNavigationManager(logs []nginx.NGINXLog) *NavigationManager {
 		period.PeriodAllTime,
 	}
 
-	selectedPeriod := calculateInitialPeriod(periods, logs)
+	selectedPeriod := calculateInitialPeriod(periods, logStart)
 
 	return &NavigationManager{
 		periods:           periods,
@@ -174,6 +217,90 @@ func newUIManager(currentLogs []nginx.NGINXLog, period period.Period,
 	}
 }
 
+// loadLogs replaces the stored logs with all logs of the selected sources
+func (dm *DataManager) loadLogs(accessPath string, logFormat string) {
+	logService := NewLogService(dm.serverURL, dm.authToken, logFormat)
+	logs, positions, pending, err := logService.LoadSourceLogs(accessPath, dm.activeSources(), nil, true)
+	if err != nil {
+		logs = []nginx.NGINXLog{}
+	}
+	dm.logs = logs
+	dm.positions = positions
+	dm.backlog = make(map[string]bool, len(pending))
+	for _, source := range pending {
+		dm.backlog[source] = true
+	}
+}
+
+// activeSources returns the sources that logs are read from. An empty name
+// reads the agent's default source, or the local files.
+func (dm *DataManager) activeSources() []string {
+	if dm.source != "" {
+		return []string{dm.source}
+	}
+	if len(dm.sources) > 0 {
+		return dm.sources
+	}
+	return []string{""}
+}
+
+// statsSource returns the source that stats are requested for
+func (dm *DataManager) statsSource() string {
+	if dm.source == "" && len(dm.sources) > 1 {
+		return allSourcesStats
+	}
+	return dm.source
+}
+
+// canSwitchSource reports whether there is more than one source to pick from
+func (dm *DataManager) canSwitchSource() bool {
+	return len(dm.sources) > 1
+}
+
+// nextSource cycles through the merged view followed by each source in turn
+func (dm *DataManager) nextSource() {
+	next := ""
+	if dm.source == "" {
+		next = dm.sources[0]
+	} else {
+		for i, source := range dm.sources {
+			if source == dm.source && i+1 < len(dm.sources) {
+				next = dm.sources[i+1]
+			}
+		}
+	}
+	dm.source = next
+	dm.epoch++
+}
+
+// sourceLabel names the selected source for display
+func (dm *DataManager) sourceLabel() string {
+	if dm.source == "" {
+		return "all sources"
+	}
+	return dm.source
+}
+
+// startLogStream follows new logs of the selected sources, stopping any
+// stream of previously selected sources
+func (dm *DataManager) startLogStream(accessPath string, logFormat string) {
+	dm.stopLogStream()
+	ctx, cancel := context.WithCancel(context.Background())
+	dm.cancelStream = cancel
+
+	logService := NewLogService(dm.serverURL, dm.authToken, logFormat)
+	dm.logStream = logService.StreamSources(ctx, accessPath, dm.positions)
+}
+
+// stopLogStream stops following new logs
+func (dm *DataManager) stopLogStream() {
+	if dm.cancelStream != nil {
+		dm.cancelStream()
+		dm.cancelStream = nil
+	}
+	dm.logStream = nil
+}
+
 func (dm *DataManager) getCurrentLogs(period period.Period) []nginx.NGINXLog {
 	logs := l.FilterLogs(dm.logs, period)
 	if dm.endpointFilter != nil {
@@ -185,6 +312,9 @@ func (dm *DataManager) getCurrentLogs(period period.Period) []nginx.NGINXLog {
 	if dm.locationFilter != nil && dm.locationLookup != nil {
 		logs = l.FilterByLocation(logs, dm.locationFilter, dm.locationLookup)
 	}
+	if dm.networkFilter != nil && dm.networkLookup != nil {
+		logs = l.FilterByNetwork(logs, dm.networkFilter, dm.networkLookup)
+	}
 	if dm.deviceFilter != nil && dm.deviceLookup != nil {
 		logs = l.FilterByDevice(logs, dm.deviceFilter, dm.deviceLookup)
 	}
@@ -194,6 +324,48 @@ func (dm *DataManager) getCurrentLogs(period period.Period) []nginx.NGINXLog {
 	return logs
 }
 
+// getStatsOptions builds the stats query for the period and active filters
+func (dm *DataManager) getStatsOptions(period period.Period) stats.Options {
+	opts := stats.Options{Start: period.Start()}
+	if dm.endpointFilter != nil {
+		opts.Filter.Path = dm.endpointFilter.Path
+		opts.Filter.Method = dm.endpointFilter.Method
+		opts.Filter.Status = dm.endpointFilter.Status
+	}
+	if dm.referrerFilter != nil {
+		opts.Filter.Referrer = dm.referrerFilter.Referrer
+	}
+	if dm.locationFilter != nil {
+		opts.Filter.Location = dm.locationFilter.Location
+	}
+	if dm.networkFilter != nil {
+		opts.Filter.Network = dm.networkFilter.ASN
+	}
+	if dm.deviceFilter != nil {
+		switch dm.deviceMode {
+		case c.ModeOS:
+			opts.Filter.OS = dm.deviceFilter.Device
+		case c.ModeDevice:
+			opts.Filter.Device = dm.deviceFilter.Device
+		default:
+			opts.Filter.Client = dm.deviceFilter.Device
+		}
+	}
+	if dm.versionFilter != nil {
+		opts.Filter.Version = dm.versionFilter.Version
+	}
+	return opts
+}
+
+// getLogStart returns the timestamp of the earliest known request
+func (dm *DataManager) getLogStart() time.Time {
+	if dm.statsMode {
+		return dm.stats.Start
+	}
+	logStart, _ := period.LogRange(dm.logs)
+	return logStart
+}
+
 func (dm *DataManager) setEndpointFilter(filter *l.EndpointFilter) {
 	dm.endpointFilter = filter
 }
@@ -207,9 +379,15 @@ func (dm *DataManager) setLocationFilter(filter *l.LocationFilter, lookup func(s
 	dm.locationLookup = lookup
 }
 
-func (dm *DataManager) setDeviceFilter(filter *l.DeviceFilter, lookup func(string) string) {
+func (dm *DataManager) setNetworkFilter(filter *l.NetworkFilter, lookup func(string) uint) {
+	dm.networkFilter = filter
+	dm.networkLookup = lookup
+}
+
+func (dm *DataManager) setDeviceFilter(filter *l.DeviceFilter, lookup func(string) string, mode c.DeviceMode) {
 	dm.deviceFilter = filter
 	dm.deviceLookup = lookup
+	dm.deviceMode = mode
 }
 
 func (dm *DataManager) setVersionFilter(filter *l.VersionFilter, lookup func(string) string) {
@@ -219,16 +397,19 @@ func (dm *DataManager) setVersionFilter(filter *l.VersionFilter, lookup func(str
 
 func (dm *DataManager) hasAnyFilter() bool {
 	return dm.endpointFilter != nil || dm.referrerFilter != nil ||
-		dm.locationFilter != nil || dm.deviceFilter != nil || dm.versionFilter != nil
+		dm.locationFilter != nil || dm.networkFilter != nil || dm.deviceFilter != nil ||
+		dm.versionFilter != nil
 }
 
 func (dm *DataManager) clearAllFilters() {
 	dm.endpointFilter = nil
 	dm.referrerFilter = nil
 	dm.locationFilter = nil
+	dm.networkFilter = nil
 	dm.deviceFilter = nil
 	dm.versionFilter = nil
 	dm.locationLookup = nil
+	dm.networkLookup = nil
 	dm.deviceLookup = nil
 	dm.versionLookup = nil
 }
@@ -254,6 +435,10 @@ func (dm *DataManager) collectCalculatableCards(cards []c.Card) {
 		if sc, ok := card.Renderer.(c.CalculatedSystemCard); ok {
 			dm.systemCards = append(dm.systemCards, sc)
 		}
+		// Check if the card's Renderer implements StatsCard interface
+		if sc, ok := card.Renderer.(c.StatsCard); ok {
+			dm.statsCards = append(dm.statsCards, sc)
+		}
 	}
 }
 
@@ -263,6 +448,34 @@ func (dm *DataManager) updateCardData(currentLogs []nginx.NGINXLog, period perio
 	}
 }
 
+// fetchStatsCmd fetches stats for the period and active filters in the
+// background, replacing any fetch still in flight
+func (dm *DataManager) fetchStatsCmd(accessPath string, logFormat string, period period.Period) tea.Cmd {
+	dm.statsRequest++
+	request := dm.statsRequest
+	logService := NewLogService(dm.serverURL, dm.authToken, logFormat).WithSource(dm.statsSource())
+	opts := dm.getStatsOptions(period)
+
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+		defer cancel()
+		s, err := logService.LoadStats(ctx, accessPath, opts)
+		if err != nil {
+			return StatsErrMsg{Err: err, Request: request}
+		}
+		return StatsMsg{Stats: s, Period: period, Request: request}
+	}
+}
+
+// updateStatsData updates the cards with fetched stats
+func (dm *DataManager) updateStatsData(s stats.Stats, period period.Period) {
+	dm.stats = s
+	dm.statsErr = nil
+	for _, card := range dm.statsCards {
+		card.UpdateStats(s, period)
+	}
+}
+
 func (dm *DataManager) updateSystemCardData(sysInfo system.SystemInfo) {
 	for _, card := range dm.systemCards {
 		card.UpdateCalculated(sysInfo)
@@ -284,10 +497,6 @@ func (dm *DataManager) appendNewLogs(newLogs []nginx.NGINXLog) {
 	}
 }
 
-func (dm *DataManager) getPositions() []parse.Position {
-	return dm.positions
-}
-
 func (nm *NavigationManager) getCurrentPeriod() period.Period {
 	return nm.periods[nm.selectedPeriod]
 }
@@ -434,11 +643,9 @@ func (um *UIManager) navigateRight() {
 		um.grid.MoveRight()
 	case "sidebar-footer":
 		currentIndex := um.grid.GetActiveCardIndexInArea()
-		if currentIndex == 0 {
-			nextIndex := um.grid.GetSidebarFooterCardIndex(1)
-			if nextIndex >= 0 {
-				um.grid.SetActiveCard(nextIndex)
-			}
+		nextIndex := um.grid.GetSidebarFooterCardIndex(currentIndex + 1)
+		if nextIndex >= 0 {
+			um.grid.SetActiveCard(nextIndex)
 		}
 	}
 }
@@ -558,12 +765,95 @@ func (um *UIManager) navigateDown() {
 }
 
 func (m Model) Init() tea.Cmd {
+	if m.dataManager.statsMode {
+		// Cards were created without logs, so populate them from stats. No
+		// stats are known yet, so the all-time period is selected, and its
+		// stats pick the period to show.
+		cmd := m.updateCurrentData()
+		m.dataManager.periodRequest = m.dataManager.statsRequest
+		return tea.Batch(
+			periodicSystemInfoCmd(0, m.dataManager.serverURL, m.dataManager.authToken),
+			cmd,
+			periodicStatsRefreshCmd(30*time.Second),
+		)
+	}
+
 	return tea.Batch(
 		periodicSystemInfoCmd(0, m.dataManager.serverURL, m.dataManager.authToken),
-		periodicLogRefreshCmd(30*time.Second, m.config.AccessPath, m.dataManager.serverURL, m.dataManager.authToken, m.config.LogFormat, m.dataManager.getPositions()),
+		m.followLogsCmd(),
 	)
 }
 
+// followLogsCmd loads the rest of the existing logs of the selected sources a
+// page at a time, and then follows new logs as they are written, falling back
+// to polling if the stream is unavailable
+func (m Model) followLogsCmd() tea.Cmd {
+	dm := m.dataManager
+	if len(dm.backlog) > 0 {
+		dm.stopLogStream()
+		var cmds []tea.Cmd
+		for source := range dm.backlog {
+			cmds = append(cmds, m.loadBacklogCmd(source))
+		}
+		return tea.Batch(cmds...)
+	}
+
+	dm.startLogStream(m.config.AccessPath, m.config.LogFormat)
+	return m.nextLogsCmd("")
+}
+
+// loadBacklogCmd loads the next page of the existing logs of a source,
+// including compressed archives
+func (m Model) loadBacklogCmd(source string) tea.Cmd {
+	dm := m.dataManager
+	logService := NewLogService(dm.serverURL, dm.authToken, m.config.LogFormat).WithSource(source)
+	accessPath, positions, epoch := m.config.AccessPath, dm.positions[source], dm.epoch
+	return func() tea.Msg {
+		// A failed page is logged and ends the backlog, so that new logs are
+		// still followed
+		logs, newPositions, more, _ := logService.LoadLogs(accessPath, positions, false, true)
+		return UpdateLogsMsg{
+			NewLogs:      logs,
+			NewPositions: newPositions,
+			Source:       source,
+			Epoch:        epoch,
+			More:         more,
+			Backlog:      true,
+		}
+	}
+}
+
+// nextLogsCmd waits for the next streamed logs, or schedules the next poll of
+// the source once streaming has stopped
+func (m Model) nextLogsCmd(source string) tea.Cmd {
+	dm := m.dataManager
+	if dm.logStream != nil {
+		return waitForLogStream(dm.logStream, dm.epoch)
+	}
+	return periodicLogRefreshCmd(30*time.Second, m.config.AccessPath, dm.serverURL, dm.authToken, m.config.LogFormat, source, dm.positions[source], dm.epoch)
+}
+
+// pollLogsCmd schedules the next poll of every selected source
+func (m Model) pollLogsCmd() tea.Cmd {
+	var cmds []tea.Cmd
+	for _, source := range m.dataManager.activeSources() {
+		cmds = append(cmds, m.nextLogsCmd(source))
+	}
+	return tea.Batch(cmds...)
+}
+
+// switchSource selects the next source and reloads its data
+func (m *Model) switchSource() tea.Cmd {
+	m.dataManager.nextSource()
+	if m.dataManager.statsMode {
+		return m.updateCurrentData()
+	}
+
+	m.dataManager.loadLogs(m.config.AccessPath, m.config.LogFormat)
+	m.updateCurrentData()
+	return m.followLogsCmd()
+}
+
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 
@@ -572,13 +862,64 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, periodicSystemInfoCmd(time.Second*2, m.dataManager.serverURL, m.dataManager.authToken)
 
 	case UpdateLogsMsg:
+		// Drop logs of a source that is no longer selected
+		if msg.Epoch != m.dataManager.epoch {
+			return m, nil
+		}
 		// Append new logs to existing logs
 		m.dataManager.appendNewLogs(msg.NewLogs)
-		m.dataManager.positions = msg.NewPositions
+		m.dataManager.positions[msg.Source] = msg.NewPositions
 		// Update current data to reflect new logs
-		m.updateCurrentData()
-		// Schedule next log refresh
-		return m, periodicLogRefreshCmd(30*time.Second, m.config.AccessPath, m.dataManager.serverURL, m.dataManager.authToken, m.config.LogFormat, m.dataManager.getPositions())
+		cmd := m.updateCurrentData()
+		if msg.Backlog {
+			if msg.More {
+				return m, tea.Batch(cmd, m.loadBacklogCmd(msg.Source))
+			}
+			delete(m.dataManager.backlog, msg.Source)
+			if len(m.dataManager.backlog) > 0 {
+				return m, cmd
+			}
+			return m, tea.Batch(cmd, m.followLogsCmd())
+		}
+		if msg.More && m.dataManager.logStream == nil {
+			// Poll again straight away for the rest of the logs
+			dm := m.dataManager
+			return m, tea.Batch(cmd, periodicLogRefreshCmd(0, m.config.AccessPath, dm.serverURL, dm.authToken, m.config.LogFormat, msg.Source, dm.positions[msg.Source], dm.epoch))
+		}
+		// Wait for the next logs
+		return m, tea.Batch(cmd, m.nextLogsCmd(msg.Source))
+
+	case LogStreamClosedMsg:
+		if msg.Epoch != m.dataManager.epoch {
+			return m, nil
+		}
+		m.dataManager.logStream = nil
+		return m, m.pollLogsCmd()
+
+	case RefreshStatsMsg:
+		return m, tea.Batch(m.updateCurrentData(), periodicStatsRefreshCmd(30*time.Second))
+
+	case StatsMsg:
+		// Drop stats of a fetch that has since been replaced
+		if msg.Request != m.dataManager.statsRequest {
+			return m, nil
+		}
+		m.dataManager.updateStatsData(msg.Stats, msg.Period)
+		if msg.Request == m.dataManager.periodRequest {
+			// Pick the initial period from the earliest request, as when
+			// loading logs, and fetch its stats if it isn't all-time
+			m.navManager.selectedPeriod = calculateInitialPeriod(m.navManager.periods, msg.Stats.Start)
+			if m.navManager.getCurrentPeriod() != msg.Period {
+				return m, m.updateCurrentData()
+			}
+		}
+
+	case StatsErrMsg:
+		// Keep the previous stats, and show why they weren't updated
+		if msg.Request != m.dataManager.statsRequest {
+			return m, nil
+		}
+		m.dataManager.statsErr = msg.Err
 
 	case tea.KeyMsg:
 		return m.handleKeyMsg(msg)
@@ -603,6 +944,7 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		selectable, _ = activeCard.Renderer.(c.SelectableCard)
 	}
 	inSelectMode := selectable != nil && selectable.IsInSelectMode()
+	var cmd tea.Cmd
 
 	switch {
 	case key.Matches(msg, m.uiManager.keys.Quit):
@@ -621,6 +963,9 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			case *c.LocationsCard:
 				m.dataManager.locationFilter = nil
 				m.dataManager.locationLookup = nil
+			case *c.NetworksCard:
+				m.dataManager.networkFilter = nil
+				m.dataManager.networkLookup = nil
 			case *c.DeviceCard:
 				m.dataManager.deviceFilter = nil
 				m.dataManager.deviceLookup = nil
@@ -629,8 +974,7 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				m.dataManager.versionLookup = nil
 			}
 			activeCard.SetFiltered(false)
-			m.updateCurrentData()
-			return m, nil
+			return m, m.updateCurrentData()
 		}
 		return m, tea.Quit
 
@@ -654,7 +998,7 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 						})
 						activeCard.SetFiltered(true)
 						selectable.ExitSelectMode()
-						m.updateCurrentData()
+						cmd = m.updateCurrentData()
 					}
 				} else if referrersCard, ok := activeCard.Renderer.(*c.ReferrersCard); ok {
 					if filter := referrersCard.GetSelectedReferrer(); filter != nil {
@@ -663,7 +1007,7 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 						})
 						activeCard.SetFiltered(true)
 						selectable.ExitSelectMode()
-						m.updateCurrentData()
+						cmd = m.updateCurrentData()
 					}
 				} else if locationsCard, ok := activeCard.Renderer.(*c.LocationsCard); ok {
 					if filter := locationsCard.GetSelectedLocation(); filter != nil {
@@ -672,16 +1016,25 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 						}, locationsCard.GetLocationLookup())
 						activeCard.SetFiltered(true)
 						selectable.ExitSelectMode()
-						m.updateCurrentData()
+						cmd = m.updateCurrentData()
+					}
+				} else if networksCard, ok := activeCard.Renderer.(*c.NetworksCard); ok {
+					if filter := networksCard.GetSelectedNetwork(); filter != nil {
+						m.dataManager.setNetworkFilter(&l.NetworkFilter{
+							ASN: filter.ASN,
+						}, networksCard.GetNetworkLookup())
+						activeCard.SetFiltered(true)
+						selectable.ExitSelectMode()
+						cmd = m.updateCurrentData()
 					}
 				} else if deviceCard, ok := activeCard.Renderer.(*c.DeviceCard); ok {
 					if filter := deviceCard.GetSelectedDevice(); filter != nil {
 						m.dataManager.setDeviceFilter(&l.DeviceFilter{
 							Device: filter.Device,
-						}, deviceCard.GetDeviceLookup())
+						}, deviceCard.GetDeviceLookup(), filter.Mode)
 						activeCard.SetFiltered(true)
 						selectable.ExitSelectMode()
-						m.updateCurrentData()
+						cmd = m.updateCurrentData()
 					}
 				} else if versionCard, ok := activeCard.Renderer.(*c.VersionCard); ok {
 					if filter := versionCard.GetSelectedVersion(); filter != nil {
@@ -690,7 +1043,7 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 						}, versionCard.GetVersionLookup())
 						activeCard.SetFiltered(true)
 						selectable.ExitSelectMode()
-						m.updateCurrentData()
+						cmd = m.updateCurrentData()
 					}
 				}
 			} else {
@@ -702,18 +1055,23 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case msg.String() == "tab":
 		m.navManager.toggleNavigationMode()
 
+	case msg.String() == "s":
+		if m.dataManager.canSwitchSource() {
+			return m, m.switchSource()
+		}
+
 	case msg.String() == "p":
 		m.navManager.navigatePeriodsRight()
-		m.updateCurrentData()
+		cmd = m.updateCurrentData()
 
 	case msg.String() == "P":
 		m.navManager.navigatePeriodsLeft()
-		m.updateCurrentData()
+		cmd = m.updateCurrentData()
 
 	case key.Matches(msg, m.uiManager.keys.Left):
 		if m.navManager.isTabNavigationMode() {
 			m.navManager.navigatePeriodsLeft()
-			m.updateCurrentData()
+			cmd = m.updateCurrentData()
 		} else if inSelectMode {
 			// For LocationsCard in select mode, use left/right to select
 			if _, ok := activeCard.Renderer.(*c.LocationsCard); ok {
@@ -726,7 +1084,7 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case key.Matches(msg, m.uiManager.keys.Right):
 		if m.navManager.isTabNavigationMode() {
 			m.navManager.navigatePeriodsRight()
-			m.updateCurrentData()
+			cmd = m.updateCurrentData()
 		} else if inSelectMode {
 			// For LocationsCard in select mode, use left/right to select
 			if _, ok := activeCard.Renderer.(*c.LocationsCard); ok {
@@ -751,13 +1109,19 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 	}
 
-	return m, nil
+	return m, cmd
 }
 
-func (m *Model) updateCurrentData() {
+// updateCurrentData updates the cards for the selected period and filters. In
+// stats mode, it returns a command fetching the stats for them.
+func (m *Model) updateCurrentData() tea.Cmd {
 	period := m.navManager.getCurrentPeriod()
+	if m.dataManager.statsMode {
+		return m.dataManager.fetchStatsCmd(m.config.AccessPath, m.config.LogFormat, period)
+	}
 	m.dataManager.currentLogs = m.dataManager.getCurrentLogs(period)
 	m.dataManager.updateCardData(m.dataManager.currentLogs, period)
+	return nil
 }
 
 func (m Model) View() string {
@@ -778,13 +1142,24 @@ func (m Model) View() string {
 	gridView := m.uiManager.grid.RenderGrid()
 	view.WriteString(gridView)
 
-	// Render help
+	// Render help, after the error of the latest stats fetch if it failed
 	helpText := m.getHelpText()
 	helpLine := lipgloss.NewStyle().
 		Width(m.width).
 		Align(lipgloss.Right).
 		Foreground(styles.BorderColor).
 		Render(helpText)
+	if err := m.dataManager.statsErr; err != nil {
+		errWidth := max(m.width-lipgloss.Width(helpText), 0)
+		errText := ansi.Truncate(" Failed to load stats: "+err.Error(), errWidth, "…")
+		helpLine = lipgloss.NewStyle().
+			Width(errWidth).
+			Foreground(styles.Red).
+			Render(errText) +
+			lipgloss.NewStyle().
+				Foreground(styles.BorderColor).
+				Render(helpText)
+	}
 
 	view.WriteString("\n\n")
 	view.WriteString(helpLine)
@@ -838,12 +1213,19 @@ func (m Model) renderTabs() string {
 	}
 
 	tabsStr := strings.Join(tabs, "")
+
+	// Show the selected source on the left when there is a choice of sources
+	var sourceStr string
+	if m.dataManager.canSwitchSource() {
+		sourceStr = activeTabStyle.Render(m.dataManager.sourceLabel())
+	}
+
 	tabLine := lipgloss.NewStyle().
-		Width(m.width).
+		Width(max(m.width-lipgloss.Width(sourceStr), 0)).
 		Align(lipgloss.Right).
 		Render(tabsStr)
 
-	return tabLine
+	return sourceStr + tabLine
 }
 
 func (m Model) getHelpText() string {
@@ -866,25 +1248,32 @@ func (m Model) getHelpText() string {
 		if _, ok := activeCard.Renderer.(c.SelectableCard); ok {
 			// Check specific card types for custom help text
 			if _, ok := activeCard.Renderer.(*c.DeviceCard); ok {
-				return "← → ↑ ↓    [enter] select    [m] cycle mode    [p] switch period    [q] quit  "
+				return "← → ↑ ↓    [enter] select    [m] cycle mode    " + m.sourceHelp() + "[p] switch period    [q] quit  "
 			}
 			if _, ok := activeCard.Renderer.(*c.LocationsCard); ok {
-				return "← → ↑ ↓    [enter] select    [p] switch period    [q] quit  "
+				return "← → ↑ ↓    [enter] select    " + m.sourceHelp() + "[p] switch period    [q] quit  "
 			}
 			// For other selectable cards (endpoint, version, referrers)
-			return "← → ↑ ↓    [enter] select    [p] switch period    [q] quit  "
+			return "← → ↑ ↓    [enter] select    " + m.sourceHelp() + "[p] switch period    [q] quit  "
 		}
 	}
 
-	return "← → ↑ ↓    [p] switch period    [q] quit  "
+	return "← → ↑ ↓    " + m.sourceHelp() + "[p] switch period    [q] quit  "
+}
+
+// sourceHelp returns the help for switching source, if there is a choice
+func (m Model) sourceHelp() string {
+	if m.dataManager.canSwitchSource() {
+		return "[s] switch source    "
+	}
+	return ""
 }
 
 func (m Model) GetSelectedPeriod() period.Period {
 	return m.navManager.getCurrentPeriod()
 }
 
-func calculateInitialPeriod(periods []period.Period, logs []nginx.NGINXLog) int {
-	logStart, _ := period.LogRange(logs)
+func calculateInitialPeriod(periods []period.Period, logStart time.Time) int {
 	selectedPeriod := 3 // Default to 30 days
 
 	for i, p := range periods {
@@ -913,14 +1302,15 @@ func periodicSystemInfoCmd(d time.Duration, serverURL string, authToken string)
 }
 
 // periodicLogRefreshCmd creates a command that periodically fetches new logs
-func periodicLogRefreshCmd(d time.Duration, accessPath, serverURL string, authToken string, logFormat string, positions []parse.Position) tea.Cmd {
+// of a source
+func periodicLogRefreshCmd(d time.Duration, accessPath, serverURL string, authToken string, logFormat string, source string, positions []parse.Position, epoch int) tea.Cmd {
 	return tea.Tick(d, func(t time.Time) tea.Msg {
-		logService := NewLogService(serverURL, authToken, logFormat)
+		logService := NewLogService(serverURL, authToken, logFormat).WithSource(source)
 
 		// Load new logs starting from the last position
 		// You'll need to modify LoadLogsFromPosition to accept a position parameter
 		// and return only logs after that position
-		newLogs, newPositions, err := logService.LoadLogs(accessPath, positions, false, false)
+		newLogs, newPositions, more, err := logService.LoadLogs(accessPath, positions, false, false)
 		if err != nil {
 			return nil
 		}
@@ -928,6 +1318,17 @@ func periodicLogRefreshCmd(d time.Duration, accessPath, serverURL string, authTo
 		return UpdateLogsMsg{
 			NewLogs:      newLogs,
 			NewPositions: newPositions,
+			Source:       source,
+			Epoch:        epoch,
+			More:         more,
 		}
 	})
 }
+
+// periodicStatsRefreshCmd creates a command that periodically triggers a
+// refetch of the stats for the current period
+func periodicStatsRefreshCmd(d time.Duration) tea.Cmd {
+	return tea.Tick(d, func(t time.Time) tea.Msg {
+		return RefreshStatsMsg{}
+	})
+}
@@ -2,19 +2,23 @@ package model
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/charmbracelet/x/term"
 
 	"github.com/tom-draper/nginx-analytics/tui/internal/config"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/location"
 	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
 	parse "github.com/tom-draper/nginx-analytics/agent/pkg/logs"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
 	"github.com/tom-draper/nginx-analytics/agent/pkg/system"
 	l "github.com/tom-draper/nginx-analytics/tui/internal/logs"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/nginx"
@@ -35,6 +39,15 @@ var (
 		},
 	}
 
+	// HTTP client for requests to the agent, replaced when TLS is configured
+	apiClient = http.DefaultClient
+
+	// Maximum size of each page of logs requested from the agent
+	logPageBytes = 8 * 1024 * 1024
+
+	// Maximum time to wait for stats before giving up on them
+	statsTimeout = 30 * time.Second
+
 	// Retry configuration
 	maxRetries     = 3
 	retryDelay     = 1 * time.Second
@@ -45,6 +58,7 @@ type LogService struct {
 	serverURL string
 	authToken string
 	logFormat string
+	source    string // Named agent source, or empty for the agent's default
 }
 
 func NewLogService(serverURL string, authToken string, logFormat string) *LogService {
@@ -55,13 +69,22 @@ func NewLogService(serverURL string, authToken string, logFormat string) *LogSer
 	}
 }
 
-// LoadLogs loads and parses nginx logs from either local file or remote server
-func (ls *LogService) LoadLogs(accessPath string, positions []parse.Position, isErrorLog bool, includeCompressed bool) ([]nginx.NGINXLog, []parse.Position, error) {
+// LoadLogs loads and parses nginx logs from either local file or remote server.
+// The agent serves a page of logs at a time, and more reports whether there
+// are more logs to load from the positions returned.
+func (ls *LogService) LoadLogs(accessPath string, positions []parse.Position, isErrorLog bool, includeCompressed bool) (logs []nginx.NGINXLog, newPositions []parse.Position, more bool, err error) {
 	result, err := ls.getLogs(accessPath, positions, isErrorLog, includeCompressed)
 	if err != nil {
-		return nil, positions, fmt.Errorf("failed to load logs: %w", err)
+		return nil, positions, false, fmt.Errorf("failed to load logs: %w", err)
 	}
-	return l.ParseNginxLogs(result.Logs, ls.logFormat), result.Positions, nil
+
+	// Agents that support server-side parsing return structured records;
+	// older agents return raw lines that still need parsing locally.
+	logs = result.Records
+	if len(result.Logs) > 0 {
+		logs = append(logs, l.ParseNginxLogs(result.Logs, ls.logFormat)...)
+	}
+	return logs, result.Positions, result.Cursor != "", nil
 }
 
 // LoadLogSizes loads log size information
@@ -72,6 +95,16 @@ func (ls *LogService) LoadLogSizes(accessPath string) (parse.LogSizes, error) {
 	return ls.readLogsSizes(accessPath)
 }
 
+// LoadStats loads aggregated access log statistics, computed by the agent when
+// connected to a server or locally otherwise. Requests to the agent are
+// abandoned when ctx is done.
+func (ls *LogService) LoadStats(ctx context.Context, accessPath string, opts stats.Options) (stats.Stats, error) {
+	if ls.serverURL != "" {
+		return ls.fetchStats(ctx, opts)
+	}
+	return ls.computeStats(accessPath, opts)
+}
+
 func (ls *LogService) FilterLogsByPeriod(logs []nginx.NGINXLog, period period.Period) []nginx.NGINXLog {
 	return l.FilterLogs(logs, period)
 }
@@ -87,9 +120,12 @@ func (ls *LogService) getLogs(accessPath string, positions []parse.Position, isE
 	}
 
 	if err != nil {
-		logger.Log.Printf("Error getting logs: %v", err)
+		logger.Errorf("Error getting logs: %v", err)
 		return parse.LogResult{}, fmt.Errorf("failed to retrieve logs: %w", err)
 	}
+	if logs.Rotated {
+		logger.Debug("Log rotation detected")
+	}
 
 	return logs, nil
 }
@@ -101,6 +137,9 @@ func (ls *LogService) readLogs(path string, positions []parse.Position, isErrorL
 	return parse.GetLogs(path, positions, isErrorLog, includeCompressed)
 }
 
+// fetchLogs fetches a page of logs from the agent. A page cut short is
+// returned with a cursor, and its positions are where the next page starts,
+// so that the rest can be fetched later without holding the whole backlog.
 func (ls *LogService) fetchLogs(positions []parse.Position, isErrorLog bool, includeCompressed bool) (parse.LogResult, error) {
 	path := "/api/logs/access"
 	if isErrorLog {
@@ -114,6 +153,14 @@ func (ls *LogService) fetchLogs(positions []parse.Position, isErrorLog bool, inc
 
 	params := url.Values{}
 	params.Add("includeCompressed", fmt.Sprintf("%t", includeCompressed))
+	params.Add("maxBytes", strconv.Itoa(logPageBytes))
+	if ls.source != "" {
+		params.Add("source", ls.source)
+	}
+	if !isErrorLog {
+		// Let the agent parse with its own configured log format
+		params.Add("format", "parsed")
+	}
 	if len(positions) > 0 {
 		jsonStr, err := ls.positionsToJSON(positions)
 		if err != nil {
@@ -121,17 +168,95 @@ func (ls *LogService) fetchLogs(positions []parse.Position, isErrorLog bool, inc
 		}
 		params.Add("positions", jsonStr)
 	}
-	endpoint.RawQuery = params.Encode()
 
+	endpoint.RawQuery = params.Encode()
 	body, err := ls.httpGetAndReadBody(endpoint.String())
 	if err != nil {
 		return parse.LogResult{}, err
 	}
 
+	// Older agents return everything at once without a cursor
 	var result parse.LogResult
 	if err := json.Unmarshal(body, &result); err != nil {
 		return parse.LogResult{}, fmt.Errorf("failed to parse JSON: %w", err)
 	}
+	return result, nil
+}
+
+func (ls *LogService) computeStats(path string, opts stats.Options) (stats.Stats, error) {
+	result, err := ls.readLogs(path, nil, false, true)
+	if err != nil {
+		return stats.Stats{}, fmt.Errorf("failed to read logs: %w", err)
+	}
+	if opts.LocationLookup == nil && location.LocationsEnabled() {
+		opts.LocationLookup = func(ipAddress string) string {
+			loc, _ := location.LocationLookup(ipAddress)
+			return loc.Country
+		}
+	}
+	if opts.NetworkLookup == nil && location.NetworksEnabled() {
+		opts.NetworkLookup = func(ipAddress string) (uint, string) {
+			loc, _ := location.LocationLookup(ipAddress)
+			return loc.ASN, loc.Organization
+		}
+	}
+	return stats.Compute(l.ParseNginxLogs(result.Logs, ls.logFormat), opts), nil
+}
+
+func (ls *LogService) fetchStats(ctx context.Context, opts stats.Options) (stats.Stats, error) {
+	endpoint, err := url.Parse(ls.serverURL + "/api/stats")
+	if err != nil {
+		return stats.Stats{}, fmt.Errorf("invalid base URL: %w", err)
+	}
+
+	params := url.Values{}
+	if ls.source != "" {
+		params.Add("source", ls.source)
+	}
+	if !opts.Start.IsZero() {
+		params.Add("start", opts.Start.Format(time.RFC3339))
+	}
+	if !opts.End.IsZero() {
+		params.Add("end", opts.End.Format(time.RFC3339))
+	}
+	if opts.Interval > 0 {
+		params.Add("interval", opts.Interval.String())
+	}
+	if opts.Limit > 0 {
+		params.Add("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Filter.Status != 0 {
+		params.Add("status", strconv.Itoa(opts.Filter.Status))
+	}
+	if opts.Filter.Network != 0 {
+		params.Add("network", strconv.FormatUint(uint64(opts.Filter.Network), 10))
+	}
+	filters := map[string]string{
+		"path":     opts.Filter.Path,
+		"method":   opts.Filter.Method,
+		"referrer": opts.Filter.Referrer,
+		"client":   opts.Filter.Client,
+		"os":       opts.Filter.OS,
+		"device":   opts.Filter.Device,
+		"version":  opts.Filter.Version,
+		"location": opts.Filter.Location,
+	}
+	for key, value := range filters {
+		if value != "" {
+			params.Add(key, value)
+		}
+	}
+	endpoint.RawQuery = params.Encode()
+
+	body, err := ls.httpGetAndReadBodyContext(ctx, endpoint.String())
+	if err != nil {
+		return stats.Stats{}, err
+	}
+
+	var result stats.Stats
+	if err := json.Unmarshal(body, &result); err != nil {
+		return stats.Stats{}, fmt.Errorf("failed to parse JSON: %w", err)
+	}
 
 	return result, nil
 }
@@ -164,7 +289,11 @@ func (ls *LogService) positionsToJSON(positions []parse.Position) (string, error
 }
 
 func (ls *LogService) httpGetAndReadBody(url string) ([]byte, error) {
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	return ls.httpGetAndReadBodyContext(context.Background(), url)
+}
+
+func (ls *LogService) httpGetAndReadBodyContext(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
 	}
@@ -172,7 +301,7 @@ func (ls *LogService) httpGetAndReadBody(url string) ([]byte, error) {
 		req.Header.Set("Authorization", "Bearer "+ls.authToken)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := apiClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make request to %s: %w", url, err)
 	}
@@ -189,6 +318,15 @@ func (ls *LogService) httpGetAndReadBody(url string) ([]byte, error) {
 	return body, nil
 }
 
+// SetTLSConfig sets the TLS config used for requests to the agent, such as a
+// pinned CA bundle or a client certificate.
+func SetTLSConfig(cfg *tls.Config) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+	apiClient = &http.Client{Transport: transport}
+	httpClient.Transport.(*http.Transport).TLSClientConfig = cfg
+}
+
 // httpGetWithRetry performs an HTTP GET with retry logic and exponential backoff
 func httpGetWithRetry(client *http.Client, url string, maxRetries int, initialDelay time.Duration) ([]byte, error) {
 	var lastErr error
@@ -196,7 +334,7 @@ func httpGetWithRetry(client *http.Client, url string, maxRetries int, initialDe
 
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		if attempt > 0 {
-			logger.Log.Printf("Retry attempt %d/%d for %s after %v", attempt, maxRetries, url, delay)
+			logger.Warnf("Retry attempt %d/%d for %s after %v", attempt, maxRetries, url, delay)
 			time.Sleep(delay)
 			delay = time.Duration(float64(delay) * retryBackoff)
 		}
@@ -272,7 +410,7 @@ func (ss *SystemService) fetchSystemInfo() (system.SystemInfo, error) {
 		req.Header.Set("Authorization", "Bearer "+ss.authToken)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := apiClient.Do(req)
 	if err != nil {
 		return system.SystemInfo{}, fmt.Errorf("failed to fetch system info: %w", err)
 	}
@@ -308,6 +446,7 @@ func (cf *CardFactory) CreateCards(currentLogs []nginx.NGINXLog, p period.Period
 	endpointsCard := cards.NewEndpointsCard(currentLogs, p)
 	versionsCard := cards.NewVersionCard(currentLogs, p)
 	locationsCard := cards.NewLocationsCard(currentLogs, p, serverURL, authToken)
+	networksCard := cards.NewNetworksCard(currentLogs, p, locationsCard.Locations(), serverURL, authToken)
 	devicesCard := cards.NewDeviceCard(currentLogs, p)
 	activitiesCard := cards.NewActivityCard(currentLogs, p)
 	cpusCard := cards.NewCPUCard()
@@ -333,6 +472,7 @@ func (cf *CardFactory) CreateCards(currentLogs []nginx.NGINXLog, p period.Period
 		"log":         cards.NewCard("Logs", logSizesCard),
 		"usageTime":   cards.NewCard("Usage Time", usageTimesCard),
 		"referrer":    cards.NewCard("Referrers", referrersCard),
+		"network":     cards.NewCard("Networks", networksCard),
 		"version":     cards.NewCard("Version", versionsCard),
 	}
 
@@ -356,9 +496,11 @@ func (cf *CardFactory) setCardSizes(cardInstances map[string]*cards.Card) {
 		}
 	}
 
-	// Special size for referrer card
-	if referrerCard, exists := cardInstances["referrer"]; exists {
-		referrerCard.SetSize(cardWidth, 35)
+	// Special size for referrer and network cards
+	for _, cardName := range []string{"referrer", "network"} {
+		if card, exists := cardInstances[cardName]; exists {
+			card.SetSize(cardWidth, 35)
+		}
 	}
 }
 
@@ -393,6 +535,7 @@ func (gf *GridFactory) SetupGrid(cardInstances map[string]*cards.Card) *dashboar
 		{"storage", dashboard.PositionSystem},
 		{"usageTime", dashboard.PositionFooter},
 		{"referrer", dashboard.PositionFooter},
+		{"network", dashboard.PositionFooter},
 		{"version", dashboard.PositionVersion},
 	}
 
@@ -454,21 +597,21 @@ func NewErrorHandler() *ErrorHandler {
 // HandleLogError handles log-related errors
 func (eh *ErrorHandler) HandleLogError(err error, context string) {
 	if err != nil {
-		logger.Log.Printf("Log error in %s: %v", context, err)
+		logger.Errorf("Log error in %s: %v", context, err)
 	}
 }
 
 // HandleSystemError handles system-related errors
 func (eh *ErrorHandler) HandleSystemError(err error, context string) {
 	if err != nil {
-		logger.Log.Printf("System error in %s: %v", context, err)
+		logger.Errorf("System error in %s: %v", context, err)
 	}
 }
 
 // HandleNetworkError handles network-related errors
 func (eh *ErrorHandler) HandleNetworkError(err error, context string) {
 	if err != nil {
-		logger.Log.Printf("Network error in %s: %v", context, err)
+		logger.Errorf("Network error in %s: %v", context, err)
 	}
 }
 
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
+	"github.com/tom-draper/nginx-analytics/tui/internal/logs/period"
+)
+
+func TestLoadLogsLoadsAPageAtATime(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("maxBytes") == "" {
+			t.Errorf("request without a page size: %s", r.URL)
+		}
+		switch positions := r.URL.Query().Get("positions"); positions {
+		case "":
+			fmt.Fprint(w, `{"logs":[],"records":[{"path":"/1"}],"positions":[{"position":10}],"cursor":"next"}`)
+		case `[{"position":10}]`:
+			fmt.Fprint(w, `{"logs":[],"records":[{"path":"/2"}],"positions":[{"position":20}]}`)
+		default:
+			t.Errorf("unexpected positions %q", positions)
+		}
+	}))
+	defer server.Close()
+
+	logService := NewLogService(server.URL, "", "")
+	logs, positions, more, err := logService.LoadLogs("", nil, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].Path != "/1" || !more {
+		t.Errorf("unexpected first page: %+v (more %t)", logs, more)
+	}
+
+	// The next page continues from the positions of the last
+	logs, positions, more, err = logService.LoadLogs("", positions, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].Path != "/2" || more {
+		t.Errorf("unexpected last page: %+v (more %t)", logs, more)
+	}
+	if len(positions) != 1 || positions[0].Position != 20 {
+		t.Errorf("unexpected positions: %+v", positions)
+	}
+}
+
+func TestFetchStatsCmdTimesOut(t *testing.T) {
+	previous := statsTimeout
+	statsTimeout = 50 * time.Millisecond
+	defer func() { statsTimeout = previous }()
+
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer server.Close()
+	defer close(unblock)
+
+	dm := &DataManager{serverURL: server.URL, statsMode: true}
+	stale := dm.fetchStatsCmd("", "", period.PeriodAllTime)
+	msg, ok := dm.fetchStatsCmd("", "", period.PeriodAllTime)().(StatsErrMsg)
+	if !ok || msg.Err == nil {
+		t.Fatalf("expected a stats error, got %+v", msg)
+	}
+	if msg.Request != dm.statsRequest {
+		t.Errorf("got request %d, want %d", msg.Request, dm.statsRequest)
+	}
+	if msg := stale().(StatsErrMsg); msg.Request == dm.statsRequest {
+		t.Error("replaced fetch has the current request")
+	}
+}
+
+func TestInitialStatsPickPeriod(t *testing.T) {
+	dm := &DataManager{statsMode: true}
+	m := Model{dataManager: dm, navManager: newNavigationManager(time.Time{})}
+	m.Init()
+	if got := m.navManager.getCurrentPeriod(); got != period.PeriodAllTime {
+		t.Fatalf("got initial period %v, want all time", got)
+	}
+
+	// All-time stats starting two hours ago pick the last 24 hours
+	start := time.Now().Add(-2 * time.Hour)
+	updated, cmd := m.Update(StatsMsg{Stats: stats.Stats{Start: start}, Period: period.PeriodAllTime, Request: dm.statsRequest})
+	m = updated.(Model)
+	if got := m.navManager.getCurrentPeriod(); got != period.Period24Hours {
+		t.Errorf("got period %v, want 24 hours", got)
+	}
+	if cmd == nil || dm.periodRequest == dm.statsRequest {
+		t.Error("expected the stats of the picked period to be fetched")
+	}
+}
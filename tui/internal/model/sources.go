@@ -0,0 +1,131 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
+	parse "github.com/tom-draper/nginx-analytics/agent/pkg/logs"
+	"github.com/tom-draper/nginx-analytics/tui/internal/logs/nginx"
+)
+
+// allSourcesStats asks the agent to merge stats across every source
+const allSourcesStats = "*"
+
+type sourceInfo struct {
+	Name string `json:"name"`
+}
+
+// WithSource returns a copy of the service that reads from the named agent
+// source
+func (ls *LogService) WithSource(source string) *LogService {
+	scoped := *ls
+	scoped.source = source
+	return &scoped
+}
+
+// LoadSources lists the names of the log sources configured on the agent.
+// Local files have no named sources, and neither do older agents.
+func (ls *LogService) LoadSources() ([]string, error) {
+	if ls.serverURL == "" {
+		return nil, nil
+	}
+
+	body, err := ls.httpGetAndReadBody(ls.serverURL + "/api/sources")
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []sourceInfo
+	if err := json.Unmarshal(body, &sources); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+
+	names := make([]string, len(sources))
+	for i, source := range sources {
+		names[i] = source.Name
+	}
+	return names, nil
+}
+
+// LoadSourceLogs loads a page of the logs of each source from its positions,
+// merged in timestamp order, and lists the sources with more logs to load. An
+// empty source name reads the agent's default source. A source that fails to
+// load keeps its positions so that it is retried next time, and an error is
+// only returned if every source fails.
+func (ls *LogService) LoadSourceLogs(accessPath string, sources []string, positions map[string][]parse.Position, includeCompressed bool) ([]nginx.NGINXLog, map[string][]parse.Position, []string, error) {
+	newPositions := make(map[string][]parse.Position, len(sources))
+	var logs []nginx.NGINXLog
+	var pending []string
+	var failed int
+	var lastErr error
+	for _, source := range sources {
+		sourceLogs, sourcePositions, more, err := ls.WithSource(source).LoadLogs(accessPath, positions[source], false, includeCompressed)
+		if err != nil {
+			logger.Warnf("Error loading source %q: %v", source, err)
+			failed++
+			lastErr = err
+		}
+		logs = append(logs, sourceLogs...)
+		newPositions[source] = sourcePositions
+		if more {
+			pending = append(pending, source)
+		}
+	}
+	if failed > 0 && failed == len(sources) {
+		return nil, newPositions, nil, lastErr
+	}
+
+	if len(sources) > 1 {
+		sortByTimestamp(logs)
+	}
+	return logs, newPositions, pending, nil
+}
+
+// StreamSources streams new logs from each source on a single channel, with
+// every message tagged with the source it came from. The channel is closed
+// once every source's stream has closed.
+func (ls *LogService) StreamSources(ctx context.Context, accessPath string, positions map[string][]parse.Position) <-chan UpdateLogsMsg {
+	updates := make(chan UpdateLogsMsg)
+
+	var wg sync.WaitGroup
+	for source, sourcePositions := range positions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range ls.WithSource(source).StreamLogs(ctx, accessPath, sourcePositions) {
+				msg.Source = source
+				select {
+				case updates <- msg:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(updates)
+	}()
+	return updates
+}
+
+// sortByTimestamp orders logs from different sources by when they were
+// written. Logs without a timestamp sort first.
+func sortByTimestamp(logs []nginx.NGINXLog) {
+	sort.SliceStable(logs, func(i, j int) bool {
+		return timestamp(logs[i]).Before(timestamp(logs[j]))
+	})
+}
+
+func timestamp(log nginx.NGINXLog) time.Time {
+	if log.Timestamp == nil {
+		return time.Time{}
+	}
+	return *log.Timestamp
+}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoadSourceLogsMergesSources(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch source := r.URL.Query().Get("source"); source {
+		case "api":
+			fmt.Fprint(w, `{"logs":[],"records":[{"path":"/api/1","timestamp":"2025-01-01T10:00:00Z"},{"path":"/api/2","timestamp":"2025-01-01T12:00:00Z"}],"positions":[{"position":10}]}`)
+		case "web":
+			fmt.Fprint(w, `{"logs":[],"records":[{"path":"/web/1","timestamp":"2025-01-01T11:00:00Z"}],"positions":[{"position":20}],"cursor":"next"}`)
+		default:
+			http.Error(w, "Unknown source: "+source, http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	logService := NewLogService(server.URL, "", "")
+	logs, positions, pending, err := logService.LoadSourceLogs("", []string{"api", "web", "missing"}, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/api/1", "/web/1", "/api/2"}
+	if len(logs) != len(want) {
+		t.Fatalf("got %d logs, want %d", len(logs), len(want))
+	}
+	for i, path := range want {
+		if logs[i].Path != path {
+			t.Errorf("log %d: got %s, want %s", i, logs[i].Path, path)
+		}
+	}
+	if positions["api"][0].Position != 10 || positions["web"][0].Position != 20 {
+		t.Errorf("unexpected positions: %+v", positions)
+	}
+	if len(pending) != 1 || pending[0] != "web" {
+		t.Errorf("unexpected sources with more logs: %v", pending)
+	}
+
+	if _, _, _, err := logService.LoadSourceLogs("", []string{"missing"}, nil, true); err == nil {
+		t.Error("expected an error when every source fails")
+	}
+}
+
+func TestNextSource(t *testing.T) {
+	dm := &DataManager{sources: []string{"api", "web"}}
+
+	want := []string{"api", "web", "", "api"}
+	for i, source := range want {
+		dm.nextSource()
+		if dm.source != source {
+			t.Errorf("switch %d: got %q, want %q", i+1, dm.source, source)
+		}
+	}
+	if dm.epoch != len(want) {
+		t.Errorf("got epoch %d, want %d", dm.epoch, len(want))
+	}
+	if dm.statsSource() != "api" {
+		t.Errorf("got stats source %q, want api", dm.statsSource())
+	}
+
+	dm.source = ""
+	if dm.statsSource() != allSourcesStats {
+		t.Errorf("got stats source %q, want %s", dm.statsSource(), allSourcesStats)
+	}
+}
@@ -0,0 +1,223 @@
+package model
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/tom-draper/nginx-analytics/agent/pkg/logger"
+	parse "github.com/tom-draper/nginx-analytics/agent/pkg/logs"
+	l "github.com/tom-draper/nginx-analytics/tui/internal/logs"
+)
+
+const (
+	maxStreamRetryDelay = 30 * time.Second
+	maxStreamEventSize  = 64 * 1024 * 1024
+)
+
+// errStreamUnsupported is returned when the agent has no log stream, such as
+// an older agent, so callers should fall back to polling
+var errStreamUnsupported = errors.New("log stream not supported")
+
+// LogStreamClosedMsg is sent when the log stream ends for good
+type LogStreamClosedMsg struct {
+	Epoch int
+}
+
+// StreamLogs subscribes to new access logs as they are written, from the
+// agent's event stream when connected to a server or by watching the local
+// files otherwise. Dropped connections are retried with exponential backoff,
+// resuming from the last positions received. The channel is closed once
+// streaming is unavailable or ctx is cancelled.
+func (ls *LogService) StreamLogs(ctx context.Context, accessPath string, positions []parse.Position) <-chan UpdateLogsMsg {
+	updates := make(chan UpdateLogsMsg)
+	if ls.serverURL != "" {
+		go ls.streamRemoteLogs(ctx, positions, updates)
+	} else {
+		go ls.streamLocalLogs(ctx, accessPath, positions, updates)
+	}
+	return updates
+}
+
+func (ls *LogService) streamRemoteLogs(ctx context.Context, positions []parse.Position, updates chan<- UpdateLogsMsg) {
+	defer close(updates)
+
+	delay := retryDelay
+	for {
+		connected, err := ls.consumeLogStream(ctx, &positions, updates)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errStreamUnsupported) {
+			logger.Warnf("Falling back to polling: %v", err)
+			return
+		}
+		if connected {
+			delay = retryDelay
+		}
+
+		logger.Warnf("Log stream disconnected, reconnecting in %v: %v", delay, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(time.Duration(float64(delay)*retryBackoff), maxStreamRetryDelay)
+	}
+}
+
+// consumeLogStream reads events from a single stream connection until it
+// ends, keeping positions up to date with every event received
+func (ls *LogService) consumeLogStream(ctx context.Context, positions *[]parse.Position, updates chan<- UpdateLogsMsg) (bool, error) {
+	endpoint, err := url.Parse(ls.serverURL + "/api/logs/stream")
+	if err != nil {
+		return false, fmt.Errorf("%w: invalid base URL: %v", errStreamUnsupported, err)
+	}
+	params := url.Values{"format": {"parsed"}}
+	if ls.source != "" {
+		params.Add("source", ls.source)
+	}
+	endpoint.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if ls.authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+ls.authToken)
+	}
+	if len(*positions) > 0 {
+		jsonStr, err := ls.positionsToJSON(*positions)
+		if err != nil {
+			return false, err
+		}
+		req.Header.Set("Last-Event-ID", jsonStr)
+	}
+
+	resp, err := apiClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Client errors won't be fixed by reconnecting
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		return false, fmt.Errorf("%w: status %d", errStreamUnsupported, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamEventSize)
+
+	var id, event string
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if event == "logs" {
+				msg, err := ls.decodeLogEvent(id, data.String())
+				if err != nil {
+					return true, err
+				}
+				select {
+				case updates <- msg:
+				case <-ctx.Done():
+					return true, ctx.Err()
+				}
+				*positions = msg.NewPositions
+			}
+			id, event = "", ""
+			data.Reset()
+		case strings.HasPrefix(line, ":"):
+			// Comment, used by the agent as a heartbeat
+		case strings.HasPrefix(line, "id:"):
+			id = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return true, fmt.Errorf("failed to read stream: %w", err)
+	}
+	return true, errors.New("stream closed by server")
+}
+
+func (ls *LogService) decodeLogEvent(id string, data string) (UpdateLogsMsg, error) {
+	var result parse.LogResult
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		return UpdateLogsMsg{}, fmt.Errorf("failed to parse event data: %w", err)
+	}
+
+	positions := result.Positions
+	if id != "" {
+		if err := json.Unmarshal([]byte(id), &positions); err != nil {
+			return UpdateLogsMsg{}, fmt.Errorf("failed to parse event id: %w", err)
+		}
+	}
+
+	logs := result.Records
+	if len(result.Logs) > 0 {
+		logs = append(logs, l.ParseNginxLogs(result.Logs, ls.logFormat)...)
+	}
+	return UpdateLogsMsg{NewLogs: logs, NewPositions: positions}, nil
+}
+
+func (ls *LogService) streamLocalLogs(ctx context.Context, accessPath string, positions []parse.Position, updates chan<- UpdateLogsMsg) {
+	defer close(updates)
+
+	if accessPath == "" {
+		return
+	}
+	changes, err := parse.Watch(ctx, accessPath)
+	if err != nil {
+		logger.Warnf("Falling back to polling: %v", err)
+		return
+	}
+
+	for range changes {
+		logs, newPositions, _, err := ls.LoadLogs(accessPath, positions, false, false)
+		if err != nil {
+			continue
+		}
+		if len(logs) == 0 {
+			positions = newPositions
+			continue
+		}
+		select {
+		case updates <- UpdateLogsMsg{NewLogs: logs, NewPositions: newPositions}:
+			positions = newPositions
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// waitForLogStream creates a command that waits for the next streamed logs,
+// tagging them with the epoch of the sources being streamed
+func waitForLogStream(updates <-chan UpdateLogsMsg, epoch int) tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-updates
+		if !ok {
+			return LogStreamClosedMsg{Epoch: epoch}
+		}
+		msg.Epoch = epoch
+		return msg
+	}
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	parse "github.com/tom-draper/nginx-analytics/agent/pkg/logs"
+)
+
+func TestStreamLogsResumesAfterDisconnect(t *testing.T) {
+	var connections atomic.Int32
+	lastEventIDs := make(chan string, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := connections.Add(1)
+		lastEventIDs <- r.Header.Get("Last-Event-ID")
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		position := 100 * n
+		fmt.Fprintf(w, ": heartbeat\n\n")
+		fmt.Fprintf(w, "id: [{\"position\":%d,\"filename\":\"access.log\"}]\n", position)
+		fmt.Fprintf(w, "event: logs\n")
+		fmt.Fprintf(w, "data: {\"logs\":[],\"records\":[{\"path\":\"/%d\"}]}\n\n", n)
+		// Closing the response simulates a dropped connection
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	initial := []parse.Position{{Filename: "access.log", Position: 42}}
+	updates := NewLogService(server.URL, "", "").StreamLogs(ctx, "", initial)
+
+	for i := 1; i <= 2; i++ {
+		select {
+		case msg := <-updates:
+			if len(msg.NewLogs) != 1 || msg.NewLogs[0].Path != fmt.Sprintf("/%d", i) {
+				t.Fatalf("event %d: unexpected logs %+v", i, msg.NewLogs)
+			}
+			if len(msg.NewPositions) != 1 || msg.NewPositions[0].Position != int64(100*i) {
+				t.Fatalf("event %d: unexpected positions %+v", i, msg.NewPositions)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for event %d", i)
+		}
+	}
+
+	if id := <-lastEventIDs; id != `[{"position":42,"filename":"access.log"}]` {
+		t.Errorf("first connection sent Last-Event-ID %s", id)
+	}
+	if id := <-lastEventIDs; id != `[{"position":100,"filename":"access.log"}]` {
+		t.Errorf("reconnection sent Last-Event-ID %s", id)
+	}
+}
+
+func TestStreamLogsUnsupported(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	updates := NewLogService(server.URL, "", "").StreamLogs(context.Background(), "", nil)
+
+	select {
+	case _, ok := <-updates:
+		if ok {
+			t.Fatal("expected stream to close without updates")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for stream to close")
+	}
+}
@@ -8,9 +8,10 @@ import (
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
+	u "github.com/tom-draper/nginx-analytics/agent/pkg/user"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/nginx"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/period"
-	u "github.com/tom-draper/nginx-analytics/tui/internal/logs/user"
 	"github.com/tom-draper/nginx-analytics/tui/internal/ui/styles"
 )
 
@@ -613,6 +614,25 @@ func (r *ActivityCard) UpdateCalculated(logs []nginx.NGINXLog, p period.Period)
 	r.successRate = getSuccessRates(logs, interval)
 }
 
+// UpdateStats plots the requests, users and success rate of each stats
+// bucket, spaced by the bucket interval the agent used
+func (r *ActivityCard) UpdateStats(s stats.Stats, p period.Period) {
+	r.period = p
+	r.bucketInterval = time.Duration(s.Interval) * time.Second
+	if r.bucketInterval <= 0 {
+		r.bucketInterval = defaultBucketInterval
+	}
+
+	r.requests = bucketPoints(s.Buckets, func(b stats.Bucket) (int, bool) { return b.Requests, true })
+	r.users = bucketPoints(s.Buckets, func(b stats.Bucket) (int, bool) { return b.Users, true })
+	r.successRate = bucketPoints(s.Buckets, func(b stats.Bucket) (float64, bool) {
+		if b.Total == 0 {
+			return 0, false
+		}
+		return float64(b.Success) / float64(b.Total), true
+	})
+}
+
 type point[T ~int | ~float32 | ~float64] struct {
 	timestamp time.Time
 	value     T
@@ -4,6 +4,7 @@ import (
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
 	"github.com/tom-draper/nginx-analytics/agent/pkg/system"
 	l "github.com/tom-draper/nginx-analytics/tui/internal/logs"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/nginx"
@@ -158,6 +159,12 @@ type CalculatedCard interface {
 	UpdateCalculated(logs []nginx.NGINXLog, period p.Period)
 }
 
+// StatsCard is implemented by cards that can render from statistics
+// precomputed by the agent instead of raw logs
+type StatsCard interface {
+	UpdateStats(s stats.Stats, period p.Period)
+}
+
 type CalculatedSystemCard interface {
 	UpdateCalculated(sysInfo system.SystemInfo)
 }
@@ -206,9 +213,15 @@ type LocationFilter struct {
 	Location string
 }
 
+// NetworkFilter represents a filter for network data
+type NetworkFilter struct {
+	ASN uint
+}
+
 // DeviceFilter represents a filter for device/client data
 type DeviceFilter struct {
 	Device string
+	Mode   DeviceMode
 }
 
 // VersionFilter represents a filter for version data
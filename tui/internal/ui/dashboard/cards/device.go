@@ -6,9 +6,10 @@ import (
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/useragent"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/nginx"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/period"
-	"github.com/tom-draper/nginx-analytics/tui/internal/logs/useragent"
 	"github.com/tom-draper/nginx-analytics/tui/internal/ui/styles"
 )
 
@@ -33,6 +34,7 @@ type DeviceCard struct {
 	selectedIndex int
 	mode          DeviceMode
 	logs          []nginx.NGINXLog
+	stats         *stats.Stats // Set instead of logs when driven by precomputed statistics
 }
 
 const maxClients = 35 // Maximum number of clients to display
@@ -166,10 +168,31 @@ func (p *DeviceCard) RenderContent(width, height int) string {
 
 func (c *DeviceCard) UpdateCalculated(logs []nginx.NGINXLog, period period.Period) {
 	c.logs = logs
+	c.stats = nil
 	c.clients = c.getClients(logs)
 	c.sorted = c.sortClients()
 }
 
+// UpdateStats keeps s to count the browsers, operating systems or devices
+// it holds, whichever mode is selected now or later
+func (c *DeviceCard) UpdateStats(s stats.Stats, period period.Period) {
+	c.logs = nil
+	c.stats = &s
+	c.clients = c.getStatsClients()
+	c.sorted = c.sortClients()
+}
+
+func (c *DeviceCard) getStatsClients() map[string]int {
+	switch c.mode {
+	case ModeOS:
+		return countsToMap(c.stats.OS)
+	case ModeDevice:
+		return countsToMap(c.stats.Devices)
+	default:
+		return countsToMap(c.stats.Clients)
+	}
+}
+
 func (c *DeviceCard) sortClients() []client {
 	sorted := make([]client, 0, len(c.clients))
 	for name, count := range c.clients {
@@ -266,13 +289,17 @@ func (c *DeviceCard) GetSelectedDevice() *DeviceFilter {
 	if !ok {
 		return nil
 	}
-	return &DeviceFilter{Device: cl.name}
+	return &DeviceFilter{Device: cl.name, Mode: c.mode}
 }
 
 // CycleMode advances to the next display mode and recalculates data
 func (c *DeviceCard) CycleMode() {
 	c.mode = (c.mode + 1) % 3
-	c.clients = c.getClients(c.logs)
+	if c.stats != nil {
+		c.clients = c.getStatsClients()
+	} else {
+		c.clients = c.getClients(c.logs)
+	}
 	c.sorted = c.sortClients()
 }
 
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/nginx"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/period"
 	"github.com/tom-draper/nginx-analytics/tui/internal/ui/styles"
@@ -215,6 +216,16 @@ func (r *EndpointsCard) UpdateCalculated(logs []nginx.NGINXLog, period period.Pe
 	r.sorted = r.sortEndpoints()
 }
 
+// UpdateStats lists the request counts of each path, method and status
+// counted by the agent
+func (r *EndpointsCard) UpdateStats(s stats.Stats, period period.Period) {
+	r.endpoints = make([]endpoint, 0, len(s.Endpoints))
+	for _, ep := range s.Endpoints {
+		r.endpoints = append(r.endpoints, endpoint{path: ep.Path, method: ep.Method, status: ep.Status, count: ep.Count})
+	}
+	r.sorted = r.sortEndpoints()
+}
+
 func (r *EndpointsCard) sortEndpoints() []endpoint {
 	sorted := make([]endpoint, len(r.endpoints))
 	copy(sorted, r.endpoints)
@@ -6,6 +6,7 @@ import (
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/x/ansi"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
 	loc "github.com/tom-draper/nginx-analytics/tui/internal/logs/location"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/nginx"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/period"
@@ -14,7 +15,7 @@ import (
 )
 
 type LocationsCard struct {
-	locations     loc.Locations
+	locations     *loc.Locations
 	serverURL     string
 	authToken     string
 	selectMode    bool
@@ -22,7 +23,7 @@ type LocationsCard struct {
 }
 
 func NewLocationsCard(logs []nginx.NGINXLog, period period.Period, serverURL string, authToken string) *LocationsCard {
-	card := &LocationsCard{serverURL: serverURL, authToken: authToken}
+	card := &LocationsCard{locations: &loc.Locations{}, serverURL: serverURL, authToken: authToken}
 	card.UpdateCalculated(logs, period)
 	return card
 }
@@ -31,6 +32,12 @@ func (r *LocationsCard) UpdateCalculated(logs []nginx.NGINXLog, period period.Pe
 	r.locations.UpdateLocations(logs, r.serverURL, r.authToken)
 }
 
+// UpdateStats sets the request counts of each country, which the agent has
+// already resolved, so no IP addresses are looked up
+func (r *LocationsCard) UpdateStats(s stats.Stats, period period.Period) {
+	r.locations.SetCounts(countsToMap(s.Locations))
+}
+
 func (r *LocationsCard) RenderContent(width, height int) string {
 	if len(r.locations.Locations) == 0 || height < 2 {
 		return r.renderEmptyState(width)
@@ -275,6 +282,12 @@ func (r *LocationsCard) GetSelectedLocation() *LocationFilter {
 	return &LocationFilter{Location: l.Location}
 }
 
+// Locations returns the resolved locations of the card, to share with the
+// networks card
+func (r *LocationsCard) Locations() *loc.Locations {
+	return r.locations
+}
+
 // GetLocationLookup returns the location lookup function for filtering
 func (r *LocationsCard) GetLocationLookup() func(string) string {
 	return r.locations.GetLocationForIP
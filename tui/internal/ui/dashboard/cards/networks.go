@@ -0,0 +1,250 @@
+package cards
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
+	loc "github.com/tom-draper/nginx-analytics/tui/internal/logs/location"
+	"github.com/tom-draper/nginx-analytics/tui/internal/logs/nginx"
+	"github.com/tom-draper/nginx-analytics/tui/internal/logs/period"
+	"github.com/tom-draper/nginx-analytics/tui/internal/ui/styles"
+)
+
+// NetworksCard lists the autonomous systems requests come from, such as
+// cloud providers and ISPs, by requests with their users.
+type NetworksCard struct {
+	// locations is shared with the locations card, so that each IP address
+	// is only resolved once
+	locations     *loc.Locations
+	serverURL     string
+	authToken     string
+	selectMode    bool
+	selectedIndex int
+}
+
+const maxNetworks = 16 // Maximum number of networks to display
+
+func NewNetworksCard(logs []nginx.NGINXLog, period period.Period, locations *loc.Locations, serverURL string, authToken string) *NetworksCard {
+	card := &NetworksCard{locations: locations, serverURL: serverURL, authToken: authToken}
+	card.UpdateCalculated(logs, period)
+	return card
+}
+
+func (r *NetworksCard) UpdateCalculated(logs []nginx.NGINXLog, period period.Period) {
+	r.locations.UpdateLocations(logs, r.serverURL, r.authToken)
+}
+
+// UpdateStats sets the requests and users of each network, which the agent
+// has already resolved, so no IP addresses are looked up
+func (r *NetworksCard) UpdateStats(s stats.Stats, period period.Period) {
+	r.locations.SetNetworks(s.Networks)
+}
+
+func (r *NetworksCard) networks() []stats.Network {
+	networks := r.locations.Networks
+	if len(networks) > maxNetworks {
+		networks = networks[:maxNetworks]
+	}
+	return networks
+}
+
+func (r *NetworksCard) RenderContent(width, height int) string {
+	networks := r.networks()
+	if len(networks) == 0 {
+		faintStyle := lipgloss.NewStyle().
+			Foreground(styles.LightGray).
+			Bold(true)
+
+		// Show empty message if no networks
+		lines := []string{"", faintStyle.Render("No networks found")}
+
+		for i, line := range lines {
+			if len(line) > 0 {
+				displayWidth := lipgloss.Width(line)
+				padding := (width - displayWidth) / 2
+				if padding > 0 {
+					lines[i] = strings.Repeat(" ", padding) + line
+				}
+			}
+		}
+
+		// Fill to height
+		for len(lines) < height {
+			lines = append(lines, "")
+		}
+
+		return strings.Join(lines[:height], "\n")
+	}
+
+	maxCount := networks[0].Requests
+
+	barStyle := lipgloss.NewStyle().
+		Background(styles.Green).
+		Foreground(styles.Black)
+
+	normalTextStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("15")) // White/default text
+
+	faintStyle := lipgloss.NewStyle().
+		Foreground(styles.LightGray)
+
+	// Style for selected row in select mode
+	selectedBarStyle := lipgloss.NewStyle().
+		Background(lipgloss.Color("15")). // White
+		Foreground(styles.Black).
+		Bold(true)
+
+	var buf strings.Builder
+
+	maxDisplayNetworks := min(len(networks), height)
+
+	// Render each network as a horizontal bar with overlaid text, and its
+	// users on the right when they fit
+	for i := range maxDisplayNetworks {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+
+		n := networks[i]
+		isSelected := r.selectMode && i == r.selectedIndex
+
+		barLength := 0
+		if maxCount > 0 {
+			barLength = (n.Requests * width) / maxCount
+			if barLength == 0 && n.Requests > 0 {
+				barLength = 1 // Ensure non-zero counts show at least one bar
+			}
+		}
+
+		overlayText := fmt.Sprintf("%d %s", n.Requests, networkLabel(n))
+		if isSelected {
+			overlayText = "> " + overlayText
+		}
+		text := []rune(overlayText)
+		if len(text) > width {
+			if width > 3 {
+				text = append(text[:width-3], []rune("...")...)
+			} else {
+				text = text[:width]
+			}
+		}
+
+		var users []rune
+		if n.Users > 0 {
+			users = []rune(fmt.Sprintf("%d users", n.Users))
+			if len(text)+1+len(users) > width {
+				users = nil
+			}
+		}
+
+		for j := range width {
+			char := " "
+			isUsers := false
+			if j < len(text) {
+				char = string(text[j])
+			} else if k := j - (width - len(users)); k >= 0 {
+				char = string(users[k])
+				isUsers = true
+			}
+
+			switch {
+			case isSelected:
+				buf.WriteString(selectedBarStyle.Render(char))
+			case j < barLength:
+				buf.WriteString(barStyle.Render(char))
+			case isUsers:
+				buf.WriteString(faintStyle.Render(char))
+			case char == " ":
+				buf.WriteByte(' ')
+			default:
+				buf.WriteString(normalTextStyle.Render(char))
+			}
+		}
+	}
+
+	// Fill remaining height with empty lines
+	for i := maxDisplayNetworks; i < height; i++ {
+		buf.WriteByte('\n')
+	}
+
+	return buf.String()
+}
+
+// networkLabel names a network by its number and organization.
+func networkLabel(n stats.Network) string {
+	if n.Organization == "" {
+		return fmt.Sprintf("AS%d", n.ASN)
+	}
+	return fmt.Sprintf("AS%d %s", n.ASN, n.Organization)
+}
+
+func (r *NetworksCard) GetRequiredHeight(width int) int {
+	networks := r.networks()
+	if len(networks) == 0 {
+		return 3 // Minimum height for "No networks found" message
+	}
+
+	// Each network needs one line
+	return len(networks)
+}
+
+// SelectableCard interface implementation
+
+func (r *NetworksCard) EnterSelectMode() {
+	r.selectMode = true
+	r.selectedIndex = 0
+}
+
+func (r *NetworksCard) ExitSelectMode() {
+	r.selectMode = false
+}
+
+func (r *NetworksCard) IsInSelectMode() bool {
+	return r.selectMode
+}
+
+func (r *NetworksCard) SelectUp() {
+	if r.selectedIndex > 0 {
+		r.selectedIndex--
+	}
+}
+
+func (r *NetworksCard) SelectDown() {
+	if r.selectedIndex < len(r.networks())-1 {
+		r.selectedIndex++
+	}
+}
+
+func (r *NetworksCard) SelectLeft() {
+	// No-op for networks card - uses up/down navigation
+}
+
+func (r *NetworksCard) SelectRight() {
+	// No-op for networks card - uses up/down navigation
+}
+
+func (r *NetworksCard) HasSelection() bool {
+	_, ok := selectedItem(r.selectMode, r.selectedIndex, r.networks())
+	return ok
+}
+
+func (r *NetworksCard) ClearSelection() {
+	r.selectedIndex = 0
+	r.selectMode = false
+}
+
+// GetSelectedNetwork returns the currently selected network filter, or nil if none selected
+func (r *NetworksCard) GetSelectedNetwork() *NetworkFilter {
+	n, ok := selectedItem(r.selectMode, r.selectedIndex, r.networks())
+	if !ok {
+		return nil
+	}
+	return &NetworkFilter{ASN: n.ASN}
+}
+
+// GetNetworkLookup returns the network lookup function for filtering
+func (r *NetworksCard) GetNetworkLookup() func(string) uint {
+	return r.locations.GetNetworkForIP
+}
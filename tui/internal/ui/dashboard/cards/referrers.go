@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/nginx"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/period"
 	"github.com/tom-draper/nginx-analytics/tui/internal/ui/styles"
@@ -168,6 +169,15 @@ func (r *ReferrersCard) UpdateCalculated(logs []nginx.NGINXLog, period period.Pe
 	r.sorted = r.sortReferrers()
 }
 
+// UpdateStats lists the request counts of each referrer counted by the agent
+func (r *ReferrersCard) UpdateStats(s stats.Stats, period period.Period) {
+	r.referrers = make([]referrer, 0, len(s.Referrers))
+	for _, ref := range s.Referrers {
+		r.referrers = append(r.referrers, referrer{path: ref.Referrer, method: ref.Method, status: ref.Status, count: ref.Count})
+	}
+	r.sorted = r.sortReferrers()
+}
+
 func (r *ReferrersCard) sortReferrers() []referrer {
 	sorted := make([]referrer, len(r.referrers))
 	copy(sorted, r.referrers)
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/nginx"
 	p "github.com/tom-draper/nginx-analytics/tui/internal/logs/period"
 	"github.com/tom-draper/nginx-analytics/tui/internal/ui/dashboard/plot"
@@ -33,6 +34,14 @@ func (r *RequestsCard) UpdateCalculated(logs []nginx.NGINXLog, period p.Period)
 	r.histogram = plot.NewMicroHistogram(timestamps, 50) // Use default width, will be scaled in render
 }
 
+// UpdateStats sets the total requests and their hourly rate over the period,
+// and resamples the requests of each stats bucket into the histogram
+func (r *RequestsCard) UpdateStats(s stats.Stats, period p.Period) {
+	r.count = s.Requests
+	r.rate = float64(r.count) / float64(statsRangeHours(s, period))
+	r.histogram = plot.NewMicroHistogramFromBins(resampleBuckets(s.Buckets, 50, func(b stats.Bucket) int { return b.Requests }))
+}
+
 func getTimestamps(logs []nginx.NGINXLog) []time.Time {
 	timestamps := make([]time.Time, 0, len(logs))
 	for _, log := range logs {
@@ -0,0 +1,68 @@
+package cards
+
+import (
+	"time"
+
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
+	p "github.com/tom-draper/nginx-analytics/tui/internal/logs/period"
+)
+
+// statsRangeHours mirrors LogRangePeriodHours for precomputed statistics.
+func statsRangeHours(s stats.Stats, period p.Period) int {
+	if period != p.PeriodAllTime && s.Requests > 0 {
+		return p.PeriodHours(period)
+	}
+
+	hours := int(s.End.Sub(s.Start).Hours())
+	if hours < 1 {
+		return 1 // At least 1 hour
+	}
+	return hours
+}
+
+// resampleBuckets spreads bucket values across bucketCount evenly sized bins
+// covering the bucket time range, matching the layout of NewMicroHistogram.
+func resampleBuckets(buckets []stats.Bucket, bucketCount int, value func(stats.Bucket) int) []int {
+	bins := make([]int, bucketCount)
+	if len(buckets) == 0 || bucketCount <= 0 {
+		return bins
+	}
+
+	minTime := buckets[0].Timestamp
+	maxTime := buckets[len(buckets)-1].Timestamp
+	if minTime.Equal(maxTime) {
+		bins[0] = value(buckets[0])
+		return bins
+	}
+
+	bucketDuration := maxTime.Sub(minTime) / time.Duration(bucketCount)
+	if bucketDuration == 0 {
+		bucketDuration = 1 * time.Nanosecond
+	}
+
+	for _, b := range buckets {
+		i := min(int(b.Timestamp.Sub(minTime)/bucketDuration), bucketCount-1)
+		bins[i] += value(b)
+	}
+	return bins
+}
+
+// bucketPoints converts buckets into chart points using value.
+func bucketPoints[T ~int | ~float64](buckets []stats.Bucket, value func(stats.Bucket) (T, bool)) []point[T] {
+	points := make([]point[T], 0, len(buckets))
+	for _, b := range buckets {
+		if v, ok := value(b); ok {
+			points = append(points, point[T]{timestamp: b.Timestamp, value: v})
+		}
+	}
+	return points
+}
+
+// countsToMap converts a top-N list into a name to count map.
+func countsToMap(counts []stats.Count) map[string]int {
+	m := make(map[string]int, len(counts))
+	for _, c := range counts {
+		m[c.Name] = c.Count
+	}
+	return m
+}
@@ -72,7 +72,7 @@ func (p *StorageCard) UpdateCalculated(sysInfo sys.SystemInfo) {
 		p.used = disk.Used
 		p.total = disk.Size
 	} else {
-		logger.Log.Printf("Error getting primary disk: %v", err)
+		logger.Warnf("Error getting primary disk: %v", err)
 	}
 }
 
@@ -7,6 +7,7 @@ import (
 	"time" // Added for time-related operations
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/nginx"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/period"
 	"github.com/tom-draper/nginx-analytics/tui/internal/ui/dashboard/plot" // Import plot package
@@ -130,6 +131,22 @@ func (r *SuccessRateCard) UpdateCalculated(logs []nginx.NGINXLog, period period.
 	}
 }
 
+// UpdateStats sets the success rate the agent computed, and the success rate
+// of each histogram bar from the successful and total requests of its buckets
+func (r *SuccessRateCard) UpdateStats(s stats.Stats, period period.Period) {
+	const histogramBuckets = 50
+	success := resampleBuckets(s.Buckets, histogramBuckets, func(b stats.Bucket) int { return b.Success })
+	total := resampleBuckets(s.Buckets, histogramBuckets, func(b stats.Bucket) int { return b.Total })
+
+	r.successRatePerBucket = make([]float64, histogramBuckets)
+	for i := range total {
+		if total[i] > 0 {
+			r.successRatePerBucket[i] = float64(success[i]) / float64(total[i])
+		}
+	}
+	r.successRate = s.SuccessRate
+}
+
 func successCount(logs []nginx.NGINXLog) int {
 	count := 0
 	for _, log := range logs {
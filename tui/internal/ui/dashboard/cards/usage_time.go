@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/nginx"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/period"
 	"github.com/tom-draper/nginx-analytics/tui/internal/ui/styles"
@@ -27,6 +28,24 @@ func (c *UsageTimeCard) UpdateCalculated(logs []nginx.NGINXLog, period period.Pe
 	c.usageTimes = c.calculateUsageTimePointsBucketed(logs, c.bucketMinutes)
 }
 
+// UpdateStats plots the requests made in each hour of the day
+func (c *UsageTimeCard) UpdateStats(s stats.Stats, period period.Period) {
+	if s.Requests == 0 {
+		c.usageTimes = nil
+		return
+	}
+
+	now := time.Now()
+	baseDate := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	c.usageTimes = make([]point[int], 0, len(s.UsageTime))
+	for hour, count := range s.UsageTime {
+		c.usageTimes = append(c.usageTimes, point[int]{
+			timestamp: baseDate.Add(time.Duration(hour) * time.Hour),
+			value:     count,
+		})
+	}
+}
+
 func (c UsageTimeCard) calculateUsageTimePointsBucketed(logs []nginx.NGINXLog, bucketMinutes int) []point[int] {
 	if len(logs) == 0 {
 		return nil
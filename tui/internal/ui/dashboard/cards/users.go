@@ -5,9 +5,10 @@ import (
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/user"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/nginx"
 	p "github.com/tom-draper/nginx-analytics/tui/internal/logs/period"
-	"github.com/tom-draper/nginx-analytics/tui/internal/logs/user"
 	"github.com/tom-draper/nginx-analytics/tui/internal/ui/dashboard/plot"
 	"github.com/tom-draper/nginx-analytics/tui/internal/ui/styles"
 )
@@ -32,6 +33,14 @@ func (r *UsersCard) UpdateCalculated(logs []nginx.NGINXLog, period p.Period) {
 	r.histogram = plot.NewUserMicroHistogram(timestamps, 50) // Use default width, will be scaled in render
 }
 
+// UpdateStats sets the total users and their hourly rate over the period,
+// and resamples the users of each stats bucket into the histogram
+func (r *UsersCard) UpdateStats(s stats.Stats, period p.Period) {
+	r.count = s.Users
+	r.rate = float64(r.count) / float64(statsRangeHours(s, period))
+	r.histogram = plot.NewMicroHistogramFromBins(resampleBuckets(s.Buckets, 50, func(b stats.Bucket) int { return b.Users }))
+}
+
 func getUserEvents(logs []nginx.NGINXLog) []plot.UserEvent {
 	events := make([]plot.UserEvent, 0, len(logs))
 	for _, log := range logs {
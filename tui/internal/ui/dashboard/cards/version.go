@@ -6,9 +6,10 @@ import (
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/stats"
+	"github.com/tom-draper/nginx-analytics/agent/pkg/version"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/nginx"
 	"github.com/tom-draper/nginx-analytics/tui/internal/logs/period"
-	"github.com/tom-draper/nginx-analytics/tui/internal/logs/version"
 	"github.com/tom-draper/nginx-analytics/tui/internal/ui/styles"
 )
 
@@ -159,6 +160,12 @@ func (c *VersionCard) UpdateCalculated(logs []nginx.NGINXLog, period period.Peri
 	c.sorted = c.sortVersions()
 }
 
+// UpdateStats sets the request counts of each API version
+func (c *VersionCard) UpdateStats(s stats.Stats, period period.Period) {
+	c.versions = countsToMap(s.Versions)
+	c.sorted = c.sortVersions()
+}
+
 func (c *VersionCard) sortVersions() []versionEntry {
 	sorted := make([]versionEntry, 0, len(c.versions))
 	for name, count := range c.versions {
@@ -434,8 +434,8 @@ func (d *DashboardGrid) MoveLeft() {
 		}
 
 	case "sidebar-footer":
-		if d.GetActiveCardIndexInArea() > 0 {
-			footerIndex := d.GetSidebarFooterCardIndex(0)
+		if currentIndex := d.GetActiveCardIndexInArea(); currentIndex > 0 {
+			footerIndex := d.GetSidebarFooterCardIndex(currentIndex - 1)
 			if footerIndex != -1 {
 				d.SetActiveCard(footerIndex)
 			}
@@ -482,11 +482,9 @@ func (d *DashboardGrid) MoveRight() {
 		}
 
 	case "sidebar-footer":
-		if d.GetActiveCardIndexInArea() == 0 && len(d.cardsByPosition[PositionFooter]) > 1 {
-			footerIndex := d.GetSidebarFooterCardIndex(1)
-			if footerIndex != -1 {
-				d.SetActiveCard(footerIndex)
-			}
+		footerIndex := d.GetSidebarFooterCardIndex(d.GetActiveCardIndexInArea() + 1)
+		if footerIndex != -1 {
+			d.SetActiveCard(footerIndex)
 		}
 	}
 }